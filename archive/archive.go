@@ -0,0 +1,336 @@
+// Package archive reads and writes tar archives compressed with zstd, in
+// which every member is compressed as its own frame with a dictionary
+// shared by the whole archive and embedded at its start. Archives of many
+// small, similar files compress far better this way than as one stream,
+// and the dictionary can be trained from the members themselves.
+//
+// An archive is the dictionary in a skippable frame, followed by one zstd
+// frame per member holding its tar header, content and padding, the last
+// also holding the tar trailer:
+//
+//	dictionary | member 0 | member 1 | ... | member n + trailer
+//
+//	dictionary: magic (4) | payload size (4) | tag "zdic" (4) | dictionary
+//
+// Archives without a dictionary omit the first frame. Since decoders skip
+// skippable frames, any zstd tool given the dictionary decompresses an
+// archive to a plain tar stream.
+//
+//	w, err := archive.NewWriter(f, &archive.Options{Train: true})
+//	for _, file := range files {
+//	    w.WriteHeader(&tar.Header{Name: file.Name, Mode: 0o644, Size: int64(len(file.Data))})
+//	    w.Write(file.Data)
+//	}
+//	err = w.Close()
+//
+//	r, err := archive.NewReader(f)
+//	defer r.Close()
+//	for {
+//	    hdr, err := r.Next()
+//	    ...
+//	}
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+const (
+	dictMagic = 0x184D2A5E
+	dictTag   = "zdic"
+	// maxDictSize bounds the dictionary frame a Reader accepts.
+	maxDictSize = 16 << 20
+	// minTrainMembers is the fewest members a dictionary is trained from.
+	minTrainMembers = 16
+)
+
+var (
+	// ErrDictAndTrain is returned by NewWriter when Options sets both a
+	// dictionary and training.
+	ErrDictAndTrain = errors.New("archive: Dict and Train are mutually exclusive")
+	// ErrInvalidDict is returned by NewReader when the dictionary frame
+	// is corrupt.
+	ErrInvalidDict = errors.New("archive: invalid dictionary frame")
+)
+
+// Options configures a Writer.
+type Options struct {
+	// Dict is the dictionary shared by the members. If nil and Train is
+	// not set, members are compressed without one.
+	Dict []byte
+	// Train trains the dictionary from the members being added. The
+	// dictionary must precede the members, so the whole archive is held
+	// in memory until Close. If there are fewer than 16 members or
+	// training fails, the archive is written without a dictionary.
+	Train bool
+	// TrainOptions configures training; nil uses the defaults.
+	TrainOptions *zstddict.TrainDictOptions
+	// Level is the encoder level. If 0, zstd.SpeedDefault is used.
+	Level zstd.EncoderLevel
+}
+
+// Writer writes a compressed tar archive. Its methods are those of
+// tar.Writer.
+type Writer struct {
+	w    io.Writer
+	opts Options
+	tw   *tar.Writer
+	sink sink
+
+	c     *zstddict.Compressor
+	frame *zstddict.Writer // member frame being written, if not training
+	dict  []byte
+	err   error
+}
+
+// sink receives the tar stream and directs it to the current member.
+type sink struct {
+	cur io.Writer
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	return s.cur.Write(p)
+}
+
+// NewWriter returns a Writer writing an archive to w. opts may be nil.
+// Without training, the dictionary frame is written immediately.
+func NewWriter(w io.Writer, opts *Options) (*Writer, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Dict != nil && opts.Train {
+		return nil, ErrDictAndTrain
+	}
+	aw := &Writer{w: w, opts: *opts}
+	aw.tw = tar.NewWriter(&aw.sink)
+	aw.sink.cur = io.Discard
+	if opts.Train {
+		return aw, nil
+	}
+	if err := aw.start(opts.Dict); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// start writes the dictionary frame, if any, and prepares the compressor.
+func (w *Writer) start(dict []byte) error {
+	level := w.opts.Level
+	if level == 0 {
+		level = zstd.SpeedDefault
+	}
+	c, err := zstddict.New(zstddict.WithDictBytes(dict), zstddict.WithLevel(level))
+	if err != nil {
+		return err
+	}
+	w.c, w.dict = c, dict
+	if dict == nil {
+		return nil
+	}
+	hdr := binary.LittleEndian.AppendUint32(nil, dictMagic)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(dictTag)+len(dict)))
+	hdr = append(hdr, dictTag...)
+	if _, err := w.w.Write(hdr); err != nil {
+		return err
+	}
+	_, err = w.w.Write(dict)
+	return err
+}
+
+// members holds the tar stream of each member while training.
+type members struct {
+	units [][]byte
+}
+
+func (m *members) Write(p []byte) (int, error) {
+	last := &m.units[len(m.units)-1]
+	*last = append(*last, p...)
+	return len(p), nil
+}
+
+// WriteHeader ends the current member and starts a new one described by
+// hdr.
+func (w *Writer) WriteHeader(hdr *tar.Header) error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.tw.Flush(); err != nil {
+		return err
+	}
+	if err := w.nextFrame(); err != nil {
+		w.err = err
+		return err
+	}
+	return w.tw.WriteHeader(hdr)
+}
+
+// nextFrame ends the current member frame and starts the next.
+func (w *Writer) nextFrame() error {
+	if w.opts.Train {
+		m, ok := w.sink.cur.(*members)
+		if !ok {
+			m = &members{}
+			w.sink.cur = m
+		}
+		m.units = append(m.units, nil)
+		return nil
+	}
+	if err := w.endFrame(); err != nil {
+		return err
+	}
+	frame, err := w.c.Writer(w.w)
+	if err != nil {
+		return err
+	}
+	w.frame, w.sink.cur = frame, frame
+	return nil
+}
+
+// endFrame ends the current member frame, if any.
+func (w *Writer) endFrame() error {
+	if w.frame == nil {
+		return nil
+	}
+	err := w.frame.Close()
+	w.frame = nil
+	return err
+}
+
+// Write writes to the current member.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.tw.Write(p)
+}
+
+// Close writes the tar trailer into the last member frame and, when
+// training, trains the dictionary and writes the whole archive. It does
+// not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.sink.cur == io.Discard {
+		// An empty archive is just the tar trailer.
+		if err := w.nextFrame(); err != nil {
+			return err
+		}
+	}
+	err := w.tw.Close()
+	if err == nil && w.opts.Train {
+		err = w.writeTrained()
+	}
+	if ferr := w.endFrame(); err == nil {
+		err = ferr
+	}
+	if w.c != nil {
+		w.c.Close()
+	}
+	w.err = errors.New("archive: writer closed")
+	return err
+}
+
+// writeTrained trains the dictionary from the buffered members and writes
+// the archive.
+func (w *Writer) writeTrained() error {
+	units := w.sink.cur.(*members).units
+	var dict []byte
+	if len(units) >= minTrainMembers {
+		var err error
+		if dict, err = zstddict.TrainDict(units, w.opts.TrainOptions); err != nil {
+			dict = nil
+		}
+	}
+	if err := w.start(dict); err != nil {
+		return err
+	}
+	for _, u := range units {
+		frame, err := w.c.Compress(u)
+		if err != nil {
+			return err
+		}
+		if _, err := w.w.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dict returns the archive's dictionary, or nil if it has none. When
+// training, it is only known after Close.
+func (w *Writer) Dict() []byte {
+	return w.dict
+}
+
+// Reader reads a compressed tar archive. Its methods are those of
+// tar.Reader.
+type Reader struct {
+	*tar.Reader
+	c    *zstddict.Compressor
+	zr   *zstddict.Reader
+	dict []byte
+}
+
+// NewReader returns a Reader for the archive in r, loading its embedded
+// dictionary. Plain tar.zst files without one are read too.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	dict, err := readDict(br)
+	if err != nil {
+		return nil, err
+	}
+	c, err := zstddict.New(zstddict.WithDictBytes(dict))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := c.Reader(br)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Reader{Reader: tar.NewReader(zr), c: c, zr: zr, dict: dict}, nil
+}
+
+// readDict reads the dictionary frame at the start of r, if there is one.
+func readDict(r *bufio.Reader) ([]byte, error) {
+	hdr, err := r.Peek(12)
+	if err != nil || binary.LittleEndian.Uint32(hdr) != dictMagic || string(hdr[8:]) != dictTag {
+		return nil, nil
+	}
+	size := int64(binary.LittleEndian.Uint32(hdr[4:])) - int64(len(dictTag))
+	if size <= 0 || size > maxDictSize {
+		return nil, ErrInvalidDict
+	}
+	if _, err := r.Discard(len(hdr)); err != nil {
+		return nil, err
+	}
+	dict := make([]byte, size)
+	if _, err := io.ReadFull(r, dict); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDict, err)
+	}
+	if _, err := zstd.InspectDictionary(dict); err != nil && zstddict.DetectDictFormat(dict) == zstddict.FormatStructured {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDict, err)
+	}
+	return dict, nil
+}
+
+// Dict returns the archive's dictionary, or nil if it has none.
+func (r *Reader) Dict() []byte {
+	return r.dict
+}
+
+// Close releases the decoder. It does not close the underlying reader.
+func (r *Reader) Close() error {
+	err := r.zr.Close()
+	r.c.Close()
+	return err
+}
@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+type testFile struct {
+	name string
+	data []byte
+}
+
+func testFiles(n int) []testFile {
+	var files []testFile
+	for i := range n {
+		files = append(files, testFile{
+			name: fmt.Sprintf("etc/app/conf.d/%03d.yaml", i),
+			data: fmt.Appendf(nil, "service:\n  name: app-%d\n  port: %d\n  replicas: %d\n  image: registry.example.com/app:%d\n", i, 8000+i, i%5, i%7),
+		})
+	}
+	return files
+}
+
+func writeArchive(t *testing.T, files []testFile, opts *Options) ([]byte, *Writer) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, opts)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for _, f := range files {
+		if err := w.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data))}); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if _, err := w.Write(f.data); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes(), w
+}
+
+func readArchive(t *testing.T, data []byte) ([]testFile, []byte) {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer r.Close()
+	var files []testFile
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return files, r.Dict()
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, testFile{hdr.Name, b})
+	}
+}
+
+func TestArchive(t *testing.T) {
+	files := testFiles(300)
+	plain, _ := writeArchive(t, files, nil)
+	trained, w := writeArchive(t, files, &Options{Train: true, TrainOptions: &zstddict.TrainDictOptions{MaxDictSize: 4096}})
+	if w.Dict() == nil {
+		t.Fatal("Train produced no dictionary")
+	}
+	given, _ := writeArchive(t, files, &Options{Dict: w.Dict()})
+	t.Logf("plain %d bytes, trained %d bytes", len(plain), len(trained))
+	if len(trained) >= len(plain) {
+		t.Errorf("trained archive is %d bytes, plain %d; want smaller", len(trained), len(plain))
+	}
+
+	for name, data := range map[string][]byte{"plain": plain, "trained": trained, "given": given} {
+		got, dict := readArchive(t, data)
+		if len(got) != len(files) {
+			t.Fatalf("%s: read %d members, want %d", name, len(got), len(files))
+		}
+		for i := range files {
+			if got[i].name != files[i].name || !bytes.Equal(got[i].data, files[i].data) {
+				t.Fatalf("%s: member %d = %q, want %q", name, i, got[i].name, files[i].name)
+			}
+		}
+		if (dict != nil) != (name != "plain") {
+			t.Errorf("%s: Dict() = %d bytes", name, len(dict))
+		}
+	}
+
+	// Any zstd decoder given the dictionary sees a plain tar stream.
+	dec, err := zstd.NewReader(bytes.NewReader(trained), zstd.WithDecoderDicts(w.Dict()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	tr := tar.NewReader(dec)
+	n := 0
+	for ; ; n++ {
+		if _, err := tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("tar.Reader.Next() error = %v", err)
+		}
+	}
+	if n != len(files) {
+		t.Errorf("plain zstd decoder read %d members, want %d", n, len(files))
+	}
+
+	empty, _ := writeArchive(t, nil, &Options{Train: true})
+	if got, _ := readArchive(t, empty); len(got) != 0 {
+		t.Errorf("empty archive has %d members", len(got))
+	}
+	if _, err := NewWriter(io.Discard, &Options{Dict: w.Dict(), Train: true}); !errors.Is(err, ErrDictAndTrain) {
+		t.Errorf("NewWriter(Dict, Train) error = %v, want ErrDictAndTrain", err)
+	}
+}
@@ -0,0 +1,305 @@
+// Package benchx runs compression benchmarks over a sample corpus.
+//
+// RunMatrix sweeps encoder levels against dictionary sizes, training one
+// dictionary per size on part of the corpus and measuring ratio and speed
+// on the rest:
+//
+//	m, err := benchx.RunMatrix(samples, benchx.MatrixOptions{})
+//	m.WriteText(os.Stdout)
+package benchx
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+// MatrixOptions configures RunMatrix.
+type MatrixOptions struct {
+	// Levels are the encoder levels compared. If empty, all levels are.
+	Levels []zstd.EncoderLevel
+	// DictSizes are the maximum dictionary sizes compared, in bytes; 0
+	// means no dictionary. If empty, 0, 1KB, 4KB, 16KB and 64KB are used.
+	DictSizes []int
+	// TrainFraction is the share of samples used for training, taken
+	// from the start of the corpus; the rest are measured. If 0, 0.5 is
+	// used.
+	TrainFraction float64
+	// Rounds is the number of times the measured samples are compressed
+	// and decompressed per cell, to steady the timings. If 0, 3 is used.
+	Rounds int
+}
+
+// Cell is the result for one level and dictionary size.
+type Cell struct {
+	Level zstd.EncoderLevel
+	// DictSize is the requested maximum dictionary size and ActualDictSize
+	// the size training produced; both are 0 without a dictionary.
+	DictSize       int
+	ActualDictSize int
+
+	InBytes  int64
+	OutBytes int64
+	// CompressTime and DecompressTime are totals over all rounds.
+	CompressTime   time.Duration
+	DecompressTime time.Duration
+	rounds         int
+}
+
+// Ratio returns the compression ratio, input over output size.
+func (c Cell) Ratio() float64 {
+	if c.OutBytes == 0 {
+		return 0
+	}
+	return float64(c.InBytes) / float64(c.OutBytes)
+}
+
+// CompressMBps returns the compression speed in megabytes of input per
+// second.
+func (c Cell) CompressMBps() float64 {
+	return mbps(c.InBytes*int64(c.rounds), c.CompressTime)
+}
+
+// DecompressMBps returns the decompression speed in megabytes of output
+// per second.
+func (c Cell) DecompressMBps() float64 {
+	return mbps(c.InBytes*int64(c.rounds), c.DecompressTime)
+}
+
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / 1e6 / d.Seconds()
+}
+
+// Matrix holds the results of RunMatrix. Cells[i][j] is the result for
+// Levels[i] and DictSizes[j].
+type Matrix struct {
+	Levels    []zstd.EncoderLevel
+	DictSizes []int
+	Cells     [][]Cell
+	// Samples is the number of measured samples.
+	Samples int
+}
+
+// RunMatrix measures every combination of opts.Levels and opts.DictSizes
+// over samples.
+func RunMatrix(samples [][]byte, opts MatrixOptions) (*Matrix, error) {
+	if len(opts.Levels) == 0 {
+		opts.Levels = []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBetterCompression, zstd.SpeedBestCompression}
+	}
+	if len(opts.DictSizes) == 0 {
+		opts.DictSizes = []int{0, 1 << 10, 4 << 10, 16 << 10, 64 << 10}
+	}
+	if opts.TrainFraction <= 0 || opts.TrainFraction >= 1 {
+		opts.TrainFraction = 0.5
+	}
+	if opts.Rounds <= 0 {
+		opts.Rounds = 3
+	}
+	split := int(float64(len(samples)) * opts.TrainFraction)
+	train, eval := samples[:split], samples[split:]
+	if len(eval) == 0 {
+		return nil, errors.New("benchx: no samples left to measure")
+	}
+
+	m := &Matrix{Levels: opts.Levels, DictSizes: opts.DictSizes, Samples: len(eval)}
+	dicts := make([][]byte, len(opts.DictSizes))
+	for j, size := range opts.DictSizes {
+		if size == 0 {
+			continue
+		}
+		dict, err := zstddict.TrainDict(train, &zstddict.TrainDictOptions{MaxDictSize: size})
+		if err != nil {
+			return nil, fmt.Errorf("benchx: training %d byte dictionary: %w", size, err)
+		}
+		dicts[j] = dict
+	}
+
+	m.Cells = make([][]Cell, len(opts.Levels))
+	for i, level := range opts.Levels {
+		m.Cells[i] = make([]Cell, len(opts.DictSizes))
+		for j, size := range opts.DictSizes {
+			cell, err := measure(eval, dicts[j], level, opts.Rounds)
+			if err != nil {
+				return nil, err
+			}
+			cell.DictSize = size
+			m.Cells[i][j] = cell
+		}
+	}
+	return m, nil
+}
+
+// measure compresses and decompresses samples with one configuration.
+func measure(samples [][]byte, dict []byte, level zstd.EncoderLevel, rounds int) (Cell, error) {
+	cell := Cell{Level: level, ActualDictSize: len(dict), rounds: rounds}
+	c, err := zstddict.New(zstddict.WithDictBytes(dict), zstddict.WithLevel(level), zstddict.WithSmallMessages())
+	if err != nil {
+		return cell, err
+	}
+
+	frames := make([][]byte, len(samples))
+	var buf []byte
+	for r := range rounds {
+		start := time.Now()
+		for k, s := range samples {
+			frames[k], err = c.CompressTo(frames[k][:0], s)
+			if err != nil {
+				return cell, err
+			}
+		}
+		cell.CompressTime += time.Since(start)
+
+		start = time.Now()
+		for _, f := range frames {
+			if buf, err = c.DecompressTo(buf[:0], f); err != nil {
+				return cell, err
+			}
+		}
+		cell.DecompressTime += time.Since(start)
+
+		if r == 0 {
+			for k, s := range samples {
+				cell.InBytes += int64(len(s))
+				cell.OutBytes += int64(len(frames[k]))
+			}
+		}
+	}
+	return cell, nil
+}
+
+// dictSizeLabel formats a dictionary size for table headings.
+func dictSizeLabel(size int) string {
+	switch {
+	case size == 0:
+		return "none"
+	case size%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", size>>10)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// metrics are the tables written by WriteText and WriteHTML.
+var metrics = []struct {
+	title  string
+	format string
+	value  func(Cell) float64
+}{
+	{"Compression ratio", "%.2f", Cell.Ratio},
+	{"Compression speed (MB/s)", "%.1f", Cell.CompressMBps},
+	{"Decompression speed (MB/s)", "%.1f", Cell.DecompressMBps},
+}
+
+// WriteText writes one table per metric, with a row per level and a
+// column per dictionary size.
+func (m *Matrix) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for k, metric := range metrics {
+		if k > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s\t", metric.title)
+		for _, size := range m.DictSizes {
+			fmt.Fprintf(tw, "%s\t", dictSizeLabel(size))
+		}
+		fmt.Fprintln(tw)
+		for i, level := range m.Levels {
+			fmt.Fprintf(tw, "%s\t", level)
+			for j := range m.DictSizes {
+				fmt.Fprintf(tw, metric.format+"\t", metric.value(m.Cells[i][j]))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	return tw.Flush()
+}
+
+// heatCell is a table cell shaded by its value relative to the table.
+type heatCell struct {
+	Text  string
+	Color template.CSS
+}
+
+type heatTable struct {
+	Title string
+	Rows  []heatRow
+}
+
+type heatRow struct {
+	Level string
+	Cells []heatCell
+}
+
+var heatmapTemplate = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Level × dictionary size</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { padding: 4px 10px; text-align: right; }
+</style></head><body>
+<h1>Level × dictionary size</h1>
+<p>{{.Samples}} measured samples. Darker cells are better.</p>
+{{range .Tables}}<h2>{{.Title}}</h2>
+<table><tr><th></th>{{range $.Sizes}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Level}}</th>{{range .Cells}}<td style="background: {{.Color}}">{{.Text}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}</body></html>
+`))
+
+// WriteHTML writes the tables as an HTML heatmap.
+func (m *Matrix) WriteHTML(w io.Writer) error {
+	var sizes []string
+	for _, size := range m.DictSizes {
+		sizes = append(sizes, dictSizeLabel(size))
+	}
+	var tables []heatTable
+	for _, metric := range metrics {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, row := range m.Cells {
+			for _, c := range row {
+				v := metric.value(c)
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+		t := heatTable{Title: metric.title}
+		for i, level := range m.Levels {
+			row := heatRow{Level: level.String()}
+			for _, c := range m.Cells[i] {
+				v := metric.value(c)
+				shade := 0.0
+				if hi > lo {
+					shade = (v - lo) / (hi - lo)
+				}
+				row.Cells = append(row.Cells, heatCell{
+					Text:  fmt.Sprintf(metric.format, v),
+					Color: template.CSS(fmt.Sprintf("rgba(30, 110, 200, %.2f)", 0.1+0.8*shade)),
+				})
+			}
+			t.Rows = append(t.Rows, row)
+		}
+		tables = append(tables, t)
+	}
+	return heatmapTemplate.Execute(w, map[string]any{
+		"Samples": m.Samples,
+		"Sizes":   sizes,
+		"Tables":  tables,
+	})
+}
+
+// String returns the text tables.
+func (m *Matrix) String() string {
+	var sb strings.Builder
+	m.WriteText(&sb)
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package benchx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func testSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = fmt.Appendf(nil,
+			`{"name":"file_%d.txt","path":"/home/user/documents/file_%d.txt","size":%d,"mode":"-rw-r--r--","owner":"user","group":"staff"}`,
+			i, i, i*137)
+	}
+	return samples
+}
+
+func TestRunMatrix(t *testing.T) {
+	levels := []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedBestCompression}
+	sizes := []int{0, 2048}
+	m, err := RunMatrix(testSamples(400), MatrixOptions{Levels: levels, DictSizes: sizes, Rounds: 1})
+	if err != nil {
+		t.Fatalf("RunMatrix: %v", err)
+	}
+	if m.Samples != 200 {
+		t.Errorf("Samples = %d, want 200", m.Samples)
+	}
+	if len(m.Cells) != len(levels) || len(m.Cells[0]) != len(sizes) {
+		t.Fatalf("Cells is %dx%d, want %dx%d", len(m.Cells), len(m.Cells[0]), len(levels), len(sizes))
+	}
+	for i := range levels {
+		none, dict := m.Cells[i][0], m.Cells[i][1]
+		if none.ActualDictSize != 0 || dict.ActualDictSize == 0 || dict.ActualDictSize > 2048 {
+			t.Errorf("%s: dictionary sizes %d and %d", levels[i], none.ActualDictSize, dict.ActualDictSize)
+		}
+		if dict.Ratio() <= none.Ratio() {
+			t.Errorf("%s: ratio with dictionary %.2f, without %.2f", levels[i], dict.Ratio(), none.Ratio())
+		}
+		if dict.CompressMBps() <= 0 || dict.DecompressMBps() <= 0 {
+			t.Errorf("%s: speeds %.1f and %.1f MB/s", levels[i], dict.CompressMBps(), dict.DecompressMBps())
+		}
+	}
+
+	text := m.String()
+	for _, want := range []string{"Compression ratio", "none", "2KB", "fastest", "best"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("WriteText output lacks %q:\n%s", want, text)
+		}
+	}
+	var html bytes.Buffer
+	if err := m.WriteHTML(&html); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	if !strings.Contains(html.String(), "<table>") || !strings.Contains(html.String(), "rgba(") {
+		t.Errorf("WriteHTML output lacks a shaded table")
+	}
+}
+
+func TestRunMatrix_NoSamples(t *testing.T) {
+	if _, err := RunMatrix(nil, MatrixOptions{}); err == nil {
+		t.Error("RunMatrix with no samples to measure succeeded")
+	}
+}
@@ -0,0 +1,241 @@
+// Package cachecodec compresses values stored in shared caches such as
+// memcached and groupcache, and in off-heap caches such as bigcache and
+// freecache; see OffHeap.
+//
+// Every stored value starts with a five-byte prefix: a format byte and the
+// big-endian ID of the dictionary it was compressed with. A Codec decodes
+// values written with any of the dictionaries it holds, so services sharing
+// a cache can rotate dictionaries one at a time: deploy the new dictionary
+// as a previous one everywhere, then promote it to current.
+//
+//	codec, err := cachecodec.New(newDict, oldDict)
+//	cache := cachecodec.Wrap(memcacheAdapter{mc}, codec)
+//
+// The adapter for github.com/bradfitz/gomemcache is a few lines:
+//
+//	type memcacheAdapter struct{ *memcache.Client }
+//
+//	func (m memcacheAdapter) Get(_ context.Context, key string) ([]byte, error) {
+//	    item, err := m.Client.Get(key)
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return item.Value, nil
+//	}
+//
+//	func (m memcacheAdapter) Set(_ context.Context, key string, value []byte) error {
+//	    return m.Client.Set(&memcache.Item{Key: key, Value: value})
+//	}
+//
+// For groupcache, compress in the getter and decode what the group returns:
+//
+//	load := codec.CompressGetter(loadFromDB)
+//	group := groupcache.NewGroup("files", 64<<20, groupcache.GetterFunc(
+//	    func(ctx context.Context, key string, dest groupcache.Sink) error {
+//	        v, err := load(ctx, key)
+//	        if err != nil {
+//	            return err
+//	        }
+//	        return dest.SetBytes(v)
+//	    }))
+//	var stored []byte
+//	err := group.Get(ctx, key, groupcache.AllocatingByteSliceSink(&stored))
+//	value, err := codec.Decode(stored)
+package cachecodec
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+// Format bytes starting a stored value.
+const (
+	formatZstd = 'z' // zstd frame follows
+	formatRaw  = 'r' // value stored as is, because compression didn't help
+)
+
+// prefixLen is the size of the format byte and dictionary ID.
+const prefixLen = 5
+
+// ErrNotEncoded is returned by Decode for values without a valid prefix,
+// such as values written by code that doesn't use this package.
+var ErrNotEncoded = errors.New("cachecodec: value not written by cachecodec")
+
+// ErrUnknownDict is matched by errors reporting a value compressed with a
+// dictionary the Codec doesn't hold. The concrete error is an
+// *UnknownDictError.
+var ErrUnknownDict = errors.New("cachecodec: unknown dictionary")
+
+// UnknownDictError reports the dictionary ID of a value that can't be
+// decoded.
+type UnknownDictError struct {
+	DictID uint32
+}
+
+func (e *UnknownDictError) Error() string {
+	return fmt.Sprintf("cachecodec: value uses unknown dictionary %d", e.DictID)
+}
+
+// Is reports whether target is ErrUnknownDict.
+func (e *UnknownDictError) Is(target error) bool {
+	return target == ErrUnknownDict
+}
+
+// Codec encodes cache values with the current dictionary and decodes values
+// written with the current or any previous dictionary. It is safe for
+// concurrent use.
+type Codec struct {
+	current *zstddict.Compressor
+	id      uint32
+	byID    map[uint32]*zstddict.Compressor
+}
+
+// New returns a Codec compressing with current and also decoding values
+// written with any of previous. A nil current compresses without a
+// dictionary.
+func New(current []byte, previous ...[]byte) (*Codec, error) {
+	c := &Codec{byID: make(map[uint32]*zstddict.Compressor)}
+	for i, dict := range append([][]byte{current}, previous...) {
+		if i > 0 && dict == nil {
+			continue
+		}
+		var id uint32
+		if dict != nil {
+			d, err := zstd.InspectDictionary(dict)
+			if err != nil {
+				return nil, fmt.Errorf("cachecodec: dictionary %d: %w", i, err)
+			}
+			id = d.ID()
+		}
+		if _, ok := c.byID[id]; ok {
+			continue
+		}
+		comp, err := zstddict.New(zstddict.WithDictBytes(dict), zstddict.WithSmallMessages())
+		if err != nil {
+			return nil, err
+		}
+		c.byID[id] = comp
+		if i == 0 {
+			c.current, c.id = comp, id
+		}
+	}
+	// Values compressed without a dictionary stay readable whatever the
+	// configuration.
+	if _, ok := c.byID[0]; !ok {
+		comp, err := zstddict.New(zstddict.WithSmallMessages())
+		if err != nil {
+			return nil, err
+		}
+		c.byID[0] = comp
+	}
+	return c, nil
+}
+
+// DictID returns the ID of the dictionary new values are compressed with,
+// or 0 for none.
+func (c *Codec) DictID() uint32 {
+	return c.id
+}
+
+// Encode compresses value and prefixes it with the dictionary ID. Values
+// that don't shrink are stored uncompressed.
+func (c *Codec) Encode(value []byte) ([]byte, error) {
+	out := make([]byte, prefixLen, prefixLen+len(value)/2)
+	out[0] = formatZstd
+	binary.BigEndian.PutUint32(out[1:], c.id)
+	out, err := c.current.CompressTo(out, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(out)-prefixLen < len(value) {
+		return out, nil
+	}
+
+	out = append(out[:0], formatRaw, 0, 0, 0, 0)
+	return append(out, value...), nil
+}
+
+// Decode reverses Encode. It fails with ErrNotEncoded for values without a
+// prefix and with an *UnknownDictError for values compressed with a
+// dictionary the Codec doesn't hold. Values stored uncompressed are
+// returned as a subslice of stored.
+func (c *Codec) Decode(stored []byte) ([]byte, error) {
+	if len(stored) < prefixLen {
+		return nil, ErrNotEncoded
+	}
+	id := binary.BigEndian.Uint32(stored[1:])
+	switch stored[0] {
+	case formatRaw:
+		return stored[prefixLen:], nil
+	case formatZstd:
+		comp, ok := c.byID[id]
+		if !ok {
+			return nil, &UnknownDictError{DictID: id}
+		}
+		return comp.Decompress(stored[prefixLen:])
+	default:
+		return nil, ErrNotEncoded
+	}
+}
+
+// DictIDOf returns the dictionary ID recorded in a stored value's prefix,
+// so callers can tell which dictionaries are still referenced before
+// retiring one.
+func DictIDOf(stored []byte) (uint32, error) {
+	if len(stored) < prefixLen || stored[0] != formatZstd && stored[0] != formatRaw {
+		return 0, ErrNotEncoded
+	}
+	return binary.BigEndian.Uint32(stored[1:]), nil
+}
+
+// Cache is a byte-oriented key-value cache, such as a thin adapter over a
+// memcached client.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// Wrap returns a Cache that encodes values with codec before storing them
+// in c and decodes them on fetch. Errors from c, including cache misses,
+// are returned unchanged.
+func Wrap(c Cache, codec *Codec) Cache {
+	return &compressedCache{c: c, codec: codec}
+}
+
+type compressedCache struct {
+	c     Cache
+	codec *Codec
+}
+
+func (cc *compressedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	stored, err := cc.c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return cc.codec.Decode(stored)
+}
+
+func (cc *compressedCache) Set(ctx context.Context, key string, value []byte) error {
+	stored, err := cc.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return cc.c.Set(ctx, key, stored)
+}
+
+// CompressGetter wraps a loader, such as a groupcache getter's data
+// source, so the values it produces are encoded for storage.
+func (c *Codec) CompressGetter(load func(ctx context.Context, key string) ([]byte, error)) func(ctx context.Context, key string) ([]byte, error) {
+	return func(ctx context.Context, key string) ([]byte, error) {
+		value, err := load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return c.Encode(value)
+	}
+}
@@ -0,0 +1,122 @@
+package cachecodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+)
+
+// mapCache is an in-memory Cache.
+type mapCache map[string][]byte
+
+var errMiss = errors.New("cache miss")
+
+func (m mapCache) Get(_ context.Context, key string) ([]byte, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, errMiss
+	}
+	return v, nil
+}
+
+func (m mapCache) Set(_ context.Context, key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func TestRotation(t *testing.T) {
+	oldDict, newDict := testdict.Train(t, 1001), testdict.Train(t, 2002)
+	value := []byte(strings.Repeat("/usr/local/bin/tool3 4096 -rw-r--r--\n", 4))
+
+	shared := mapCache{}
+	ctx := context.Background()
+
+	// An old service writes with the old dictionary.
+	oldCodec, err := New(oldDict)
+	if err != nil {
+		t.Fatalf("New(old) error = %v", err)
+	}
+	if err := Wrap(shared, oldCodec).Set(ctx, "a", value); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if id, err := DictIDOf(shared["a"]); err != nil || id != 1001 {
+		t.Errorf("DictIDOf() = %d, %v; want 1001", id, err)
+	}
+	if len(shared["a"]) >= len(value) {
+		t.Errorf("stored %d bytes for a %d-byte value, want compression", len(shared["a"]), len(value))
+	}
+
+	// A rotated service writes with the new one and still reads the old.
+	newCodec, err := New(newDict, oldDict)
+	if err != nil {
+		t.Fatalf("New(new, old) error = %v", err)
+	}
+	cache := Wrap(shared, newCodec)
+	if err := cache.Set(ctx, "b", value); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		got, err := cache.Get(ctx, key)
+		if err != nil || !bytes.Equal(got, value) {
+			t.Errorf("Get(%q) = %q, %v; want original value", key, got, err)
+		}
+	}
+
+	// The old service can't read the new dictionary's values.
+	_, err = Wrap(shared, oldCodec).Get(ctx, "b")
+	var ue *UnknownDictError
+	if !errors.As(err, &ue) || !errors.Is(err, ErrUnknownDict) || ue.DictID != 2002 {
+		t.Errorf("Get() with unknown dictionary error = %v, want UnknownDictError{2002}", err)
+	}
+
+	if _, err := cache.Get(ctx, "missing"); err != errMiss {
+		t.Errorf("Get(missing) error = %v, want the cache's miss error", err)
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	codec, err := New(nil)
+	if err != nil {
+		t.Fatalf("New(nil) error = %v", err)
+	}
+	for _, value := range [][]byte{{}, []byte("x"), []byte("short")} {
+		stored, err := codec.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode(%q) error = %v", value, err)
+		}
+		if stored[0] != formatRaw || len(stored) != prefixLen+len(value) {
+			t.Errorf("Encode(%q) = %q, want raw value with prefix", value, stored)
+		}
+		if got, err := codec.Decode(stored); err != nil || !bytes.Equal(got, value) {
+			t.Errorf("Decode(Encode(%q)) = %q, %v", value, got, err)
+		}
+	}
+
+	for _, stored := range [][]byte{nil, []byte("abc"), []byte("plain value")} {
+		if _, err := codec.Decode(stored); !errors.Is(err, ErrNotEncoded) {
+			t.Errorf("Decode(%q) error = %v, want ErrNotEncoded", stored, err)
+		}
+	}
+}
+
+func TestCompressGetter(t *testing.T) {
+	codec, err := New(testdict.Train(t, 1001))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	value := []byte(strings.Repeat("/usr/local/bin/tool1 4096 -rw-r--r--\n", 4))
+	load := codec.CompressGetter(func(context.Context, string) ([]byte, error) {
+		return value, nil
+	})
+	stored, err := load(context.Background(), "k")
+	if err != nil {
+		t.Fatalf("getter error = %v", err)
+	}
+	if got, err := codec.Decode(stored); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("Decode() = %q, %v; want original value", got, err)
+	}
+}
@@ -0,0 +1,89 @@
+package cachecodec
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// OffHeapCache is the interface of off-heap byte caches keyed by string.
+// A *bigcache.BigCache from github.com/allegro/bigcache satisfies it as
+// is; github.com/coocood/freecache needs a few lines:
+//
+//	type freecacheAdapter struct{ *freecache.Cache }
+//
+//	func (f freecacheAdapter) Get(key string) ([]byte, error) {
+//	    return f.Cache.Get([]byte(key))
+//	}
+//
+//	func (f freecacheAdapter) Set(key string, value []byte) error {
+//	    return f.Cache.Set([]byte(key), value, 0)
+//	}
+//
+// These caches keep entries in large byte arrays the garbage collector
+// doesn't scan, so entries are already copied in and out; compressing
+// them with a dictionary mostly costs CPU and buys cache capacity.
+type OffHeapCache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+}
+
+// OffHeapOptions configures NewOffHeap.
+type OffHeapOptions struct {
+	// MigrateLegacy accepts entries written before the cache was wrapped,
+	// which have no prefix. Get returns them as stored and writes them
+	// back encoded, so a populated cache converts itself as it is read.
+	//
+	// Legacy entries are recognized by failing to parse as encoded
+	// entries, so a legacy value that happens to start with a valid
+	// prefix, the bytes 'z' or 'r' followed by a known dictionary ID, is
+	// misread. Leave this off once Migrated stops growing.
+	MigrateLegacy bool
+}
+
+// OffHeap stores entries in an OffHeapCache encoded by a Codec, each with
+// the Codec's prefix recording its dictionary ID. It is safe for
+// concurrent use if the cache is.
+type OffHeap struct {
+	c        OffHeapCache
+	codec    *Codec
+	opts     OffHeapOptions
+	migrated atomic.Int64
+}
+
+// NewOffHeap returns an OffHeap storing entries in c encoded with codec.
+func NewOffHeap(c OffHeapCache, codec *Codec, opts OffHeapOptions) *OffHeap {
+	return &OffHeap{c: c, codec: codec, opts: opts}
+}
+
+// Get returns the decoded entry for key. Errors from the cache, including
+// misses, are returned unchanged.
+func (o *OffHeap) Get(key string) ([]byte, error) {
+	stored, err := o.c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := o.codec.Decode(stored)
+	if !o.opts.MigrateLegacy || !errors.Is(err, ErrNotEncoded) {
+		return value, err
+	}
+	// Rewriting is best effort: the value is good either way, and a
+	// failed write leaves the legacy entry for the next read.
+	if o.Set(key, stored) == nil {
+		o.migrated.Add(1)
+	}
+	return stored, nil
+}
+
+// Set encodes value and stores it under key.
+func (o *OffHeap) Set(key string, value []byte) error {
+	stored, err := o.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return o.c.Set(key, stored)
+}
+
+// Migrated returns the number of legacy entries rewritten by Get.
+func (o *OffHeap) Migrated() int64 {
+	return o.migrated.Load()
+}
@@ -0,0 +1,65 @@
+package cachecodec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+)
+
+// offHeapMap is an in-memory OffHeapCache.
+type offHeapMap map[string][]byte
+
+func (m offHeapMap) Get(key string) ([]byte, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, errMiss
+	}
+	return v, nil
+}
+
+func (m offHeapMap) Set(key string, value []byte) error {
+	m[key] = bytes.Clone(value)
+	return nil
+}
+
+func TestOffHeap(t *testing.T) {
+	codec, err := New(testdict.Train(t, 1001))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	value := []byte(strings.Repeat("/usr/local/bin/tool2 4096 -rw-r--r--\n", 4))
+	legacy := []byte(`{"path":"/usr/local/bin/tool5"}`)
+
+	m := offHeapMap{"legacy": legacy}
+	cache := NewOffHeap(m, codec, OffHeapOptions{})
+	if err := cache.Set("a", value); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if id, err := DictIDOf(m["a"]); err != nil || id != 1001 || len(m["a"]) >= len(value) {
+		t.Errorf("stored entry = %d bytes, dictionary %d, %v; want compressed with 1001", len(m["a"]), id, err)
+	}
+	if got, err := cache.Get("a"); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("Get() = %q, %v; want original value", got, err)
+	}
+	if _, err := cache.Get("legacy"); err != ErrNotEncoded {
+		t.Errorf("Get(legacy) without migration error = %v, want ErrNotEncoded", err)
+	}
+	if _, err := cache.Get("missing"); err != errMiss {
+		t.Errorf("Get(missing) error = %v, want the cache's miss error", err)
+	}
+
+	cache = NewOffHeap(m, codec, OffHeapOptions{MigrateLegacy: true})
+	for range 2 {
+		if got, err := cache.Get("legacy"); err != nil || !bytes.Equal(got, legacy) {
+			t.Errorf("Get(legacy) = %q, %v; want legacy value", got, err)
+		}
+	}
+	if _, err := DictIDOf(m["legacy"]); err != nil {
+		t.Errorf("legacy entry not rewritten: %v", err)
+	}
+	if n := cache.Migrated(); n != 1 {
+		t.Errorf("Migrated() = %d, want 1", n)
+	}
+}
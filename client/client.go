@@ -3,17 +3,21 @@ package client
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/paulstuart/zstd-dict/grpccodec"
 	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/zstddict"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Client wraps the FileListService gRPC client.
 type Client struct {
-	conn   *grpc.ClientConn
-	client pb.FileListServiceClient
+	conn     *grpc.ClientConn
+	client   pb.FileListServiceClient
+	fallback string
 }
 
 // Options configures the client connection.
@@ -24,6 +28,30 @@ type Options struct {
 	Compressor string
 	// Timeout is the connection timeout.
 	Timeout time.Duration
+	// FallbackCompressor, if set, is used to retry a call once when the
+	// server rejects the request because it lacks the client's dictionary,
+	// e.g. "zstd". Without it such calls fail with a *grpccodec.DecodeError.
+	FallbackCompressor string
+	// Dict, if set, obtains the server's dictionary before connecting and
+	// registers the zstd-dict compressor with it. Compressor defaults to
+	// zstd-dict when Dict is set.
+	Dict *DictSource
+	// Record, if set, is a directory in which the response to every
+	// successful unary call is saved, both raw and recompressed locally
+	// with the call's compressor, for later use with Replay. The
+	// recompressed copy is the client's own compression of the decoded
+	// response, not the bytes the server sent.
+	Record string
+	// Replay, if set, is a directory recorded with Record. Calls are
+	// served from it without connecting to Address or loading Dict, so
+	// benchmarks and compression experiments are reproducible offline.
+	// The recompressed copy is decompressed only if the compressor is
+	// already registered in the process. Calls with no recorded response
+	// fail with ErrNotRecorded.
+	Replay string
+	// DialOptions are appended after those derived from the fields
+	// above, for example to install a custom dialer or interceptors.
+	DialOptions []grpc.DialOption
 }
 
 // New creates a new client connection to the FileListService.
@@ -32,9 +60,40 @@ func New(opts Options) (*Client, error) {
 		opts.Timeout = 10 * time.Second
 	}
 
+	// Replay never touches the network, so it must not fetch a
+	// dictionary either.
+	if opts.Replay != "" {
+		if opts.Compressor == "" && opts.Dict != nil {
+			opts.Compressor = grpccodec.NameZstdDict
+		}
+		return &Client{
+			client:   pb.NewFileListServiceClient(&replayConn{dir: opts.Replay, compressor: opts.Compressor}),
+			fallback: opts.FallbackCompressor,
+		}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	if opts.Dict != nil {
+		dict, _, err := LoadDict(ctx, *opts.Dict)
+		if err != nil {
+			return nil, err
+		}
+		if err := grpccodec.RegisterWithConfig(grpccodec.Config{Dict: dict}); err != nil {
+			return nil, err
+		}
+		if opts.Compressor == "" {
+			opts.Compressor = grpccodec.NameZstdDict
+		}
+	}
+
 	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	}
+	if opts.Record != "" {
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(recordInterceptor(opts.Record, opts.Compressor)))
+	}
 
 	if opts.Compressor != "" {
 		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(
@@ -42,8 +101,7 @@ func New(opts Options) (*Client, error) {
 		))
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
-	defer cancel()
+	dialOpts = append(dialOpts, opts.DialOptions...)
 
 	conn, err := grpc.DialContext(ctx, opts.Address, dialOpts...)
 	if err != nil {
@@ -51,31 +109,68 @@ func New(opts Options) (*Client, error) {
 	}
 
 	return &Client{
-		conn:   conn,
-		client: pb.NewFileListServiceClient(conn),
+		conn:     conn,
+		client:   pb.NewFileListServiceClient(conn),
+		fallback: opts.FallbackCompressor,
 	}, nil
 }
 
 // Close closes the client connection.
 func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
 
 // ListFiles requests a directory listing from the server.
+//
+// If either side fails to decompress a message because of a dictionary
+// mismatch, the error is a *grpccodec.DecodeError matching
+// zstddict.ErrDictMismatch or grpccodec.ErrDictMissing, with the
+// dictionary IDs involved and, when the server provides one, the URL of its
+// dictionary.
 func (c *Client) ListFiles(ctx context.Context, path string, maxDepth int32) (*pb.ListFilesResponse, error) {
-	return c.client.ListFiles(ctx, &pb.ListFilesRequest{
+	return c.listFiles(ctx, &pb.ListFilesRequest{
 		Path:     path,
 		MaxDepth: maxDepth,
 	})
 }
 
+// listFiles issues the call, translating codec failures into typed errors
+// and falling back to the fallback compressor on dictionary mismatches.
+func (c *Client) listFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	resp, err := c.client.ListFiles(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	err = grpccodec.FromStatus(err)
+	if c.fallback != "" && isDictError(err) {
+		resp, err = c.client.ListFiles(ctx, req, grpc.UseCompressor(c.fallback))
+		if err != nil {
+			return nil, grpccodec.FromStatus(err)
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// isDictError reports whether err is a dictionary mismatch or a missing
+// dictionary.
+func isDictError(err error) bool {
+	return errors.Is(err, zstddict.ErrDictMismatch) || errors.Is(err, grpccodec.ErrDictMissing)
+}
+
 // ListFilesWithStats requests a directory listing and returns timing/size statistics.
+// It asks the server to measure its compression time, which costs the
+// server an extra compression pass.
 func (c *Client) ListFilesWithStats(ctx context.Context, path string, maxDepth int32) (*pb.ListFilesResponse, Stats, error) {
 	start := time.Now()
 
-	resp, err := c.client.ListFiles(ctx, &pb.ListFilesRequest{
-		Path:     path,
-		MaxDepth: maxDepth,
+	resp, err := c.listFiles(ctx, &pb.ListFilesRequest{
+		Path:               path,
+		MaxDepth:           maxDepth,
+		MeasureCompression: true,
 	})
 
 	stats := Stats{
@@ -87,6 +182,12 @@ func (c *Client) ListFilesWithStats(ctx context.Context, path string, maxDepth i
 	}
 
 	stats.FileCount = resp.TotalCount
+	if ci := resp.GetCompression(); ci != nil {
+		stats.UncompressedSize = ci.GetUncompressedSize()
+		stats.Compressor = ci.GetCompressor()
+		stats.DictID = ci.GetDictId()
+		stats.ServerCompressTime = time.Duration(ci.GetServerCompressMicros()) * time.Microsecond
+	}
 
 	return resp, stats, nil
 }
@@ -95,4 +196,10 @@ func (c *Client) ListFilesWithStats(ctx context.Context, path string, maxDepth i
 type Stats struct {
 	Duration  time.Duration
 	FileCount int64
+
+	// Compression details reported by the server; see pb.CompressionInfo.
+	UncompressedSize   int64
+	Compressor         string
+	DictID             uint32
+	ServerCompressTime time.Duration
 }
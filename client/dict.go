@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDictSize bounds dictionary downloads.
+const maxDictSize = 16 << 20
+
+// DictSource describes where the client obtains the server's dictionary.
+// Downloaded dictionaries are cached on disk by dictionary ID, so later
+// runs that know the ID start without network access.
+//
+// Dictionaries are loaded once, at startup. To follow a server's later
+// rotations, use WatchDicts, which subscribes to its DictionaryService and
+// swaps new versions into grpccodec.TypeCompressors while RPCs are in
+// flight.
+type DictSource struct {
+	// URL is fetched with an HTTP GET when the dictionary is not cached.
+	URL string
+	// Fetch, if set, is used instead of URL, for example to call an RPC
+	// that returns the dictionary.
+	Fetch func(ctx context.Context) ([]byte, error)
+	// ID is the expected dictionary ID. When set, a cached copy is used
+	// if present, and a download with a different ID is rejected. When
+	// zero the dictionary is always fetched, then cached.
+	ID uint32
+	// CacheDir overrides the cache directory, which defaults to
+	// zstd-dict under os.UserCacheDir ($XDG_CACHE_HOME on Linux).
+	CacheDir string
+	// HTTPClient is used for URL downloads; the default is
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// LoadDict returns the dictionary described by src, from the cache if
+// possible, and its ID. Fetched dictionaries are validated and cached;
+// failure to write the cache is not an error.
+func LoadDict(ctx context.Context, src DictSource) ([]byte, uint32, error) {
+	dir, dirErr := src.cacheDir()
+	if src.ID != 0 && dirErr == nil {
+		if dict, err := os.ReadFile(cachePath(dir, src.ID)); err == nil {
+			if id, err := inspectDict(dict); err == nil && id == src.ID {
+				return dict, id, nil
+			}
+		}
+	}
+
+	dict, err := src.fetch(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("client: fetching dictionary: %w", err)
+	}
+	id, err := inspectDict(dict)
+	if err != nil {
+		return nil, 0, fmt.Errorf("client: fetched dictionary: %w", err)
+	}
+	if src.ID != 0 && id != src.ID {
+		return nil, 0, fmt.Errorf("client: fetched dictionary has ID %d, want %d", id, src.ID)
+	}
+	if dirErr == nil {
+		_ = writeCache(dir, id, dict)
+	}
+	return dict, id, nil
+}
+
+func (src DictSource) cacheDir() (string, error) {
+	if src.CacheDir != "" {
+		return src.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zstd-dict"), nil
+}
+
+func (src DictSource) fetch(ctx context.Context) ([]byte, error) {
+	if src.Fetch != nil {
+		return src.Fetch(ctx)
+	}
+	if src.URL == "" {
+		return nil, errors.New("no dictionary URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := src.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", src.URL, resp.Status)
+	}
+	dict, err := io.ReadAll(io.LimitReader(resp.Body, maxDictSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dict) > maxDictSize {
+		return nil, fmt.Errorf("GET %s: dictionary larger than %d bytes", src.URL, maxDictSize)
+	}
+	return dict, nil
+}
+
+// inspectDict returns the ID of a zstd dictionary, rejecting anything that
+// is not one.
+func inspectDict(dict []byte) (uint32, error) {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return 0, err
+	}
+	return d.ID(), nil
+}
+
+func cachePath(dir string, id uint32) string {
+	return filepath.Join(dir, strconv.FormatUint(uint64(id), 10)+".dict")
+}
+
+// writeCache stores dict atomically, so concurrent clients never read a
+// partial file.
+func writeCache(dir string, id uint32, dict []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".dict-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(dict); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cachePath(dir, id))
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+func TestLoadDict(t *testing.T) {
+	var samples [][]byte
+	for i := range 200 {
+		samples = append(samples, []byte(fmt.Sprintf(`{"path":"dir/file%d.txt","size":%d,"mode":420}`, i, i*37)))
+	}
+	dict, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches++
+		w.Write(dict)
+	}))
+	defer srv.Close()
+
+	src := DictSource{URL: srv.URL, CacheDir: t.TempDir()}
+	got, id, err := LoadDict(context.Background(), src)
+	if err != nil {
+		t.Fatalf("LoadDict() error = %v", err)
+	}
+	if id != 4242 || !bytes.Equal(got, dict) {
+		t.Fatalf("LoadDict() = %d bytes, ID %d; want %d bytes, ID 4242", len(got), id, len(dict))
+	}
+
+	// With a known ID the cached copy is used.
+	src.ID = 4242
+	if _, _, err := LoadDict(context.Background(), src); err != nil {
+		t.Fatalf("LoadDict() from cache error = %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("fetches = %d, want 1", fetches)
+	}
+
+	// A download with an unexpected ID is rejected.
+	src = DictSource{URL: srv.URL, CacheDir: t.TempDir(), ID: 7}
+	if _, _, err := LoadDict(context.Background(), src); err == nil {
+		t.Error("LoadDict() accepted a dictionary with the wrong ID")
+	}
+
+	src = DictSource{Fetch: func(context.Context) ([]byte, error) { return []byte("not a dictionary"), nil }, CacheDir: t.TempDir()}
+	if _, _, err := LoadDict(context.Background(), src); err == nil {
+		t.Error("LoadDict() accepted an invalid dictionary")
+	}
+}
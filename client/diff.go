@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	"github.com/paulstuart/zstd-dict/internal/listdiff"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+)
+
+// Listing is a directory listing kept up to date with DiffFiles.
+type Listing struct {
+	// Root is the listed directory as resolved by the server.
+	Root string
+	// Files holds the entries sorted by path.
+	Files []*pb.FileInfo
+	// Version identifies the listing to the server.
+	Version string
+
+	// raw is the canonical serialization, the dictionary the server
+	// compresses the next changes with.
+	raw []byte
+}
+
+// DiffFiles returns the current listing of path, fetching only the changes
+// since base. With a nil base, or one the server no longer remembers, the
+// whole listing is transferred. base is not modified.
+func (c *Client) DiffFiles(ctx context.Context, path string, maxDepth int32, base *Listing) (*Listing, error) {
+	req := &pb.DiffFilesRequest{Path: path, MaxDepth: maxDepth}
+	if base != nil {
+		req.BaseVersion = base.Version
+	}
+	resp, err := c.client.DiffFiles(ctx, req)
+	if err != nil {
+		err = grpccodec.FromStatus(err)
+		if c.fallback == "" || !isDictError(err) {
+			return nil, err
+		}
+		if resp, err = c.client.DiffFiles(ctx, req, grpc.UseCompressor(c.fallback)); err != nil {
+			return nil, grpccodec.FromStatus(err)
+		}
+	}
+
+	var dict []byte
+	var files []*pb.FileInfo
+	switch resp.GetBaseVersion() {
+	case "":
+	case req.BaseVersion:
+		dict, files = base.raw, base.Files
+	default:
+		return nil, fmt.Errorf("client: DiffFiles: changes are against version %s, want %s", resp.GetBaseVersion(), req.BaseVersion)
+	}
+	changes, err := listdiff.Decompress(resp.GetChanges(), dict)
+	if err != nil {
+		return nil, fmt.Errorf("client: DiffFiles: %w", err)
+	}
+
+	l := &Listing{Root: changes.GetRoot(), Files: listdiff.Apply(files, changes)}
+	if l.raw, err = listdiff.Marshal(l.Root, l.Files); err != nil {
+		return nil, err
+	}
+	if l.Version = listdiff.Version(l.raw); l.Version != resp.GetVersion() {
+		return nil, fmt.Errorf("client: DiffFiles: listing version %s after applying changes, server has %s", l.Version, resp.GetVersion())
+	}
+	return l, nil
+}
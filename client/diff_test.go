@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/server"
+	"google.golang.org/grpc"
+)
+
+func TestClient_DiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 200 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.txt", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterFileListServiceServer(s, server.New())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	c, err := New(Options{Address: lis.Addr().String()})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	full, err := c.DiffFiles(ctx, dir, 0, nil)
+	if err != nil {
+		t.Fatalf("DiffFiles() error = %v", err)
+	}
+	if len(full.Files) != 200 {
+		t.Fatalf("DiffFiles() returned %d files, want 200", len(full.Files))
+	}
+
+	if err := os.Remove(filepath.Join(dir, "file007.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "added.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next, err := c.DiffFiles(ctx, dir, 0, full)
+	if err != nil {
+		t.Fatalf("DiffFiles() with base error = %v", err)
+	}
+	if len(next.Files) != 200 || next.Version == full.Version {
+		t.Errorf("DiffFiles() with base = %d files, version %s; want 200 files, new version", len(next.Files), next.Version)
+	}
+	want, err := c.ListFiles(ctx, dir, 0)
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if int64(len(next.Files)) != want.TotalCount {
+		t.Errorf("DiffFiles() = %d files, ListFiles() = %d", len(next.Files), want.TotalCount)
+	}
+
+	// An unknown base falls back to the whole listing.
+	again, err := c.DiffFiles(ctx, dir, 0, &Listing{Version: "unknown"})
+	if err != nil {
+		t.Fatalf("DiffFiles() with unknown base error = %v", err)
+	}
+	if again.Version != next.Version {
+		t.Errorf("DiffFiles() with unknown base = version %s, want %s", again.Version, next.Version)
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotRecorded is returned in replay mode for calls that have no
+// recorded response.
+var ErrNotRecorded = errors.New("client: no recorded response")
+
+// Recordings are stored one call per file pair in a directory:
+//
+//	<method>-<key>.pb                         the response, protobuf encoded
+//	<method>-<key>.recompressed.<compressor>  the response recompressed locally
+//
+// The key is a hash of the deterministically marshaled request, so a
+// replay serves the response recorded for an identical request. The
+// recompressed copy is only written for calls that used a compressor. It
+// is not what the server sent: gRPC doesn't expose a response's
+// compressed bytes, even to stats handlers, so the client compresses the
+// decoded response again with its own registration of the compressor.
+// Its size and decompression cost can differ from the server's if the
+// server used another level or dictionary.
+
+// recompressedExt separates a recording's path from the name of the
+// compressor its local recompression was made with.
+const recompressedExt = ".recompressed."
+
+// recordPath returns the path, without extension, of the recording of a
+// call to method with request req.
+func recordPath(dir, method string, req any) (string, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("client: cannot record request of type %T", req)
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(method+"\x00"), b...))
+	name := strings.ReplaceAll(strings.Trim(method, "/"), "/", ".")
+	return filepath.Join(dir, name+"-"+hex.EncodeToString(sum[:8])), nil
+}
+
+// callCompressor returns the compressor named by the last
+// grpc.UseCompressor option in opts, or def if there is none.
+func callCompressor(def string, opts []grpc.CallOption) string {
+	name := def
+	for _, o := range opts {
+		if co, ok := o.(grpc.CompressorCallOption); ok {
+			name = co.CompressorType
+		}
+	}
+	if name == "identity" {
+		return ""
+	}
+	return name
+}
+
+// recordInterceptor returns an interceptor that saves the response of
+// every successful unary call in dir. Failing to save is reported as the
+// call's error, since a silently incomplete recording defeats replay.
+func recordInterceptor(dir, compressor string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		if err := record(dir, method, req, reply, callCompressor(compressor, opts)); err != nil {
+			return fmt.Errorf("client: recording %s: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// record writes the raw and, if comp is set, locally recompressed
+// response.
+func record(dir, method string, req, reply any, comp string) error {
+	path, err := recordPath(dir, method, req)
+	if err != nil {
+		return err
+	}
+	m, ok := reply.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot record response of type %T", reply)
+	}
+	raw, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".pb", raw, 0o644); err != nil {
+		return err
+	}
+	if comp == "" {
+		return nil
+	}
+	c := encoding.GetCompressor(comp)
+	if c == nil {
+		return fmt.Errorf("compressor %q not registered", comp)
+	}
+	var buf bytes.Buffer
+	w, err := c.Compress(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path+recompressedExt+comp, buf.Bytes(), 0o644)
+}
+
+// replayConn is a grpc.ClientConnInterface that serves unary calls from a
+// recording directory instead of the network.
+//
+// When the call's compressor is registered and a copy recompressed with it
+// was recorded, that copy is decompressed, so replays include the
+// client's decompression cost; otherwise the raw response is used.
+type replayConn struct {
+	dir        string
+	compressor string
+}
+
+func (r *replayConn) Invoke(_ context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	path, err := recordPath(r.dir, method, args)
+	if err != nil {
+		return err
+	}
+	m, ok := reply.(proto.Message)
+	if !ok {
+		return fmt.Errorf("client: cannot replay response of type %T", reply)
+	}
+	raw, err := r.load(path, callCompressor(r.compressor, opts))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w for %s in %s", ErrNotRecorded, method, r.dir)
+	}
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(raw, m)
+}
+
+// load returns the recorded response at path, decompressing the copy
+// recompressed with comp if there is one.
+func (r *replayConn) load(path, comp string) ([]byte, error) {
+	if c := encoding.GetCompressor(comp); comp != "" && c != nil {
+		data, err := os.ReadFile(path + recompressedExt + comp)
+		if err == nil {
+			dr, err := c.Decompress(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(dr)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return os.ReadFile(path + ".pb")
+}
+
+func (r *replayConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "client: streaming calls cannot be replayed")
+}
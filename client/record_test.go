@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/server"
+	"google.golang.org/grpc"
+)
+
+func TestClient_RecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 50 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.txt", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterFileListServiceServer(s, server.New())
+	go s.Serve(lis)
+
+	recording := t.TempDir()
+	c, err := New(Options{Address: lis.Addr().String(), Compressor: grpccodec.NameZstd, Record: recording})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	want, err := c.ListFiles(ctx, dir, 0)
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	c.Close()
+	s.Stop()
+
+	files, _ := filepath.Glob(filepath.Join(recording, "*"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d files, want raw and zstd copies: %v", len(files), files)
+	}
+	if local, _ := filepath.Glob(filepath.Join(recording, "*"+recompressedExt+grpccodec.NameZstd)); len(local) != 1 {
+		t.Errorf("recorded %v, want one local zstd recompression", files)
+	}
+
+	for _, comp := range []string{grpccodec.NameZstd, ""} {
+		r, err := New(Options{Compressor: comp, Replay: recording})
+		if err != nil {
+			t.Fatalf("New() replay error = %v", err)
+		}
+		got, err := r.ListFiles(ctx, dir, 0)
+		if err != nil {
+			t.Fatalf("ListFiles() replay with %q error = %v", comp, err)
+		}
+		if got.TotalCount != want.TotalCount || len(got.Files) != len(want.Files) {
+			t.Errorf("replay with %q = %d files, want %d", comp, got.TotalCount, want.TotalCount)
+		}
+
+		if _, err := r.ListFiles(ctx, dir, 1); !errors.Is(err, ErrNotRecorded) {
+			t.Errorf("ListFiles() of unrecorded request error = %v, want ErrNotRecorded", err)
+		}
+		r.Close()
+	}
+}
+
+func TestClient_ReplaySkipsDict(t *testing.T) {
+	fetched := false
+	c, err := New(Options{
+		Replay: t.TempDir(),
+		Dict: &DictSource{Fetch: func(context.Context) ([]byte, error) {
+			fetched = true
+			return nil, errors.New("offline")
+		}},
+	})
+	if err != nil {
+		t.Fatalf("New() replay with Dict error = %v", err)
+	}
+	defer c.Close()
+	if fetched {
+		t.Error("New() in replay mode fetched the dictionary")
+	}
+	if _, err := c.ListFiles(context.Background(), "/", 0); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("ListFiles() error = %v, want ErrNotRecorded", err)
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	"google.golang.org/grpc"
+)
+
+// DictSetter is a codec whose dictionary can be replaced while it is in
+// use, such as a *grpccodec.TypeCompressor.
+type DictSetter interface {
+	SetDict(dict []byte) error
+}
+
+// WatchOptions configures WatchDicts.
+type WatchOptions struct {
+	// Codecs maps dictionary names to the codecs receiving their versions.
+	Codecs map[string]DictSetter
+	// OnUpdate, if set, is called after each version pushed by the
+	// server is installed, or with the error that prevented it.
+	OnUpdate func(name string, id uint32, err error)
+	// RetryDelay is the wait before subscribing again after the stream
+	// fails. If 0, one second is used.
+	RetryDelay time.Duration
+}
+
+// WatchDicts subscribes to the DictionaryService on cc and installs every
+// dictionary version the server promotes in the codec registered for its
+// name, so the client rotates dictionaries in step with the server:
+//
+//	t, _ := grpccodec.RegisterTypeCompressor("filelist.ListFilesResponse")
+//	go client.WatchDicts(ctx, conn, client.WatchOptions{
+//	    Codecs: map[string]client.DictSetter{"filelist.ListFilesResponse": t},
+//	})
+//
+// The server sends the current versions first, so codecs are primed as
+// soon as the subscription starts. WatchDicts subscribes again after the
+// stream fails and returns ctx.Err() once ctx is done.
+func WatchDicts(ctx context.Context, cc grpc.ClientConnInterface, opts WatchOptions) error {
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	req := &dpb.WatchDictionariesRequest{}
+	for name := range opts.Codecs {
+		req.Names = append(req.Names, name)
+	}
+	dc := dpb.NewDictionaryServiceClient(cc)
+
+	for {
+		err := watchDicts(ctx, dc, req, opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if opts.OnUpdate != nil {
+			opts.OnUpdate("", 0, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchDicts runs one subscription until the stream fails.
+func watchDicts(ctx context.Context, dc dpb.DictionaryServiceClient, req *dpb.WatchDictionariesRequest, opts WatchOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := dc.WatchDictionaries(ctx, req)
+	if err != nil {
+		return fmt.Errorf("client: watching dictionaries: %w", err)
+	}
+	for {
+		d, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("client: watching dictionaries: %w", err)
+		}
+		err = installDict(opts.Codecs[d.GetName()], d)
+		if opts.OnUpdate != nil {
+			opts.OnUpdate(d.GetName(), d.GetId(), err)
+		}
+	}
+}
+
+// installDict validates a pushed version and hands it to codec.
+func installDict(codec DictSetter, d *dpb.Dictionary) error {
+	if codec == nil {
+		return fmt.Errorf("client: no codec for dictionary %q", d.GetName())
+	}
+	id, err := inspectDict(d.GetData())
+	if err != nil {
+		return fmt.Errorf("client: dictionary %q: %w", d.GetName(), err)
+	}
+	if id != d.GetId() {
+		return fmt.Errorf("client: dictionary %q has ID %d, want %d", d.GetName(), id, d.GetId())
+	}
+	return codec.SetDict(d.GetData())
+}
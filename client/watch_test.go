@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	"github.com/paulstuart/zstd-dict/server"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// chanSetter records the dictionaries it is given.
+type chanSetter chan []byte
+
+func (c chanSetter) SetDict(dict []byte) error {
+	c <- dict
+	return nil
+}
+
+func TestWatchDicts(t *testing.T) {
+	var samples [][]byte
+	for i := range 200 {
+		samples = append(samples, []byte(fmt.Sprintf(`{"path":"dir/file%d.txt","size":%d,"mode":420}`, i, i*37)))
+	}
+	train := func(id uint32) []byte {
+		dict, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{ID: id})
+		if err != nil {
+			t.Fatalf("TrainDict() error = %v", err)
+		}
+		return dict
+	}
+
+	ds := server.NewDictionaryServer()
+	if err := ds.Promote("listing", train(101)); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+	if err := ds.Promote("listing", []byte("not a dictionary")); err == nil {
+		t.Error("Promote() accepted an invalid dictionary")
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	dpb.RegisterDictionaryServiceServer(s, ds)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = dpb.NewDictionaryServiceClient(conn).GetDictionary(ctx, &dpb.GetDictionaryRequest{Name: "other"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetDictionary(other) error = %v, want NotFound", err)
+	}
+
+	listing := make(chanSetter, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchDicts(ctx, conn, WatchOptions{Codecs: map[string]DictSetter{"listing": listing}})
+	}()
+	next := func() uint32 {
+		t.Helper()
+		select {
+		case dict := <-listing:
+			id, err := inspectDict(dict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("no dictionary pushed")
+			return 0
+		}
+	}
+
+	if id := next(); id != 101 {
+		t.Errorf("first pushed dictionary ID = %d, want 101", id)
+	}
+	if err := ds.Promote("unwatched", train(201)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Promote("listing", train(102)); err != nil {
+		t.Fatal(err)
+	}
+	if id := next(); id != 102 {
+		t.Errorf("promoted dictionary ID = %d, want 102", id)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchDicts() = %v, want context.Canceled", err)
+	}
+}
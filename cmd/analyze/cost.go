@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TCP parameters for the transfer model: a 10-segment initial congestion
+// window (RFC 6928) doubling each round trip.
+const (
+	mss         = 1460
+	initialCwnd = 10 * mss
+	bytesPerGB  = 1 << 30
+	perMillion  = 1_000_000
+	bitsPerMbit = 1_000_000
+	bitsPerByte = 8
+)
+
+// costModel converts byte counts into transfer time and money.
+type costModel struct {
+	rtt       time.Duration
+	bandwidth float64 // bytes per second
+	costPerGB float64 // dollars
+}
+
+// newCostModel builds a model from the -rtt, -bandwidth (Mbit/s), and
+// -cost-per-gb flags.
+func newCostModel(rtt time.Duration, mbps, costPerGB float64) costModel {
+	return costModel{rtt: rtt, bandwidth: mbps * bitsPerMbit / bitsPerByte, costPerGB: costPerGB}
+}
+
+// transferTime estimates the time to deliver n bytes on a connection
+// starting from the initial congestion window, as after an idle period:
+// one round trip per window, plus serialization at the link bandwidth.
+func (m costModel) transferTime(n int64) time.Duration {
+	rounds := 1
+	for window, sent := int64(initialCwnd), int64(initialCwnd); sent < n; sent += window {
+		window *= 2
+		rounds++
+	}
+	t := time.Duration(rounds) * m.rtt
+	if m.bandwidth > 0 {
+		t += time.Duration(float64(n) / m.bandwidth * float64(time.Second))
+	}
+	return t
+}
+
+// dollars returns the egress cost of n bytes.
+func (m costModel) dollars(n int64) float64 {
+	return float64(n) / bytesPerGB * m.costPerGB
+}
+
+// costRow is the traffic one compression method produced for a message set.
+type costRow struct {
+	name  string
+	bytes int64
+	time  time.Duration // sum of per-message transfer times
+}
+
+// tally adds one message of n bytes to r.
+func (r *costRow) tally(m costModel, n int) {
+	r.bytes += int64(n)
+	r.time += m.transferTime(int64(n))
+}
+
+// printNetworkCost reports rows as latency and dollars, relative to the
+// first row, and the dictionary's break-even point in those terms. dict is
+// the row for dictionary compression and plain the row it is compared to.
+func printNetworkCost(m costModel, msgs int, rows []costRow, plain, dict costRow, dictSize int) {
+	fmt.Printf("Network Cost (RTT %v, %.0f Mbit/s, $%.3f/GB):\n",
+		m.rtt, m.bandwidth*bitsPerByte/bitsPerMbit, m.costPerGB)
+	fmt.Printf("  %-14s %12s %14s %14s\n", "Method", "Latency/msg", "Saved/msg", "$ per 1M msgs")
+	base := rows[0]
+	n := time.Duration(msgs)
+	for _, r := range rows {
+		fmt.Printf("  %-14s %12v %14v %14.2f\n", r.name,
+			(r.time / n).Round(time.Microsecond),
+			((base.time - r.time) / n).Round(time.Microsecond),
+			m.dollars(r.bytes)/float64(msgs)*perMillion)
+	}
+
+	savedTime := (plain.time - dict.time) / n
+	savedDollars := m.dollars(plain.bytes-dict.bytes) / float64(msgs)
+	dictTime := m.transferTime(int64(dictSize))
+	fmt.Printf("  Dictionary download:  %v, $%.6f\n", dictTime.Round(time.Microsecond), m.dollars(int64(dictSize)))
+	if savedTime > 0 {
+		fmt.Printf("  Latency break-even:   %d messages (%v saved/msg vs %s)\n",
+			int64((dictTime+savedTime-1)/savedTime), savedTime.Round(time.Microsecond), plain.name)
+	} else {
+		fmt.Printf("  Latency break-even:   never (no latency saved vs %s)\n", plain.name)
+	}
+	fmt.Printf("  Dollars saved:        $%.2f per 1M messages vs %s\n\n", savedDollars*perMillion, plain.name)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/paulstuart/zstd-dict/server"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+// cpuMethod is a compression method exercised by the CPU simulation.
+// newClient returns the compress and decompress functions for one
+// simulated client, which may keep per-client state such as a reused gzip
+// writer.
+type cpuMethod struct {
+	name      string
+	newClient func() (compress, decompress func([]byte) ([]byte, error))
+}
+
+// cpuResult is the cost of one method across all simulated clients.
+type cpuResult struct {
+	name           string
+	in, out        int64
+	compressCPU    time.Duration
+	decompressCPU  time.Duration
+	compressWall   time.Duration
+	decompressWall time.Duration
+}
+
+// mbSaved returns the megabytes the method kept off the wire.
+func (r cpuResult) mbSaved() float64 {
+	return float64(r.in-r.out) / (1 << 20)
+}
+
+// runCPUSimulation has clients goroutines each compress, then decompress,
+// perClient messages with every method and reports the CPU spent per
+// megabyte saved, the figure capacity planners weigh against bandwidth.
+func runCPUSimulation(dir string, clients, perClient int) error {
+	samples, err := server.GenerateResponseSamples([]string{dir}, 20, 500)
+	if err != nil {
+		return err
+	}
+	if len(samples) < 250 {
+		return fmt.Errorf("not enough samples (got %d, need 250+)", len(samples))
+	}
+	trainSet, testSet := splitTrain(samples)
+	dict, err := zstddict.TrainDict(trainSet, &zstddict.TrainDictOptions{MaxDictSize: 16 * 1024})
+	if err != nil {
+		return err
+	}
+
+	methods := []cpuMethod{gzipMethod()}
+	for _, m := range []struct {
+		name string
+		opts []zstddict.Option
+	}{
+		{"Zstd", nil},
+		{"Zstd+Dict", []zstddict.Option{zstddict.WithDictBytes(dict)}},
+	} {
+		c, err := zstddict.New(m.opts...)
+		if err != nil {
+			return err
+		}
+		methods = append(methods, cpuMethod{m.name, func() (func([]byte) ([]byte, error), func([]byte) ([]byte, error)) {
+			return c.Compress, c.Decompress
+		}})
+	}
+
+	_, precise := processCPUTime()
+	fmt.Println("=== Concurrent Client CPU Overhead ===")
+	fmt.Println()
+	fmt.Printf("Clients: %d, messages per client: %d, sample messages: %d (avg %d bytes)\n",
+		clients, perClient, len(testSet), avgLen(testSet))
+	fmt.Printf("Dictionary size: %d bytes\n", len(dict))
+	if !precise {
+		fmt.Println("Process CPU time is unavailable here; CPU is estimated as wall time x busy cores.")
+	}
+	fmt.Println()
+
+	var results []cpuResult
+	for _, m := range methods {
+		r, err := simulateMethod(m, testSet, clients, perClient)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+		results = append(results, r)
+	}
+
+	fmt.Printf("%-10s %9s %9s %10s %10s %12s %12s %14s\n",
+		"Method", "Ratio", "MB saved", "Comp CPU", "Decomp CPU", "Comp MB/s", "CPU s/MB", "vs gzip")
+	fmt.Println("-------------------------------------------------------------------------------------------------")
+	base := results[0]
+	for _, r := range results {
+		perMB := (r.compressCPU + r.decompressCPU).Seconds() / r.mbSaved()
+		basePerMB := (base.compressCPU + base.decompressCPU).Seconds() / base.mbSaved()
+		fmt.Printf("%-10s %8.1f%% %9.1f %10v %10v %12.1f %12.4f %13.2fx\n",
+			r.name,
+			float64(r.out)/float64(r.in)*100,
+			r.mbSaved(),
+			r.compressCPU.Round(time.Millisecond),
+			r.decompressCPU.Round(time.Millisecond),
+			float64(r.in)/(1<<20)/r.compressWall.Seconds(),
+			perMB,
+			perMB/basePerMB)
+	}
+	fmt.Println()
+	fmt.Println("CPU s/MB is compression plus decompression CPU per megabyte saved versus")
+	fmt.Println("sending uncompressed; lower is cheaper. Comp MB/s is aggregate input throughput.")
+	return nil
+}
+
+// simulateMethod runs clients concurrent clients compressing and then
+// decompressing perClient messages each, cycling through samples.
+func simulateMethod(m cpuMethod, samples [][]byte, clients, perClient int) (cpuResult, error) {
+	r := cpuResult{name: m.name}
+	type client struct {
+		compress, decompress func([]byte) ([]byte, error)
+		frames               [][]byte
+	}
+	cs := make([]*client, clients)
+	for i := range cs {
+		comp, decomp := m.newClient()
+		cs[i] = &client{compress: comp, decompress: decomp, frames: make([][]byte, perClient)}
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		firstErr = cmp.Or(firstErr, err)
+		mu.Unlock()
+	}
+
+	r.compressCPU, r.compressWall = measureCPU(clients, func() {
+		var wg sync.WaitGroup
+		for i, c := range cs {
+			wg.Go(func() {
+				for j := range perClient {
+					frame, err := c.compress(samples[(i*perClient+j)%len(samples)])
+					if err != nil {
+						fail(err)
+						return
+					}
+					c.frames[j] = frame
+				}
+			})
+		}
+		wg.Wait()
+	})
+	if firstErr != nil {
+		return r, firstErr
+	}
+	for i, c := range cs {
+		for j, frame := range c.frames {
+			r.in += int64(len(samples[(i*perClient+j)%len(samples)]))
+			r.out += int64(len(frame))
+		}
+	}
+
+	r.decompressCPU, r.decompressWall = measureCPU(clients, func() {
+		var wg sync.WaitGroup
+		for _, c := range cs {
+			wg.Go(func() {
+				for _, frame := range c.frames {
+					if _, err := c.decompress(frame); err != nil {
+						fail(err)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+	})
+	return r, firstErr
+}
+
+// measureCPU runs fn and returns the process CPU time and wall time it
+// took. Without process CPU accounting, CPU is estimated from wall time
+// and the number of cores the workers could occupy.
+func measureCPU(workers int, fn func()) (cpu, wall time.Duration) {
+	runtime.GC()
+	before, ok := processCPUTime()
+	start := time.Now()
+	fn()
+	wall = time.Since(start)
+	after, _ := processCPUTime()
+	if !ok {
+		return wall * time.Duration(min(workers, runtime.GOMAXPROCS(0))), wall
+	}
+	return after - before, wall
+}
+
+// gzipMethod returns gzip at the default level, with a writer and reader
+// reused per client as a well-tuned service would.
+func gzipMethod() cpuMethod {
+	return cpuMethod{"Gzip", func() (func([]byte) ([]byte, error), func([]byte) ([]byte, error)) {
+		var zw *gzip.Writer
+		var zr *gzip.Reader
+		compress := func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			if zw == nil {
+				zw = gzip.NewWriter(&buf)
+			} else {
+				zw.Reset(&buf)
+			}
+			if _, err := zw.Write(data); err != nil {
+				return nil, err
+			}
+			err := zw.Close()
+			return buf.Bytes(), err
+		}
+		decompress := func(frame []byte) ([]byte, error) {
+			var err error
+			if zr == nil {
+				zr, err = gzip.NewReader(bytes.NewReader(frame))
+			} else {
+				err = zr.Reset(bytes.NewReader(frame))
+			}
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		}
+		return compress, decompress
+	}}
+}
+
+// avgLen returns the mean length of samples.
+func avgLen(samples [][]byte) int {
+	var n int
+	for _, s := range samples {
+		n += len(s)
+	}
+	return n / len(samples)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/server"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxFieldDepth bounds how deep field ablation descends into nested
+// messages, which also stops recursive message types.
+const maxFieldDepth = 3
+
+// fieldPath is a chain of fields from the top-level message.
+type fieldPath []protoreflect.FieldDescriptor
+
+func (p fieldPath) String() string {
+	names := make([]string, len(p))
+	for i, fd := range p {
+		names[i] = string(fd.Name())
+	}
+	return strings.Join(names, ".")
+}
+
+// fieldContribution is the compressed bytes attributable to one field:
+// how much smaller the samples compress with the field cleared.
+type fieldContribution struct {
+	path fieldPath
+	raw  int64
+	zstd int64
+	dict int64
+}
+
+// loadMessageType resolves name in the FileDescriptorSet at path, or in the
+// FileListService protos when path is empty.
+func loadMessageType(path, name string) (protoreflect.MessageDescriptor, error) {
+	if path == "" {
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, err
+		}
+		md, ok := d.(protoreflect.MessageDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a message", name)
+		}
+		return md, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// readDelimited reads length-delimited messages of type md from path.
+func readDelimited(path string, md protoreflect.MessageDescriptor) ([]proto.Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []proto.Message
+	r := bufio.NewReader(f)
+	for {
+		m := dynamicpb.NewMessage(md)
+		if err := protodelim.UnmarshalFrom(r, m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return msgs, nil
+			}
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+// parseSamples decodes serialized samples as messages of type md.
+func parseSamples(samples [][]byte, md protoreflect.MessageDescriptor) ([]proto.Message, error) {
+	msgs := make([]proto.Message, len(samples))
+	for i, s := range samples {
+		m := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(s, m); err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+		msgs[i] = m
+	}
+	return msgs, nil
+}
+
+// fieldPaths lists every field of md, and of its message-typed fields, to
+// maxFieldDepth.
+func fieldPaths(md protoreflect.MessageDescriptor, prefix fieldPath) []fieldPath {
+	var paths []fieldPath
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		p := append(slices.Clone(prefix), fd)
+		paths = append(paths, p)
+		if fd.Message() != nil && !fd.IsMap() && len(p) < maxFieldDepth {
+			paths = append(paths, fieldPaths(fd.Message(), p)...)
+		}
+	}
+	return paths
+}
+
+// clearPath clears the field at path in m, in every element of any
+// repeated message along the way.
+func clearPath(m protoreflect.Message, path fieldPath) {
+	fd := path[0]
+	if len(path) == 1 {
+		m.Clear(fd)
+		return
+	}
+	if !m.Has(fd) {
+		return
+	}
+	if fd.IsList() {
+		list := m.Mutable(fd).List()
+		for i := range list.Len() {
+			clearPath(list.Get(i).Message(), path[1:])
+		}
+		return
+	}
+	clearPath(m.Mutable(fd).Message(), path[1:])
+}
+
+// marshal encodes m in field-number order. dynamicpb messages otherwise
+// marshal their fields in random order, which would make every ablation
+// measure noise.
+var marshal = proto.MarshalOptions{Deterministic: true}.Marshal
+
+// compressedTotals returns the raw, zstd, and zstd+dict sizes of msgs.
+func compressedTotals(msgs []proto.Message, compNone, compDict *zstddict.Compressor) (raw, plain, dict int64, err error) {
+	for _, m := range msgs {
+		data, err := marshal(m)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		raw += int64(len(data))
+		c, _ := compNone.Compress(data)
+		plain += int64(len(c))
+		c, _ = compDict.Compress(data)
+		dict += int64(len(c))
+	}
+	return raw, plain, dict, nil
+}
+
+// analyzeFields reports each field's contribution to the compressed size
+// of msgs by ablation: clearing the field in every sample and measuring how
+// much the totals shrink. dict is trained on the unmodified samples.
+func analyzeFields(md protoreflect.MessageDescriptor, msgs []proto.Message, dict []byte) error {
+	compNone, _ := zstddict.New()
+	compDict, err := zstddict.New(zstddict.WithDictBytes(dict))
+	if err != nil {
+		return err
+	}
+
+	raw, plain, withDict, err := compressedTotals(msgs, compNone, compDict)
+	if err != nil {
+		return err
+	}
+
+	var results []fieldContribution
+	for _, path := range fieldPaths(md, nil) {
+		ablated := make([]proto.Message, len(msgs))
+		for i, m := range msgs {
+			c := proto.Clone(m)
+			clearPath(c.ProtoReflect(), path)
+			ablated[i] = c
+		}
+		r, p, d, err := compressedTotals(ablated, compNone, compDict)
+		if err != nil {
+			return err
+		}
+		results = append(results, fieldContribution{path: path, raw: raw - r, zstd: plain - p, dict: withDict - d})
+	}
+	slices.SortFunc(results, func(a, b fieldContribution) int {
+		return int(b.dict - a.dict)
+	})
+
+	fmt.Printf("Message:    %s\n", md.FullName())
+	fmt.Printf("Samples:    %d\n", len(msgs))
+	fmt.Printf("Dictionary: %d bytes\n\n", len(dict))
+	fmt.Printf("Totals: raw %d, zstd %d, zstd+dict %d bytes\n\n", raw, plain, withDict)
+	fmt.Printf("%-36s %10s %10s %7s %10s %7s\n", "Field", "Raw", "Zstd", "Zstd%", "Dict", "Dict%")
+	fmt.Println(strings.Repeat("-", 86))
+	for _, r := range results {
+		fmt.Printf("%-36s %10d %10d %6.1f%% %10d %6.1f%%\n", r.path,
+			r.raw, r.zstd, pct(r.zstd, plain), r.dict, pct(r.dict, withDict))
+	}
+	fmt.Println()
+	fmt.Println("Contributions are the bytes saved by clearing the field in every sample;")
+	fmt.Println("nested rows are included in their parent's total. Negative values mean the")
+	fmt.Println("rest of the message compresses worse without the field.")
+	return nil
+}
+
+func pct(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// runFieldAnalysis implements the -fields mode. Without a samples file it
+// analyzes ListFilesResponse samples generated from dir.
+func runFieldAnalysis(descriptorPath, message, samplesPath, dir string) error {
+	if message == "" {
+		if descriptorPath != "" {
+			return errors.New("-message is required with -descriptor")
+		}
+		message = string((&pb.ListFilesResponse{}).ProtoReflect().Descriptor().FullName())
+	}
+	md, err := loadMessageType(descriptorPath, message)
+	if err != nil {
+		return err
+	}
+
+	var msgs []proto.Message
+	switch {
+	case samplesPath != "":
+		msgs, err = readDelimited(samplesPath, md)
+	case descriptorPath == "" && message == string((&pb.ListFilesResponse{}).ProtoReflect().Descriptor().FullName()):
+		var samples [][]byte
+		samples, err = server.GenerateResponseSamples([]string{dir}, 20, 500)
+		if err == nil {
+			msgs, err = parseSamples(samples, md)
+		}
+	default:
+		return errors.New("-samples is required for this message type")
+	}
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return errors.New("no samples")
+	}
+
+	training := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		if training[i], err = marshal(m); err != nil {
+			return err
+		}
+	}
+	dict, err := zstddict.TrainDict(training, &zstddict.TrainDictOptions{MaxDictSize: 16 * 1024})
+	if err != nil {
+		return fmt.Errorf("training dictionary: %w", err)
+	}
+	return analyzeFields(md, msgs, dict)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/samplers"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+// tokenPattern matches the word-like runs reported as tokens.
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9_]{3,}`)
+
+// sensitivePatterns flag literals that shouldn't ship in a dictionary,
+// which is distributed to every client.
+var sensitivePatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{"ipv4", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)},
+	{"aws-key", regexp.MustCompile(`AKIA[0-9A-Z]{16}`)},
+	{"jwt", regexp.MustCompile(`eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"secret", regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_-]?key)\s*[=:]\s*\S+`)},
+	{"hex", regexp.MustCompile(`\b[0-9a-fA-F]{32,}\b`)},
+}
+
+type tokenStat struct {
+	Token string
+	Count int
+	Bytes int // content bytes covered by the token's occurrences
+	Pct   float64
+}
+
+type finding struct {
+	Kind   string
+	Offset int
+	Text   string
+}
+
+// dictReport is what -inspect reports about a dictionary.
+type dictReport struct {
+	Path        string
+	Format      zstddict.DictFormat
+	ID          uint32
+	Size        int
+	ContentSize int
+	// Printable is the percentage of content bytes that are printable
+	// ASCII or whitespace.
+	Printable float64
+	// TokenPct and TopPct are the percentages of the content covered by
+	// all tokens and by the reported top tokens.
+	TokenPct float64
+	TopPct   float64
+	Tokens   []tokenStat
+	Findings []finding
+	// SampleCoverage is the percentage of corpus bytes starting an
+	// 8-byte sequence present in the content, or -1 without a corpus.
+	SampleCoverage float64
+
+	content []byte
+}
+
+func inspectDict(path string, dict []byte, corpus [][]byte, top int) (*dictReport, error) {
+	r := &dictReport{Path: path, Format: zstddict.DetectDictFormat(dict), Size: len(dict), SampleCoverage: -1}
+	content := dict
+	if r.Format == zstddict.FormatStructured {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, err
+		}
+		r.ID, content = d.ID(), d.Content()
+	}
+	r.content = content
+	r.ContentSize = len(content)
+	if len(content) == 0 {
+		return r, nil
+	}
+
+	printable := 0
+	for _, b := range content {
+		if b >= 0x20 && b < 0x7f || b == '\n' || b == '\r' || b == '\t' {
+			printable++
+		}
+	}
+	r.Printable = percent(printable, len(content))
+
+	counts := map[string]int{}
+	tokenBytes := 0
+	for _, loc := range tokenPattern.FindAllIndex(content, -1) {
+		counts[string(content[loc[0]:loc[1]])]++
+		tokenBytes += loc[1] - loc[0]
+	}
+	r.TokenPct = percent(tokenBytes, len(content))
+	for tok, n := range counts {
+		r.Tokens = append(r.Tokens, tokenStat{Token: tok, Count: n, Bytes: n * len(tok), Pct: percent(n*len(tok), len(content))})
+	}
+	slices.SortFunc(r.Tokens, func(a, b tokenStat) int {
+		return cmp.Or(b.Bytes-a.Bytes, strings.Compare(a.Token, b.Token))
+	})
+	if len(r.Tokens) > top {
+		r.Tokens = r.Tokens[:top]
+	}
+	topBytes := 0
+	for _, t := range r.Tokens {
+		topBytes += t.Bytes
+	}
+	r.TopPct = percent(topBytes, len(content))
+
+	for _, p := range sensitivePatterns {
+		for _, loc := range p.re.FindAllIndex(content, -1) {
+			r.Findings = append(r.Findings, finding{Kind: p.kind, Offset: loc[0], Text: string(content[loc[0]:loc[1]])})
+		}
+	}
+	slices.SortFunc(r.Findings, func(a, b finding) int { return a.Offset - b.Offset })
+
+	if len(corpus) > 0 {
+		r.SampleCoverage = sampleCoverage(content, corpus)
+	}
+	return r, nil
+}
+
+// sampleCoverage returns the percentage of corpus positions whose next 8
+// bytes also occur in content, a rough measure of how much of the corpus
+// the dictionary can match.
+func sampleCoverage(content []byte, corpus [][]byte) float64 {
+	const gram = 8
+	grams := map[uint64]bool{}
+	for p := 0; p+gram <= len(content); p++ {
+		grams[binary.LittleEndian.Uint64(content[p:])] = true
+	}
+	var hit, total int
+	for _, s := range corpus {
+		for p := 0; p+gram <= len(s); p++ {
+			total++
+			if grams[binary.LittleEndian.Uint64(s[p:])] {
+				hit++
+			}
+		}
+	}
+	return percent(hit, total)
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+func (r *dictReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Dictionary:  %s\n", r.Path)
+	fmt.Fprintf(w, "Format:      %s", r.Format)
+	if r.Format == zstddict.FormatStructured {
+		fmt.Fprintf(w, " (ID %d)", r.ID)
+	}
+	fmt.Fprintf(w, "\nSize:        %d bytes, content %d bytes\n", r.Size, r.ContentSize)
+	fmt.Fprintf(w, "Printable:   %.1f%%\n", r.Printable)
+	fmt.Fprintf(w, "Tokens:      %.1f%% of content, top %d cover %.1f%%\n", r.TokenPct, len(r.Tokens), r.TopPct)
+	if r.SampleCoverage >= 0 {
+		fmt.Fprintf(w, "Corpus:      %.1f%% of corpus bytes start an 8-byte match in the content\n", r.SampleCoverage)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%-40s %7s %8s %6s\n", "Token", "Count", "Bytes", "Pct")
+	fmt.Fprintln(w, strings.Repeat("-", 64))
+	for _, t := range r.Tokens {
+		fmt.Fprintf(w, "%-40s %7d %8d %5.1f%%\n", truncate(t.Token, 40), t.Count, t.Bytes, t.Pct)
+	}
+	fmt.Fprintln(w)
+
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No sensitive-looking literals found.")
+		return
+	}
+	fmt.Fprintf(w, "%d sensitive-looking literals:\n", len(r.Findings))
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "  %-8s @%-6d %s\n", f.Kind, f.Offset, truncate(f.Text, 60))
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+// contentSpan is a run of displayed content, marked if it is a finding.
+type contentSpan struct {
+	Text string
+	Mark bool
+}
+
+// spans renders the content for HTML, showing non-printable bytes as dots
+// and marking findings.
+func (r *dictReport) spans() []contentSpan {
+	marked := make([]bool, len(r.content))
+	for _, f := range r.Findings {
+		for i := range len(f.Text) {
+			marked[f.Offset+i] = true
+		}
+	}
+	var spans []contentSpan
+	var b strings.Builder
+	for i, c := range r.content {
+		if i > 0 && marked[i] != marked[i-1] {
+			spans = append(spans, contentSpan{Text: b.String(), Mark: marked[i-1]})
+			b.Reset()
+		}
+		if c >= 0x20 && c < 0x7f || c == '\n' {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune('·')
+		}
+	}
+	if b.Len() > 0 {
+		spans = append(spans, contentSpan{Text: b.String(), Mark: marked[len(marked)-1]})
+	}
+	return spans
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Dictionary {{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: left; }
+td.n { text-align: right; }
+pre { white-space: pre-wrap; word-break: break-all; background: #f6f6f6; padding: 1em; }
+mark { background: #f99; }
+</style></head><body>
+<h1>Dictionary {{.Path}}</h1>
+<table>
+<tr><th>Format</th><td>{{.Format}}{{if .ID}} (ID {{.ID}}){{end}}</td></tr>
+<tr><th>Size</th><td>{{.Size}} bytes, content {{.ContentSize}} bytes</td></tr>
+<tr><th>Printable</th><td>{{printf "%.1f" .Printable}}%</td></tr>
+<tr><th>Tokens</th><td>{{printf "%.1f" .TokenPct}}% of content, top {{len .Tokens}} cover {{printf "%.1f" .TopPct}}%</td></tr>
+{{if ge .SampleCoverage 0.0}}<tr><th>Corpus coverage</th><td>{{printf "%.1f" .SampleCoverage}}%</td></tr>{{end}}
+</table>
+<h2>Top tokens</h2>
+<table><tr><th>Token</th><th>Count</th><th>Bytes</th><th>Pct</th></tr>
+{{range .Tokens}}<tr><td><code>{{.Token}}</code></td><td class="n">{{.Count}}</td><td class="n">{{.Bytes}}</td><td class="n">{{printf "%.1f" .Pct}}%</td></tr>
+{{end}}</table>
+<h2>Sensitive-looking literals</h2>
+{{if .Findings}}<table><tr><th>Kind</th><th>Offset</th><th>Text</th></tr>
+{{range .Findings}}<tr><td>{{.Kind}}</td><td class="n">{{.Offset}}</td><td><code>{{.Text}}</code></td></tr>
+{{end}}</table>{{else}}<p>None found.</p>{{end}}
+<h2>Content</h2>
+<pre>{{range .Spans}}{{if .Mark}}<mark>{{.Text}}</mark>{{else}}{{.Text}}{{end}}{{end}}</pre>
+</body></html>
+`))
+
+func (r *dictReport) writeHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, struct {
+		*dictReport
+		Spans []contentSpan
+	}{r, r.spans()})
+}
+
+// runInspect implements the -inspect mode.
+func runInspect(path, corpusDir, htmlPath string, top int) error {
+	dict, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var corpus [][]byte
+	if corpusDir != "" {
+		corpus, err = samplers.Collect(os.DirFS(corpusDir), ".", samplers.Options{MaxSamples: 5000})
+		if err != nil {
+			return fmt.Errorf("reading corpus: %w", err)
+		}
+	}
+
+	r, err := inspectDict(path, dict, corpus, top)
+	if err != nil {
+		return err
+	}
+	r.writeText(os.Stdout)
+
+	if htmlPath == "" {
+		return nil
+	}
+	f, err := os.Create(htmlPath)
+	if err != nil {
+		return err
+	}
+	if err := r.writeHTML(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("\nHTML report written to %s\n", htmlPath)
+	return nil
+}
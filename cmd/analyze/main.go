@@ -7,23 +7,76 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
+	"time"
 
+	"github.com/paulstuart/zstd-dict/internal/baseline"
 	"github.com/paulstuart/zstd-dict/server"
 	"github.com/paulstuart/zstd-dict/zstddict"
 )
 
+// trainCount is how many samples dictionaries are trained on; the rest
+// are held out to measure them.
+const trainCount = 200
+
+// splitTrain draws trainCount samples at random for training and returns
+// them with the rest.
+func splitTrain(samples [][]byte) (train, test [][]byte) {
+	return zstddict.SplitSamples(samples, float64(trainCount)/float64(len(samples)), 1)
+}
+
 func main() {
 	sampleDir := flag.String("dir", "/usr/local", "Directory to sample")
 	numRequests := flag.Int("n", 100, "Simulate N requests")
 	realistic := flag.Bool("realistic", false, "Run realistic scenarios instead")
+	rtt := flag.Duration("rtt", 50*time.Millisecond, "Network round-trip time for the cost model")
+	bandwidth := flag.Float64("bandwidth", 100, "Network bandwidth in Mbit/s for the cost model")
+	costPerGB := flag.Float64("cost-per-gb", 0.09, "Data transfer cost in dollars per GB for the cost model")
+	fields := flag.Bool("fields", false, "Report per-field protobuf contributions to compressed size instead")
+	descriptor := flag.String("descriptor", "", "FileDescriptorSet for -fields (default: the FileListService protos)")
+	message := flag.String("message", "", "Full message name for -fields (default: filelist.ListFilesResponse)")
+	samplesPath := flag.String("samples", "", "File of length-delimited messages for -fields (default: generated from -dir)")
+	inspect := flag.String("inspect", "", "Report on the content of this dictionary file instead")
+	corpus := flag.String("corpus", "", "Directory of sample files to measure -inspect coverage against (optional)")
+	htmlPath := flag.String("html", "", "Also write the -inspect report as HTML to this file")
+	top := flag.Int("top", 30, "Number of tokens listed by -inspect")
+	cpu := flag.Bool("cpu", false, "Simulate concurrent compressing clients and report CPU per MB saved instead")
+	clients := flag.Int("clients", runtime.GOMAXPROCS(0), "Number of concurrent clients for -cpu")
 	flag.Parse()
 
+	if *inspect != "" {
+		if err := runInspect(*inspect, *corpus, *htmlPath, *top); err != nil {
+			fmt.Fprintf(os.Stderr, "Error inspecting dictionary: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *fields {
+		if err := runFieldAnalysis(*descriptor, *message, *samplesPath, *sampleDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error analyzing fields: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *cpu {
+		if err := runCPUSimulation(*sampleDir, *clients, *numRequests); err != nil {
+			fmt.Fprintf(os.Stderr, "Error simulating clients: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	model := newCostModel(*rtt, *bandwidth, *costPerGB)
+
 	if *realistic {
-		RunRealisticScenarios()
+		RunRealisticScenarios(model)
 		return
 	}
 
-	fmt.Println("=== Dictionary Compression Bandwidth Analysis ===\n")
+	fmt.Println("=== Dictionary Compression Bandwidth Analysis ===")
+	fmt.Println()
 
 	// Generate training samples
 	fmt.Printf("Generating samples from: %s\n", *sampleDir)
@@ -33,14 +86,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	if len(samples) < 100 {
-		fmt.Fprintf(os.Stderr, "Not enough samples (got %d, need 100+)\n", len(samples))
+	if len(samples) <= trainCount {
+		fmt.Fprintf(os.Stderr, "Not enough samples (got %d, need more than %d)\n", len(samples), trainCount)
 		os.Exit(1)
 	}
 
 	// Train dictionary
-	fmt.Printf("Training dictionary from %d samples...\n", len(samples))
-	dict, err := zstddict.TrainDict(samples[:200], &zstddict.TrainDictOptions{
+	trainSamples, testSamples := splitTrain(samples)
+	fmt.Printf("Training dictionary from %d samples...\n", len(trainSamples))
+	dict, err := zstddict.TrainDict(trainSamples, &zstddict.TrainDictOptions{
 		MaxDictSize: 16 * 1024, // 16KB max
 	})
 	if err != nil {
@@ -55,7 +109,6 @@ func main() {
 	compDict, _ := zstddict.New(zstddict.WithDictBytes(dict))
 
 	// Simulate requests
-	testSamples := samples[200:]
 	if len(testSamples) > *numRequests {
 		testSamples = testSamples[:*numRequests]
 	}
@@ -66,11 +119,18 @@ func main() {
 		totalZstd         int64
 		totalZstdDict     int64
 	)
+	baselines := baseline.Codecs()
+	totalBaseline := make([]int64, len(baselines))
+	costUncompressed := costRow{name: "Uncompressed"}
+	costGzip := costRow{name: "Gzip"}
+	costZstd := costRow{name: "Zstd"}
+	costDict := costRow{name: "Zstd+Dict"}
 
 	fmt.Printf("Simulating %d file listing requests...\n\n", len(testSamples))
 
 	for i, sample := range testSamples {
 		totalUncompressed += int64(len(sample))
+		costUncompressed.tally(model, len(sample))
 
 		// Gzip
 		var gzipBuf bytes.Buffer
@@ -78,14 +138,22 @@ func main() {
 		gw.Write(sample)
 		gw.Close()
 		totalGzip += int64(gzipBuf.Len())
+		costGzip.tally(model, gzipBuf.Len())
+
+		for j, codec := range baselines {
+			compressed, _ := codec.Compress(sample)
+			totalBaseline[j] += int64(len(compressed))
+		}
 
 		// Zstd plain
 		compressed, _ := compNone.Compress(sample)
 		totalZstd += int64(len(compressed))
+		costZstd.tally(model, len(compressed))
 
 		// Zstd with dict
 		compressedDict, _ := compDict.Compress(sample)
 		totalZstdDict += int64(len(compressedDict))
+		costDict.tally(model, len(compressedDict))
 
 		// Show progress every 20 requests
 		if (i+1)%20 == 0 {
@@ -101,11 +169,17 @@ func main() {
 	}
 
 	// Final summary
-	fmt.Println("=== Final Results ===\n")
+	fmt.Println("=== Final Results ===")
+	fmt.Println()
 	fmt.Printf("Total requests:       %d\n", len(testSamples))
 	fmt.Printf("Average message size: %d bytes\n\n", totalUncompressed/int64(len(testSamples)))
 
 	dictCostIncluded := totalZstdDict + int64(len(dict))
+	report, err := zstddict.EvaluateDict(dict, testSamples, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error evaluating dictionary: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Printf("Method          Total Bytes    Ratio    vs Uncompressed    vs Gzip    Break-even\n")
 	fmt.Println("------------------------------------------------------------------------------------")
@@ -114,6 +188,14 @@ func main() {
 		totalGzip,
 		float64(totalGzip)/float64(totalUncompressed)*100,
 		(totalUncompressed-totalGzip)/1024)
+	for j, codec := range baselines {
+		fmt.Printf("%-15s %11d    %.1f%%      %6d KB   %5d KB        -\n",
+			codec.Name,
+			totalBaseline[j],
+			float64(totalBaseline[j])/float64(totalUncompressed)*100,
+			(totalUncompressed-totalBaseline[j])/1024,
+			(totalGzip-totalBaseline[j])/1024)
+	}
 	fmt.Printf("Zstd            %11d    %.1f%%      %6d KB   %5d KB        -\n",
 		totalZstd,
 		float64(totalZstd)/float64(totalUncompressed)*100,
@@ -124,7 +206,7 @@ func main() {
 		float64(totalZstdDict)/float64(totalUncompressed)*100,
 		(totalUncompressed-totalZstdDict)/1024,
 		(totalGzip-totalZstdDict)/1024,
-		calculateBreakeven(dict, testSamples, compNone, compDict))
+		report.BreakEven)
 	fmt.Printf("(w/ dict cost)  %11d    %.1f%%      %6d KB   %5d KB\n\n",
 		dictCostIncluded,
 		float64(dictCostIncluded)/float64(totalUncompressed)*100,
@@ -136,83 +218,35 @@ func main() {
 	fmt.Printf("Average savings per request vs gzip: %d bytes (%.1f%%)\n",
 		avgSavingsVsGzip,
 		float64(avgSavingsVsGzip)/float64(totalGzip/int64(len(testSamples)))*100)
+	fmt.Println()
 
-	// Show size distribution
-	fmt.Println("\n=== Message Size Distribution ===\n")
-	showSizeDistribution(testSamples, compNone, compDict)
-}
-
-func calculateBreakeven(dict []byte, samples [][]byte, compNone, compDict *zstddict.Compressor) int {
-	dictCost := len(dict)
-	cumulativeSavings := 0
+	printNetworkCost(model, len(testSamples),
+		[]costRow{costUncompressed, costGzip, costZstd, costDict}, costZstd, costDict, len(dict))
 
-	for i, sample := range samples {
-		plain, _ := compNone.Compress(sample)
-		withDict, _ := compDict.Compress(sample)
-		savings := len(plain) - len(withDict)
-		cumulativeSavings += savings
-
-		if cumulativeSavings >= dictCost {
-			return i + 1
-		}
-	}
-	return -1 // Never breaks even
+	// Show size distribution
+	fmt.Println("\n=== Message Size Distribution ===")
+	fmt.Println()
+	showSizeDistribution(report)
 }
 
-func showSizeDistribution(samples [][]byte, compNone, compDict *zstddict.Compressor) {
-	// Categorize by original size
-	type bucket struct {
-		minSize, maxSize int
-		count            int
-		totalOrig        int64
-		totalZstd        int64
-		totalDict        int64
-	}
-
-	buckets := []bucket{
-		{0, 1000, 0, 0, 0, 0},
-		{1000, 5000, 0, 0, 0, 0},
-		{5000, 10000, 0, 0, 0, 0},
-		{10000, 50000, 0, 0, 0, 0},
-		{50000, 1000000, 0, 0, 0, 0},
-	}
-
-	for _, sample := range samples {
-		size := len(sample)
-		plain, _ := compNone.Compress(sample)
-		withDict, _ := compDict.Compress(sample)
-
-		for i := range buckets {
-			if size >= buckets[i].minSize && size < buckets[i].maxSize {
-				buckets[i].count++
-				buckets[i].totalOrig += int64(size)
-				buckets[i].totalZstd += int64(len(plain))
-				buckets[i].totalDict += int64(len(withDict))
-				break
-			}
-		}
-	}
-
+func showSizeDistribution(report *zstddict.EvalReport) {
 	fmt.Printf("Size Range         Count   Zstd Ratio   Dict Ratio   Improvement\n")
 	fmt.Println("------------------------------------------------------------------")
-	for _, b := range buckets {
-		if b.count == 0 {
+	for _, b := range report.Buckets {
+		if b.Count == 0 {
 			continue
 		}
-		zstdRatio := float64(b.totalZstd) / float64(b.totalOrig) * 100
-		dictRatio := float64(b.totalDict) / float64(b.totalOrig) * 100
-		improvement := zstdRatio - dictRatio
 
 		var rangeStr string
-		if b.maxSize >= 1000000 {
-			rangeStr = fmt.Sprintf("%5dK+", b.minSize/1024)
-		} else if b.minSize >= 1000 {
-			rangeStr = fmt.Sprintf("%2dK-%2dK", b.minSize/1024, b.maxSize/1024)
+		if b.Max >= 1000000 {
+			rangeStr = fmt.Sprintf("%5dK+", b.Min/1024)
+		} else if b.Min >= 1000 {
+			rangeStr = fmt.Sprintf("%2dK-%2dK", b.Min/1024, b.Max/1024)
 		} else {
-			rangeStr = fmt.Sprintf("%4d-%4d", b.minSize, b.maxSize)
+			rangeStr = fmt.Sprintf("%4d-%4d", b.Min, b.Max)
 		}
 
 		fmt.Printf("%-15s %7d      %5.1f%%      %5.1f%%      %+5.1f%%\n",
-			rangeStr, b.count, zstdRatio, dictRatio, improvement)
+			rangeStr, b.Count, b.PlainRatio()*100, b.DictRatio()*100, b.Improvement())
 	}
 }
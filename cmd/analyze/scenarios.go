@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/paulstuart/zstd-dict/internal/baseline"
 	"github.com/paulstuart/zstd-dict/zstddict"
 )
 
@@ -20,7 +21,7 @@ type MetricsPayload struct {
 	Tags        map[string]string `json:"tags"`
 }
 
-func RunRealisticScenarios() {
+func RunRealisticScenarios(model costModel) {
 	scenarios := []struct {
 		name        string
 		generator   func(int) [][]byte
@@ -52,9 +53,9 @@ func RunRealisticScenarios() {
 		// Generate samples
 		samples := scenario.generator(1000)
 
-		// Train dictionary on first 20% of samples
-		trainingSet := samples[:200]
-		testSet := samples[200:500] // Use 300 for testing
+		// Train dictionary on 20% of samples
+		trainingSet, testSet := zstddict.SplitSamples(samples, 0.2, 1)
+		testSet = testSet[:300] // Use 300 for testing
 
 		dict, err := zstddict.TrainDict(trainingSet, &zstddict.TrainDictOptions{
 			MaxDictSize: 2048, // 2KB dictionary
@@ -68,20 +69,27 @@ func RunRealisticScenarios() {
 		compDict, _ := zstddict.New(zstddict.WithDictBytes(dict))
 
 		// Analyze
-		analyzeScenario(testSet, dict, compNone, compDict)
+		analyzeScenario(model, testSet, dict, compNone, compDict)
 	}
 }
 
-func analyzeScenario(samples [][]byte, dict []byte, compNone, compDict *zstddict.Compressor) {
+func analyzeScenario(model costModel, samples [][]byte, dict []byte, compNone, compDict *zstddict.Compressor) {
 	var (
 		totalOrig int64
 		totalGzip int64
 		totalZstd int64
 		totalDict int64
 	)
+	baselines := baseline.Codecs()
+	totalBaseline := make([]int64, len(baselines))
+	costOrig := costRow{name: "Uncompressed"}
+	costGzip := costRow{name: "Gzip"}
+	costZstd := costRow{name: "Zstd"}
+	costDict := costRow{name: "Zstd+Dict"}
 
 	for _, sample := range samples {
 		totalOrig += int64(len(sample))
+		costOrig.tally(model, len(sample))
 
 		// Gzip
 		var gzipBuf bytes.Buffer
@@ -89,14 +97,22 @@ func analyzeScenario(samples [][]byte, dict []byte, compNone, compDict *zstddict
 		gw.Write(sample)
 		gw.Close()
 		totalGzip += int64(gzipBuf.Len())
+		costGzip.tally(model, gzipBuf.Len())
+
+		for j, codec := range baselines {
+			compressed, _ := codec.Compress(sample)
+			totalBaseline[j] += int64(len(compressed))
+		}
 
 		// Zstd
 		compressed, _ := compNone.Compress(sample)
 		totalZstd += int64(len(compressed))
+		costZstd.tally(model, len(compressed))
 
 		// Zstd+Dict
 		compressedDict, _ := compDict.Compress(sample)
 		totalDict += int64(len(compressedDict))
+		costDict.tally(model, len(compressedDict))
 	}
 
 	avgSize := totalOrig / int64(len(samples))
@@ -110,6 +126,10 @@ func analyzeScenario(samples [][]byte, dict []byte, compNone, compDict *zstddict
 	fmt.Printf("  Uncompressed:  %7d KB  (100.0%%)\n", totalOrig/1024)
 	fmt.Printf("  Gzip:          %7d KB   (%.1f%%)\n",
 		totalGzip/1024, float64(totalGzip)/float64(totalOrig)*100)
+	for j, codec := range baselines {
+		fmt.Printf("  %-14s %7d KB   (%.1f%%)\n", codec.Name+":",
+			totalBaseline[j]/1024, float64(totalBaseline[j])/float64(totalOrig)*100)
+	}
 	fmt.Printf("  Zstd:          %7d KB   (%.1f%%)\n",
 		totalZstd/1024, float64(totalZstd)/float64(totalOrig)*100)
 	fmt.Printf("  Zstd+Dict:     %7d KB   (%.1f%%)  ← %d bytes better/msg\n\n",
@@ -126,6 +146,9 @@ func analyzeScenario(samples [][]byte, dict []byte, compNone, compDict *zstddict
 	fmt.Printf("  After %d msgs:     %.1f KB saved vs zstd\n\n",
 		len(samples), float64(totalZstd-dictCostIncluded)/1024)
 
+	printNetworkCost(model, len(samples),
+		[]costRow{costOrig, costGzip, costZstd, costDict}, costZstd, costDict, len(dict))
+
 	// Bandwidth savings for different request volumes
 	fmt.Printf("Cumulative Bandwidth Savings (vs Zstd):\n")
 	volumes := []int{100, 1000, 10000, 100000}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/server"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func runHTTP(args []string) {
+	fs := flag.NewFlagSet("http", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "HTTP listen address")
+	dictPath := fs.String("dict", "", "Path to dictionary file (optional)")
+	fs.Parse(args)
+
+	var dict []byte
+	if *dictPath != "" {
+		var err error
+		dict, err = os.ReadFile(*dictPath)
+		if err != nil {
+			log.Fatalf("Failed to load dictionary: %v", err)
+		}
+		log.Printf("Loaded dictionary: %s (%d bytes)", *dictPath, len(dict))
+	}
+
+	zh, err := newZstdHandler(http.HandlerFunc(serveFiles), dict)
+	if err != nil {
+		log.Fatalf("Failed to create compressors: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /files", zh)
+	mux.HandleFunc("POST /admin/level", zh.setLevel)
+	if dict != nil {
+		mux.HandleFunc("GET /dict", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(dict)
+		})
+	}
+
+	log.Printf("HTTP server listening on %s", *addr)
+	log.Printf("Try: curl -s -H 'Accept-Encoding: zstd-dict' 'http://localhost%s/files?path=.' | zstd -d -D %s", *addr, cmp.Or(*dictPath, "my.dict"))
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+// serveFiles serves ListFiles as JSON: GET /files?path=dir&depth=n.
+func serveFiles(w http.ResponseWriter, r *http.Request) {
+	req := &pb.ListFilesRequest{Path: r.URL.Query().Get("path")}
+	if d := r.URL.Query().Get("depth"); d != "" {
+		depth, err := strconv.Atoi(d)
+		if err != nil {
+			http.Error(w, "invalid depth", http.StatusBadRequest)
+			return
+		}
+		req.MaxDepth = int32(depth)
+	}
+
+	resp, err := server.New().ListFiles(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := protojson.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// zstdHandler compresses responses according to Accept-Encoding,
+// preferring zstd-dict, then zstd, then gzip. zstd-dict is not a registered
+// content coding: clients opt in explicitly and decode with the dictionary
+// served at /dict, whose ID is sent in Zstd-Dict-Id.
+type zstdHandler struct {
+	next   http.Handler
+	plain  *zstddict.Compressor
+	dict   *zstddict.Compressor // nil without a dictionary
+	dictID string
+}
+
+func newZstdHandler(next http.Handler, dict []byte) (*zstdHandler, error) {
+	h := &zstdHandler{next: next}
+	var err error
+	if h.plain, err = zstddict.New(); err != nil {
+		return nil, err
+	}
+	if dict != nil {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, err
+		}
+		if h.dict, err = zstddict.New(zstddict.WithDictBytes(dict)); err != nil {
+			return nil, err
+		}
+		h.dictID = strconv.FormatUint(uint64(d.ID()), 10)
+	}
+	return h, nil
+}
+
+func (h *zstdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &bufferedResponse{header: w.Header(), status: http.StatusOK}
+	h.next.ServeHTTP(rec, r)
+
+	body := rec.buf.Bytes()
+	encoding := h.negotiate(r.Header.Get("Accept-Encoding"))
+	w.Header().Add("Vary", "Accept-Encoding")
+	if rec.status == http.StatusOK && encoding != "" {
+		var out []byte
+		var err error
+		switch encoding {
+		case "zstd-dict":
+			out, err = h.dict.Compress(body)
+			w.Header().Set("Zstd-Dict-Id", h.dictID)
+		case "zstd":
+			out, err = h.plain.Compress(body)
+		case "gzip":
+			var gz bytes.Buffer
+			zw := gzip.NewWriter(&gz)
+			zw.Write(body)
+			err = zw.Close()
+			out = gz.Bytes()
+		}
+		if err == nil {
+			log.Printf("%s %s: %d bytes, %s %d bytes", r.Method, r.URL, len(body), encoding, len(out))
+			w.Header().Set("Content-Encoding", encoding)
+			body = out
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rec.status)
+	w.Write(body)
+}
+
+// setLevel switches the zstd encoder level at runtime:
+// POST /admin/level?level=fastest|default|better|best.
+func (h *zstdHandler) setLevel(w http.ResponseWriter, r *http.Request) {
+	ok, level := zstd.EncoderLevelFromString(r.URL.Query().Get("level"))
+	if !ok {
+		http.Error(w, "level must be fastest, default, better or best", http.StatusBadRequest)
+		return
+	}
+	for _, c := range []*zstddict.Compressor{h.plain, h.dict} {
+		if c == nil {
+			continue
+		}
+		if err := c.SetLevel(level); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Printf("Encoder level set to %s", level)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// negotiate picks the best encoding listed in an Accept-Encoding header, or
+// "" for identity. Quality values are ignored except q=0.
+func (h *zstdHandler) negotiate(accept string) string {
+	offered := map[string]bool{}
+	for part := range strings.SplitSeq(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(params, " ", "") == "q=0" {
+			continue
+		}
+		offered[strings.ToLower(name)] = true
+	}
+	switch {
+	case h.dict != nil && offered["zstd-dict"]:
+		return "zstd-dict"
+	case offered["zstd"]:
+		return "zstd"
+	case offered["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// bufferedResponse collects a response so it can be compressed whole.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.buf.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
@@ -3,20 +3,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/benchx"
 	"github.com/paulstuart/zstd-dict/client"
 	"github.com/paulstuart/zstd-dict/grpccodec"
+	"github.com/paulstuart/zstd-dict/internal/baseline"
+	"github.com/paulstuart/zstd-dict/samplers"
 	"github.com/paulstuart/zstd-dict/server"
 	"github.com/paulstuart/zstd-dict/zstddict"
-	pb "github.com/paulstuart/zstd-dict/proto/filelist"
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/encoding/gzip"
+	grpcstats "google.golang.org/grpc/stats"
 )
 
 func main() {
@@ -37,6 +44,12 @@ func main() {
 		runTrain(args)
 	case "bench":
 		runBench(args)
+	case "http":
+		runHTTP(args)
+	case "convert":
+		runConvert(args)
+	case "corpus":
+		runCorpus(args)
 	default:
 		printUsage()
 		os.Exit(1)
@@ -50,7 +63,10 @@ Commands:
   server    Start the gRPC server
   client    Query the server for directory listing
   train     Generate a dictionary from sample data
-  bench     Run compression benchmarks
+  bench     Run compression benchmarks (bench matrix: levels x dictionary sizes)
+  http      Serve the file listing as REST/JSON with zstd-dict compression
+  convert   Convert a dictionary between raw content and structured zstd formats
+  corpus    Report statistics for a training corpus (corpus stats)
 
 Run 'demo <command> -h' for command-specific options.`)
 }
@@ -59,18 +75,18 @@ func runServer(args []string) {
 	fs := flag.NewFlagSet("server", flag.ExitOnError)
 	addr := fs.String("addr", ":50051", "Server address")
 	dictPath := fs.String("dict", "", "Path to dictionary file (optional)")
+	dictURL := fs.String("dict-url", "", "URL clients can fetch the dictionary from, reported on dictionary mismatches")
+	debugAddr := fs.String("debug-addr", "", "Address to serve /debug/zstd connection stats and /dict on (optional)")
 	fs.Parse(args)
 
-	// Register compressors
+	var dict []byte
 	if *dictPath != "" {
-		dict, err := os.ReadFile(*dictPath)
+		var err error
+		dict, err = os.ReadFile(*dictPath)
 		if err != nil {
 			log.Fatalf("Failed to load dictionary: %v", err)
 		}
-		grpccodec.Register(dict)
 		log.Printf("Loaded dictionary: %s (%d bytes)", *dictPath, len(dict))
-	} else {
-		grpccodec.Register(nil)
 	}
 
 	lis, err := net.Listen("tcp", *addr)
@@ -78,8 +94,35 @@ func runServer(args []string) {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterFileListServiceServer(s, server.New())
+	mon := new(grpccodec.ConnMonitor)
+	if *debugAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/zstd", mon)
+		if dict != nil {
+			mux.HandleFunc("/dict", func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write(dict)
+			})
+		}
+		go func() {
+			log.Printf("Debug endpoint on http://%s/debug/zstd", *debugAddr)
+			if err := http.ListenAndServe(*debugAddr, mux); err != nil {
+				log.Printf("Debug endpoint failed: %v", err)
+			}
+		}()
+	}
+
+	// Accept the baseline compressors used by the bench command.
+	baseline.RegisterGRPC()
+
+	s, err := server.NewGRPCServer(server.Options{
+		Dict:          dict,
+		DictURL:       *dictURL,
+		StatsHandlers: []grpcstats.Handler{mon},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
 
 	log.Printf("Server listening on %s", *addr)
 	if err := s.Serve(lis); err != nil {
@@ -92,8 +135,12 @@ func runClient(args []string) {
 	addr := fs.String("addr", "localhost:50051", "Server address")
 	path := fs.String("path", ".", "Directory to list")
 	depth := fs.Int("depth", 0, "Max recursion depth (0 = unlimited)")
-	compressor := fs.String("compress", "", "Compressor: zstd, zstd-dict, gzip, or empty for none")
+	compressor := fs.String("compress", "", "Compressor: zstd, zstd-dict, gzip, snappy (lz4, br with build tags), or empty for none")
 	dictPath := fs.String("dict", "", "Path to dictionary file (for zstd-dict)")
+	dictURL := fs.String("dict-url", "", "URL to download and cache the server's dictionary from (for zstd-dict)")
+	dictID := fs.Uint("dict-id", 0, "Expected dictionary ID; a cached copy is used when present")
+	record := fs.String("record", "", "Directory to record responses in for -replay")
+	replay := fs.String("replay", "", "Directory of recorded responses to serve instead of querying the server")
 	fs.Parse(args)
 
 	// Register compressors if using zstd
@@ -106,13 +153,22 @@ func runClient(args []string) {
 				log.Fatalf("Failed to load dictionary: %v", err)
 			}
 		}
-		grpccodec.Register(dict)
+		if err := grpccodec.RegisterWithConfig(grpccodec.Config{Dict: dict}); err != nil {
+			log.Fatalf("Failed to register compressors: %v", err)
+		}
 	}
 
-	c, err := client.New(client.Options{
+	opts := client.Options{
 		Address:    *addr,
 		Compressor: *compressor,
-	})
+		Record:     *record,
+		Replay:     *replay,
+	}
+	if *dictURL != "" {
+		opts.Dict = &client.DictSource{URL: *dictURL, ID: uint32(*dictID)}
+	}
+	baseline.RegisterGRPC()
+	c, err := client.New(opts)
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
@@ -122,6 +178,14 @@ func runClient(args []string) {
 	defer cancel()
 
 	resp, stats, err := c.ListFilesWithStats(ctx, *path, int32(*depth))
+	var de *grpccodec.DecodeError
+	if errors.As(err, &de) && errors.Is(err, zstddict.ErrDictMismatch) {
+		hint := "retrain or obtain the server's dictionary"
+		if de.DictURL != "" {
+			hint = "fetch it from " + de.DictURL
+		}
+		log.Fatalf("Dictionary mismatch: server has dictionary %d, request used %d; %s", de.LocalDictID, de.FrameDictID, hint)
+	}
 	if err != nil {
 		log.Fatalf("ListFiles failed: %v", err)
 	}
@@ -129,6 +193,10 @@ func runClient(args []string) {
 	fmt.Printf("Root: %s\n", resp.Root)
 	fmt.Printf("Files: %d\n", resp.TotalCount)
 	fmt.Printf("Duration: %v\n", stats.Duration)
+	if stats.Compressor != "" {
+		fmt.Printf("Server compression: %s (dict %d), %d bytes uncompressed, %v\n",
+			stats.Compressor, stats.DictID, stats.UncompressedSize, stats.ServerCompressTime)
+	}
 	fmt.Println()
 
 	// Print first 20 files
@@ -153,6 +221,7 @@ func runTrain(args []string) {
 	fs := flag.NewFlagSet("train", flag.ExitOnError)
 	output := fs.String("o", "filelist.dict", "Output dictionary file")
 	maxSize := fs.Int("size", 32*1024, "Maximum dictionary size in bytes")
+	sweep := fs.String("sweep", "", "Comma-separated dictionary sizes to compare on held-out samples, writing the best (overrides -size)")
 	fs.Parse(args)
 
 	dirs := fs.Args()
@@ -178,11 +247,31 @@ func runTrain(args []string) {
 		log.Fatalf("Not enough samples for training (need at least 10, got %d)", len(samples))
 	}
 
-	dict, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{
-		MaxDictSize: *maxSize,
-	})
-	if err != nil {
-		log.Fatalf("Failed to train dictionary: %v", err)
+	var dict []byte
+	if *sweep != "" {
+		var opts zstddict.TrainBestOptions
+		for sz := range strings.SplitSeq(*sweep, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(sz))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid dictionary size %q", sz)
+			}
+			opts.Sizes = append(opts.Sizes, n)
+		}
+		res, err := zstddict.TrainBest(samples, &opts)
+		if err != nil {
+			log.Fatalf("Failed to train dictionary: %v", err)
+		}
+		fmt.Printf("Trained on %d samples, evaluated on %d:\n\n", res.TrainSamples, res.HoldoutSamples)
+		res.WriteText(os.Stdout)
+		fmt.Println()
+		dict = res.Dict()
+	} else {
+		dict, err = zstddict.TrainDict(samples, &zstddict.TrainDictOptions{
+			MaxDictSize: *maxSize,
+		})
+		if err != nil {
+			log.Fatalf("Failed to train dictionary: %v", err)
+		}
 	}
 
 	if err := os.WriteFile(*output, dict, 0644); err != nil {
@@ -192,13 +281,114 @@ func runTrain(args []string) {
 	log.Printf("Dictionary written to %s (%d bytes)", *output, len(dict))
 }
 
+func runConvert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := fs.String("to", "structured", "Target format: raw or structured")
+	corpusDir := fs.String("corpus", "", "Directory of sample files for building entropy tables (required for raw to structured)")
+	id := fs.Uint("id", 0, "Dictionary ID for structured output (default: derived from the content)")
+	output := fs.String("o", "", "Output dictionary file (required)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *output == "" {
+		log.Fatal("Usage: demo convert -to raw|structured [-corpus dir] [-id n] -o out.dict in.dict")
+	}
+	var format zstddict.DictFormat
+	switch *to {
+	case "raw":
+		format = zstddict.FormatRaw
+	case "structured":
+		format = zstddict.FormatStructured
+	default:
+		log.Fatalf("Unknown format %q: want raw or structured", *to)
+	}
+
+	dict, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to load dictionary: %v", err)
+	}
+	opts := &zstddict.ConvertDictOptions{ID: uint32(*id)}
+	if *corpusDir != "" {
+		opts.Corpus, err = samplers.Collect(os.DirFS(*corpusDir), ".", samplers.Options{})
+		if err != nil {
+			log.Fatalf("Failed to read corpus: %v", err)
+		}
+		log.Printf("Read %d corpus samples from %s", len(opts.Corpus), *corpusDir)
+	}
+
+	out, err := zstddict.ConvertDict(dict, format, opts)
+	if err != nil {
+		log.Fatalf("Failed to convert dictionary: %v", err)
+	}
+	if err := os.WriteFile(*output, out, 0644); err != nil {
+		log.Fatalf("Failed to write dictionary: %v", err)
+	}
+	log.Printf("Converted %s dictionary %s (%d bytes) to %s %s (%d bytes)",
+		zstddict.DetectDictFormat(dict), fs.Arg(0), len(dict), format, *output, len(out))
+}
+
+func runCorpus(args []string) {
+	if len(args) == 0 || args[0] != "stats" {
+		log.Fatal("Usage: demo corpus stats [-lines] [-format f] [-max n] [dir ...]")
+	}
+	fs := flag.NewFlagSet("corpus stats", flag.ExitOnError)
+	lines := fs.Bool("lines", false, "Treat each line as a sample instead of each file")
+	format := fs.String("format", "", "Sample format: har (response bodies), access-log (last quoted field), or json:<field> (JSON-lines field)")
+	maxSamples := fs.Int("max", 0, "Maximum number of samples, chosen at random (0 = all)")
+	fs.Parse(args[1:])
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	opts := samplers.Options{MaxSamples: *maxSamples}
+	if *lines {
+		opts.Extract = samplers.Lines
+	}
+	switch field, isJSON := strings.CutPrefix(*format, "json:"); {
+	case *format == "":
+	case *format == "har":
+		opts.Extract = samplers.HAR
+	case *format == "access-log":
+		opts.Extract = samplers.AccessLogBody(-1)
+	case isJSON && field != "":
+		opts.Extract = samplers.JSONLogField(field)
+	default:
+		log.Fatalf("Unknown sample format %q", *format)
+	}
+	var samples [][]byte
+	for _, dir := range dirs {
+		s, err := samplers.Collect(os.DirFS(dir), ".", opts)
+		if err != nil {
+			log.Fatalf("Failed to collect samples from %s: %v", dir, err)
+		}
+		samples = append(samples, s...)
+	}
+
+	st := samplers.AnalyzeCorpus(samples)
+	fmt.Printf("Samples:          %d (%d bytes)\n", st.Samples, st.TotalBytes)
+	fmt.Printf("Duplicates:       %d (%.1f%%)\n", st.Duplicates, st.DuplicateRate*100)
+	fmt.Printf("Sizes:            min %d, median %d, mean %.0f, p90 %d, p99 %d, max %d\n",
+		st.MinSize, st.MedianSize, st.MeanSize, st.P90Size, st.P99Size, st.MaxSize)
+	fmt.Printf("Entropy:          %.2f bits/byte\n", st.Entropy)
+	fmt.Printf("Self redundancy:  %.1f%%\n", st.SelfRedundancy*100)
+	fmt.Printf("Cross redundancy: %.1f%%\n", st.CrossRedundancy*100)
+}
+
 func runBench(args []string) {
+	if len(args) > 0 && args[0] == "matrix" {
+		runBenchMatrix(args[1:])
+		return
+	}
 	fs := flag.NewFlagSet("bench", flag.ExitOnError)
 	addr := fs.String("addr", "localhost:50051", "Server address")
 	path := fs.String("path", ".", "Directory to list")
 	depth := fs.Int("depth", 0, "Max recursion depth")
 	dictPath := fs.String("dict", "", "Path to dictionary file")
 	iterations := fs.Int("n", 10, "Number of iterations per compressor")
+	record := fs.String("record", "", "Directory to record responses in for -replay")
+	replay := fs.String("replay", "", "Directory of recorded responses to benchmark against instead of the server")
+	emulateRTT := fs.Duration("emulate-rtt", 0, "Emulated network round-trip time added to each call")
+	emulateBandwidth := fs.Float64("emulate-bandwidth", 0, "Emulated network bandwidth in Mbit/s (0 = unlimited)")
 	fs.Parse(args)
 
 	// Load dictionary if provided
@@ -212,16 +402,27 @@ func runBench(args []string) {
 	}
 
 	// Register all compressors
-	grpccodec.Register(dict)
+	if err := grpccodec.RegisterWithConfig(grpccodec.Config{Dict: dict}); err != nil {
+		log.Fatalf("Failed to register compressors: %v", err)
+	}
 	_ = gzip.Name // Ensure gzip is registered
+	baseline.RegisterGRPC()
 
-	compressors := []string{"", "gzip", "zstd"}
+	compressors := []string{"", "gzip"}
+	for _, codec := range baseline.Codecs() {
+		compressors = append(compressors, codec.Name)
+	}
+	compressors = append(compressors, "zstd")
 	if dict != nil {
 		compressors = append(compressors, "zstd-dict")
 	}
 
-	fmt.Printf("Benchmarking %d iterations for path: %s\n\n", *iterations, *path)
-	fmt.Printf("%-12s %10s %10s %10s\n", "Compressor", "Avg(ms)", "Min(ms)", "Max(ms)")
+	fmt.Printf("Benchmarking %d iterations for path: %s\n", *iterations, *path)
+	if *emulateRTT > 0 || *emulateBandwidth > 0 {
+		fmt.Printf("Emulated network: RTT %v, bandwidth %s\n", *emulateRTT, mbpsString(*emulateBandwidth))
+	}
+	fmt.Println()
+	fmt.Printf("%-12s %10s %10s %10s %10s\n", "Compressor", "Avg(ms)", "Min(ms)", "Max(ms)", "Rx KB/req")
 	fmt.Println(string(make([]byte, 50)))
 
 	for _, comp := range compressors {
@@ -230,9 +431,13 @@ func runBench(args []string) {
 			name = "none"
 		}
 
+		link := &netem{rtt: *emulateRTT, bytesPerSec: *emulateBandwidth * 1e6 / 8}
 		c, err := client.New(client.Options{
-			Address:    *addr,
-			Compressor: comp,
+			Address:     *addr,
+			Compressor:  comp,
+			Record:      *record,
+			Replay:      *replay,
+			DialOptions: link.dialOptions(),
 		})
 		if err != nil {
 			log.Printf("%-12s failed to connect: %v", name, err)
@@ -264,11 +469,88 @@ func runBench(args []string) {
 		c.Close()
 
 		avg := total / time.Duration(*iterations)
-		fmt.Printf("%-12s %10.2f %10.2f %10.2f\n",
+		fmt.Printf("%-12s %10.2f %10.2f %10.2f %10.1f\n",
 			name,
 			float64(avg.Microseconds())/1000,
 			float64(minD.Microseconds())/1000,
 			float64(maxD.Microseconds())/1000,
+			float64(link.read.Load())/1024/float64(*iterations),
 		)
 	}
 }
+
+// mbpsString formats a bandwidth flag, where 0 means unlimited.
+func mbpsString(mbps float64) string {
+	if mbps <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(mbps, 'g', -1, 64) + " Mbit/s"
+}
+
+func runBenchMatrix(args []string) {
+	fs := flag.NewFlagSet("bench matrix", flag.ExitOnError)
+	levels := fs.String("levels", "fastest,default,better,best", "Comma-separated encoder levels")
+	sizes := fs.String("sizes", "0,1024,4096,16384,65536", "Comma-separated dictionary sizes in bytes (0 = no dictionary)")
+	lines := fs.Bool("lines", false, "Treat each line as a sample instead of each file")
+	maxSamples := fs.Int("max", 0, "Maximum number of samples, chosen at random (0 = all)")
+	rounds := fs.Int("rounds", 3, "Compression rounds per cell")
+	htmlOut := fs.String("html", "", "Also write an HTML heatmap to this file")
+	fs.Parse(args)
+
+	var opts benchx.MatrixOptions
+	for l := range strings.SplitSeq(*levels, ",") {
+		ok, level := zstd.EncoderLevelFromString(strings.TrimSpace(l))
+		if !ok {
+			log.Fatalf("Unknown encoder level %q", l)
+		}
+		opts.Levels = append(opts.Levels, level)
+	}
+	for sz := range strings.SplitSeq(*sizes, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(sz))
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid dictionary size %q", sz)
+		}
+		opts.DictSizes = append(opts.DictSizes, n)
+	}
+	opts.Rounds = *rounds
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	// Shuffled so the training and measured halves are drawn alike.
+	sopts := samplers.Options{MaxSamples: *maxSamples, Shuffle: true}
+	if *lines {
+		sopts.Extract = samplers.Lines
+	}
+	var samples [][]byte
+	for _, dir := range dirs {
+		s, err := samplers.Collect(os.DirFS(dir), ".", sopts)
+		if err != nil {
+			log.Fatalf("Failed to collect samples from %s: %v", dir, err)
+		}
+		samples = append(samples, s...)
+	}
+
+	m, err := benchx.RunMatrix(samples, opts)
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
+	}
+	fmt.Printf("%d samples, %d measured\n\n", len(samples), m.Samples)
+	if err := m.WriteText(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if *htmlOut != "" {
+		f, err := os.Create(*htmlOut)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := m.WriteHTML(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote heatmap to %s", *htmlOut)
+	}
+}
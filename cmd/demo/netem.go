@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// netem emulates a slower network for bench: every call waits one round
+// trip, and the connection's bytes are paced at the emulated bandwidth in
+// each direction. It ignores TCP slow start, so large responses on high
+// latency links fare somewhat better than they would in reality.
+type netem struct {
+	rtt         time.Duration
+	bytesPerSec float64 // 0 means unlimited
+
+	// read and written count the bytes crossing the emulated link.
+	read, written atomic.Int64
+}
+
+// dialOptions returns the dial options routing a client through n.
+func (n *netem) dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return &shapedConn{Conn: conn, n: n}, nil
+		}),
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			time.Sleep(n.rtt)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+	}
+}
+
+// pace sleeps for the time size bytes take to cross the link.
+func (n *netem) pace(size int) {
+	if n.bytesPerSec > 0 && size > 0 {
+		time.Sleep(time.Duration(float64(size) / n.bytesPerSec * float64(time.Second)))
+	}
+}
+
+// shapedConn paces a connection's reads and writes through a netem.
+type shapedConn struct {
+	net.Conn
+	n *netem
+}
+
+func (c *shapedConn) Read(p []byte) (int, error) {
+	k, err := c.Conn.Read(p)
+	c.n.read.Add(int64(k))
+	c.n.pace(k)
+	return k, err
+}
+
+func (c *shapedConn) Write(p []byte) (int, error) {
+	c.n.pace(len(p))
+	k, err := c.Conn.Write(p)
+	c.n.written.Add(int64(k))
+	return k, err
+}
@@ -0,0 +1,138 @@
+// Command dictembed generates a Go file that embeds a zstd dictionary, so
+// binaries can ship their dictionary without depending on files at run
+// time. It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/paulstuart/zstd-dict/cmd/dictembed -dict files.dict -version 2024-06
+//
+// The generated file embeds the dictionary with go:embed and declares
+// typed accessors. With the default -name of Dict:
+//
+//	func Dict() []byte        // a copy of the dictionary
+//	const DictID uint32       // the dictionary ID, 0 for raw content
+//	const DictVersion string  // the -version flag
+//	const DictSize int        // the dictionary size in bytes
+//
+// go:embed only reaches files in the package directory or below, so the
+// dictionary must live there.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by dictembed; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	_ "embed"
+)
+
+//go:embed {{printf "%q" .Path}}
+var {{.Var}} []byte
+
+// {{.Name}}ID is the ID of the embedded {{.Format}} dictionary, 0 for raw content.
+const {{.Name}}ID uint32 = {{.ID}}
+
+// {{.Name}}Version identifies the embedded dictionary's release.
+const {{.Name}}Version = {{printf "%q" .Version}}
+
+// {{.Name}}Size is the size of the embedded dictionary in bytes.
+const {{.Name}}Size = {{.Size}}
+
+// {{.Name}} returns a copy of the dictionary embedded from {{printf "%q" .Path}}.
+func {{.Name}}() []byte {
+	return bytes.Clone({{.Var}})
+}
+`))
+
+func main() {
+	dictPath := flag.String("dict", "", "Dictionary file to embed (required)")
+	out := flag.String("o", "", "Output file (default: <dict name>_dict.go next to the dictionary)")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "Package name (default: $GOPACKAGE, set by go generate)")
+	name := flag.String("name", "Dict", "Exported name for the accessor; constants are prefixed with it")
+	version := flag.String("version", "", "Version string recorded as <name>Version")
+	flag.Parse()
+
+	if err := run(*dictPath, *out, *pkg, *name, *version); err != nil {
+		fmt.Fprintf(os.Stderr, "dictembed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dictPath, out, pkg, name, version string) error {
+	if dictPath == "" {
+		return fmt.Errorf("-dict is required")
+	}
+	if pkg == "" {
+		return fmt.Errorf("-pkg is required outside go generate")
+	}
+	if !token.IsIdentifier(name) || !token.IsExported(name) {
+		return fmt.Errorf("-name %q is not an exported Go identifier", name)
+	}
+	if out == "" {
+		base := strings.TrimSuffix(filepath.Base(dictPath), filepath.Ext(dictPath))
+		out = filepath.Join(filepath.Dir(dictPath), strings.ReplaceAll(base, ".", "_")+"_dict.go")
+	}
+
+	// go:embed paths are relative to the generated file's directory and
+	// may not leave it. The template quotes the path, so names with
+	// spaces or other special characters embed the right file.
+	rel, err := filepath.Rel(filepath.Dir(out), dictPath)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("%s is outside the output directory; go:embed can't reach it", dictPath)
+	}
+
+	dict, err := os.ReadFile(dictPath)
+	if err != nil {
+		return err
+	}
+	if len(dict) == 0 {
+		return fmt.Errorf("%s is empty", dictPath)
+	}
+	dictFormat := zstddict.DetectDictFormat(dict)
+	var id uint32
+	if dictFormat == zstddict.FormatStructured {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dictPath, err)
+		}
+		id = d.ID()
+	}
+
+	var buf bytes.Buffer
+	err = fileTemplate.Execute(&buf, map[string]any{
+		"Package": pkg,
+		"Path":    rel,
+		"Name":    name,
+		"Var":     strings.ToLower(name[:1]) + name[1:] + "Bytes",
+		"Format":  dictFormat,
+		"ID":      id,
+		"Version": version,
+		"Size":    len(dict),
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	return os.WriteFile(out, src, 0o644)
+}
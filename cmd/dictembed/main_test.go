@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestRun_Golden(t *testing.T) {
+	// The space in the name needs the go:embed path quoted.
+	const dictName = "list files.dict"
+	dict, err := os.ReadFile(filepath.Join("testdata", dictName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, dictName), dict, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(filepath.Join(dir, dictName), "", "dicts", "Listing", "2024-06"); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "list files_dict.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "list_files_dict.go.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated file differs from %s (run with -update to rewrite):\n%s", golden, got)
+	}
+}
+
+func TestRun_StructuredDict(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "files.dict")
+	if err := os.WriteFile(path, testdict.Train(t, 3227), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "gen.go")
+	if err := run(path, out, "dicts", "Dict", ""); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"//go:embed \"files.dict\"\n", "const DictID uint32 = 3227\n"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated file lacks %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "files.dict")
+	if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name                     string
+		dict, out, pkg, dictName string
+	}{
+		{"no dict", "", "", "dicts", "Dict"},
+		{"no package", path, "", "", "Dict"},
+		{"unexported name", path, "", "dicts", "dict"},
+		{"outside output dir", path, filepath.Join(dir, "sub", "gen.go"), "dicts", "Dict"},
+		{"missing dict", filepath.Join(dir, "missing.dict"), "", "dicts", "Dict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := run(tt.dict, tt.out, tt.pkg, tt.dictName, ""); err == nil {
+				t.Error("run() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+// Package connectzstd adds zstd and dictionary-enhanced zstd compression to
+// Connect (connectrpc.com/connect) servers and clients, with the same
+// compressor names and error details as package grpccodec.
+//
+// Servers install the compressors and advertise their dictionary:
+//
+//	opt, err := connectzstd.HandlerOptions(connectzstd.Config{Dict: dict})
+//	path, h := filelistconnect.NewFileListServiceHandler(impl, opt)
+//	mux.Handle(path, connectzstd.AdvertiseDict(dict, h))
+//
+// Clients send with the dictionary compressor and report dictionary
+// mismatches as a *grpccodec.DecodeError:
+//
+//	opt, err := connectzstd.ClientOptions(connectzstd.Config{Dict: dict})
+//	client := filelistconnect.NewFileListServiceClient(http.DefaultClient, url, opt)
+package connectzstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"connectrpc.com/connect"
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// HeaderDictID carries the sender's dictionary ID in request and response
+// headers, so each side can tell which dictionary the other holds.
+const HeaderDictID = "Zstd-Dict-Id"
+
+// Config selects the compressors to install.
+type Config struct {
+	// Dict is the dictionary for the zstd-dict compressor. If nil, only
+	// the plain zstd compressor is installed.
+	Dict []byte
+	// DictURL is reported to clients whose requests use a dictionary the
+	// server doesn't have.
+	DictURL string
+}
+
+// codec holds the options for one compressor name.
+type codec struct {
+	name    string
+	dictID  uint32
+	dictURL string
+	hasDict bool
+	encOpts []zstd.EOption
+	decOpts []zstd.DOption
+}
+
+// codecs validates cfg and returns the compressors it describes.
+func (cfg Config) codecs() ([]codec, error) {
+	codecs, err := cfg.describe()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range codecs {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return codecs, nil
+}
+
+// describe returns the compressors cfg asks for.
+func (cfg Config) describe() ([]codec, error) {
+	codecs := []codec{{
+		name:    grpccodec.NameZstd,
+		dictURL: cfg.DictURL,
+		encOpts: []zstd.EOption{zstd.WithEncoderConcurrency(1)},
+		decOpts: []zstd.DOption{zstd.WithDecoderConcurrency(1)},
+	}}
+	if cfg.Dict == nil {
+		return codecs, nil
+	}
+	d, err := zstd.InspectDictionary(cfg.Dict)
+	if err != nil {
+		return nil, err
+	}
+	dict := bytes.Clone(cfg.Dict)
+	return append(codecs, codec{
+		name:    grpccodec.NameZstdDict,
+		dictID:  d.ID(),
+		dictURL: cfg.DictURL,
+		hasDict: true,
+		encOpts: []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithEncoderDict(dict)},
+		decOpts: []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderDicts(dict)},
+	}), nil
+}
+
+// HandlerOptions returns a handler option installing the compressors
+// described by cfg. Responses are compressed with the compressor the
+// client used.
+func HandlerOptions(cfg Config) (connect.HandlerOption, error) {
+	codecs, err := cfg.codecs()
+	if err != nil {
+		return nil, err
+	}
+	var opts []connect.HandlerOption
+	for _, c := range codecs {
+		opts = append(opts, connect.WithCompression(c.name, c.newDecompressor, c.newCompressor))
+	}
+	return connect.WithHandlerOptions(opts...), nil
+}
+
+// ClientOptions returns a client option installing the compressors
+// described by cfg, sending requests with zstd-dict if cfg has a
+// dictionary and zstd otherwise, and exchanging HeaderDictID with the
+// server so dictionary mismatches surface as a *grpccodec.DecodeError.
+func ClientOptions(cfg Config) (connect.ClientOption, error) {
+	codecs, err := cfg.codecs()
+	if err != nil {
+		return nil, err
+	}
+	var opts []connect.ClientOption
+	for _, c := range codecs {
+		opts = append(opts, connect.WithAcceptCompression(c.name, c.newDecompressor, c.newCompressor))
+	}
+	send := codecs[len(codecs)-1]
+	opts = append(opts,
+		connect.WithSendCompression(send.name),
+		connect.WithInterceptors(dictInterceptor{name: send.name, dictID: send.dictID}),
+	)
+	return connect.WithClientOptions(opts...), nil
+}
+
+// AdvertiseDict wraps a Connect handler to report the server's dictionary
+// ID in HeaderDictID on every response, including failed ones.
+func AdvertiseDict(dict []byte, h http.Handler) http.Handler {
+	var id string
+	if d, err := zstd.InspectDictionary(dict); err == nil {
+		id = strconv.FormatUint(uint64(d.ID()), 10)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id != "" {
+			w.Header().Set(HeaderDictID, id)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// validate builds an encoder and decoder from c's options, so a
+// dictionary zstd rejects fails HandlerOptions and ClientOptions rather
+// than the first call that compresses.
+func (c codec) validate() error {
+	enc, err := zstd.NewWriter(nil, c.encOpts...)
+	if err != nil {
+		return err
+	}
+	enc.Close()
+	dec, err := zstd.NewReader(nil, c.decOpts...)
+	if err != nil {
+		return err
+	}
+	dec.Close()
+	return nil
+}
+
+func (c codec) newCompressor() connect.Compressor {
+	enc, err := zstd.NewWriter(nil, c.encOpts...)
+	if err != nil {
+		// The options were validated when the codec was built, but
+		// Connect's factories can't return an error, so report it from
+		// the stream instead.
+		return failedCompressor{err}
+	}
+	return enc
+}
+
+func (c codec) newDecompressor() connect.Decompressor {
+	dec, err := zstd.NewReader(nil, c.decOpts...)
+	if err != nil {
+		return failedDecompressor{connectError(&grpccodec.DecodeError{Compressor: c.name, LocalDictID: c.dictID, Err: err})}
+	}
+	return &decompressor{c: c, dec: dec}
+}
+
+// failedCompressor reports the error that stopped its encoder being
+// built from every write.
+type failedCompressor struct{ err error }
+
+func (f failedCompressor) Write([]byte) (int, error) { return 0, f.err }
+func (f failedCompressor) Close() error              { return f.err }
+func (f failedCompressor) Reset(io.Writer)           {}
+
+// failedDecompressor reports the error that stopped its decoder being
+// built from every read.
+type failedDecompressor struct{ err error }
+
+func (f failedDecompressor) Read([]byte) (int, error) { return 0, f.err }
+func (f failedDecompressor) Close() error             { return nil }
+func (f failedDecompressor) Reset(io.Reader) error    { return f.err }
+
+// decompressor checks each frame's dictionary ID before decoding, like
+// grpccodec.Zstd.Decompress, and reports failures as Connect errors
+// carrying the grpccodec error details.
+type decompressor struct {
+	c   codec
+	dec *zstd.Decoder
+
+	src         io.Reader
+	started     bool
+	frameDictID uint32
+}
+
+func (d *decompressor) Reset(r io.Reader) error {
+	d.src = r
+	d.started = false
+	d.frameDictID = 0
+	return nil
+}
+
+func (d *decompressor) Read(p []byte) (int, error) {
+	if !d.started {
+		if err := d.start(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := d.dec.Read(p)
+	if err != nil && err != io.EOF {
+		err = connectError(&grpccodec.DecodeError{Compressor: d.c.name, FrameDictID: d.frameDictID, LocalDictID: d.c.dictID, Err: err})
+	}
+	return n, err
+}
+
+// start inspects the frame header and points the decoder at the stream.
+func (d *decompressor) start() error {
+	d.started = true
+	var hdr [zstd.HeaderMaxSize]byte
+	n, err := io.ReadFull(d.src, hdr[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	var h zstd.Header
+	if h.Decode(hdr[:n]) == nil && !h.Skippable {
+		d.frameDictID = h.DictionaryID
+		if h.DictionaryID != 0 && h.DictionaryID != d.c.dictID {
+			cause := grpccodec.ErrDictMismatch
+			if !d.c.hasDict {
+				cause = grpccodec.ErrDictMissing
+			}
+			return connectError(&grpccodec.DecodeError{
+				Compressor: d.c.name, FrameDictID: h.DictionaryID, LocalDictID: d.c.dictID,
+				DictURL: d.c.dictURL, Err: cause,
+			})
+		}
+	}
+	if err := d.dec.Reset(io.MultiReader(bytes.NewReader(hdr[:n]), d.src)); err != nil {
+		return connectError(&grpccodec.DecodeError{Compressor: d.c.name, FrameDictID: d.frameDictID, LocalDictID: d.c.dictID, Err: err})
+	}
+	return nil
+}
+
+// Close readies the decompressor for reuse. The zstd decoder itself stays
+// open, since Connect pools decompressors.
+func (d *decompressor) Close() error {
+	d.src = nil
+	return d.dec.Reset(nil)
+}
+
+// connectError converts a codec error to a Connect error with the
+// grpccodec ErrorInfo detail attached.
+func connectError(err error) *connect.Error {
+	cerr := connect.NewError(connect.Code(grpccodec.Code(err)), err)
+	if info := grpccodec.ErrorInfo(err); info != nil {
+		if detail, derr := connect.NewErrorDetail(info); derr == nil {
+			cerr.AddDetail(detail)
+		}
+	}
+	return cerr
+}
+
+// fromConnectError recovers a typed codec error from a Connect error's
+// details.
+func fromConnectError(cerr *connect.Error) error {
+	for _, d := range cerr.Details() {
+		v, err := d.Value()
+		if err != nil {
+			continue
+		}
+		if info, ok := v.(*errdetails.ErrorInfo); ok {
+			if err := grpccodec.FromErrorInfo(info, cerr.Message()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dictInterceptor advertises the client's dictionary in HeaderDictID and
+// turns codec failures reported by the server back into typed errors.
+type dictInterceptor struct {
+	name   string
+	dictID uint32
+}
+
+func (i dictInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			req.Header().Set(HeaderDictID, strconv.FormatUint(uint64(i.dictID), 10))
+		}
+		resp, err := next(ctx, req)
+		if err != nil && req.Spec().IsClient {
+			err = i.clientError(err)
+		}
+		return resp, err
+	}
+}
+
+func (i dictInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		conn.RequestHeader().Set(HeaderDictID, strconv.FormatUint(uint64(i.dictID), 10))
+		return conn
+	}
+}
+
+func (i dictInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// clientError rewrites a failed call's error so errors.As finds a
+// *grpccodec.DecodeError. Servers that attach no details but advertise a
+// different dictionary in HeaderDictID are reported as ErrDictMismatch.
+func (i dictInterceptor) clientError(err error) error {
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) {
+		return err
+	}
+	if codecErr := fromConnectError(cerr); codecErr != nil {
+		return wrapError(cerr, codecErr)
+	}
+	if i.dictID == 0 || cerr.Code() != connect.CodeFailedPrecondition && cerr.Code() != connect.CodeInternal {
+		return err
+	}
+	serverID := cerr.Meta().Get(HeaderDictID)
+	if serverID == "" {
+		return err
+	}
+	id, perr := strconv.ParseUint(serverID, 10, 32)
+	if perr != nil || uint32(id) == i.dictID {
+		return err
+	}
+	return wrapError(cerr, &grpccodec.DecodeError{
+		Compressor:  i.name,
+		FrameDictID: i.dictID,
+		LocalDictID: uint32(id),
+		Err:         grpccodec.ErrDictMismatch,
+	})
+}
+
+// wrapError returns a Connect error with cerr's code, metadata and details
+// whose cause is codecErr.
+func wrapError(cerr *connect.Error, codecErr error) *connect.Error {
+	out := connect.NewError(cerr.Code(), codecErr)
+	for k, v := range cerr.Meta() {
+		out.Meta()[k] = v
+	}
+	for _, d := range cerr.Details() {
+		out.AddDetail(d)
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package connectzstd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+const procedure = "/filelist.FileListService/ListFiles"
+
+func TestRoundTrip(t *testing.T) {
+	dict := testdict.Train(t, 1001)
+	client := newTestClient(t, dict, dict)
+
+	req := &pb.ListFilesRequest{Path: strings.Repeat("/usr/local/bin/tool3 ", 50)}
+	resp, err := client.CallUnary(context.Background(), connect.NewRequest(req))
+	if err != nil {
+		t.Fatalf("CallUnary() error = %v", err)
+	}
+	if resp.Msg.GetRoot() != req.GetPath() {
+		t.Errorf("Root = %q, want the request path echoed", resp.Msg.GetRoot())
+	}
+	if got := resp.Header().Get(HeaderDictID); got != "1001" {
+		t.Errorf("response %s = %q, want 1001", HeaderDictID, got)
+	}
+}
+
+func TestDictMismatch(t *testing.T) {
+	client := newTestClient(t, testdict.Train(t, 1001), testdict.Train(t, 2002))
+
+	req := &pb.ListFilesRequest{Path: strings.Repeat("/usr/local/bin/tool3 ", 50)}
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(req))
+	if got := connect.CodeOf(err); got != connect.CodeFailedPrecondition {
+		t.Fatalf("code = %v, want FailedPrecondition (err = %v)", got, err)
+	}
+	var de *grpccodec.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("error %v is not a *grpccodec.DecodeError", err)
+	}
+	if !errors.Is(err, zstddict.ErrDictMismatch) || de.FrameDictID != 2002 || de.LocalDictID != 1001 {
+		t.Errorf("DecodeError = %+v, want mismatch between frame 2002 and local 1001", de)
+	}
+	if de.DictURL != "https://example.com/dict" {
+		t.Errorf("DictURL = %q, want the server's URL", de.DictURL)
+	}
+}
+
+func TestInvalidDict(t *testing.T) {
+	if _, err := HandlerOptions(Config{Dict: []byte("not a dictionary")}); err == nil {
+		t.Error("HandlerOptions() with invalid dict succeeded")
+	}
+	if _, err := ClientOptions(Config{Dict: []byte("not a dictionary")}); err == nil {
+		t.Error("ClientOptions() with invalid dict succeeded")
+	}
+}
+
+func TestFactoryError(t *testing.T) {
+	c := codec{
+		name:    grpccodec.NameZstdDict,
+		encOpts: []zstd.EOption{zstd.WithEncoderConcurrency(-1)},
+		decOpts: []zstd.DOption{zstd.WithDecoderConcurrency(-1)},
+	}
+	if err := c.validate(); err == nil {
+		t.Fatal("validate() with invalid options succeeded")
+	}
+	if _, err := c.newCompressor().Write([]byte("x")); err == nil {
+		t.Error("Write() on a failed compressor succeeded")
+	}
+	d := c.newDecompressor()
+	if err := d.Reset(strings.NewReader("x")); err == nil {
+		t.Error("Reset() on a failed decompressor succeeded")
+	}
+	if _, err := d.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() on a failed decompressor succeeded")
+	}
+}
+
+// newTestClient starts an echo server using serverDict and returns a client
+// using clientDict.
+func newTestClient(t *testing.T, serverDict, clientDict []byte) *connect.Client[pb.ListFilesRequest, pb.ListFilesResponse] {
+	t.Helper()
+	hopt, err := HandlerOptions(Config{Dict: serverDict, DictURL: "https://example.com/dict"})
+	if err != nil {
+		t.Fatalf("HandlerOptions() error = %v", err)
+	}
+	h := connect.NewUnaryHandler(procedure,
+		func(_ context.Context, req *connect.Request[pb.ListFilesRequest]) (*connect.Response[pb.ListFilesResponse], error) {
+			return connect.NewResponse(&pb.ListFilesResponse{Root: req.Msg.GetPath()}), nil
+		}, hopt)
+	mux := http.NewServeMux()
+	mux.Handle(procedure, AdvertiseDict(serverDict, h))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	copt, err := ClientOptions(Config{Dict: clientDict})
+	if err != nil {
+		t.Fatalf("ClientOptions() error = %v", err)
+	}
+	return connect.NewClient[pb.ListFilesRequest, pb.ListFilesResponse](srv.Client(), srv.URL+procedure, copt)
+}
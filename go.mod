@@ -3,11 +3,17 @@ module github.com/paulstuart/zstd-dict
 go 1.25.4
 
 require (
-	github.com/klauspost/compress v1.18.1 // indirect
+	connectrpc.com/connect v1.21.0
+	github.com/andybalholm/brotli v1.2.5
+	github.com/klauspost/compress v1.18.1
+	github.com/pierrec/lz4/v4 v4.1.30
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251022142026-3a174f9686a8
+	google.golang.org/grpc v1.77.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
 	golang.org/x/net v0.46.1-0.20251013234738-63d1a5100f82 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20251022142026-3a174f9686a8 // indirect
-	google.golang.org/grpc v1.77.0 // indirect
-	google.golang.org/protobuf v1.36.10 // indirect
 )
@@ -0,0 +1,72 @@
+package grpccodec
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/experimental"
+	"google.golang.org/grpc/mem"
+)
+
+// countingPool counts the buffers handed out and returned.
+type countingPool struct {
+	mem.BufferPool
+	gets, puts atomic.Int64
+}
+
+func (p *countingPool) Get(n int) *[]byte {
+	p.gets.Add(1)
+	return p.BufferPool.Get(n)
+}
+
+func (p *countingPool) Put(b *[]byte) {
+	p.puts.Add(1)
+	p.BufferPool.Put(b)
+}
+
+// TestBufferPool checks that decompressed messages are read into, and
+// returned to, the receive buffer pools gRPC is configured with.
+func TestBufferPool(t *testing.T) {
+	serverPool := &countingPool{BufferPool: mem.DefaultBufferPool()}
+	clientPool := &countingPool{BufferPool: mem.DefaultBufferPool()}
+
+	s := grpc.NewServer(experimental.BufferPool(serverPool))
+	pb.RegisterFileListServiceServer(s, echoFiles{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(NameZstd)),
+		experimental.WithBufferPool(clientPool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewFileListServiceClient(conn)
+
+	for range 10 {
+		if _, err := client.ListFiles(context.Background(), &pb.ListFilesRequest{Path: "/srv/data"}); err != nil {
+			t.Fatalf("ListFiles() error = %v", err)
+		}
+	}
+	for name, p := range map[string]*countingPool{"client": clientPool, "server": serverPool} {
+		gets, puts := p.gets.Load(), p.puts.Load()
+		if gets == 0 {
+			t.Errorf("%s pool was never used", name)
+		}
+		// The last response's buffers may still be in flight on the server.
+		if puts < gets-10 {
+			t.Errorf("%s pool: %d buffers taken, only %d returned", name, gets, puts)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package grpccodec
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+)
+
+// CapabilitiesHeader is the metadata key under which peers advertise the
+// compressors they support and the dictionary each uses. Unlike
+// grpc-accept-encoding, which gRPC only sends for the compressors of the
+// process, it carries dictionary IDs, so sidecars and meshes can tell
+// which peers share a dictionary version and route or negotiate
+// compression across fleets running different versions. The value is a
+// comma-separated list in which a compressor with a dictionary carries its
+// ID as a parameter:
+//
+//	zstd, zstd-dict;dict=1001, zstd-dict.filelist.ListFilesResponse;dict=2002, gzip
+const CapabilitiesHeader = "zstd-capabilities"
+
+// Capability is a compressor a peer supports.
+type Capability struct {
+	Compressor string
+	// DictID is the ID of the compressor's dictionary, or 0 if it has
+	// none.
+	DictID uint32
+}
+
+// String returns c in the CapabilitiesHeader format.
+func (c Capability) String() string {
+	if c.DictID == 0 {
+		return c.Compressor
+	}
+	return c.Compressor + ";dict=" + strconv.FormatUint(uint64(c.DictID), 10)
+}
+
+// Capabilities lists the compressors a peer supports.
+type Capabilities []Capability
+
+// String returns caps as a CapabilitiesHeader value.
+func (caps Capabilities) String() string {
+	s := make([]string, len(caps))
+	for i, c := range caps {
+		s[i] = c.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Lookup returns the capability for the compressor called name.
+func (caps Capabilities) Lookup(name string) (Capability, bool) {
+	for _, c := range caps {
+		if c.Compressor == name {
+			return c, true
+		}
+	}
+	return Capability{}, false
+}
+
+// ParseCapabilities parses a CapabilitiesHeader value. Unknown parameters
+// are ignored, so later versions can add their own.
+func ParseCapabilities(s string) (Capabilities, error) {
+	var caps Capabilities
+	for item := range strings.SplitSeq(s, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if name == "" {
+			continue
+		}
+		c := Capability{Compressor: name}
+		for p := range strings.SplitSeq(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if k != "dict" {
+				continue
+			}
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("grpccodec: capability %q: bad dictionary ID %q", name, v)
+			}
+			c.DictID = uint32(id)
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// LocalCapabilities returns the compressors registered by this package,
+// with their current dictionaries, followed by those of extra, such as
+// "gzip", that are registered with gRPC. gRPC offers no way to list every
+// registered compressor, so others must be named in extra.
+func LocalCapabilities(extra ...string) Capabilities {
+	registry.mu.Lock()
+	var caps Capabilities
+	for name, z := range registry.registered {
+		caps = append(caps, Capability{Compressor: name, DictID: z.dictID})
+	}
+	for name, t := range registry.types {
+		_, id := t.Dict()
+		caps = append(caps, Capability{Compressor: name, DictID: id})
+	}
+	registry.mu.Unlock()
+	slices.SortFunc(caps, func(a, b Capability) int { return strings.Compare(a.Compressor, b.Compressor) })
+
+	for _, name := range extra {
+		if _, ok := caps.Lookup(name); !ok && encoding.GetCompressor(name) != nil {
+			caps = append(caps, Capability{Compressor: name})
+		}
+	}
+	return caps
+}
+
+// PeerCapabilities returns the capabilities advertised in md, such as the
+// incoming metadata of a server handler or the header a client received
+// with grpc.Header, or nil if the peer advertised none.
+func PeerCapabilities(md metadata.MD) (Capabilities, error) {
+	vals := md.Get(CapabilitiesHeader)
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	return ParseCapabilities(strings.Join(vals, ","))
+}
+
+// Advertiser sends CapabilitiesHeader with the local capabilities: in the
+// response header of every RPC a server handles, and in the metadata of
+// every RPC a client makes.
+//
+//	a := grpccodec.NewAdvertiser("gzip")
+//	s := grpc.NewServer(
+//	    grpc.ChainUnaryInterceptor(a.UnaryServerInterceptor()),
+//	    grpc.ChainStreamInterceptor(a.StreamServerInterceptor()),
+//	)
+//
+// The capabilities are read for each RPC, so dictionaries rotated with
+// TypeCompressor.SetDict are advertised as soon as they are set.
+type Advertiser struct {
+	extra []string
+}
+
+// NewAdvertiser returns an Advertiser of LocalCapabilities(extra...).
+func NewAdvertiser(extra ...string) *Advertiser {
+	return &Advertiser{extra: extra}
+}
+
+func (a *Advertiser) value() string {
+	return LocalCapabilities(a.extra...).String()
+}
+
+// UnaryServerInterceptor adds CapabilitiesHeader to response headers.
+func (a *Advertiser) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(CapabilitiesHeader, a.value()))
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor adds CapabilitiesHeader to response headers.
+func (a *Advertiser) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		_ = ss.SetHeader(metadata.Pairs(CapabilitiesHeader, a.value()))
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor adds CapabilitiesHeader to request metadata.
+func (a *Advertiser) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(a.outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor adds CapabilitiesHeader to request metadata.
+func (a *Advertiser) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(a.outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+func (a *Advertiser) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, CapabilitiesHeader, a.value())
+}
@@ -0,0 +1,91 @@
+package grpccodec
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	const in = "zstd, zstd-dict;dict=1001;level=3 ,gzip,"
+	caps, err := ParseCapabilities(in)
+	if err != nil {
+		t.Fatalf("ParseCapabilities() error = %v", err)
+	}
+	if got, want := caps.String(), "zstd, zstd-dict;dict=1001, gzip"; got != want {
+		t.Errorf("ParseCapabilities(%q) = %q, want %q", in, got, want)
+	}
+	if c, ok := caps.Lookup(NameZstdDict); !ok || c.DictID != 1001 {
+		t.Errorf("Lookup(%q) = %v, %v", NameZstdDict, c, ok)
+	}
+	if _, err := ParseCapabilities("zstd-dict;dict=x"); err == nil {
+		t.Error("ParseCapabilities() accepted a malformed dictionary ID")
+	}
+}
+
+func TestAdvertiser(t *testing.T) {
+	tc, err := RegisterTypeCompressor("test.AdvertisedMessage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SetDict(testdict.Train(t, 3003)); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAdvertiser("gzip", "snappy")
+	local := LocalCapabilities("gzip", "snappy")
+	if c, ok := local.Lookup(tc.Name()); !ok || c.DictID != 3003 {
+		t.Errorf("LocalCapabilities() = %v, want %s with dictionary 3003", local, tc.Name())
+	}
+	if _, ok := local.Lookup("snappy"); ok {
+		t.Error("LocalCapabilities() lists an unregistered compressor")
+	}
+
+	var fromClient Capabilities
+	record := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		fromClient, _ = PeerCapabilities(md)
+		return handler(ctx, req)
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(record, a.UnaryServerInterceptor()))
+	pb.RegisterFileListServiceServer(s, echoFiles{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(a.UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var header metadata.MD
+	_, err = pb.NewFileListServiceClient(conn).ListFiles(context.Background(), &pb.ListFilesRequest{Path: "/srv"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	fromServer, err := PeerCapabilities(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, caps := range map[string]Capabilities{"server": fromServer, "client": fromClient} {
+		if c, ok := caps.Lookup(tc.Name()); !ok || c.DictID != 3003 {
+			t.Errorf("%s advertised %v, want %s with dictionary 3003", name, caps, tc.Name())
+		}
+		if _, ok := caps.Lookup("gzip"); !ok {
+			t.Errorf("%s advertised %v, want gzip", name, caps)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package grpccodec
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+// ConnMonitor tracks which compressor each gRPC connection is using and how
+// many bytes it has moved, so operators can confirm which peers actually
+// use zstd-dict. Install it as a stats handler and serve it over HTTP:
+//
+//	mon := new(grpccodec.ConnMonitor)
+//	s := grpc.NewServer(grpc.StatsHandler(mon))
+//	http.Handle("/debug/zstd", mon)
+//
+// It works on the client side too, via grpc.WithStatsHandler.
+// The zero value is ready to use.
+type ConnMonitor struct {
+	mu    sync.Mutex
+	conns map[*connEntry]struct{}
+}
+
+// ConnInfo describes one connection tracked by a ConnMonitor. Byte counts
+// cover message payloads only, excluding gRPC and HTTP/2 framing.
+type ConnInfo struct {
+	RemoteAddr string
+	LocalAddr  string
+	Since      time.Time
+
+	// InCompressor and OutCompressor are the compressors most recently
+	// used for received and sent messages; empty means uncompressed.
+	InCompressor  string
+	OutCompressor string
+	// InDictID and OutDictID are the dictionary IDs of those compressors
+	// as registered by this package, or 0 if they have none.
+	InDictID  uint32
+	OutDictID uint32
+
+	RPCs               int64
+	InBytes            int64 // decompressed bytes received
+	InCompressedBytes  int64 // bytes received on the wire
+	OutBytes           int64 // uncompressed bytes sent
+	OutCompressedBytes int64 // bytes sent on the wire
+}
+
+// connEntry is the mutable state behind a ConnInfo, guarded by ConnMonitor.mu.
+type connEntry struct {
+	info ConnInfo
+}
+
+type connKey struct{}
+
+// TagConn implements stats.Handler.
+func (m *ConnMonitor) TagConn(ctx context.Context, info *grpcstats.ConnTagInfo) context.Context {
+	e := &connEntry{info: ConnInfo{
+		RemoteAddr: addrString(info.RemoteAddr),
+		LocalAddr:  addrString(info.LocalAddr),
+		Since:      time.Now(),
+	}}
+	m.mu.Lock()
+	if m.conns == nil {
+		m.conns = make(map[*connEntry]struct{})
+	}
+	m.conns[e] = struct{}{}
+	m.mu.Unlock()
+	return context.WithValue(ctx, connKey{}, e)
+}
+
+// HandleConn implements stats.Handler. Connections are forgotten when they
+// end.
+func (m *ConnMonitor) HandleConn(ctx context.Context, s grpcstats.ConnStats) {
+	if _, ok := s.(*grpcstats.ConnEnd); !ok {
+		return
+	}
+	if e, ok := ctx.Value(connKey{}).(*connEntry); ok {
+		m.mu.Lock()
+		delete(m.conns, e)
+		m.mu.Unlock()
+	}
+}
+
+// TagRPC implements stats.Handler.
+func (m *ConnMonitor) TagRPC(ctx context.Context, _ *grpcstats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC implements stats.Handler.
+func (m *ConnMonitor) HandleRPC(ctx context.Context, s grpcstats.RPCStats) {
+	e, ok := ctx.Value(connKey{}).(*connEntry)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch s := s.(type) {
+	case *grpcstats.Begin:
+		e.info.RPCs++
+	case *grpcstats.InHeader:
+		e.info.InCompressor = s.Compression
+		e.info.InDictID = RegisteredDictID(s.Compression)
+	case *grpcstats.OutHeader:
+		e.info.OutCompressor = s.Compression
+		e.info.OutDictID = RegisteredDictID(s.Compression)
+	case *grpcstats.InPayload:
+		e.info.InBytes += int64(s.Length)
+		e.info.InCompressedBytes += int64(s.CompressedLength)
+	case *grpcstats.OutPayload:
+		e.info.OutBytes += int64(s.Length)
+		e.info.OutCompressedBytes += int64(s.CompressedLength)
+	}
+}
+
+// Conns returns the open connections, sorted by remote then local address.
+func (m *ConnMonitor) Conns() []ConnInfo {
+	m.mu.Lock()
+	conns := make([]ConnInfo, 0, len(m.conns))
+	for e := range m.conns {
+		conns = append(conns, e.info)
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(conns, func(a, b ConnInfo) int {
+		return cmp.Or(cmp.Compare(a.RemoteAddr, b.RemoteAddr), cmp.Compare(a.LocalAddr, b.LocalAddr))
+	})
+	return conns
+}
+
+// WriteText writes the open connections to w as an aligned table.
+func (m *ConnMonitor) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REMOTE\tLOCAL\tAGE\tRPCS\tIN\tIN-DICT\tIN-BYTES\tIN-WIRE\tOUT\tOUT-DICT\tOUT-BYTES\tOUT-WIRE")
+	for _, c := range m.Conns() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%d\t%d\t%d\t%s\t%d\t%d\t%d\n",
+			c.RemoteAddr, c.LocalAddr, time.Since(c.Since).Round(time.Second), c.RPCs,
+			compressorName(c.InCompressor), c.InDictID, c.InBytes, c.InCompressedBytes,
+			compressorName(c.OutCompressor), c.OutDictID, c.OutBytes, c.OutCompressedBytes)
+	}
+	return tw.Flush()
+}
+
+// ServeHTTP serves the connection table as plain text.
+func (m *ConnMonitor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	m.WriteText(w)
+}
+
+func compressorName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,50 @@
+package grpccodec
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+func TestConnMonitor(t *testing.T) {
+	var m ConnMonitor
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}
+	ctx := m.TagConn(context.Background(), &grpcstats.ConnTagInfo{RemoteAddr: remote})
+
+	m.HandleRPC(ctx, &grpcstats.Begin{})
+	m.HandleRPC(ctx, &grpcstats.InHeader{Compression: NameZstd})
+	m.HandleRPC(ctx, &grpcstats.InPayload{Length: 1000, CompressedLength: 200})
+	m.HandleRPC(ctx, &grpcstats.OutHeader{Compression: NameZstd})
+	m.HandleRPC(ctx, &grpcstats.OutPayload{Length: 500, CompressedLength: 100})
+	m.HandleRPC(ctx, &grpcstats.OutPayload{Length: 500, CompressedLength: 100})
+
+	conns := m.Conns()
+	if len(conns) != 1 {
+		t.Fatalf("Conns() = %d entries, want 1", len(conns))
+	}
+	c := conns[0]
+	if c.RemoteAddr != remote.String() || c.RPCs != 1 {
+		t.Errorf("RemoteAddr, RPCs = %q, %d; want %q, 1", c.RemoteAddr, c.RPCs, remote)
+	}
+	if c.InCompressor != NameZstd || c.OutCompressor != NameZstd {
+		t.Errorf("compressors = %q/%q, want %q", c.InCompressor, c.OutCompressor, NameZstd)
+	}
+	if c.InBytes != 1000 || c.InCompressedBytes != 200 || c.OutBytes != 1000 || c.OutCompressedBytes != 200 {
+		t.Errorf("byte counts = %+v", c)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/zstd", nil))
+	if body := rec.Body.String(); !strings.Contains(body, remote.String()) || !strings.Contains(body, NameZstd) {
+		t.Errorf("debug page missing connection:\n%s", body)
+	}
+
+	m.HandleConn(ctx, &grpcstats.ConnEnd{})
+	if n := len(m.Conns()); n != 0 {
+		t.Errorf("after ConnEnd, Conns() = %d entries, want 0", n)
+	}
+}
@@ -0,0 +1,225 @@
+package grpccodec
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrDictMissing is returned when a frame needs a dictionary but the
+	// compressor has none loaded.
+	ErrDictMissing = errors.New("grpccodec: dictionary required but not loaded")
+	// ErrDictMismatch is returned when a frame was compressed with a
+	// different dictionary than the one loaded. It wraps
+	// zstddict.ErrDictMismatch, so errors.Is matches either.
+	ErrDictMismatch = fmt.Errorf("grpccodec: %w", zstddict.ErrDictMismatch)
+	// ErrUnsupportedCodec is returned when the peer has no decompressor
+	// registered for the requested compressor.
+	ErrUnsupportedCodec = errors.New("grpccodec: peer does not support compressor")
+)
+
+// ErrorDomain is the errdetails.ErrorInfo domain used by Status.
+const ErrorDomain = "grpccodec.zstd-dict"
+
+// ErrorInfo reasons attached by Status.
+const (
+	ReasonDictMissing      = "DICT_MISSING"
+	ReasonDictMismatch     = "DICT_MISMATCH"
+	ReasonCodecUnsupported = "CODEC_UNSUPPORTED"
+	ReasonDecodeFailed     = "DECODE_FAILED"
+)
+
+// DecodeError describes a failure to decompress a message, with the
+// dictionary context needed to tell an outdated dictionary from a corrupt
+// payload. Err is ErrDictMismatch or ErrDictMissing for dictionary problems,
+// and the underlying decoder error otherwise.
+type DecodeError struct {
+	// Compressor is the name of the compressor that failed.
+	Compressor string
+	// FrameDictID is the dictionary ID declared by the frame, 0 for none.
+	FrameDictID uint32
+	// LocalDictID is the ID of the loaded dictionary, 0 for none.
+	LocalDictID uint32
+	// DictURL, when known, is where the peer's dictionary can be fetched.
+	// It is filled in by compressors configured WithDictURL.
+	DictURL string
+	// Err is the cause.
+	Err error
+}
+
+// Error describes the failure, followed by the ErrorInfo for it. gRPC
+// reports a decompressor's error as a bare Internal status holding only
+// its message, so the detail travels there for FromStatus to recover.
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("grpccodec: %s: frame dictionary %d, local dictionary %d: %v",
+		e.Compressor, e.FrameDictID, e.LocalDictID, e.Err)
+	if b, err := proto.Marshal(ErrorInfo(e)); err == nil {
+		msg += infoPrefix + base64.RawURLEncoding.EncodeToString(b) + infoSuffix
+	}
+	return msg
+}
+
+// infoPrefix and infoSuffix delimit the encoded ErrorInfo in a
+// DecodeError's message.
+const (
+	infoPrefix = " [" + ErrorDomain + ":"
+	infoSuffix = "]"
+)
+
+// messageInfo returns the ErrorInfo embedded in msg by DecodeError.Error
+// and msg without it, or nil and msg if there is none.
+func messageInfo(msg string) (*errdetails.ErrorInfo, string) {
+	i := strings.LastIndex(msg, infoPrefix)
+	if i < 0 {
+		return nil, msg
+	}
+	enc, rest, ok := strings.Cut(msg[i+len(infoPrefix):], infoSuffix)
+	if !ok {
+		return nil, msg
+	}
+	b, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, msg
+	}
+	info := new(errdetails.ErrorInfo)
+	if proto.Unmarshal(b, info) != nil {
+		return nil, msg
+	}
+	return info, msg[:i] + rest
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Status maps a codec error to a gRPC status carrying an
+// errdetails.ErrorInfo, so peers can distinguish dictionary problems
+// (FailedPrecondition) from unsupported codecs (Unimplemented) and corrupt
+// payloads (DataLoss). Errors not produced by this package are converted
+// with status.Convert.
+func Status(err error) *status.Status {
+	info := ErrorInfo(err)
+	if info == nil {
+		return status.Convert(err)
+	}
+	st := status.New(Code(err), err.Error())
+	if withInfo, derr := st.WithDetails(info); derr == nil {
+		st = withInfo
+	}
+	return st
+}
+
+// Code returns the gRPC code Status uses for err.
+func Code(err error) codes.Code {
+	var de *DecodeError
+	switch {
+	case errors.Is(err, ErrDictMismatch), errors.Is(err, ErrDictMissing):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrUnsupportedCodec):
+		return codes.Unimplemented
+	case errors.As(err, &de):
+		return codes.DataLoss
+	default:
+		return status.Code(err)
+	}
+}
+
+// ErrorInfo returns the ErrorInfo detail Status attaches for err, or nil if
+// err is not a codec error. It lets other RPC frameworks carry the same
+// details.
+func ErrorInfo(err error) *errdetails.ErrorInfo {
+	meta := map[string]string{}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		meta["compressor"] = de.Compressor
+		meta["frame_dict_id"] = strconv.FormatUint(uint64(de.FrameDictID), 10)
+		meta["local_dict_id"] = strconv.FormatUint(uint64(de.LocalDictID), 10)
+		if de.DictURL != "" {
+			meta["dict_url"] = de.DictURL
+		}
+	}
+
+	var reason string
+	switch {
+	case errors.Is(err, ErrDictMismatch):
+		reason = ReasonDictMismatch
+	case errors.Is(err, ErrDictMissing):
+		reason = ReasonDictMissing
+	case errors.Is(err, ErrUnsupportedCodec):
+		reason = ReasonCodecUnsupported
+	case de != nil:
+		reason = ReasonDecodeFailed
+	default:
+		return nil
+	}
+	return &errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain, Metadata: meta}
+}
+
+// FromStatus recovers a typed codec error from an error returned by a gRPC
+// call, using only ErrorInfo details: those attached by Status, or the one
+// a DecodeError embeds in its message, which is all that survives in the
+// plain status gRPC produces itself when decompression fails. It also
+// recognizes gRPC's status for a compressor that is not installed. Other
+// errors are returned unchanged.
+func FromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+
+	embedded, msg := messageInfo(st.Message())
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			if err := FromErrorInfo(info, msg); err != nil {
+				return err
+			}
+		}
+	}
+	if embedded != nil {
+		if err := FromErrorInfo(embedded, msg); err != nil {
+			return err
+		}
+	}
+	if st.Code() == codes.Unimplemented && strings.Contains(msg, "Decompressor is not installed") {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCodec, msg)
+	}
+	return err
+}
+
+// FromErrorInfo recovers the typed codec error described by an ErrorInfo
+// detail built by ErrorInfo; msg is the accompanying error message. It
+// returns nil if info is from another domain.
+func FromErrorInfo(info *errdetails.ErrorInfo, msg string) error {
+	if info.GetDomain() != ErrorDomain {
+		return nil
+	}
+	de := &DecodeError{Compressor: info.GetMetadata()["compressor"]}
+	de.FrameDictID = parseID(info.GetMetadata()["frame_dict_id"])
+	de.LocalDictID = parseID(info.GetMetadata()["local_dict_id"])
+	de.DictURL = info.GetMetadata()["dict_url"]
+	switch info.GetReason() {
+	case ReasonDictMismatch:
+		de.Err = ErrDictMismatch
+	case ReasonDictMissing:
+		de.Err = ErrDictMissing
+	case ReasonCodecUnsupported:
+		return fmt.Errorf("%w: %s", ErrUnsupportedCodec, msg)
+	default:
+		de.Err = errors.New(msg)
+	}
+	return de
+}
+
+func parseID(s string) uint32 {
+	id, _ := strconv.ParseUint(s, 10, 32)
+	return uint32(id)
+}
@@ -0,0 +1,398 @@
+package grpccodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// PayloadHeader is the metadata key a client sets to the ID of its payload
+// dictionary, telling the server it can decompress payload fields.
+const PayloadHeader = "zstd-payload-dict"
+
+// payloadCompressorName identifies payload compression in DecodeErrors.
+const payloadCompressorName = "payload"
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// PayloadFields maps message types to the bytes fields of each whose
+// contents are compressed, for example:
+//
+//	grpccodec.PayloadFields{
+//	    "blob.v1.PutRequest": {"data"},
+//	    "blob.v1.Chunk":      {"data", "extra"},
+//	}
+type PayloadFields map[protoreflect.FullName][]protoreflect.Name
+
+// PayloadCompressor implements the explicit payload compression pattern
+// described in the package documentation as a pair of interceptors:
+// selected bytes fields are compressed with the dictionary before a
+// message is sent and decompressed after it is received, while the rest
+// of the message, and gRPC's own compression, are left alone. It suits
+// services whose messages carry opaque blobs that transport compression
+// would otherwise handle without the dictionary.
+//
+// Fields are found wherever the registered types occur, including nested
+// messages, lists and map values. Received fields are decompressed only
+// when they hold a zstd frame, so uncompressed values from peers without
+// the interceptors pass through, provided they don't happen to start with
+// the zstd magic number. Clients always compress; servers compress
+// responses only for clients that sent PayloadHeader with a matching
+// dictionary ID.
+//
+//	pc, err := grpccodec.NewPayloadCompressor(dict, fields)
+//	s := grpc.NewServer(
+//	    grpc.ChainUnaryInterceptor(pc.UnaryServerInterceptor()),
+//	    grpc.ChainStreamInterceptor(pc.StreamServerInterceptor()),
+//	)
+//	conn, err := grpc.NewClient(addr,
+//	    grpc.WithChainUnaryInterceptor(pc.UnaryClientInterceptor()),
+//	    grpc.WithChainStreamInterceptor(pc.StreamClientInterceptor()),
+//	)
+type PayloadCompressor struct {
+	c      *zstddict.Compressor
+	dictID uint32
+	fields map[protoreflect.FullName][]protoreflect.FieldDescriptor
+
+	// relevant caches whether each message type can contain payload
+	// fields, by protoreflect.FullName.
+	relevant sync.Map
+}
+
+// NewPayloadCompressor returns a PayloadCompressor compressing fields with
+// dict, which may be nil for plain zstd. Every message type in fields must
+// be in protoregistry.GlobalTypes, and every named field must be a bytes
+// field. opts configure the underlying zstddict.Compressor.
+func NewPayloadCompressor(dict []byte, fields PayloadFields, opts ...zstddict.Option) (*PayloadCompressor, error) {
+	p := &PayloadCompressor{fields: make(map[protoreflect.FullName][]protoreflect.FieldDescriptor)}
+	if dict != nil {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, fmt.Errorf("grpccodec: payload dictionary: %w", err)
+		}
+		p.dictID = d.ID()
+	}
+	for msg, names := range fields {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(msg)
+		if err != nil {
+			return nil, fmt.Errorf("grpccodec: payload message %s: %w", msg, err)
+		}
+		for _, name := range names {
+			fd := mt.Descriptor().Fields().ByName(name)
+			if fd == nil || fd.Kind() != protoreflect.BytesKind || fd.IsMap() {
+				return nil, fmt.Errorf("grpccodec: %s has no bytes field %q", msg, name)
+			}
+			p.fields[msg] = append(p.fields[msg], fd)
+		}
+	}
+
+	c, err := zstddict.New(append([]zstddict.Option{zstddict.WithDictBytes(dict), zstddict.WithStrictDict(true)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	p.c = c
+	return p, nil
+}
+
+// DictID returns the ID of the payload dictionary, or 0 if there is none.
+func (p *PayloadCompressor) DictID() uint32 {
+	return p.dictID
+}
+
+// CompressMessage returns a copy of m with its payload fields compressed.
+// m itself is not modified. Values that compression wouldn't shrink are
+// left uncompressed. Values other than protobuf messages, and messages
+// without payload fields, are returned as is.
+func (p *PayloadCompressor) CompressMessage(m any) (any, error) {
+	return p.compressMessage(m, p.c.Compress)
+}
+
+// CompressMessageContext is like CompressMessage, but applies the
+// Compressor's profile labels on top of those carried by ctx; see
+// zstddict.WithProfileLabels. The interceptors use it with the call's
+// context.
+func (p *PayloadCompressor) CompressMessageContext(ctx context.Context, m any) (any, error) {
+	return p.compressMessage(m, func(b []byte) ([]byte, error) {
+		return p.c.CompressContext(ctx, b)
+	})
+}
+
+func (p *PayloadCompressor) compressMessage(m any, compress func([]byte) ([]byte, error)) (any, error) {
+	msg, ok := m.(proto.Message)
+	if !ok || !p.relevantType(msg.ProtoReflect().Descriptor()) {
+		return m, nil
+	}
+	msg = proto.Clone(msg)
+	err := p.walk(msg.ProtoReflect(), func(b []byte) ([]byte, error) {
+		if len(b) == 0 {
+			return b, nil
+		}
+		out, err := compress(b)
+		// A raw value that looks like a frame must be sent compressed.
+		if err != nil || len(out) < len(b) || bytes.HasPrefix(b, zstdMagic) {
+			return out, err
+		}
+		return b, nil
+	})
+	return msg, err
+}
+
+// DecompressMessage decompresses the payload fields of m in place. A field
+// that fails to decompress is reported as a *DecodeError.
+func (p *PayloadCompressor) DecompressMessage(m any) error {
+	return p.decompressMessage(m, p.c.Decompress)
+}
+
+// DecompressMessageContext is like DecompressMessage, but applies the
+// Compressor's profile labels on top of those carried by ctx.
+func (p *PayloadCompressor) DecompressMessageContext(ctx context.Context, m any) error {
+	return p.decompressMessage(m, func(b []byte) ([]byte, error) {
+		return p.c.DecompressContext(ctx, b)
+	})
+}
+
+func (p *PayloadCompressor) decompressMessage(m any, decompress func([]byte) ([]byte, error)) error {
+	msg, ok := m.(proto.Message)
+	if !ok || !p.relevantType(msg.ProtoReflect().Descriptor()) {
+		return nil
+	}
+	return p.walk(msg.ProtoReflect(), func(b []byte) ([]byte, error) {
+		if !bytes.HasPrefix(b, zstdMagic) {
+			return b, nil
+		}
+		out, err := decompress(b)
+		if err != nil {
+			return nil, p.decodeError(b, err)
+		}
+		return out, nil
+	})
+}
+
+// decodeError describes a payload field that failed to decompress.
+func (p *PayloadCompressor) decodeError(frame []byte, err error) error {
+	de := &DecodeError{Compressor: payloadCompressorName, LocalDictID: p.dictID, Err: err}
+	var mismatch *zstddict.DictMismatchError
+	if errors.As(err, &mismatch) {
+		de.FrameDictID = mismatch.Actual
+		de.Err = ErrDictMismatch
+		if p.dictID == 0 {
+			de.Err = ErrDictMissing
+		}
+	} else {
+		var h zstd.Header
+		if h.Decode(frame) == nil {
+			de.FrameDictID = h.DictionaryID
+		}
+	}
+	return de
+}
+
+// relevantType reports whether messages of type md can contain payload
+// fields.
+func (p *PayloadCompressor) relevantType(md protoreflect.MessageDescriptor) bool {
+	if v, ok := p.relevant.Load(md.FullName()); ok {
+		return v.(bool)
+	}
+	ok := p.hasFields(md, nil)
+	p.relevant.Store(md.FullName(), ok)
+	return ok
+}
+
+// hasFields reports whether messages of type md can contain payload
+// fields. seen guards against recursive message types.
+func (p *PayloadCompressor) hasFields(md protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool) bool {
+	if len(p.fields[md.FullName()]) > 0 {
+		return true
+	}
+	if seen == nil {
+		seen = make(map[protoreflect.FullName]bool)
+	}
+	if seen[md.FullName()] {
+		return false
+	}
+	seen[md.FullName()] = true
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Message() != nil && p.hasFields(fd.Message(), seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk applies fn to every payload field value in m and its submessages.
+func (p *PayloadCompressor) walk(m protoreflect.Message, fn func([]byte) ([]byte, error)) error {
+	for _, fd := range p.fields[m.Descriptor().FullName()] {
+		if !m.Has(fd) {
+			continue
+		}
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			for i := range list.Len() {
+				b, err := fn(list.Get(i).Bytes())
+				if err != nil {
+					return err
+				}
+				list.Set(i, protoreflect.ValueOfBytes(b))
+			}
+			continue
+		}
+		b, err := fn(m.Get(fd).Bytes())
+		if err != nil {
+			return err
+		}
+		m.Set(fd, protoreflect.ValueOfBytes(b))
+	}
+
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				err = p.walk(mv.Message(), fn)
+				return err == nil
+			})
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = p.walk(list.Get(i).Message(), fn)
+			}
+		case !fd.IsMap() && !fd.IsList() && fd.Message() != nil:
+			err = p.walk(v.Message(), fn)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// peerAccepts reports whether the client behind ctx sent PayloadHeader
+// with this compressor's dictionary ID.
+func (p *PayloadCompressor) peerAccepts(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vals := md.Get(PayloadHeader)
+	return len(vals) > 0 && vals[0] == strconv.FormatUint(uint64(p.dictID), 10)
+}
+
+// outgoing adds PayloadHeader to the outgoing metadata of ctx.
+func (p *PayloadCompressor) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, PayloadHeader, strconv.FormatUint(uint64(p.dictID), 10))
+}
+
+// UnaryClientInterceptor compresses request payloads and decompresses
+// response payloads.
+func (p *PayloadCompressor) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		req, err := p.CompressMessageContext(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := invoker(p.outgoing(ctx), method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		return p.DecompressMessageContext(ctx, reply)
+	}
+}
+
+// StreamClientInterceptor compresses sent payloads and decompresses
+// received ones.
+func (p *PayloadCompressor) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(p.outgoing(ctx), desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &payloadClientStream{ClientStream: cs, p: p}, nil
+	}
+}
+
+type payloadClientStream struct {
+	grpc.ClientStream
+	p *PayloadCompressor
+}
+
+func (s *payloadClientStream) SendMsg(m any) error {
+	m, err := s.p.CompressMessageContext(s.Context(), m)
+	if err != nil {
+		return err
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *payloadClientStream) RecvMsg(m any) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.p.DecompressMessageContext(s.Context(), m)
+}
+
+// UnaryServerInterceptor decompresses request payloads and, for clients
+// that advertise the dictionary, compresses response payloads. Requests
+// that fail to decompress are rejected with the status built by Status.
+func (p *PayloadCompressor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p.DecompressMessageContext(ctx, req); err != nil {
+			return nil, statusFor(err)
+		}
+		resp, err := handler(ctx, req)
+		if err != nil || !p.peerAccepts(ctx) {
+			return resp, err
+		}
+		return p.CompressMessageContext(ctx, resp)
+	}
+}
+
+// StreamServerInterceptor decompresses received payloads and, for clients
+// that advertise the dictionary, compresses sent payloads.
+func (p *PayloadCompressor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &payloadServerStream{ServerStream: ss, p: p, compress: p.peerAccepts(ss.Context())})
+	}
+}
+
+type payloadServerStream struct {
+	grpc.ServerStream
+	p        *PayloadCompressor
+	compress bool
+}
+
+func (s *payloadServerStream) SendMsg(m any) error {
+	if s.compress {
+		var err error
+		if m, err = s.p.CompressMessageContext(s.Context(), m); err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *payloadServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return statusFor(s.p.DecompressMessageContext(s.Context(), m))
+}
+
+// statusFor converts a *DecodeError into its rich status error.
+func statusFor(err error) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return Status(de).Err()
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package grpccodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestPayloadCompressor(t *testing.T) {
+	dict := testdict.Train(t, 5005)
+	fields := PayloadFields{
+		"google.protobuf.BytesValue": {"value"},
+		"google.protobuf.Any":        {"value"},
+	}
+	// The interceptors run their payload work under the profile labels.
+	pc, err := NewPayloadCompressor(dict, fields, zstddict.WithProfileLabels("payload"))
+	if err != nil {
+		t.Fatalf("NewPayloadCompressor() error = %v", err)
+	}
+
+	payload := []byte(strings.Repeat("/usr/local/bin/tool3 4096 -rw-r--r--\n", 20))
+	// Any values are found inside lists of submessages.
+	typ := &typepb.Type{Name: "t", Options: []*typepb.Option{
+		{Name: "a", Value: &anypb.Any{TypeUrl: "x", Value: payload}},
+		{Name: "b", Value: &anypb.Any{TypeUrl: "x", Value: []byte("tiny")}},
+	}}
+	sent, err := pc.CompressMessage(typ)
+	if err != nil {
+		t.Fatalf("CompressMessage() error = %v", err)
+	}
+	if !bytes.Equal(typ.Options[0].Value.Value, payload) {
+		t.Fatal("CompressMessage() modified its argument")
+	}
+	got := sent.(*typepb.Type)
+	if v := got.Options[0].Value.Value; len(v) >= len(payload) || !bytes.HasPrefix(v, zstdMagic) {
+		t.Errorf("payload field not compressed: %d bytes", len(v))
+	}
+	if v := got.Options[1].Value.Value; !bytes.Equal(v, []byte("tiny")) {
+		t.Errorf("incompressible field = %q, want it left as is", v)
+	}
+	if err := pc.DecompressMessage(got); err != nil {
+		t.Fatalf("DecompressMessage() error = %v", err)
+	}
+	if !proto.Equal(got, typ) {
+		t.Error("round trip through CompressMessage and DecompressMessage changed the message")
+	}
+
+	// Client and server interceptors agree through PayloadHeader.
+	var onWire *wrapperspb.BytesValue
+	handler := func(ctx context.Context, req any) (any, error) {
+		if !bytes.Equal(req.(*wrapperspb.BytesValue).Value, payload) {
+			t.Error("server handler saw a compressed request")
+		}
+		return wrapperspb.Bytes(payload), nil
+	}
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		onWire = req.(*wrapperspb.BytesValue)
+		md, _ := metadata.FromOutgoingContext(ctx)
+		resp, err := pc.UnaryServerInterceptor()(metadata.NewIncomingContext(ctx, md), proto.Clone(onWire), &grpc.UnaryServerInfo{}, handler)
+		if err != nil {
+			return err
+		}
+		proto.Merge(reply.(proto.Message), resp.(proto.Message))
+		return nil
+	}
+	reply := &wrapperspb.BytesValue{}
+	if err := pc.UnaryClientInterceptor()(context.Background(), "/svc/M", wrapperspb.Bytes(payload), reply, nil, invoker); err != nil {
+		t.Fatalf("unary call error = %v", err)
+	}
+	if !bytes.HasPrefix(onWire.Value, zstdMagic) {
+		t.Error("request payload was not compressed on the wire")
+	}
+	if !bytes.Equal(reply.Value, payload) {
+		t.Error("client did not decompress the response payload")
+	}
+
+	// Servers don't compress responses for clients that didn't ask.
+	resp, err := pc.UnaryServerInterceptor()(context.Background(), wrapperspb.Bytes(payload), &grpc.UnaryServerInfo{}, handler)
+	if err != nil || !bytes.Equal(resp.(*wrapperspb.BytesValue).Value, payload) {
+		t.Errorf("response to plain client = %v, %v; want uncompressed", resp, err)
+	}
+
+	// A payload made with another dictionary is rejected with a rich status.
+	other, _ := NewPayloadCompressor(testdict.Train(t, 6006), fields)
+	bad, _ := other.CompressMessage(wrapperspb.Bytes(payload))
+	_, err = pc.UnaryServerInterceptor()(context.Background(), bad, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("mismatched payload status = %v, want FailedPrecondition", err)
+	}
+	var de *DecodeError
+	if !errors.As(FromStatus(err), &de) || de.FrameDictID != 6006 || de.LocalDictID != 5005 {
+		t.Errorf("FromStatus() = %v, want dictionaries 6006 and 5005", FromStatus(err))
+	}
+
+	if _, err := NewPayloadCompressor(dict, PayloadFields{"google.protobuf.Any": {"type_url"}}); err == nil {
+		t.Error("NewPayloadCompressor() with a string field succeeded, want error")
+	}
+}
@@ -0,0 +1,493 @@
+package grpccodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// TypeCompressorName returns the compressor name used for messages of type
+// msg, such as "zstd-dict.filelist.ListFilesResponse".
+func TypeCompressorName(msg protoreflect.FullName) string {
+	return NameZstdDict + "." + string(msg)
+}
+
+// TypeCompressor is a gRPC compressor dedicated to one protobuf message
+// type. Unlike Zstd, its dictionary can be replaced while RPCs are in
+// flight: gRPC's compressor registry may only change before serving starts,
+// so the compressor is registered once and swaps dictionaries internally.
+//
+// It compresses with the most recent dictionary, or without one until the
+// first is set, and decompresses frames made with any dictionary it has
+// ever been given.
+type TypeCompressor struct {
+	name    string
+	msgType protoreflect.FullName
+	opts    []CodecOption
+	plain   *Zstd
+
+	mu      sync.Mutex                       // serializes SetDict
+	current atomic.Pointer[Zstd]             // nil until the first SetDict
+	byID    atomic.Pointer[map[uint32]*Zstd] // copy-on-write
+}
+
+// RegisterTypeCompressor registers the compressor for messages of type msg
+// with gRPC, or returns the one already registered. Like
+// RegisterWithConfig, it must be called before serving starts or client
+// connections are created; dictionaries can be set at any time.
+func RegisterTypeCompressor(msg protoreflect.FullName, opts ...CodecOption) (*TypeCompressor, error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	name := TypeCompressorName(msg)
+	if t, ok := registry.types[name]; ok {
+		return t, nil
+	}
+	if encoding.GetCompressor(name) != nil {
+		return nil, fmt.Errorf("%w: %q", ErrAlreadyRegistered, name)
+	}
+
+	t := &TypeCompressor{name: name, msgType: msg, opts: opts, plain: NewZstd(opts...)}
+	t.plain.name = name
+	t.byID.Store(&map[uint32]*Zstd{})
+	encoding.RegisterCompressor(t)
+	if registry.types == nil {
+		registry.types = make(map[string]*TypeCompressor)
+	}
+	registry.types[name] = t
+	return t, nil
+}
+
+// Name returns the name of the compressor.
+func (t *TypeCompressor) Name() string {
+	return t.name
+}
+
+// MessageType returns the message type the compressor is dedicated to.
+func (t *TypeCompressor) MessageType() protoreflect.FullName {
+	return t.msgType
+}
+
+// SetDict makes dict the dictionary for new messages. Earlier
+// dictionaries remain available for decompression.
+func (t *TypeCompressor) SetDict(dict []byte) error {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	z, ok := (*t.byID.Load())[d.ID()]
+	if !ok {
+		z = NewZstdDict(dict, t.opts...)
+		z.name = t.name
+		byID := maps.Clone(*t.byID.Load())
+		byID[d.ID()] = z
+		t.byID.Store(&byID)
+	} else if !bytes.Equal(z.dict, dict) {
+		return fmt.Errorf("grpccodec: %s: dictionary ID %d is already used by a different dictionary", t.name, d.ID())
+	}
+	t.current.Store(z)
+	return nil
+}
+
+// Dict returns the current dictionary and its ID, or nil and 0 if none has
+// been set.
+func (t *TypeCompressor) Dict() ([]byte, uint32) {
+	z := t.current.Load()
+	if z == nil {
+		return nil, 0
+	}
+	return bytes.Clone(z.dict), z.dictID
+}
+
+// Compress implements encoding.Compressor.
+func (t *TypeCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if z := t.current.Load(); z != nil {
+		return z.Compress(w)
+	}
+	return t.plain.Compress(w)
+}
+
+// Decompress implements encoding.Compressor. The frame header selects the
+// dictionary; frames needing one this compressor was never given fail with
+// a *DecodeError wrapping ErrDictMismatch, or ErrDictMissing if it has none.
+func (t *TypeCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	var hdr [zstd.HeaderMaxSize]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(hdr[:n]), r)
+
+	var h zstd.Header
+	if h.Decode(hdr[:n]) != nil || h.Skippable || h.DictionaryID == 0 {
+		return t.plain.Decompress(r)
+	}
+	if z, ok := (*t.byID.Load())[h.DictionaryID]; ok {
+		return z.Decompress(r)
+	}
+	cause := ErrDictMismatch
+	_, localID := t.Dict()
+	if localID == 0 {
+		cause = ErrDictMissing
+	}
+	return nil, &DecodeError{Compressor: t.name, FrameDictID: h.DictionaryID, LocalDictID: localID, Err: cause}
+}
+
+// ProvisionOptions configures a Provisioner.
+type ProvisionOptions struct {
+	// Files resolves service descriptors. If nil,
+	// protoregistry.GlobalFiles is used.
+	Files *protoregistry.Files
+	// MaxSamples is the number of responses kept per message type for
+	// training, chosen by reservoir sampling. If 0, 2000 is used.
+	MaxSamples int
+	// MinSamples is the number of captured responses needed before a
+	// message type's first dictionary is trained. If 0, 100 is used.
+	MinSamples int
+	// RetrainAfter is the number of responses captured since the last
+	// training after which a message type is trained again. If 0, each
+	// type is trained once.
+	RetrainAfter int
+	// MaxDictSize bounds each dictionary; see zstddict.TrainDictOptions.
+	MaxDictSize int
+	// Filter, if set, is applied to each captured response before it is
+	// kept for training, so redacted data never reaches the reservoir.
+	Filter zstddict.SampleFilter
+	// CodecOptions configure the per-type compressors.
+	CodecOptions []CodecOption
+	// OnTrain, if set, is called after every training attempt, for
+	// example to log or publish the new dictionary.
+	OnTrain func(ProvisionedType, error)
+}
+
+// Provisioner maintains one dictionary per response message type of a
+// gRPC server, trained from the server's own responses, so dictionaries
+// need not be curated by hand for each service. Methods returning the same
+// message type share a dictionary.
+//
+// Install its interceptors, register services, then call Inspect before
+// serving:
+//
+//	p := grpccodec.NewProvisioner(grpccodec.ProvisionOptions{RetrainAfter: 10000})
+//	s := grpc.NewServer(
+//	    grpc.ChainUnaryInterceptor(p.UnaryServerInterceptor()),
+//	    grpc.ChainStreamInterceptor(p.StreamServerInterceptor()),
+//	)
+//	pb.RegisterFileListServiceServer(s, impl)
+//	if err := p.Inspect(s); err != nil {
+//	    log.Fatal(err)
+//	}
+//	go p.Run(ctx, time.Minute)
+//
+// Once a type has a dictionary, its responses are sent with that type's
+// TypeCompressor whenever the client advertises it. Clients opt in by
+// calling RegisterTypeCompressor for the types they expect and setting the
+// dictionaries published through Types or OnTrain.
+type Provisioner struct {
+	opts ProvisionOptions
+
+	mu      sync.Mutex
+	methods map[string]*TypeCompressor // by full method name
+	types   map[protoreflect.FullName]*typeSamples
+	rng     *rand.Rand
+}
+
+// typeSamples is the training state of one message type, guarded by
+// Provisioner.mu.
+type typeSamples struct {
+	comp    *TypeCompressor
+	methods []string
+	samples [][]byte
+	seen    int // responses offered for sampling
+	fresh   int // responses offered since the last training
+}
+
+// ProvisionedType describes the dictionary maintained for one message type.
+type ProvisionedType struct {
+	MessageType protoreflect.FullName
+	// Methods are the full method names returning MessageType.
+	Methods []string
+	// Compressor is the name of the type's TypeCompressor.
+	Compressor string
+	// Dict and DictID are the current dictionary, or nil and 0 before the
+	// first training.
+	Dict   []byte
+	DictID uint32
+	// Samples is the number of responses held for training.
+	Samples int
+}
+
+// NewProvisioner returns a Provisioner configured by opts.
+func NewProvisioner(opts ProvisionOptions) *Provisioner {
+	if opts.Files == nil {
+		opts.Files = protoregistry.GlobalFiles
+	}
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = 2000
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = 100
+	}
+	return &Provisioner{
+		opts:    opts,
+		methods: make(map[string]*TypeCompressor),
+		types:   make(map[protoreflect.FullName]*typeSamples),
+		rng:     rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+// Inspect looks up the response type of every method registered on srv,
+// typically a *grpc.Server, and registers a TypeCompressor for each
+// distinct type. It must be called before serving starts. Services missing
+// from the descriptor registry are skipped.
+func (p *Provisioner) Inspect(srv interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for svcName, info := range srv.GetServiceInfo() {
+		d, err := p.opts.Files.FindDescriptorByName(protoreflect.FullName(svcName))
+		if err != nil {
+			continue
+		}
+		svc, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		for _, m := range info.Methods {
+			md := svc.Methods().ByName(protoreflect.Name(m.Name))
+			if md == nil {
+				continue
+			}
+			msg := md.Output().FullName()
+			ts, ok := p.types[msg]
+			if !ok {
+				comp, err := RegisterTypeCompressor(msg, p.opts.CodecOptions...)
+				if err != nil {
+					return err
+				}
+				ts = &typeSamples{comp: comp}
+				p.types[msg] = ts
+			}
+			fullMethod := "/" + svcName + "/" + m.Name
+			if _, ok := p.methods[fullMethod]; !ok {
+				ts.methods = append(ts.methods, fullMethod)
+				p.methods[fullMethod] = ts.comp
+			}
+		}
+	}
+	return nil
+}
+
+// UnaryServerInterceptor captures responses for training and sends them
+// with their type's compressor.
+func (p *Provisioner) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if comp := p.compressor(info.FullMethod); comp != nil {
+			p.capture(comp, resp)
+			p.route(ctx, comp)
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor captures streamed responses for training and
+// sends them with their type's compressor.
+func (p *Provisioner) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		comp := p.compressor(info.FullMethod)
+		if comp == nil {
+			return handler(srv, ss)
+		}
+		p.route(ss.Context(), comp)
+		return handler(srv, &captureStream{ServerStream: ss, p: p, comp: comp})
+	}
+}
+
+// captureStream offers each sent message to the Provisioner.
+type captureStream struct {
+	grpc.ServerStream
+	p    *Provisioner
+	comp *TypeCompressor
+}
+
+func (s *captureStream) SendMsg(m any) error {
+	s.p.capture(s.comp, m)
+	return s.ServerStream.SendMsg(m)
+}
+
+func (p *Provisioner) compressor(fullMethod string) *TypeCompressor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.methods[fullMethod]
+}
+
+// route switches the response to comp once it has a dictionary. gRPC
+// refuses compressors the client didn't advertise, leaving the client's
+// choice in place.
+func (p *Provisioner) route(ctx context.Context, comp *TypeCompressor) {
+	if comp.current.Load() != nil {
+		_ = grpc.SetSendCompressor(ctx, comp.Name())
+	}
+}
+
+// capture offers resp to its type's reservoir. Responses the reservoir
+// would discard are never marshaled.
+func (p *Provisioner) capture(comp *TypeCompressor, resp any) {
+	m, ok := resp.(proto.Message)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	ts := p.types[comp.msgType]
+	ts.seen++
+	ts.fresh++
+	slot := len(ts.samples)
+	if slot >= p.opts.MaxSamples {
+		slot = p.rng.IntN(ts.seen)
+	}
+	p.mu.Unlock()
+	if slot >= p.opts.MaxSamples {
+		return
+	}
+
+	data, err := proto.Marshal(m)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	if p.opts.Filter != nil {
+		var keep bool
+		if data, keep = p.opts.Filter(data); !keep || len(data) == 0 {
+			return
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slot < len(ts.samples) {
+		ts.samples[slot] = data
+	} else {
+		ts.samples = append(ts.samples, data)
+	}
+}
+
+// Train trains a dictionary for every message type that has enough samples
+// and either has no dictionary yet or has captured RetrainAfter responses
+// since its last training, and installs it in the type's compressor.
+func (p *Provisioner) Train() error {
+	p.mu.Lock()
+	var due []*typeSamples
+	var samples [][][]byte
+	for _, ts := range p.types {
+		if len(ts.samples) < p.opts.MinSamples {
+			continue
+		}
+		if ts.comp.current.Load() != nil && (p.opts.RetrainAfter <= 0 || ts.fresh < p.opts.RetrainAfter) {
+			continue
+		}
+		ts.fresh = 0
+		due = append(due, ts)
+		samples = append(samples, slices.Clone(ts.samples))
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for i, ts := range due {
+		dict, err := p.train(samples[i])
+		if err == nil {
+			err = ts.comp.SetDict(dict)
+		}
+		if err != nil {
+			err = fmt.Errorf("grpccodec: training %s: %w", ts.comp.msgType, err)
+			errs = append(errs, err)
+		}
+		if p.opts.OnTrain != nil {
+			p.opts.OnTrain(p.describe(ts), err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// train builds a dictionary from samples. The dictionary builder panics on
+// some degenerate inputs, such as identical samples; those become errors so
+// one message type can't take down the server.
+func (p *Provisioner) train(samples [][]byte) (dict []byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("dictionary builder panicked: %v", v)
+		}
+	}()
+	return zstddict.TrainDict(samples, &zstddict.TrainDictOptions{MaxDictSize: p.opts.MaxDictSize})
+}
+
+// Run calls Train every interval until ctx is done, then returns
+// ctx.Err(). Training errors are reported through OnTrain.
+func (p *Provisioner) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			_ = p.Train()
+		}
+	}
+}
+
+// Types describes every provisioned message type, sorted by name.
+func (p *Provisioner) Types() []ProvisionedType {
+	p.mu.Lock()
+	all := slices.Collect(maps.Values(p.types))
+	p.mu.Unlock()
+
+	types := make([]ProvisionedType, 0, len(all))
+	for _, ts := range all {
+		types = append(types, p.describe(ts))
+	}
+	slices.SortFunc(types, func(a, b ProvisionedType) int {
+		return strings.Compare(string(a.MessageType), string(b.MessageType))
+	})
+	return types
+}
+
+func (p *Provisioner) describe(ts *typeSamples) ProvisionedType {
+	dict, id := ts.comp.Dict()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	methods := slices.Clone(ts.methods)
+	slices.Sort(methods)
+	return ProvisionedType{
+		MessageType: ts.comp.msgType,
+		Methods:     methods,
+		Compressor:  ts.comp.Name(),
+		Dict:        dict,
+		DictID:      id,
+		Samples:     len(ts.samples),
+	}
+}
@@ -0,0 +1,155 @@
+package grpccodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestTypeCompressor(t *testing.T) {
+	tc, err := RegisterTypeCompressor("test.TypeCompressorMessage")
+	if err != nil {
+		t.Fatalf("RegisterTypeCompressor() error = %v", err)
+	}
+	if again, err := RegisterTypeCompressor("test.TypeCompressorMessage"); err != nil || again != tc {
+		t.Fatalf("second RegisterTypeCompressor() = %p, %v; want %p", again, err, tc)
+	}
+
+	data := bytes.Repeat([]byte("/usr/local/bin/tool3 4096 -rw-r--r--\n"), 20)
+	plain := compressType(t, tc, data)
+	if err := tc.SetDict(testdict.Train(t, 1001)); err != nil {
+		t.Fatalf("SetDict(1001) error = %v", err)
+	}
+	first := compressType(t, tc, data)
+	if err := tc.SetDict(testdict.Train(t, 2002)); err != nil {
+		t.Fatalf("SetDict(2002) error = %v", err)
+	}
+	second := compressType(t, tc, data)
+	if _, id := tc.Dict(); id != 2002 || RegisteredDictID(tc.Name()) != 2002 {
+		t.Errorf("current dictionary = %d, want 2002", id)
+	}
+
+	// Frames from every dictionary generation stay decodable.
+	for i, frame := range [][]byte{plain, first, second} {
+		r, err := tc.Decompress(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatalf("frame %d: Decompress() error = %v", i, err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("frame %d: round trip = %d bytes, %v; want original", i, len(got), err)
+		}
+	}
+
+	other := NewZstdDict(testdict.Train(t, 3003))
+	_, err = tc.Decompress(bytes.NewReader(compressWith(t, other, data)))
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrDictMismatch) || de.FrameDictID != 3003 || de.LocalDictID != 2002 {
+		t.Errorf("Decompress() with unknown dictionary error = %v, want mismatch 3003 vs 2002", err)
+	}
+}
+
+type echoFiles struct {
+	pb.UnimplementedFileListServiceServer
+}
+
+func (echoFiles) ListFiles(_ context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	resp := &pb.ListFilesResponse{Root: req.GetPath()}
+	for i := range 20 {
+		resp.Files = append(resp.Files, &pb.FileInfo{Path: req.GetPath() + "/file" + strconv.Itoa(i%5), Size: 4096, Mode: 0o644})
+	}
+	return resp, nil
+}
+
+func TestProvisioner(t *testing.T) {
+	p := NewProvisioner(ProvisionOptions{MinSamples: 20})
+	var mon ConnMonitor
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(p.UnaryServerInterceptor()), grpc.StatsHandler(&mon))
+	pb.RegisterFileListServiceServer(s, echoFiles{})
+	if err := p.Inspect(s); err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(NameZstd)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewFileListServiceClient(conn)
+
+	calls := 0
+	call := func() {
+		t.Helper()
+		calls++
+		req := &pb.ListFilesRequest{Path: "/srv/data/user" + strconv.Itoa(calls)}
+		if _, err := client.ListFiles(context.Background(), req); err != nil {
+			t.Fatalf("ListFiles() error = %v", err)
+		}
+	}
+	for range 30 {
+		call()
+	}
+	if got := mon.Conns()[0].OutCompressor; got != NameZstd {
+		t.Errorf("before training, response compressor = %q, want %q", got, NameZstd)
+	}
+
+	if err := p.Train(); err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+	types := p.Types()
+	if len(types) != 2 {
+		t.Fatalf("Types() = %d entries, want 2", len(types))
+	}
+	if idle := types[0]; idle.MessageType != "filelist.DiffFilesResponse" || idle.DictID != 0 || idle.Samples != 0 {
+		t.Errorf("Types()[0] = %s, dict %d, %d samples; want untrained DiffFilesResponse", idle.MessageType, idle.DictID, idle.Samples)
+	}
+	pt := types[1]
+	if pt.MessageType != "filelist.ListFilesResponse" || pt.DictID == 0 || pt.Samples != 30 {
+		t.Errorf("Types()[1] = %s, dict %d, %d samples; want trained ListFilesResponse with 30 samples",
+			pt.MessageType, pt.DictID, pt.Samples)
+	}
+	if len(pt.Methods) != 1 || pt.Methods[0] != "/filelist.FileListService/ListFiles" {
+		t.Errorf("Methods = %v, want ListFiles", pt.Methods)
+	}
+
+	// Client and server share the registry here, so the client already
+	// holds the new dictionary.
+	call()
+	c := mon.Conns()[0]
+	if c.OutCompressor != pt.Compressor || c.OutDictID != pt.DictID {
+		t.Errorf("after training, response compressor = %q (dict %d), want %q (dict %d)",
+			c.OutCompressor, c.OutDictID, pt.Compressor, pt.DictID)
+	}
+}
+
+func compressType(t *testing.T, tc *TypeCompressor, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := tc.Compress(&buf)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,262 @@
+package grpccodec
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+// NameZstdDictCandidate is the default compressor name for a dictionary
+// being rolled out with a Rollout.
+const NameZstdDictCandidate = "zstd-dict-candidate"
+
+// RegisterDictAs registers a dictionary compressor for dict under name
+// instead of NameZstdDict, typically NameZstdDictCandidate, so two
+// dictionaries can be in use side by side. Clients must register it too
+// to advertise support. The registration rules of RegisterWithConfig
+// apply.
+func RegisterDictAs(name string, dict []byte, opts ...CodecOption) error {
+	if name == NameZstd || name == NameZstdDict {
+		return fmt.Errorf("grpccodec: RegisterDictAs: %q is reserved", name)
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	z := NewZstdDict(dict, opts...)
+	z.name = name
+	return registerLocked(z)
+}
+
+// RolloutOptions configures a Rollout.
+type RolloutOptions struct {
+	// Control and Candidate name the compressors compared. If empty,
+	// NameZstdDict and NameZstdDictCandidate are used.
+	Control   string
+	Candidate string
+	// Percent is the share of eligible RPCs, from 0 to 100, whose
+	// responses use the candidate.
+	Percent float64
+	// MinMessages is the number of messages each arm must send before
+	// the arms are compared. If 0, 1000 is used.
+	MinMessages int64
+	// MaxRegression is how much lower, as a fraction, the candidate's
+	// compression ratio may be than the control's before the rollout is
+	// rolled back. If 0, 0.02 is used.
+	MaxRegression float64
+	// OnRollback, if set, is called once when the rollout is rolled back.
+	OnRollback func(RolloutStats)
+}
+
+// ArmStats reports the responses sent with one compressor of a Rollout.
+// Byte counts cover message payloads only.
+type ArmStats struct {
+	Compressor      string
+	DictID          uint32
+	Messages        int64
+	Bytes           int64 // uncompressed
+	CompressedBytes int64
+}
+
+// Ratio returns the compression ratio, uncompressed over compressed size,
+// or 0 before any bytes were sent.
+func (a ArmStats) Ratio() float64 {
+	if a.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(a.Bytes) / float64(a.CompressedBytes)
+}
+
+// RolloutStats is a snapshot of a Rollout.
+type RolloutStats struct {
+	Control    ArmStats
+	Candidate  ArmStats
+	Percent    float64
+	RolledBack bool
+}
+
+// Rollout gradually moves a server's responses to a candidate dictionary.
+// For every RPC whose client advertises both the control and the
+// candidate compressor, it sends the response with the candidate for
+// Percent of RPCs and with the control otherwise, and compares the
+// compression ratios of the two arms. Once both arms have sent
+// MinMessages messages, a candidate whose ratio falls more than
+// MaxRegression below the control's is rolled back: Percent drops to 0
+// until SetPercent is called again.
+//
+// The candidate is registered under its own name on servers and on the
+// clients able to use it:
+//
+//	grpccodec.RegisterDictAs(grpccodec.NameZstdDictCandidate, newDict)
+//	r := grpccodec.NewRollout(grpccodec.RolloutOptions{Percent: 5})
+//	s := grpc.NewServer(
+//	    grpc.StatsHandler(r),
+//	    grpc.ChainUnaryInterceptor(r.UnaryServerInterceptor()),
+//	    grpc.ChainStreamInterceptor(r.StreamServerInterceptor()),
+//	)
+//
+// Rollout is a stats handler so it can see each message's compressed size.
+type Rollout struct {
+	opts RolloutOptions
+
+	mu         sync.Mutex
+	percent    float64
+	rolledBack bool
+	control    ArmStats
+	candidate  ArmStats
+}
+
+// NewRollout returns a Rollout configured by opts.
+func NewRollout(opts RolloutOptions) *Rollout {
+	if opts.Control == "" {
+		opts.Control = NameZstdDict
+	}
+	if opts.Candidate == "" {
+		opts.Candidate = NameZstdDictCandidate
+	}
+	if opts.MinMessages <= 0 {
+		opts.MinMessages = 1000
+	}
+	if opts.MaxRegression <= 0 {
+		opts.MaxRegression = 0.02
+	}
+	return &Rollout{
+		opts:      opts,
+		percent:   opts.Percent,
+		control:   ArmStats{Compressor: opts.Control},
+		candidate: ArmStats{Compressor: opts.Candidate},
+	}
+}
+
+// SetPercent changes the candidate's share of eligible RPCs and clears a
+// rollback.
+func (r *Rollout) SetPercent(percent float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.percent = percent
+	r.rolledBack = false
+}
+
+// Stats returns the current state of the rollout.
+func (r *Rollout) Stats() RolloutStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statsLocked()
+}
+
+func (r *Rollout) statsLocked() RolloutStats {
+	s := RolloutStats{Control: r.control, Candidate: r.candidate, Percent: r.percent, RolledBack: r.rolledBack}
+	s.Control.DictID = RegisteredDictID(r.opts.Control)
+	s.Candidate.DictID = RegisteredDictID(r.opts.Candidate)
+	return s
+}
+
+// rolloutArm records the compressor chosen for an RPC. TagRPC stores it in
+// the RPC context, the interceptors fill it in, and HandleRPC reads it.
+type rolloutArm struct {
+	mu   sync.Mutex
+	name string
+}
+
+type rolloutArmKey struct{}
+
+// choose picks the compressor for the RPC behind ctx and sets it as the
+// send compressor. RPCs from clients lacking either compressor are left
+// alone.
+func (r *Rollout) choose(ctx context.Context) {
+	supported, err := grpc.ClientSupportedCompressors(ctx)
+	if err != nil || !slices.Contains(supported, r.opts.Control) || !slices.Contains(supported, r.opts.Candidate) {
+		return
+	}
+	r.mu.Lock()
+	percent := r.percent
+	r.mu.Unlock()
+
+	name := r.opts.Control
+	if rand.Float64()*100 < percent {
+		name = r.opts.Candidate
+	}
+	if grpc.SetSendCompressor(ctx, name) != nil {
+		return
+	}
+	if arm, ok := ctx.Value(rolloutArmKey{}).(*rolloutArm); ok {
+		arm.mu.Lock()
+		arm.name = name
+		arm.mu.Unlock()
+	}
+}
+
+// UnaryServerInterceptor assigns each RPC to an arm.
+func (r *Rollout) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		r.choose(ctx)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor assigns each streaming RPC to an arm.
+func (r *Rollout) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		r.choose(ss.Context())
+		return handler(srv, ss)
+	}
+}
+
+// TagRPC implements stats.Handler.
+func (r *Rollout) TagRPC(ctx context.Context, _ *grpcstats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, rolloutArmKey{}, &rolloutArm{})
+}
+
+// HandleRPC implements stats.Handler, recording each sent message against
+// its RPC's arm.
+func (r *Rollout) HandleRPC(ctx context.Context, s grpcstats.RPCStats) {
+	out, ok := s.(*grpcstats.OutPayload)
+	if !ok {
+		return
+	}
+	arm, ok := ctx.Value(rolloutArmKey{}).(*rolloutArm)
+	if !ok {
+		return
+	}
+	arm.mu.Lock()
+	name := arm.name
+	arm.mu.Unlock()
+	if name == "" {
+		return
+	}
+
+	r.mu.Lock()
+	a := &r.control
+	if name == r.opts.Candidate {
+		a = &r.candidate
+	}
+	a.Messages++
+	a.Bytes += int64(out.Length)
+	a.CompressedBytes += int64(out.CompressedLength)
+
+	var rolledBack *RolloutStats
+	if !r.rolledBack && r.percent > 0 &&
+		r.control.Messages >= r.opts.MinMessages && r.candidate.Messages >= r.opts.MinMessages &&
+		r.candidate.Ratio() < r.control.Ratio()*(1-r.opts.MaxRegression) {
+		r.percent = 0
+		r.rolledBack = true
+		st := r.statsLocked()
+		rolledBack = &st
+	}
+	r.mu.Unlock()
+
+	if rolledBack != nil && r.opts.OnRollback != nil {
+		r.opts.OnRollback(*rolledBack)
+	}
+}
+
+// TagConn implements stats.Handler.
+func (r *Rollout) TagConn(ctx context.Context, _ *grpcstats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (r *Rollout) HandleConn(context.Context, grpcstats.ConnStats) {}
@@ -0,0 +1,94 @@
+package grpccodec
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRollout(t *testing.T) {
+	// The control dictionary is trained on the responses; the candidate
+	// on unrelated data, so it compresses them worse.
+	var samples [][]byte
+	for i := range 200 {
+		resp, _ := echoFiles{}.ListFiles(context.Background(), &pb.ListFilesRequest{Path: "/srv/data/user" + strconv.Itoa(i)})
+		b, _ := proto.Marshal(resp)
+		samples = append(samples, b)
+	}
+	good, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{ID: 7007})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	const control, candidate = "zstd-dict-ab-control", "zstd-dict-ab-candidate"
+	if err := RegisterDictAs(control, good); err != nil {
+		t.Fatalf("RegisterDictAs() error = %v", err)
+	}
+	if err := RegisterDictAs(candidate, testdict.Train(t, 8008)); err != nil {
+		t.Fatalf("RegisterDictAs() error = %v", err)
+	}
+	if err := RegisterDictAs(NameZstdDict, good); err == nil {
+		t.Error("RegisterDictAs() with a reserved name succeeded")
+	}
+
+	var rolledBack RolloutStats
+	r := NewRollout(RolloutOptions{
+		Control:     control,
+		Candidate:   candidate,
+		Percent:     50,
+		MinMessages: 10,
+		OnRollback:  func(s RolloutStats) { rolledBack = s },
+	})
+	s := grpc.NewServer(grpc.StatsHandler(r),
+		grpc.ChainUnaryInterceptor(r.UnaryServerInterceptor()))
+	pb.RegisterFileListServiceServer(s, echoFiles{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewFileListServiceClient(conn)
+
+	for i := 0; i < 500 && !r.Stats().RolledBack; i++ {
+		if _, err := client.ListFiles(context.Background(), &pb.ListFilesRequest{Path: "/srv/data/user" + strconv.Itoa(i)}); err != nil {
+			t.Fatalf("ListFiles() error = %v", err)
+		}
+	}
+
+	st := r.Stats()
+	if !st.RolledBack || st.Percent != 0 {
+		t.Fatalf("Stats() = %+v, want the worse candidate rolled back", st)
+	}
+	if st.Control.DictID != 7007 || st.Candidate.DictID != 8008 {
+		t.Errorf("arm dictionaries = %d, %d; want 7007, 8008", st.Control.DictID, st.Candidate.DictID)
+	}
+	if st.Candidate.Ratio() >= st.Control.Ratio() {
+		t.Errorf("candidate ratio %.2f >= control ratio %.2f", st.Candidate.Ratio(), st.Control.Ratio())
+	}
+	if !rolledBack.RolledBack {
+		t.Error("OnRollback was not called")
+	}
+
+	// After the rollback every response uses the control.
+	before := r.Stats().Candidate.Messages
+	for range 20 {
+		client.ListFiles(context.Background(), &pb.ListFilesRequest{Path: "/srv/data"})
+	}
+	if got := r.Stats().Candidate.Messages; got != before {
+		t.Errorf("candidate sent %d messages after rollback", got-before)
+	}
+}
@@ -0,0 +1,109 @@
+package grpccodec
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// NameMessageRouter is the codec name, sent as the content subtype, of a
+// MessageRouter.
+const NameMessageRouter = "zstd-router"
+
+// MessageRouter is an encoding.CodecV2 that compresses each message with
+// the dictionary routed to its protobuf type, whichever method carries it.
+// Services that exchange the same message types thus share one dictionary
+// per type, where method-based routing such as the Provisioner's would
+// need one per method or service.
+//
+//	r := grpccodec.NewMessageRouter()
+//	r.Route("filelist.ListFilesResponse", grpccodec.NewZstdDict(listingDict))
+//	r.Route("filelist.FileInfo", grpccodec.NewZstdDict(entryDict))
+//	s := grpc.NewServer(r.ServerOption())
+//	conn, err := grpc.NewClient(addr, creds, r.DialOption())
+//
+// Messages of types without a route are sent as plain protobuf. The
+// receiver picks the dictionary from the type it unmarshals into, so both
+// ends need the same routes; a frame compressed with a different
+// dictionary fails with a *DecodeError. As with ScopedCodec, the codec is
+// installed per server or connection and both ends must use it.
+type MessageRouter struct {
+	proto encoding.CodecV2
+
+	mu     sync.RWMutex
+	routes map[protoreflect.FullName]*Zstd
+}
+
+// NewMessageRouter returns a MessageRouter with no routes.
+func NewMessageRouter() *MessageRouter {
+	return &MessageRouter{
+		proto:  encoding.GetCodecV2(proto.Name),
+		routes: make(map[protoreflect.FullName]*Zstd),
+	}
+}
+
+// Route compresses messages of type msg with z. A nil z removes the route.
+// Routes may change while RPCs are in flight, but a receiver must have the
+// new route before any sender uses it.
+func (r *MessageRouter) Route(msg protoreflect.FullName, z *Zstd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if z == nil {
+		delete(r.routes, msg)
+		return
+	}
+	r.routes[msg] = z
+}
+
+// Lookup returns the compressor routed to msg, or nil.
+func (r *MessageRouter) Lookup(msg protoreflect.FullName) *Zstd {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routes[msg]
+}
+
+// route returns the compressor for v's message type, or nil.
+func (r *MessageRouter) route(v any) *Zstd {
+	m, ok := v.(protov2.Message)
+	if !ok {
+		return nil
+	}
+	return r.Lookup(m.ProtoReflect().Descriptor().FullName())
+}
+
+// Marshal implements encoding.CodecV2.
+func (r *MessageRouter) Marshal(v any) (mem.BufferSlice, error) {
+	if z := r.route(v); z != nil {
+		return marshalCompressed(r.proto, z, v)
+	}
+	return r.proto.Marshal(v)
+}
+
+// Unmarshal implements encoding.CodecV2.
+func (r *MessageRouter) Unmarshal(data mem.BufferSlice, v any) error {
+	if z := r.route(v); z != nil {
+		return unmarshalCompressed(r.proto, z, data, v)
+	}
+	return r.proto.Unmarshal(data, v)
+}
+
+// Name implements encoding.CodecV2.
+func (r *MessageRouter) Name() string {
+	return NameMessageRouter
+}
+
+// ServerOption returns a server option installing r as the server's codec.
+func (r *MessageRouter) ServerOption() grpc.ServerOption {
+	return grpc.ForceServerCodecV2(r)
+}
+
+// DialOption returns a dial option installing r as the codec of every call
+// on the connection.
+func (r *MessageRouter) DialOption() grpc.DialOption {
+	return grpc.WithDefaultCallOptions(grpc.ForceCodecV2(r))
+}
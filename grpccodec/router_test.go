@@ -0,0 +1,70 @@
+package grpccodec
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageRouter(t *testing.T) {
+	r := NewMessageRouter()
+	r.Route("filelist.ListFilesResponse", NewZstdDict(testdict.Train(t, 1001)))
+
+	resp := &pb.ListFilesResponse{Root: "/srv", Files: []*pb.FileInfo{{Path: "/srv/a", Size: 4096}}}
+	data, err := r.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var h zstd.Header
+	if err := h.Decode(data.Materialize()); err != nil || h.DictionaryID != 1001 {
+		t.Errorf("routed message header = %+v, %v; want dictionary 1001", h, err)
+	}
+	got := new(pb.ListFilesResponse)
+	if err := r.Unmarshal(data, got); err != nil || !proto.Equal(got, resp) {
+		t.Errorf("Unmarshal() = %v, %v; want %v", got, err, resp)
+	}
+
+	req := &pb.ListFilesRequest{Path: "/srv"}
+	data, err = r.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want, _ := proto.Marshal(req); string(data.Materialize()) != string(want) {
+		t.Error("unrouted message is not plain protobuf")
+	}
+
+	s := grpc.NewServer(r.ServerOption())
+	pb.RegisterFileListServiceServer(s, echoFiles{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()), r.DialOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	out, err := pb.NewFileListServiceClient(conn).ListFiles(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if len(out.Files) != 20 {
+		t.Errorf("ListFiles() = %d files, want 20", len(out.Files))
+	}
+
+	r.Route("filelist.ListFilesResponse", nil)
+	if r.Lookup("filelist.ListFilesResponse") != nil {
+		t.Error("Route(nil) did not remove the route")
+	}
+}
@@ -0,0 +1,109 @@
+package grpccodec
+
+import (
+	"bytes"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+)
+
+// gRPC looks compressors up by name in a process-wide registry, so every
+// server and connection in a process shares one zstd-dict dictionary. The
+// helpers below avoid the registry: they install a message codec that
+// marshals protobuf and compresses the result with a given Zstd, on one
+// server or one connection only. Two servers in the same process can then
+// use different dictionaries:
+//
+//	a := grpc.NewServer(grpccodec.ServerCodec(grpccodec.NewZstdDict(dictA)))
+//	b := grpc.NewServer(grpccodec.ServerCodec(grpccodec.NewZstdDict(dictB)))
+//	conn, err := grpc.NewClient(addrA, creds, grpccodec.DialCodec(grpccodec.NewZstdDict(dictA)))
+//
+// Compression then happens inside the codec rather than as gRPC message
+// compression, so both ends must use these helpers: a server installed
+// with ServerCodec decodes every request with its Zstd and can't serve
+// clients that send plain protobuf, and the grpc-encoding header is not
+// used. Do not combine them with grpc.UseCompressor, which would compress
+// the already compressed messages again.
+
+// ScopedCodec is an encoding.CodecV2 that compresses marshaled protobuf
+// messages with a Zstd. Its Name is the Zstd's name, which clients send as
+// the content subtype.
+type ScopedCodec struct {
+	z     *Zstd
+	proto encoding.CodecV2
+}
+
+// NewScopedCodec returns a codec compressing messages with z.
+func NewScopedCodec(z *Zstd) *ScopedCodec {
+	return &ScopedCodec{z: z, proto: encoding.GetCodecV2(proto.Name)}
+}
+
+// Marshal implements encoding.CodecV2.
+func (c *ScopedCodec) Marshal(v any) (mem.BufferSlice, error) {
+	return marshalCompressed(c.proto, c.z, v)
+}
+
+// Unmarshal implements encoding.CodecV2. Frames compressed with another
+// dictionary fail with a *DecodeError, as with Zstd.Decompress.
+func (c *ScopedCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	return unmarshalCompressed(c.proto, c.z, data, v)
+}
+
+// marshalCompressed marshals v with codec and compresses the result with z.
+func marshalCompressed(codec encoding.CodecV2, z *Zstd, v any) (mem.BufferSlice, error) {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Free()
+
+	var buf bytes.Buffer
+	w, err := z.Compress(&buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range data {
+		if _, err := w.Write(b.ReadOnlyData()); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return mem.BufferSlice{mem.SliceBuffer(buf.Bytes())}, nil
+}
+
+// unmarshalCompressed decompresses data with z and unmarshals the result
+// into v with codec.
+func unmarshalCompressed(codec encoding.CodecV2, z *Zstd, data mem.BufferSlice, v any) error {
+	r, err := z.Decompress(data.Reader())
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(mem.BufferSlice{mem.SliceBuffer(b)}, v)
+}
+
+// Name implements encoding.CodecV2.
+func (c *ScopedCodec) Name() string {
+	return c.z.Name()
+}
+
+// ServerCodec returns a server option making the server encode and decode
+// every message with z, without registering it globally.
+func ServerCodec(z *Zstd) grpc.ServerOption {
+	return grpc.ForceServerCodecV2(NewScopedCodec(z))
+}
+
+// DialCodec returns a dial option making every call on the connection
+// encode and decode messages with z, without registering it globally.
+func DialCodec(z *Zstd) grpc.DialOption {
+	return grpc.WithDefaultCallOptions(grpc.ForceCodecV2(NewScopedCodec(z)))
+}
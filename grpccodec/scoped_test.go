@@ -0,0 +1,66 @@
+package grpccodec
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestScopedCodec(t *testing.T) {
+	dictA, dictB := testdict.Train(t, 1001), testdict.Train(t, 2002)
+
+	serve := func(dict []byte) string {
+		t.Helper()
+		s := grpc.NewServer(ServerCodec(NewZstdDict(dict)))
+		pb.RegisterFileListServiceServer(s, echoFiles{})
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		return lis.Addr().String()
+	}
+	dial := func(addr string, dict []byte) pb.FileListServiceClient {
+		t.Helper()
+		conn, err := grpc.NewClient(addr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			DialCodec(NewZstdDict(dict)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewFileListServiceClient(conn)
+	}
+	addrA, addrB := serve(dictA), serve(dictB)
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		addr string
+		dict []byte
+	}{{addrA, dictA}, {addrB, dictB}} {
+		resp, err := dial(tc.addr, tc.dict).ListFiles(ctx, &pb.ListFilesRequest{Path: "/srv"})
+		if err != nil {
+			t.Fatalf("ListFiles() error = %v", err)
+		}
+		if len(resp.Files) != 20 || resp.Root != "/srv" {
+			t.Errorf("ListFiles() = %d files under %q, want 20 under /srv", len(resp.Files), resp.Root)
+		}
+	}
+
+	// The servers don't share a dictionary.
+	_, err := dial(addrB, dictA).ListFiles(ctx, &pb.ListFilesRequest{Path: "/srv"})
+	if err == nil {
+		t.Fatal("ListFiles() with the other server's dictionary succeeded")
+	}
+	var de *DecodeError
+	if !errors.As(FromStatus(err), &de) || !errors.Is(de, ErrDictMismatch) || de.FrameDictID != 1001 || de.LocalDictID != 2002 {
+		t.Errorf("ListFiles() with the other server's dictionary error = %v, want mismatch 1001 vs 2002", err)
+	}
+}
@@ -4,15 +4,20 @@
 // The dictionary-based compressor can significantly improve compression ratios
 // for small, repetitive data patterns common in gRPC messages.
 //
-// Usage with dictionary:
+// Importing the package registers the plain "zstd" compressor. To add the
+// dictionary compressor, register it before creating any server or client
+// connection:
 //
 //	dict, _ := os.ReadFile("my.dict")
-//	compressor := grpccodec.NewZstdDict(dict)
-//	grpc.Dial(addr, grpc.WithDefaultCallOptions(grpc.UseCompressor(compressor.Name())))
+//	if err := grpccodec.RegisterWithConfig(grpccodec.Config{Dict: dict}); err != nil {
+//	    log.Fatal(err)
+//	}
+//	grpc.Dial(addr, grpc.WithDefaultCallOptions(grpc.UseCompressor(grpccodec.NameZstdDict)))
 //
 // Alternative: Explicit payload compression (not using gRPC's compressor interface)
 // can be implemented by compressing message bytes before sending and decompressing
-// after receiving. This gives more control but requires manual integration:
+// after receiving. This gives more control but requires manual integration;
+// PayloadCompressor provides interceptors doing it for registered bytes fields:
 //
 //	// Client side - compress before sending
 //	compressed, _ := zstddict.Compress(payload)
@@ -25,10 +30,18 @@
 package grpccodec
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"runtime/debug"
 	"sync"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/pool"
+	"github.com/paulstuart/zstd-dict/stats"
+	"github.com/paulstuart/zstd-dict/zstddict"
 	"google.golang.org/grpc/encoding"
 )
 
@@ -41,73 +54,133 @@ const (
 
 func init() {
 	// Register plain zstd compressor by default
-	encoding.RegisterCompressor(NewZstd())
+	registry.implicit = NewZstd()
+	registerLocked(registry.implicit)
+}
+
+// ErrAlreadyRegistered is returned when a compressor name is already taken,
+// either by a compressor registered outside this package or by one of
+// this package's compressors with a different dictionary or options.
+var ErrAlreadyRegistered = errors.New("grpccodec: compressor already registered")
+
+// registry records the compressors this package has registered with gRPC,
+// so repeated registration is idempotent and never clobbers compressors
+// registered by others.
+var registry struct {
+	mu         sync.Mutex
+	registered map[string]*Zstd
+	types      map[string]*TypeCompressor
+	// implicit is the plain compressor registered by init, which a
+	// configured one replaces.
+	implicit *Zstd
 }
 
 // Zstd implements the grpc/encoding.Compressor interface using zstd.
 type Zstd struct {
-	name string
-	dict []byte
+	name   string
+	dict   []byte
+	dictID uint32
+
+	observer       stats.Observer
+	stored         bool
+	maxDecodedSize int64
+	dictURL        string
+
+	encoderPool *pool.Pool[*zstd.Encoder]
+	decoderPool *pool.Pool[*zstd.Decoder]
+}
+
+// CodecOption configures a Zstd compressor.
+type CodecOption func(*Zstd)
+
+// WithObserver reports codec events to o. Currently these are panics
+// recovered from the underlying zstd library, reported as a *PanicError.
+func WithObserver(o stats.Observer) CodecOption {
+	return func(z *Zstd) {
+		z.observer = o
+	}
+}
+
+// WithStoredFallback makes the compressor send a message uncompressed, in a
+// stored zstd frame, whenever that is smaller than the compressed frame.
+// Each message is buffered until Close so the two sizes can be compared.
+// Receivers need no option: stored frames are ordinary zstd frames, at the
+// cost of 9 to 12 bytes of framing over the message. See
+// zstddict.AppendStoredFrame.
+func WithStoredFallback() CodecOption {
+	return func(z *Zstd) {
+		z.stored = true
+	}
+}
 
-	encoderPool sync.Pool
-	decoderPool sync.Pool
+// WithMaxDecodedSize bounds the decompressed size of each message to n
+// bytes, so a tiny frame can't expand to gigabytes before gRPC's own
+// receive limit sees it. Frames declaring a larger size are rejected
+// before decoding, others as soon as they pass the limit, with a
+// *DecodeError wrapping a *zstddict.DecodedSizeError.
+func WithMaxDecodedSize(n int64) CodecOption {
+	return func(z *Zstd) {
+		z.maxDecodedSize = n
+	}
+}
+
+// WithDictURL reports url, where this side's dictionary can be fetched,
+// in the *DecodeError for frames compressed with a dictionary the
+// compressor doesn't have. gRPC writes the Internal status for a failed
+// decompression before any handler or interceptor runs, so the compressor
+// is the only place to add it; the peer recovers it with FromStatus.
+func WithDictURL(url string) CodecOption {
+	return func(z *Zstd) {
+		z.dictURL = url
+	}
 }
 
 // NewZstd creates a new zstd compressor without dictionary support.
-func NewZstd() *Zstd {
+func NewZstd(opts ...CodecOption) *Zstd {
 	z := &Zstd{name: NameZstd}
+	for _, opt := range opts {
+		opt(z)
+	}
 	z.initPools()
 	return z
 }
 
 // NewZstdDict creates a new zstd compressor with dictionary support.
-// The dictionary should be pre-trained on representative data.
-func NewZstdDict(dict []byte) *Zstd {
+// The dictionary should be pre-trained on representative data. It is
+// copied, so the caller may reuse dict afterwards.
+func NewZstdDict(dict []byte, opts ...CodecOption) *Zstd {
 	z := &Zstd{
 		name: NameZstdDict,
-		dict: dict,
+		dict: bytes.Clone(dict),
+	}
+	for _, opt := range opts {
+		opt(z)
+	}
+	if d, err := zstd.InspectDictionary(dict); err == nil {
+		z.dictID = d.ID()
 	}
 	z.initPools()
 	return z
 }
 
+// initPools builds the encoder and decoder pools. The pool constructors
+// capture their own options rather than reading z, so a Zstd is fully
+// initialized, and immutable, once its constructor returns.
 func (z *Zstd) initPools() {
-	z.encoderPool = sync.Pool{
-		New: func() any {
-			var enc *zstd.Encoder
-			var err error
-			if z.dict != nil {
-				enc, err = zstd.NewWriter(nil,
-					zstd.WithEncoderDict(z.dict),
-					zstd.WithEncoderConcurrency(1),
-				)
-			} else {
-				enc, err = zstd.NewWriter(nil,
-					zstd.WithEncoderConcurrency(1),
-				)
-			}
-			if err != nil {
-				return nil
-			}
-			return enc
-		},
-	}
-
-	z.decoderPool = sync.Pool{
-		New: func() any {
-			var dec *zstd.Decoder
-			var err error
-			if z.dict != nil {
-				dec, err = zstd.NewReader(nil, zstd.WithDecoderDicts(z.dict))
-			} else {
-				dec, err = zstd.NewReader(nil)
-			}
-			if err != nil {
-				return nil
-			}
-			return dec
-		},
+	encOpts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	var decOpts []zstd.DOption
+	if z.dict != nil {
+		encOpts = append(encOpts, zstd.WithEncoderDict(z.dict))
+		decOpts = append(decOpts, zstd.WithDecoderDicts(z.dict))
 	}
+
+	z.encoderPool = pool.New(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, encOpts...)
+	}, func(enc *zstd.Encoder) { enc.Close() })
+
+	z.decoderPool = pool.New(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, decOpts...)
+	}, (*zstd.Decoder).Close)
 }
 
 // Name returns the name of the compressor.
@@ -116,79 +189,364 @@ func (z *Zstd) Name() string {
 }
 
 // Compress implements encoding.Compressor.
-func (z *Zstd) Compress(w io.Writer) (io.WriteCloser, error) {
-	enc := z.encoderPool.Get().(*zstd.Encoder)
-	if enc == nil {
-		// Fallback: create new encoder
-		var err error
-		if z.dict != nil {
-			enc, err = zstd.NewWriter(w, zstd.WithEncoderDict(z.dict))
-		} else {
-			enc, err = zstd.NewWriter(w)
-		}
-		if err != nil {
-			return nil, err
-		}
-		return enc, nil
+func (z *Zstd) Compress(w io.Writer) (_ io.WriteCloser, err error) {
+	defer func() { z.handlePanic(stats.OpCompress, recover(), &err) }()
+
+	if z.stored {
+		return &storedEncoder{w: w, z: z}, nil
+	}
+
+	enc, err := z.encoderPool.Get()
+	if err != nil {
+		return nil, err
 	}
 
 	enc.Reset(w)
-	return &pooledEncoder{enc: enc, pool: &z.encoderPool}, nil
+	return &pooledEncoder{enc: enc, pool: z.encoderPool, z: z}, nil
 }
 
 // Decompress implements encoding.Compressor.
-func (z *Zstd) Decompress(r io.Reader) (io.Reader, error) {
-	dec := z.decoderPool.Get().(*zstd.Decoder)
-	if dec == nil {
-		// Fallback: create new decoder
-		if z.dict != nil {
-			return zstd.NewReader(r, zstd.WithDecoderDicts(z.dict))
+//
+// The frame header is inspected before decoding, so a frame compressed with
+// a dictionary this compressor doesn't have fails immediately with a
+// *DecodeError wrapping ErrDictMismatch or ErrDictMissing. Later decode
+// failures are also reported as *DecodeError.
+//
+// The returned reader streams from a pooled decoder, so the decompressed
+// message is only ever held in the buffers gRPC reads it into. Those come
+// from gRPC's receive buffer pool, which experimental.WithBufferPool and
+// experimental.BufferPool select, and are freed once the message is
+// unmarshaled.
+func (z *Zstd) Decompress(r io.Reader) (_ io.Reader, err error) {
+	defer func() { z.handlePanic(stats.OpDecompress, recover(), &err) }()
+
+	var hdr [zstd.HeaderMaxSize]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	var h zstd.Header
+	if h.Decode(hdr[:n]) == nil && !h.Skippable && h.DictionaryID != 0 && h.DictionaryID != z.dictID {
+		cause := ErrDictMismatch
+		if z.dict == nil {
+			cause = ErrDictMissing
 		}
-		return zstd.NewReader(r)
+		return nil, &DecodeError{Compressor: z.name, FrameDictID: h.DictionaryID, LocalDictID: z.dictID, DictURL: z.dictURL, Err: cause}
+	}
+	if z.maxDecodedSize > 0 && h.HasFCS && h.FrameContentSize > uint64(z.maxDecodedSize) {
+		return nil, z.decodeError(h.DictionaryID, &zstddict.DecodedSizeError{Limit: z.maxDecodedSize, Declared: int64(h.FrameContentSize)})
+	}
+	r = io.MultiReader(bytes.NewReader(hdr[:n]), r)
+
+	dec, err := z.decoderPool.Get()
+	if err != nil {
+		return nil, err
 	}
 
 	if err := dec.Reset(r); err != nil {
 		z.decoderPool.Put(dec)
-		return nil, err
+		return nil, z.decodeError(h.DictionaryID, err)
 	}
-	return &pooledDecoder{dec: dec, pool: &z.decoderPool}, nil
+	return &pooledDecoder{dec: dec, pool: z.decoderPool, z: z, frameDictID: h.DictionaryID, limit: z.maxDecodedSize}, nil
 }
 
+// decodeError wraps a decoder failure with dictionary context.
+func (z *Zstd) decodeError(frameDictID uint32, err error) error {
+	return &DecodeError{Compressor: z.name, FrameDictID: frameDictID, LocalDictID: z.dictID, Err: err}
+}
+
+// PanicError reports a panic recovered inside the codec. The encoder or
+// decoder involved is discarded rather than returned to its pool.
+type PanicError struct {
+	Compressor string
+	Op         stats.Op
+	Value      any
+	Stack      []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("grpccodec: %s: panic during %s: %v", e.Compressor, e.Op, e.Value)
+}
+
+// handlePanic converts a recovered panic value v into a *PanicError stored
+// in *err and reports it to the observer. It returns whether v was a panic.
+func (z *Zstd) handlePanic(op stats.Op, v any, err *error) bool {
+	if v == nil {
+		return false
+	}
+	pe := &PanicError{Compressor: z.name, Op: op, Value: v, Stack: debug.Stack()}
+	*err = pe
+	if z.observer != nil {
+		z.observer.Observe(stats.Event{Compressor: z.name, DictID: z.dictID, Op: op, Err: pe})
+	}
+	return true
+}
+
+// errClosed is returned when a codec stream is used after Close or after a
+// recovered panic.
+var errClosed = errors.New("grpccodec: use of closed stream")
+
 // pooledEncoder wraps a zstd.Encoder to return it to the pool on Close.
 type pooledEncoder struct {
 	enc  *zstd.Encoder
-	pool *sync.Pool
+	pool *pool.Pool[*zstd.Encoder]
+	z    *Zstd
 }
 
-func (p *pooledEncoder) Write(data []byte) (int, error) {
+func (p *pooledEncoder) Write(data []byte) (n int, err error) {
+	if p.enc == nil {
+		return 0, errClosed
+	}
+	defer p.recover(&err)
 	return p.enc.Write(data)
 }
 
-func (p *pooledEncoder) Close() error {
-	err := p.enc.Close()
+func (p *pooledEncoder) Close() (err error) {
+	if p.enc == nil {
+		return nil
+	}
+	defer p.recover(&err)
+	err = p.enc.Close()
 	p.pool.Put(p.enc)
+	p.enc = nil
+	return err
+}
+
+// recover handles a panic in Write or Close. The encoder is dropped rather
+// than pooled, since its state can no longer be trusted.
+func (p *pooledEncoder) recover(err *error) {
+	if p.z.handlePanic(stats.OpCompress, recover(), err) {
+		if p.enc != nil {
+			p.pool.Drop()
+		}
+		p.enc = nil
+	}
+}
+
+// storedEncoder buffers a message so that its compressed size can be
+// compared with a stored frame before anything is written.
+type storedEncoder struct {
+	w      io.Writer
+	z      *Zstd
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (s *storedEncoder) Write(data []byte) (int, error) {
+	if s.closed {
+		return 0, errClosed
+	}
+	return s.buf.Write(data)
+}
+
+func (s *storedEncoder) Close() (err error) {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var enc *zstd.Encoder
+	defer func() {
+		// A panic skips the Put, dropping the encoder.
+		if s.z.handlePanic(stats.OpCompress, recover(), &err) && enc != nil {
+			s.z.encoderPool.Drop()
+		}
+	}()
+
+	enc, err = s.z.encoderPool.Get()
+	if err != nil {
+		return err
+	}
+	out := enc.EncodeAll(s.buf.Bytes(), nil)
+	s.z.encoderPool.Put(enc)
+	enc = nil
+	if len(out) >= zstddict.StoredFrameSize(s.buf.Len()) {
+		out = zstddict.AppendStoredFrame(out[:0], s.buf.Bytes())
+	}
+	_, err = s.w.Write(out)
 	return err
 }
 
 // pooledDecoder wraps a zstd.Decoder to return it to the pool when done.
 type pooledDecoder struct {
 	dec  *zstd.Decoder
-	pool *sync.Pool
+	pool *pool.Pool[*zstd.Decoder]
+
+	z           *Zstd
+	frameDictID uint32
+	closed      bool
+
+	// limit is the most output allowed, if positive, and out the output
+	// so far.
+	limit int64
+	out   int64
 }
 
-func (p *pooledDecoder) Read(data []byte) (int, error) {
-	n, err := p.dec.Read(data)
+func (p *pooledDecoder) Read(data []byte) (n int, err error) {
+	if p.closed {
+		return 0, errClosed
+	}
+	if p.dec == nil {
+		return 0, io.EOF
+	}
+	defer p.recover(&err)
+	n, err = p.dec.Read(data)
+	p.out += int64(n)
+	if p.limit > 0 && p.out > p.limit {
+		// Abandon the stream; the decoder is reset before it is pooled.
+		_ = p.dec.Reset(nil)
+		p.pool.Put(p.dec)
+		p.dec, p.closed = nil, true
+		return n, p.z.decodeError(p.frameDictID, &zstddict.DecodedSizeError{Limit: p.limit})
+	}
 	if err == io.EOF {
+		// The pool hands out each decoder to one caller at a time, so it
+		// must not be returned twice.
+		p.pool.Put(p.dec)
+		p.dec = nil
+	} else if err != nil {
+		// gRPC abandons the reader after an error, so pool the decoder
+		// now; later reads report errClosed.
+		_ = p.dec.Reset(nil)
 		p.pool.Put(p.dec)
+		p.dec, p.closed = nil, true
+		err = p.z.decodeError(p.frameDictID, err)
 	}
 	return n, err
 }
 
+// recover handles a panic in Read. The decoder is dropped rather than
+// pooled, and later reads report errClosed.
+func (p *pooledDecoder) recover(err *error) {
+	if p.z.handlePanic(stats.OpDecompress, recover(), err) {
+		if p.dec != nil {
+			p.pool.Drop()
+		}
+		p.dec = nil
+		p.closed = true
+	}
+}
+
+// Config selects the compressors registered by RegisterWithConfig.
+type Config struct {
+	// Dict is the dictionary for the zstd-dict compressor. If nil, only
+	// the plain zstd compressor is registered.
+	Dict []byte
+	// Observer, if set, receives codec events from the registered
+	// compressors.
+	Observer stats.Observer
+	// StoredFallback sends messages that don't compress uncompressed; see
+	// WithStoredFallback.
+	StoredFallback bool
+	// MaxDecodedSize, if positive, bounds the decompressed size of each
+	// message; see WithMaxDecodedSize.
+	MaxDecodedSize int64
+	// DictURL is reported to peers whose messages use a dictionary this
+	// side doesn't have; see WithDictURL.
+	DictURL string
+}
+
+// RegisterWithConfig registers the zstd compressors described by cfg with
+// gRPC.
+//
+// gRPC reads its compressor registry without locking, so registration must
+// happen before any server is started or client connection is created;
+// compressors registered later may not be seen and can race with in-flight
+// RPCs. Within that window RegisterWithConfig is safe to call concurrently
+// and repeatedly: registering the same configuration again is a no-op.
+// The plain zstd compressor registered on import has no options and is
+// replaced by the first configuration that sets any. RegisterWithConfig
+// returns ErrAlreadyRegistered if a name is held by a compressor from
+// another package, or by one of this package's compressors with a
+// different dictionary or options.
+func RegisterWithConfig(cfg Config) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	var opts []CodecOption
+	if cfg.Observer != nil {
+		opts = append(opts, WithObserver(cfg.Observer))
+	}
+	if cfg.StoredFallback {
+		opts = append(opts, WithStoredFallback())
+	}
+	if cfg.MaxDecodedSize > 0 {
+		opts = append(opts, WithMaxDecodedSize(cfg.MaxDecodedSize))
+	}
+	if cfg.DictURL != "" {
+		opts = append(opts, WithDictURL(cfg.DictURL))
+	}
+	if err := registerLocked(NewZstd(opts...)); err != nil {
+		return err
+	}
+	if cfg.Dict != nil {
+		return registerLocked(NewZstdDict(cfg.Dict, opts...))
+	}
+	return nil
+}
+
+// registerLocked registers z unless an equivalent compressor is already
+// registered. The init-registered plain compressor is replaced by one with
+// options. The caller must hold registry.mu, except during init.
+func registerLocked(z *Zstd) error {
+	if prev, ok := registry.registered[z.name]; ok {
+		switch {
+		case !bytes.Equal(prev.dict, z.dict):
+			return fmt.Errorf("%w: %q uses a different dictionary", ErrAlreadyRegistered, z.name)
+		case prev.sameOptions(z):
+			return nil
+		case prev != registry.implicit:
+			return fmt.Errorf("%w: %q uses different options", ErrAlreadyRegistered, z.name)
+		}
+		registry.implicit = nil
+	} else if encoding.GetCompressor(z.name) != nil {
+		return fmt.Errorf("%w: %q", ErrAlreadyRegistered, z.name)
+	}
+
+	encoding.RegisterCompressor(z)
+	if registry.registered == nil {
+		registry.registered = make(map[string]*Zstd)
+	}
+	registry.registered[z.name] = z
+	return nil
+}
+
+// sameOptions reports whether z and o were built with the same options.
+// Observers are equal only if they are the same comparable value, so an
+// ObserverFunc never matches.
+func (z *Zstd) sameOptions(o *Zstd) bool {
+	return z.stored == o.stored && z.maxDecodedSize == o.maxDecodedSize && z.dictURL == o.dictURL &&
+		sameObserver(z.observer, o.observer)
+}
+
+func sameObserver(a, b stats.Observer) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// RegisteredDictID returns the dictionary ID of the compressor registered
+// under name by this package, or 0 if it has no dictionary or was not
+// registered here. For a TypeCompressor it is the current dictionary.
+func RegisteredDictID(name string) uint32 {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if z, ok := registry.registered[name]; ok {
+		return z.dictID
+	}
+	if t, ok := registry.types[name]; ok {
+		_, id := t.Dict()
+		return id
+	}
+	return 0
+}
+
 // Register registers both the plain and dictionary-based zstd compressors.
 // The dictionary compressor requires the dictionary to be passed.
+//
+// Deprecated: Use RegisterWithConfig, which reports conflicting
+// registrations. Register ignores them.
 func Register(dict []byte) {
-	encoding.RegisterCompressor(NewZstd())
-	if dict != nil {
-		encoding.RegisterCompressor(NewZstdDict(dict))
-	}
+	_ = RegisterWithConfig(Config{Dict: dict})
 }
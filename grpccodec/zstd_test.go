@@ -0,0 +1,400 @@
+package grpccodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	"github.com/paulstuart/zstd-dict/stats"
+	"github.com/paulstuart/zstd-dict/zstddict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegisterWithConfig(t *testing.T) {
+	dict := bytes.Repeat([]byte("dictionary content "), 10)
+
+	if err := RegisterWithConfig(Config{Dict: dict}); err != nil {
+		t.Fatalf("RegisterWithConfig() error = %v", err)
+	}
+	first := encoding.GetCompressor(NameZstdDict)
+
+	// Registering the same configuration again is a no-op.
+	if err := RegisterWithConfig(Config{Dict: dict}); err != nil {
+		t.Fatalf("RegisterWithConfig() repeat error = %v", err)
+	}
+	if got := encoding.GetCompressor(NameZstdDict); got != first {
+		t.Error("repeat registration replaced the compressor")
+	}
+
+	other := []byte("another dictionary")
+	if err := RegisterWithConfig(Config{Dict: other}); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("RegisterWithConfig() with new dict error = %v, want ErrAlreadyRegistered", err)
+	}
+}
+
+// restoreRegistration puts back the compressor registered under name when
+// the test ends, so tests can replace the one registered on import.
+func restoreRegistration(t *testing.T, name string) {
+	registry.mu.Lock()
+	prev, implicit := registry.registered[name], registry.implicit
+	registry.mu.Unlock()
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		registry.registered[name], registry.implicit = prev, implicit
+		encoding.RegisterCompressor(prev)
+	})
+}
+
+func TestRegisterWithConfig_PlainOptions(t *testing.T) {
+	restoreRegistration(t, NameZstd)
+
+	data := bytes.Repeat([]byte{0}, 1<<20)
+	var buf bytes.Buffer
+	w, _ := NewZstd().Compress(&buf)
+	w.Write(data)
+	w.Close()
+	decode := func() error {
+		r, err := encoding.GetCompressor(NameZstd).Decompress(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	// The compressor registered on import is replaced by a configured one.
+	if err := RegisterWithConfig(Config{MaxDecodedSize: 1024}); err != nil {
+		t.Fatalf("RegisterWithConfig() error = %v", err)
+	}
+	var sizeErr *zstddict.DecodedSizeError
+	if err := decode(); !errors.As(err, &sizeErr) {
+		t.Errorf("Decompress() of 1 MiB error = %v, want *zstddict.DecodedSizeError", err)
+	}
+
+	if err := RegisterWithConfig(Config{MaxDecodedSize: 1024}); err != nil {
+		t.Errorf("RegisterWithConfig() repeat error = %v", err)
+	}
+	for _, cfg := range []Config{
+		{},
+		{MaxDecodedSize: 2048},
+		{MaxDecodedSize: 1024, StoredFallback: true},
+		{MaxDecodedSize: 1024, Observer: stats.ObserverFunc(func(stats.Event) {})},
+	} {
+		if err := RegisterWithConfig(cfg); !errors.Is(err, ErrAlreadyRegistered) {
+			t.Errorf("RegisterWithConfig(%+v) error = %v, want ErrAlreadyRegistered", cfg, err)
+		}
+	}
+	if err := decode(); !errors.As(err, &sizeErr) {
+		t.Errorf("Decompress() after rejected registrations error = %v, want *zstddict.DecodedSizeError", err)
+	}
+}
+
+func TestZstd_RoundTrip(t *testing.T) {
+	z := NewZstd()
+	data := bytes.Repeat([]byte("grpc message payload "), 100)
+
+	var buf bytes.Buffer
+	w, err := z.Compress(&buf)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	r, err := z.Decompress(&buf)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("round trip failed")
+	}
+}
+
+func TestZstd_MaxDecodedSize(t *testing.T) {
+	bomb := bytes.Repeat([]byte{0}, 1<<20)
+	c, err := zstddict.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared, err := c.Compress(bomb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed bytes.Buffer
+	w, _ := NewZstd().Compress(&streamed)
+	w.Write(bomb)
+	w.Close()
+
+	z := NewZstd(WithMaxDecodedSize(64 << 10))
+	for name, frame := range map[string][]byte{"declared": declared, "streamed": streamed.Bytes()} {
+		r, err := z.Decompress(bytes.NewReader(frame))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) || !errors.Is(err, zstddict.ErrTooLarge) {
+			t.Errorf("%s: Decompress() error = %v, want *DecodeError wrapping zstddict.ErrTooLarge", name, err)
+		}
+	}
+}
+
+func TestZstd_DecodeErrorPoolsDecoder(t *testing.T) {
+	c, err := zstddict.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := c.Compress(bytes.Repeat([]byte("grpc message payload "), 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewZstd()
+	r, err := z.Decompress(bytes.NewReader(frame[:len(frame)/2]))
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("ReadAll() of a truncated frame succeeded, want error")
+	}
+	// The reader is abandoned after the error, as gRPC does.
+	if idle, live := z.decoderPool.Stats(); idle != live {
+		t.Errorf("decoder pool has %d live decoders, %d idle; want none checked out", live, idle)
+	}
+}
+
+func TestZstd_StoredFallback(t *testing.T) {
+	z := NewZstd(WithStoredFallback())
+	rng := rand.New(rand.NewPCG(1, 2))
+	random := make([]byte, 4096)
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	text := bytes.Repeat([]byte("grpc message payload "), 100)
+
+	for _, data := range [][]byte{random, text} {
+		var buf bytes.Buffer
+		w, err := z.Compress(&buf)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		// At worst the message is stored, behind 10 bytes of framing.
+		if buf.Len() > len(data)+10 {
+			t.Errorf("%d byte message encoded to %d bytes, more than 10 bytes over the message", len(data), buf.Len())
+		}
+
+		// Receivers need no option.
+		r, err := NewZstd().Decompress(&buf)
+		if err != nil {
+			t.Fatalf("Decompress() error = %v", err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("round trip of %d byte message failed: %v", len(data), err)
+		}
+	}
+}
+
+func TestZstd_DictMismatch(t *testing.T) {
+	dictA := testdict.Train(t, 1001)
+	dictB := testdict.Train(t, 2002)
+
+	compressed := compressWith(t, NewZstdDict(dictA), []byte(strings.Repeat("/usr/local/bin/tool ", 20)))
+
+	_, err := NewZstdDict(dictB).Decompress(bytes.NewReader(compressed))
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrDictMismatch) {
+		t.Fatalf("Decompress() error = %v, want DecodeError wrapping ErrDictMismatch", err)
+	}
+	if de.FrameDictID != 1001 || de.LocalDictID != 2002 {
+		t.Errorf("DecodeError IDs = %d/%d, want 1001/2002", de.FrameDictID, de.LocalDictID)
+	}
+
+	if _, err := NewZstd().Decompress(bytes.NewReader(compressed)); !errors.Is(err, ErrDictMissing) {
+		t.Errorf("Decompress() without dict error = %v, want ErrDictMissing", err)
+	}
+
+	st := Status(err)
+	if st.Code() != codes.FailedPrecondition {
+		t.Errorf("Status() code = %v, want FailedPrecondition", st.Code())
+	}
+	back := FromStatus(st.Err())
+	if !errors.As(back, &de) || !errors.Is(back, ErrDictMismatch) || de.FrameDictID != 1001 {
+		t.Errorf("FromStatus() = %v, want mismatch for frame dictionary 1001", back)
+	}
+
+	// gRPC wraps decompressor errors in a plain Internal status.
+	wrapped := status.Errorf(codes.Internal, "grpc: failed to decompress the received message: %v", err)
+	back = FromStatus(wrapped)
+	if !errors.As(back, &de) || !errors.Is(back, zstddict.ErrDictMismatch) || de.FrameDictID != 1001 {
+		t.Errorf("FromStatus(wrapped) = %v, want mismatch for frame dictionary 1001", back)
+	}
+
+	// Without an ErrorInfo, a status that merely reads like a codec
+	// error is left alone.
+	plain := status.Error(codes.Internal, "grpccodec: zstd-dict: frame dictionary 1, local dictionary 2: grpccodec: dictionary mismatch")
+	if back := FromStatus(plain); back != plain {
+		t.Errorf("FromStatus(plain) = %v, want it unchanged", back)
+	}
+}
+
+func compressWith(t *testing.T, z *Zstd, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := z.Compress(&buf)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write([]byte) (int, error) { panic("writer exploded") }
+
+func TestZstd_PanicRecovery(t *testing.T) {
+	var events []stats.Event
+	observer := stats.ObserverFunc(func(e stats.Event) { events = append(events, e) })
+
+	// A zero Zstd has no pools; the resulting nil dereference must surface
+	// as an error, not crash the caller.
+	var zero Zstd
+	zero.observer = observer
+	if _, err := zero.Compress(io.Discard); !isPanicError(err) {
+		t.Errorf("Compress() on zero Zstd error = %v, want *PanicError", err)
+	}
+
+	z := NewZstd(WithObserver(observer))
+	w, err := z.Compress(panicWriter{})
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	w.Write([]byte("payload"))
+	if err := w.Close(); !isPanicError(err) {
+		t.Errorf("Close() error = %v, want *PanicError", err)
+	}
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Error("Write() after panic succeeded, want error")
+	}
+	if _, live := z.encoderPool.Stats(); live != 0 {
+		t.Errorf("encoder pool has %d live encoders after the panic, want the dropped one gone", live)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("observer saw %d events, want 2", len(events))
+	}
+	for _, e := range events {
+		if e.Op != stats.OpCompress || !isPanicError(e.Err) {
+			t.Errorf("event = %+v, want compress panic", e)
+		}
+	}
+}
+
+func isPanicError(err error) bool {
+	var pe *PanicError
+	return errors.As(err, &pe)
+}
+
+// dictCompressor is a legacy grpc.Compressor that sends frames under the
+// plain zstd name but compressed with a dictionary the server lacks.
+type dictCompressor struct{ dict []byte }
+
+func (c dictCompressor) Do(w io.Writer, p []byte) error {
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderDict(c.dict))
+	if err != nil {
+		return err
+	}
+	if _, err := enc.Write(p); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+func (dictCompressor) Type() string { return NameZstd }
+
+func TestWithDictURL_Server(t *testing.T) {
+	const url = "https://example.com/dict"
+	restoreRegistration(t, NameZstd)
+	if err := RegisterWithConfig(Config{DictURL: url}); err != nil {
+		t.Fatalf("RegisterWithConfig() error = %v", err)
+	}
+
+	s := grpc.NewServer()
+	dpb.RegisterDictionaryServiceServer(s, dpb.UnimplementedDictionaryServiceServer{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithCompressor(dictCompressor{dict: testdict.Train(t, 3199)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := dpb.NewDictionaryServiceClient(conn)
+
+	// gRPC fails the request before any handler runs, unary or streaming,
+	// so the status is Internal but the DecodeError survives in its message.
+	check := func(t *testing.T, err error) {
+		t.Helper()
+		if got := status.Code(err); got != codes.Internal {
+			t.Fatalf("code = %v (%v), want Internal", got, err)
+		}
+		var de *DecodeError
+		if !errors.As(FromStatus(err), &de) {
+			t.Fatalf("FromStatus(%v) is not a *DecodeError", err)
+		}
+		if !errors.Is(de, ErrDictMissing) || de.FrameDictID != 3199 {
+			t.Errorf("DecodeError = %+v, want a missing dictionary 3199", de)
+		}
+		if de.DictURL != url {
+			t.Errorf("DictURL = %q, want %q", de.DictURL, url)
+		}
+	}
+	t.Run("unary", func(t *testing.T) {
+		_, err := client.GetDictionary(context.Background(), &dpb.GetDictionaryRequest{Name: "listing"})
+		check(t, err)
+	})
+	t.Run("stream", func(t *testing.T) {
+		stream, err := client.WatchDictionaries(context.Background(), &dpb.WatchDictionariesRequest{Names: []string{"listing"}})
+		if err != nil {
+			t.Fatalf("WatchDictionaries() error = %v", err)
+		}
+		_, err = stream.Recv()
+		check(t, err)
+	})
+}
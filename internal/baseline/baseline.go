@@ -0,0 +1,75 @@
+// Package baseline provides general-purpose compressors to compare against
+// zstd in the demo benchmarks and cmd/analyze.
+//
+// Snappy is always available. LZ4 and Brotli pull in third-party modules
+// and are only built with the lz4 and brotli build tags:
+//
+//	go run -tags lz4,brotli ./cmd/analyze
+package baseline
+
+import (
+	"bytes"
+	"io"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// Codec is a streaming compressor.
+type Codec struct {
+	// Name identifies the codec, and is its gRPC compressor name.
+	Name      string
+	NewWriter func(w io.Writer) io.WriteCloser
+	NewReader func(r io.Reader) (io.Reader, error)
+}
+
+// codecs holds the available codecs in registration order.
+var codecs []Codec
+
+// register adds c to the available codecs. It is called from init.
+func register(c Codec) {
+	codecs = append(codecs, c)
+}
+
+// Codecs returns the codecs compiled into this binary.
+func Codecs() []Codec {
+	return codecs
+}
+
+// Compress returns data compressed with c.
+func (c Codec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := c.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RegisterGRPC registers every codec as a gRPC compressor, skipping names
+// that are already registered. Like encoding.RegisterCompressor, it must
+// be called before any server or client connection is created.
+func RegisterGRPC() {
+	for _, c := range codecs {
+		if encoding.GetCompressor(c.Name) == nil {
+			encoding.RegisterCompressor(grpcCodec{c})
+		}
+	}
+}
+
+// grpcCodec adapts a Codec to encoding.Compressor.
+type grpcCodec struct {
+	c Codec
+}
+
+func (g grpcCodec) Name() string { return g.c.Name }
+
+func (g grpcCodec) Compress(w io.Writer) (io.WriteCloser, error) {
+	return g.c.NewWriter(w), nil
+}
+
+func (g grpcCodec) Decompress(r io.Reader) (io.Reader, error) {
+	return g.c.NewReader(r)
+}
@@ -0,0 +1,33 @@
+package baseline
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("baseline round trip "), 500)
+	for _, c := range Codecs() {
+		t.Run(c.Name, func(t *testing.T) {
+			compressed, err := c.Compress(data)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if len(compressed) >= len(data) {
+				t.Errorf("Compress() = %d bytes, want fewer than %d", len(compressed), len(data))
+			}
+			r, err := c.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("round trip mismatch")
+			}
+		})
+	}
+}
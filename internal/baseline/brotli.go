@@ -0,0 +1,21 @@
+//go:build brotli
+
+package baseline
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	register(Codec{
+		Name: "br",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriter(w)
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+	})
+}
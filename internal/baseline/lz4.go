@@ -0,0 +1,21 @@
+//go:build lz4
+
+package baseline
+
+import (
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+func init() {
+	register(Codec{
+		Name: "lz4",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			return lz4.NewWriter(w)
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return lz4.NewReader(r), nil
+		},
+	})
+}
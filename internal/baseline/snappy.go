@@ -0,0 +1,19 @@
+package baseline
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/s2"
+)
+
+func init() {
+	register(Codec{
+		Name: "snappy",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			return s2.NewWriter(w, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return s2.NewReader(r), nil
+		},
+	})
+}
@@ -0,0 +1,148 @@
+// Package listdiff computes, compresses and applies the listing changes
+// carried by the DiffFiles RPC.
+//
+// Server and client must agree byte for byte on the serialized base
+// listing, which serves as the compression dictionary, so both build it
+// with Marshal.
+package listdiff
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/protobuf/proto"
+)
+
+// MaxChangesSize bounds the decompressed size of a FileChanges message.
+const MaxChangesSize = 256 << 20
+
+// Marshal returns the canonical serialization of a listing: a
+// ListFilesResponse holding only root, files sorted by path and their
+// count, marshaled deterministically. files is sorted in place.
+func Marshal(root string, files []*pb.FileInfo) ([]byte, error) {
+	SortFiles(files)
+	return proto.MarshalOptions{Deterministic: true}.Marshal(&pb.ListFilesResponse{
+		Root:       root,
+		Files:      files,
+		TotalCount: int64(len(files)),
+	})
+}
+
+// Unmarshal parses a listing produced by Marshal.
+func Unmarshal(listing []byte) (*pb.ListFilesResponse, error) {
+	resp := &pb.ListFilesResponse{}
+	if err := proto.Unmarshal(listing, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Version returns the version string of a listing produced by Marshal.
+func Version(listing []byte) string {
+	sum := sha256.Sum256(listing)
+	return hex.EncodeToString(sum[:16])
+}
+
+// SortFiles sorts files by path.
+func SortFiles(files []*pb.FileInfo) {
+	slices.SortFunc(files, func(a, b *pb.FileInfo) int {
+		return cmp.Compare(a.GetPath(), b.GetPath())
+	})
+}
+
+// Diff returns the changes that turn the listing old into cur.
+func Diff(root string, old, cur []*pb.FileInfo) *pb.FileChanges {
+	prev := make(map[string]*pb.FileInfo, len(old))
+	for _, f := range old {
+		prev[f.GetPath()] = f
+	}
+	ch := &pb.FileChanges{Root: root}
+	for _, f := range cur {
+		if p, ok := prev[f.GetPath()]; !ok || !proto.Equal(p, f) {
+			ch.Upserted = append(ch.Upserted, f)
+		}
+		delete(prev, f.GetPath())
+	}
+	for path := range prev {
+		ch.Removed = append(ch.Removed, path)
+	}
+	slices.Sort(ch.Removed)
+	return ch
+}
+
+// Apply returns files with ch applied, sorted by path. files is not
+// modified.
+func Apply(files []*pb.FileInfo, ch *pb.FileChanges) []*pb.FileInfo {
+	byPath := make(map[string]*pb.FileInfo, len(files)+len(ch.GetUpserted()))
+	for _, f := range files {
+		byPath[f.GetPath()] = f
+	}
+	for _, path := range ch.GetRemoved() {
+		delete(byPath, path)
+	}
+	for _, f := range ch.GetUpserted() {
+		byPath[f.GetPath()] = f
+	}
+	out := make([]*pb.FileInfo, 0, len(byPath))
+	for _, f := range byPath {
+		out = append(out, f)
+	}
+	SortFiles(out)
+	return out
+}
+
+// Compress serializes ch into a zstd frame, using base as a raw content
+// dictionary when it is not empty.
+func Compress(ch *pb.FileChanges, base []byte) ([]byte, error) {
+	data, err := proto.Marshal(ch)
+	if err != nil {
+		return nil, err
+	}
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if len(base) > 0 {
+		// The window must span the dictionary for matches to reach all
+		// of it.
+		opts = append(opts, zstd.WithEncoderDictRaw(0, base), zstd.WithWindowSize(window(len(base)+len(data))))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil), nil
+}
+
+// Decompress reverses Compress.
+func Decompress(data, base []byte) (*pb.FileChanges, error) {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MaxChangesSize)}
+	if len(base) > 0 {
+		opts = append(opts, zstd.WithDecoderDictRaw(0, base))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	raw, err := dec.DecodeAll(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	ch := &pb.FileChanges{}
+	if err := proto.Unmarshal(raw, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// window returns the smallest valid window size covering n bytes.
+func window(n int) int {
+	size := zstd.MinWindowSize
+	for size < n && size < zstd.MaxWindowSize {
+		size <<= 1
+	}
+	return size
+}
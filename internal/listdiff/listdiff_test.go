@@ -0,0 +1,97 @@
+package listdiff
+
+import (
+	"fmt"
+	"testing"
+
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/protobuf/proto"
+)
+
+func testFiles(n int) []*pb.FileInfo {
+	files := make([]*pb.FileInfo, n)
+	for i := range files {
+		files[i] = &pb.FileInfo{
+			Path:    fmt.Sprintf("dir%d/file%04d.txt", i%7, i),
+			Name:    fmt.Sprintf("file%04d.txt", i),
+			Size:    int64(i * 131),
+			Mode:    0o644,
+			ModTime: 1700000000 + int64(i),
+		}
+	}
+	return files
+}
+
+func TestDiffApply(t *testing.T) {
+	old := testFiles(1000)
+	base, err := Marshal("/root", old)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	cur := make([]*pb.FileInfo, 0, len(old))
+	for i, f := range old {
+		switch {
+		case i == 10: // removed
+		case i == 20:
+			f = proto.Clone(f).(*pb.FileInfo)
+			f.Size++
+			cur = append(cur, f)
+		default:
+			cur = append(cur, f)
+		}
+	}
+	cur = append(cur, &pb.FileInfo{Path: "new.txt", Name: "new.txt", Size: 1})
+	listing, err := Marshal("/root", cur)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	ch := Diff("/root", old, cur)
+	if len(ch.Upserted) != 2 || len(ch.Removed) != 1 {
+		t.Fatalf("Diff() = %d upserted, %d removed; want 2 and 1", len(ch.Upserted), len(ch.Removed))
+	}
+
+	frame, err := Compress(ch, base)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	got, err := Decompress(frame, base)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	applied, err := Marshal(got.GetRoot(), Apply(old, got))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if Version(applied) != Version(listing) {
+		t.Errorf("applied listing has version %s, want %s", Version(applied), Version(listing))
+	}
+
+	// The base dictionary shrinks the changes well below their own size.
+	if n := proto.Size(ch); len(frame) >= n {
+		t.Errorf("compressed changes are %d bytes, uncompressed %d", len(frame), n)
+	}
+	if _, err := Decompress(frame, nil); err == nil {
+		t.Error("Decompress() without the base succeeded")
+	}
+}
+
+func TestMarshal_Canonical(t *testing.T) {
+	files := testFiles(50)
+	a, err := Marshal("/root", files)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	reversed := make([]*pb.FileInfo, len(files))
+	for i, f := range files {
+		reversed[len(files)-1-i] = f
+	}
+	b, err := Marshal("/root", reversed)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if Version(a) != Version(b) {
+		t.Error("Marshal() depends on file order")
+	}
+}
@@ -0,0 +1,346 @@
+// Package pool provides a sharded object pool for zstd encoders and decoders.
+//
+// A single shared pool shows up as a contention point on many-core
+// servers, since every Get and Put touches the same memory. Pool spreads
+// idle objects across one shard per P and each goroutine works on the
+// shard its P last used, so Gets and Puts on different Ps touch different
+// cache lines; a Get that finds its shard empty takes from the others.
+// Objects left idle across two garbage collections are discarded, so a
+// burst of traffic does not pin its encoders, each holding megabytes, for
+// good. A Limit optionally bounds the objects checked out of pools sharing
+// it.
+package pool
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"weak"
+)
+
+// Pool is a sharded pool of reusable objects of type T.
+// The zero value is not usable; create pools with New.
+type Pool[T any] struct {
+	newFn     func() (T, error)
+	discardFn func(T)
+	limit     *Limit
+
+	shards []shard[T]
+	// local hands each P the shard it last used. It holds only pointers
+	// into shards, so the objects themselves never depend on what
+	// sync.Pool keeps; its New deals shards out round-robin.
+	local sync.Pool
+	next  atomic.Uint32
+
+	// gen counts the garbage collections the pool has seen. Idle objects
+	// are stamped with it, so evict can tell how long they have waited.
+	gen atomic.Uint32
+
+	// live counts objects created by the pool and not yet discarded, and
+	// misses the Gets that created one. Both change only when an object
+	// is created or discarded, off the fast path.
+	live   atomic.Int64
+	misses atomic.Uint64
+
+	closed atomic.Bool
+}
+
+type shard[T any] struct {
+	id    int // index in Pool.shards
+	mu    sync.Mutex
+	items []entry[T] // oldest first
+	hits  atomic.Uint64
+
+	// Pad shards onto separate cache lines.
+	_ [64]byte
+}
+
+// entry is an idle object and the garbage collection count when it was
+// put back.
+type entry[T any] struct {
+	v   T
+	gen uint32
+}
+
+// Limit bounds the objects checked out of one or more pools at once. When
+// it is reached, Get either waits for an object to be put back or creates
+// an extra object that is discarded, rather than pooled, when put back.
+type Limit struct {
+	tokens chan struct{}
+	wait   bool
+
+	// extra counts objects checked out beyond the limit.
+	extra atomic.Int64
+
+	waits, overflows atomic.Uint64
+}
+
+// NewLimit returns a Limit of n objects. If wait is set, Get waits when it
+// is reached; otherwise it creates extra objects.
+func NewLimit(n int, wait bool) *Limit {
+	return &Limit{tokens: make(chan struct{}, n), wait: wait}
+}
+
+// Max returns the limit.
+func (l *Limit) Max() int {
+	return cap(l.tokens)
+}
+
+// acquire takes a token, waiting for one if the limit says so. It returns
+// false if it went over the limit instead.
+func (l *Limit) acquire() bool {
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	default:
+	}
+	if l.wait {
+		l.waits.Add(1)
+		l.tokens <- struct{}{}
+		return true
+	}
+	l.overflows.Add(1)
+	l.extra.Add(1)
+	return false
+}
+
+// release gives back the token of an object being put back. It returns
+// false if an object beyond the limit is still out, in which case the
+// object must be discarded instead of pooled.
+func (l *Limit) release() bool {
+	for {
+		n := l.extra.Load()
+		if n == 0 {
+			<-l.tokens
+			return true
+		}
+		if l.extra.CompareAndSwap(n, n-1) {
+			return false
+		}
+	}
+}
+
+// Counters reports activity of the pools sharing a Limit.
+type Counters struct {
+	// Hits counts Gets served by an idle object, and Misses those that
+	// created one.
+	Hits, Misses uint64
+	// Waits counts Gets that waited at the limit, and Overflows those
+	// that created an extra object beyond it.
+	Waits, Overflows uint64
+}
+
+// SetLimit makes p share l with other pools. It must be called before p is
+// used.
+func (p *Pool[T]) SetLimit(l *Limit) {
+	p.limit = l
+}
+
+// New creates a Pool that builds objects with newFn when every shard is
+// empty. If discard is non-nil it is called for objects the pool drops:
+// those put back to a closed pool, and those evicted after staying idle
+// across two garbage collections.
+func New[T any](newFn func() (T, error), discard func(T)) *Pool[T] {
+	p := &Pool[T]{
+		newFn:     newFn,
+		discardFn: discard,
+		shards:    make([]shard[T], runtime.GOMAXPROCS(0)),
+	}
+	for i := range p.shards {
+		p.shards[i].id = i
+	}
+	p.local.New = func() any {
+		return &p.shards[p.next.Add(1)%uint32(len(p.shards))]
+	}
+	watchGC(weak.Make(p))
+	return p
+}
+
+// gcSentinel is garbage as soon as it is allocated, so its cleanup runs
+// after the next garbage collection. The pointer keeps it out of the tiny
+// allocator, whose blocks can outlive their objects.
+type gcSentinel struct{ _ *byte }
+
+// watchGC evicts long-idle objects from the pool after every garbage
+// collection, for as long as the pool is open and reachable.
+func watchGC[T any](wp weak.Pointer[Pool[T]]) {
+	runtime.AddCleanup(new(gcSentinel), func(wp weak.Pointer[Pool[T]]) {
+		p := wp.Value()
+		if p == nil || p.closed.Load() {
+			return
+		}
+		p.evict()
+		watchGC(wp)
+	}, wp)
+}
+
+// evict discards the objects that have been idle since before the
+// previous garbage collection, like sync.Pool's victim cache, closing
+// them right away rather than leaving them to the collector.
+func (p *Pool[T]) evict() {
+	g := p.gen.Add(1)
+	var old []T
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		n := 0
+		for n < len(s.items) && g-s.items[n].gen >= 2 {
+			old = append(old, s.items[n].v)
+			n++
+		}
+		k := copy(s.items, s.items[n:])
+		clear(s.items[k:])
+		s.items = s.items[:k]
+		s.mu.Unlock()
+	}
+	for _, v := range old {
+		p.discard(v)
+	}
+}
+
+// Get returns an idle object from the pool, creating one if none is
+// available.
+func (p *Pool[T]) Get() (T, error) {
+	if p.limit != nil && !p.limit.acquire() {
+		v, err := p.create()
+		if err != nil {
+			p.limit.extra.Add(-1)
+		}
+		return v, err
+	}
+	s := p.local.Get().(*shard[T])
+	v, ok := p.take(s)
+	p.local.Put(s)
+	if ok {
+		return v, nil
+	}
+	v, err := p.create()
+	if err != nil && p.limit != nil {
+		// Give back the token taken above. release would instead cancel
+		// an overflow that another Get made meanwhile.
+		<-p.limit.tokens
+	}
+	return v, err
+}
+
+// take removes the most recently idle object from s, or failing that from
+// another shard, counting the hit against s.
+func (p *Pool[T]) take(s *shard[T]) (v T, ok bool) {
+	if v, ok = s.pop(); !ok {
+		for j := 1; j < len(p.shards) && !ok; j++ {
+			v, ok = p.shards[(s.id+j)%len(p.shards)].pop()
+		}
+	}
+	if ok {
+		s.hits.Add(1)
+	}
+	return v, ok
+}
+
+func (s *shard[T]) pop() (v T, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := len(s.items)
+	if k == 0 {
+		return v, false
+	}
+	v = s.items[k-1].v
+	s.items[k-1] = entry[T]{}
+	s.items = s.items[:k-1]
+	return v, true
+}
+
+// create builds a new object.
+func (p *Pool[T]) create() (T, error) {
+	p.misses.Add(1)
+	v, err := p.newFn()
+	if err == nil {
+		p.live.Add(1)
+	}
+	return v, err
+}
+
+// Put returns an object to the pool.
+func (p *Pool[T]) Put(v T) {
+	if p.limit != nil && !p.limit.release() {
+		p.discard(v)
+		return
+	}
+	s := p.local.Get().(*shard[T])
+	s.mu.Lock()
+	// Checked under the lock, so Close, which empties every shard after
+	// setting closed, can't miss the object.
+	closed := p.closed.Load()
+	if !closed {
+		s.items = append(s.items, entry[T]{v: v, gen: p.gen.Load()})
+	}
+	s.mu.Unlock()
+	p.local.Put(s)
+	if closed {
+		p.discard(v)
+	}
+}
+
+// Drop accounts for an object checked out of the pool that will not be
+// put back, such as one a panic left in an unknown state. Unlike an object
+// put back to a closed pool, it is not passed to the discard function.
+func (p *Pool[T]) Drop() {
+	if p.limit != nil {
+		p.limit.release()
+	}
+	p.live.Add(-1)
+}
+
+// Close discards the idle objects. Objects put back afterwards are
+// discarded too, so those checked out are released as they return. Get
+// still works, building objects that will be discarded when put back.
+func (p *Pool[T]) Close() {
+	p.closed.Store(true)
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		items := s.items
+		s.items = nil
+		s.mu.Unlock()
+		for _, e := range items {
+			p.discard(e.v)
+		}
+	}
+}
+
+func (p *Pool[T]) discard(v T) {
+	p.live.Add(-1)
+	if p.discardFn != nil {
+		p.discardFn(v)
+	}
+}
+
+// Stats reports the number of objects idle in the pool and the number
+// created by it that are still alive, whether idle or checked out. Both
+// are read with every shard locked, so idle never exceeds live.
+func (p *Pool[T]) Stats() (idle, live int) {
+	for i := range p.shards {
+		p.shards[i].mu.Lock()
+	}
+	for i := range p.shards {
+		idle += len(p.shards[i].items)
+	}
+	live = int(p.live.Load())
+	for i := range p.shards {
+		p.shards[i].mu.Unlock()
+	}
+	return idle, live
+}
+
+// Counters reports the pool's hits and misses, and the waits and
+// overflows at its Limit, which are shared with the other pools using it.
+func (p *Pool[T]) Counters() Counters {
+	c := Counters{Misses: p.misses.Load()}
+	for i := range p.shards {
+		c.Hits += p.shards[i].hits.Load()
+	}
+	if p.limit != nil {
+		c.Waits, c.Overflows = p.limit.waits.Load(), p.limit.overflows.Load()
+	}
+	return c
+}
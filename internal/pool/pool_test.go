@@ -0,0 +1,300 @@
+package pool
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Reuse(t *testing.T) {
+	created := 0
+	p := New(func() (*int, error) {
+		created++
+		v := created
+		return &v, nil
+	}, nil)
+
+	v, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	p.Put(v)
+
+	w, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if w != v {
+		t.Errorf("Get() returned a new object, want the pooled one")
+	}
+	if created != 1 {
+		t.Errorf("created = %d, want 1", created)
+	}
+
+	p.Put(w)
+	if idle, live := p.Stats(); idle != 1 || live != 1 {
+		t.Errorf("Stats() = %d, %d, want 1, 1", idle, live)
+	}
+}
+
+func TestPool_NewError(t *testing.T) {
+	wantErr := errors.New("boom")
+	p := New(func() (int, error) { return 0, wantErr }, nil)
+
+	if _, err := p.Get(); !errors.Is(err, wantErr) {
+		t.Errorf("Get() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestPool_LimitNewError(t *testing.T) {
+	wantErr := errors.New("boom")
+	var fail atomic.Bool
+	fail.Store(true)
+	p := New(func() (int, error) {
+		if fail.Load() {
+			return 0, wantErr
+		}
+		return 1, nil
+	}, nil)
+	p.SetLimit(NewLimit(1, true))
+
+	if _, err := p.Get(); !errors.Is(err, wantErr) {
+		t.Fatalf("Get() error = %v, want %v", err, wantErr)
+	}
+	// The failed Get gave its token back, so the next one doesn't block.
+	fail.Store(false)
+	done := make(chan error)
+	go func() {
+		_, err := p.Get()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get() after a failed one blocked at the limit")
+	}
+}
+
+func TestPool_LimitNewErrorOverflow(t *testing.T) {
+	// A Get fails while holding the only token, after another Get went
+	// over the limit.
+	entered, failNow := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int64
+	var discarded atomic.Int64
+	p := New(func() (int, error) {
+		if calls.Add(1) == 1 {
+			close(entered)
+			<-failNow
+			return 0, errors.New("boom")
+		}
+		return 2, nil
+	}, func(int) { discarded.Add(1) })
+	p.SetLimit(NewLimit(1, false))
+
+	failed := make(chan error)
+	go func() {
+		_, err := p.Get()
+		failed <- err
+	}()
+	<-entered
+	v, _ := p.Get()
+	close(failNow)
+	if err := <-failed; err == nil {
+		t.Fatal("Get() succeeded, want error")
+	}
+
+	// The object beyond the limit is the only one out, so it must not be
+	// kept.
+	p.Put(v)
+	if idle, live := p.Stats(); idle != 0 || live != 0 || discarded.Load() != 1 {
+		t.Errorf("idle %d, live %d, discarded %d; want 0, 0, 1", idle, live, discarded.Load())
+	}
+}
+
+func TestPool_EvictOnGC(t *testing.T) {
+	var discarded atomic.Int64
+	p := New(func() (*int, error) { return new(int), nil }, func(*int) { discarded.Add(1) })
+
+	var out []*int
+	for range 3 {
+		v, _ := p.Get()
+		out = append(out, v)
+	}
+	for _, v := range out {
+		p.Put(v)
+	}
+	// Idle objects are evicted after two collections, by a cleanup
+	// running on its own goroutine.
+	deadline := time.Now().Add(5 * time.Second)
+	for discarded.Load() < 3 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if discarded.Load() != 3 {
+		t.Errorf("discarded = %d after GC, want 3", discarded.Load())
+	}
+	if idle, live := p.Stats(); idle != 0 || live != 0 {
+		t.Errorf("Stats() = %d, %d after GC, want 0, 0", idle, live)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	discarded := 0
+	p := New(func() (int, error) { return 0, nil }, func(int) { discarded++ })
+
+	a, _ := p.Get()
+	b, _ := p.Get()
+	p.Put(a)
+	p.Close()
+	if discarded != 1 {
+		t.Errorf("Close() discarded %d idle objects, want 1", discarded)
+	}
+	p.Put(b)
+	if idle, live := p.Stats(); idle != 0 || live != 0 || discarded != 2 {
+		t.Errorf("after Put: idle %d, live %d, discarded %d; want 0, 0, 2", idle, live, discarded)
+	}
+}
+
+func TestPool_Drop(t *testing.T) {
+	discarded := 0
+	p := New(func() (int, error) { return 0, nil }, func(int) { discarded++ })
+	p.SetLimit(NewLimit(1, false))
+
+	p.Get()
+	p.Drop()
+	if idle, live := p.Stats(); idle != 0 || live != 0 || discarded != 0 {
+		t.Errorf("after Drop: idle %d, live %d, discarded %d; want 0, 0, 0", idle, live, discarded)
+	}
+	// The dropped object's place under the limit is free again.
+	p.Get()
+	if c := p.Counters(); c.Overflows != 0 {
+		t.Errorf("Overflows = %d after Drop, want 0", c.Overflows)
+	}
+}
+
+func TestPool_LimitWait(t *testing.T) {
+	p := New(func() (*int, error) { return new(int), nil }, nil)
+	p.SetLimit(NewLimit(1, true))
+
+	a, _ := p.Get()
+	got := make(chan *int)
+	go func() {
+		b, _ := p.Get()
+		got <- b
+	}()
+	// Wait until the second Get is blocked at the limit.
+	for p.Counters().Waits == 0 {
+		runtime.Gosched()
+	}
+	p.Put(a)
+	// The waiter gets the object put back, whichever P it runs on.
+	if b := <-got; b != a {
+		t.Error("Get() after waiting returned a new object, want the one put back")
+	}
+	if _, live := p.Stats(); live != 1 {
+		t.Errorf("live = %d, want 1", live)
+	}
+	if c := p.Counters(); c.Hits != 1 || c.Misses != 1 || c.Waits != 1 {
+		t.Errorf("Counters() = %+v, want 1 hit, 1 miss, 1 wait", c)
+	}
+}
+
+func TestPool_LimitOverflow(t *testing.T) {
+	var discarded atomic.Int64
+	p := New(func() (int, error) { return 0, nil }, func(int) { discarded.Add(1) })
+	p.SetLimit(NewLimit(2, false))
+
+	var out []int
+	for range 3 {
+		v, _ := p.Get()
+		out = append(out, v)
+	}
+	if c := p.Counters(); c.Overflows != 1 {
+		t.Errorf("Overflows = %d, want 1", c.Overflows)
+	}
+	for _, v := range out {
+		p.Put(v)
+	}
+	// The first object back stands for the one beyond the limit.
+	if idle, live := p.Stats(); idle != 2 || live != 2 || discarded.Load() != 1 {
+		t.Errorf("idle %d, live %d, discarded %d; want 2, 2, 1", idle, live, discarded.Load())
+	}
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	p := New(func() ([]byte, error) { return make([]byte, 8), nil }, nil)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			for range 1000 {
+				b, err := p.Get()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				p.Put(b)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestPool_ConcurrentStats(t *testing.T) {
+	p := New(func() ([]byte, error) { return make([]byte, 8), nil }, nil)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				b, _ := p.Get()
+				p.Put(b)
+			}
+		})
+	}
+	for range 1000 {
+		if idle, live := p.Stats(); idle > live || idle < 0 {
+			t.Fatalf("Stats() = %d idle, %d live", idle, live)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if c := p.Counters(); c.Misses > 8 {
+		t.Errorf("Counters() = %+v, want at most one miss per goroutine", c)
+	}
+}
+
+func BenchmarkPool_GetPut(b *testing.B) {
+	p := New(func() ([]byte, error) { return make([]byte, 8), nil }, nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v, _ := p.Get()
+			p.Put(v)
+		}
+	})
+}
+
+func BenchmarkPool_GetPutLimit(b *testing.B) {
+	p := New(func() ([]byte, error) { return make([]byte, 8), nil }, nil)
+	p.SetLimit(NewLimit(runtime.GOMAXPROCS(0), true))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v, _ := p.Get()
+			p.Put(v)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+// Package testdict trains the small dictionaries the codec packages use in
+// their tests.
+package testdict
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+// Train returns a dictionary with the given ID, trained on file listing
+// lines like "/usr/local/bin/tool3 4096 -rw-r--r--".
+func Train(t testing.TB, id uint32) []byte {
+	t.Helper()
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = []byte(strings.Repeat("/usr/local/bin/tool"+strconv.Itoa(i%7)+" 4096 -rw-r--r--\n", 20))
+	}
+	dict, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{ID: id})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	return dict
+}
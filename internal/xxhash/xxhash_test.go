@@ -0,0 +1,42 @@
+package xxhash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestSum64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+	for _, tt := range tests {
+		if got := Sum64([]byte(tt.in)); got != tt.want {
+			t.Errorf("Sum64(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestSum64_MatchesZstd checks longer inputs against the checksum zstd
+// stores in its frames, which is the low 32 bits of XXH64.
+func TestSum64_MatchesZstd(t *testing.T) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderCRC(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{7, 31, 32, 33, 100, 1000, 4099} {
+		data := bytes.Repeat([]byte("0123456789abcdefghij"), n/20+1)[:n]
+		frame := enc.EncodeAll(data, nil)
+		want := binary.LittleEndian.Uint32(frame[len(frame)-4:])
+		if got := uint32(Sum64(data)); got != want {
+			t.Errorf("Sum64(%d bytes) low bits = %#x, want %#x", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v4.23.4
+// source: proto/dictionary.proto
+
+package dictionary
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// GetDictionaryRequest names the dictionary to return.
+type GetDictionaryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name is the name the dictionary is published under.
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDictionaryRequest) Reset() {
+	*x = GetDictionaryRequest{}
+	mi := &file_proto_dictionary_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDictionaryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDictionaryRequest) ProtoMessage() {}
+
+func (x *GetDictionaryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_dictionary_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDictionaryRequest.ProtoReflect.Descriptor instead.
+func (*GetDictionaryRequest) Descriptor() ([]byte, []int) {
+	return file_proto_dictionary_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetDictionaryRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// WatchDictionariesRequest names the dictionaries to watch.
+type WatchDictionariesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// names are the names of the dictionaries to watch. Empty watches every
+	// dictionary, including those published after the call started.
+	Names         []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchDictionariesRequest) Reset() {
+	*x = WatchDictionariesRequest{}
+	mi := &file_proto_dictionary_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchDictionariesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchDictionariesRequest) ProtoMessage() {}
+
+func (x *WatchDictionariesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_dictionary_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchDictionariesRequest.ProtoReflect.Descriptor instead.
+func (*WatchDictionariesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_dictionary_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *WatchDictionariesRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+// Dictionary is one version of a published dictionary.
+type Dictionary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name is the name the dictionary is published under, by convention the
+	// full name of the message type it was trained for, such as
+	// "filelist.ListFilesResponse".
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// id is the zstd dictionary ID, also found in the dictionary header.
+	Id uint32 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	// data is the zstd dictionary.
+	Data          []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dictionary) Reset() {
+	*x = Dictionary{}
+	mi := &file_proto_dictionary_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dictionary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dictionary) ProtoMessage() {}
+
+func (x *Dictionary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_dictionary_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dictionary.ProtoReflect.Descriptor instead.
+func (*Dictionary) Descriptor() ([]byte, []int) {
+	return file_proto_dictionary_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Dictionary) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Dictionary) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Dictionary) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_proto_dictionary_proto protoreflect.FileDescriptor
+
+const file_proto_dictionary_proto_rawDesc = "" +
+	"\n" +
+	"\x16proto/dictionary.proto\x12\n" +
+	"dictionary\"*\n" +
+	"\x14GetDictionaryRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"0\n" +
+	"\x18WatchDictionariesRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\"D\n" +
+	"\n" +
+	"Dictionary\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\rR\x02id\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data2\xb3\x01\n" +
+	"\x11DictionaryService\x12I\n" +
+	"\rGetDictionary\x12 .dictionary.GetDictionaryRequest\x1a\x16.dictionary.Dictionary\x12S\n" +
+	"\x11WatchDictionaries\x12$.dictionary.WatchDictionariesRequest\x1a\x16.dictionary.Dictionary0\x01B2Z0github.com/paulstuart/zstd-dict/proto/dictionaryb\x06proto3"
+
+var (
+	file_proto_dictionary_proto_rawDescOnce sync.Once
+	file_proto_dictionary_proto_rawDescData []byte
+)
+
+func file_proto_dictionary_proto_rawDescGZIP() []byte {
+	file_proto_dictionary_proto_rawDescOnce.Do(func() {
+		file_proto_dictionary_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_dictionary_proto_rawDesc), len(file_proto_dictionary_proto_rawDesc)))
+	})
+	return file_proto_dictionary_proto_rawDescData
+}
+
+var file_proto_dictionary_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_dictionary_proto_goTypes = []any{
+	(*GetDictionaryRequest)(nil),     // 0: dictionary.GetDictionaryRequest
+	(*WatchDictionariesRequest)(nil), // 1: dictionary.WatchDictionariesRequest
+	(*Dictionary)(nil),               // 2: dictionary.Dictionary
+}
+var file_proto_dictionary_proto_depIdxs = []int32{
+	0, // 0: dictionary.DictionaryService.GetDictionary:input_type -> dictionary.GetDictionaryRequest
+	1, // 1: dictionary.DictionaryService.WatchDictionaries:input_type -> dictionary.WatchDictionariesRequest
+	2, // 2: dictionary.DictionaryService.GetDictionary:output_type -> dictionary.Dictionary
+	2, // 3: dictionary.DictionaryService.WatchDictionaries:output_type -> dictionary.Dictionary
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_dictionary_proto_init() }
+func file_proto_dictionary_proto_init() {
+	if File_proto_dictionary_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_dictionary_proto_rawDesc), len(file_proto_dictionary_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_dictionary_proto_goTypes,
+		DependencyIndexes: file_proto_dictionary_proto_depIdxs,
+		MessageInfos:      file_proto_dictionary_proto_msgTypes,
+	}.Build()
+	File_proto_dictionary_proto = out.File
+	file_proto_dictionary_proto_goTypes = nil
+	file_proto_dictionary_proto_depIdxs = nil
+}
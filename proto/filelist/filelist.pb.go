@@ -27,9 +27,13 @@ type ListFilesRequest struct {
 	// path is the root directory to list files from.
 	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
 	// max_depth limits recursion depth. 0 means unlimited.
-	MaxDepth      int32 `protobuf:"varint,2,opt,name=max_depth,json=maxDepth,proto3" json:"max_depth,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	MaxDepth int32 `protobuf:"varint,2,opt,name=max_depth,json=maxDepth,proto3" json:"max_depth,omitempty"`
+	// measure_compression asks the server to time compressing the response
+	// and report it in CompressionInfo.server_compress_micros. This costs an
+	// extra compression pass on the server.
+	MeasureCompression bool `protobuf:"varint,3,opt,name=measure_compression,json=measureCompression,proto3" json:"measure_compression,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *ListFilesRequest) Reset() {
@@ -76,6 +80,13 @@ func (x *ListFilesRequest) GetMaxDepth() int32 {
 	return 0
 }
 
+func (x *ListFilesRequest) GetMeasureCompression() bool {
+	if x != nil {
+		return x.MeasureCompression
+	}
+	return false
+}
+
 // ListFilesResponse contains the file listing.
 type ListFilesResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -84,7 +95,9 @@ type ListFilesResponse struct {
 	// files is the list of files and directories.
 	Files []*FileInfo `protobuf:"bytes,2,rep,name=files,proto3" json:"files,omitempty"`
 	// total_count is the total number of entries returned.
-	TotalCount    int64 `protobuf:"varint,3,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	TotalCount int64 `protobuf:"varint,3,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	// compression describes how the server compressed this response.
+	Compression   *CompressionInfo `protobuf:"bytes,4,opt,name=compression,proto3" json:"compression,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -140,6 +153,91 @@ func (x *ListFilesResponse) GetTotalCount() int64 {
 	return 0
 }
 
+func (x *ListFilesResponse) GetCompression() *CompressionInfo {
+	if x != nil {
+		return x.Compression
+	}
+	return nil
+}
+
+// CompressionInfo reports server-side compression details for a response,
+// so clients can compute savings without a stats handler.
+type CompressionInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// uncompressed_size is the serialized size of the response in bytes,
+	// not counting this CompressionInfo.
+	UncompressedSize int64 `protobuf:"varint,1,opt,name=uncompressed_size,json=uncompressedSize,proto3" json:"uncompressed_size,omitempty"`
+	// compressor is the name of the compressor used for the response, or
+	// empty if it was sent uncompressed.
+	Compressor string `protobuf:"bytes,2,opt,name=compressor,proto3" json:"compressor,omitempty"`
+	// dict_id is the ID of the compressor's dictionary, or 0 if none.
+	DictId uint32 `protobuf:"varint,3,opt,name=dict_id,json=dictId,proto3" json:"dict_id,omitempty"`
+	// server_compress_micros is the time the server took to compress the
+	// response, in microseconds. It is only set when the request asked for
+	// measure_compression.
+	ServerCompressMicros int64 `protobuf:"varint,4,opt,name=server_compress_micros,json=serverCompressMicros,proto3" json:"server_compress_micros,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *CompressionInfo) Reset() {
+	*x = CompressionInfo{}
+	mi := &file_proto_filelist_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompressionInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompressionInfo) ProtoMessage() {}
+
+func (x *CompressionInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_filelist_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompressionInfo.ProtoReflect.Descriptor instead.
+func (*CompressionInfo) Descriptor() ([]byte, []int) {
+	return file_proto_filelist_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CompressionInfo) GetUncompressedSize() int64 {
+	if x != nil {
+		return x.UncompressedSize
+	}
+	return 0
+}
+
+func (x *CompressionInfo) GetCompressor() string {
+	if x != nil {
+		return x.Compressor
+	}
+	return ""
+}
+
+func (x *CompressionInfo) GetDictId() uint32 {
+	if x != nil {
+		return x.DictId
+	}
+	return 0
+}
+
+func (x *CompressionInfo) GetServerCompressMicros() int64 {
+	if x != nil {
+		return x.ServerCompressMicros
+	}
+	return 0
+}
+
 // FileInfo describes a single file or directory.
 type FileInfo struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -161,7 +259,7 @@ type FileInfo struct {
 
 func (x *FileInfo) Reset() {
 	*x = FileInfo{}
-	mi := &file_proto_filelist_proto_msgTypes[2]
+	mi := &file_proto_filelist_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -173,7 +271,7 @@ func (x *FileInfo) String() string {
 func (*FileInfo) ProtoMessage() {}
 
 func (x *FileInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_filelist_proto_msgTypes[2]
+	mi := &file_proto_filelist_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -186,7 +284,7 @@ func (x *FileInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
 func (*FileInfo) Descriptor() ([]byte, []int) {
-	return file_proto_filelist_proto_rawDescGZIP(), []int{2}
+	return file_proto_filelist_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *FileInfo) GetPath() string {
@@ -231,28 +329,251 @@ func (x *FileInfo) GetIsDir() bool {
 	return false
 }
 
+// DiffFilesRequest asks for the changes to a listing since base_version.
+type DiffFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// path is the root directory to list files from.
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// max_depth limits recursion depth. 0 means unlimited.
+	MaxDepth int32 `protobuf:"varint,2,opt,name=max_depth,json=maxDepth,proto3" json:"max_depth,omitempty"`
+	// base_version is the version of the listing the client holds, from an
+	// earlier DiffFilesResponse. Empty asks for the whole listing.
+	BaseVersion   string `protobuf:"bytes,3,opt,name=base_version,json=baseVersion,proto3" json:"base_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiffFilesRequest) Reset() {
+	*x = DiffFilesRequest{}
+	mi := &file_proto_filelist_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiffFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiffFilesRequest) ProtoMessage() {}
+
+func (x *DiffFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_filelist_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiffFilesRequest.ProtoReflect.Descriptor instead.
+func (*DiffFilesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_filelist_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DiffFilesRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *DiffFilesRequest) GetMaxDepth() int32 {
+	if x != nil {
+		return x.MaxDepth
+	}
+	return 0
+}
+
+func (x *DiffFilesRequest) GetBaseVersion() string {
+	if x != nil {
+		return x.BaseVersion
+	}
+	return ""
+}
+
+// DiffFilesResponse carries the changes between two versions of a listing.
+//
+// A listing version is serialized as a ListFilesResponse holding root,
+// total_count and the files sorted by path, and nothing else, using
+// deterministic marshaling. The version string is derived from those bytes.
+type DiffFilesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// version identifies the listing after applying the changes.
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// base_version is the version the changes apply to. It is empty when the
+	// server no longer holds the requested base, in which case the changes
+	// add every entry to an empty listing.
+	BaseVersion string `protobuf:"bytes,2,opt,name=base_version,json=baseVersion,proto3" json:"base_version,omitempty"`
+	// changes is a serialized FileChanges in a zstd frame, compressed with
+	// the serialized base listing as a raw content dictionary, or with no
+	// dictionary when base_version is empty.
+	Changes       []byte `protobuf:"bytes,3,opt,name=changes,proto3" json:"changes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiffFilesResponse) Reset() {
+	*x = DiffFilesResponse{}
+	mi := &file_proto_filelist_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiffFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiffFilesResponse) ProtoMessage() {}
+
+func (x *DiffFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_filelist_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiffFilesResponse.ProtoReflect.Descriptor instead.
+func (*DiffFilesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_filelist_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DiffFilesResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *DiffFilesResponse) GetBaseVersion() string {
+	if x != nil {
+		return x.BaseVersion
+	}
+	return ""
+}
+
+func (x *DiffFilesResponse) GetChanges() []byte {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+// FileChanges lists the differences between two versions of a listing.
+type FileChanges struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// root is the requested directory path.
+	Root string `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+	// upserted holds the entries that were added or changed.
+	Upserted []*FileInfo `protobuf:"bytes,2,rep,name=upserted,proto3" json:"upserted,omitempty"`
+	// removed holds the paths of the entries that no longer exist.
+	Removed       []string `protobuf:"bytes,3,rep,name=removed,proto3" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileChanges) Reset() {
+	*x = FileChanges{}
+	mi := &file_proto_filelist_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileChanges) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileChanges) ProtoMessage() {}
+
+func (x *FileChanges) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_filelist_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileChanges.ProtoReflect.Descriptor instead.
+func (*FileChanges) Descriptor() ([]byte, []int) {
+	return file_proto_filelist_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FileChanges) GetRoot() string {
+	if x != nil {
+		return x.Root
+	}
+	return ""
+}
+
+func (x *FileChanges) GetUpserted() []*FileInfo {
+	if x != nil {
+		return x.Upserted
+	}
+	return nil
+}
+
+func (x *FileChanges) GetRemoved() []string {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
 var File_proto_filelist_proto protoreflect.FileDescriptor
 
 const file_proto_filelist_proto_rawDesc = "" +
 	"\n" +
-	"\x14proto/filelist.proto\x12\bfilelist\"C\n" +
+	"\x14proto/filelist.proto\x12\bfilelist\"t\n" +
 	"\x10ListFilesRequest\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1b\n" +
-	"\tmax_depth\x18\x02 \x01(\x05R\bmaxDepth\"r\n" +
+	"\tmax_depth\x18\x02 \x01(\x05R\bmaxDepth\x12/\n" +
+	"\x13measure_compression\x18\x03 \x01(\bR\x12measureCompression\"\xaf\x01\n" +
 	"\x11ListFilesResponse\x12\x12\n" +
 	"\x04root\x18\x01 \x01(\tR\x04root\x12(\n" +
 	"\x05files\x18\x02 \x03(\v2\x12.filelist.FileInfoR\x05files\x12\x1f\n" +
 	"\vtotal_count\x18\x03 \x01(\x03R\n" +
-	"totalCount\"\x8c\x01\n" +
+	"totalCount\x12;\n" +
+	"\vcompression\x18\x04 \x01(\v2\x19.filelist.CompressionInfoR\vcompression\"\xad\x01\n" +
+	"\x0fCompressionInfo\x12+\n" +
+	"\x11uncompressed_size\x18\x01 \x01(\x03R\x10uncompressedSize\x12\x1e\n" +
+	"\n" +
+	"compressor\x18\x02 \x01(\tR\n" +
+	"compressor\x12\x17\n" +
+	"\adict_id\x18\x03 \x01(\rR\x06dictId\x124\n" +
+	"\x16server_compress_micros\x18\x04 \x01(\x03R\x14serverCompressMicros\"\x8c\x01\n" +
 	"\bFileInfo\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
 	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x12\n" +
 	"\x04mode\x18\x04 \x01(\rR\x04mode\x12\x19\n" +
 	"\bmod_time\x18\x05 \x01(\x03R\amodTime\x12\x15\n" +
-	"\x06is_dir\x18\x06 \x01(\bR\x05isDir2W\n" +
+	"\x06is_dir\x18\x06 \x01(\bR\x05isDir\"f\n" +
+	"\x10DiffFilesRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1b\n" +
+	"\tmax_depth\x18\x02 \x01(\x05R\bmaxDepth\x12!\n" +
+	"\fbase_version\x18\x03 \x01(\tR\vbaseVersion\"j\n" +
+	"\x11DiffFilesResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12!\n" +
+	"\fbase_version\x18\x02 \x01(\tR\vbaseVersion\x12\x18\n" +
+	"\achanges\x18\x03 \x01(\fR\achanges\"k\n" +
+	"\vFileChanges\x12\x12\n" +
+	"\x04root\x18\x01 \x01(\tR\x04root\x12.\n" +
+	"\bupserted\x18\x02 \x03(\v2\x12.filelist.FileInfoR\bupserted\x12\x18\n" +
+	"\aremoved\x18\x03 \x03(\tR\aremoved2\x9d\x01\n" +
 	"\x0fFileListService\x12D\n" +
-	"\tListFiles\x12\x1a.filelist.ListFilesRequest\x1a\x1b.filelist.ListFilesResponseB0Z.github.com/paulstuart/zstd-dict/proto/filelistb\x06proto3"
+	"\tListFiles\x12\x1a.filelist.ListFilesRequest\x1a\x1b.filelist.ListFilesResponse\x12D\n" +
+	"\tDiffFiles\x12\x1a.filelist.DiffFilesRequest\x1a\x1b.filelist.DiffFilesResponseB0Z.github.com/paulstuart/zstd-dict/proto/filelistb\x06proto3"
 
 var (
 	file_proto_filelist_proto_rawDescOnce sync.Once
@@ -266,21 +587,29 @@ func file_proto_filelist_proto_rawDescGZIP() []byte {
 	return file_proto_filelist_proto_rawDescData
 }
 
-var file_proto_filelist_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_filelist_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_proto_filelist_proto_goTypes = []any{
 	(*ListFilesRequest)(nil),  // 0: filelist.ListFilesRequest
 	(*ListFilesResponse)(nil), // 1: filelist.ListFilesResponse
-	(*FileInfo)(nil),          // 2: filelist.FileInfo
+	(*CompressionInfo)(nil),   // 2: filelist.CompressionInfo
+	(*FileInfo)(nil),          // 3: filelist.FileInfo
+	(*DiffFilesRequest)(nil),  // 4: filelist.DiffFilesRequest
+	(*DiffFilesResponse)(nil), // 5: filelist.DiffFilesResponse
+	(*FileChanges)(nil),       // 6: filelist.FileChanges
 }
 var file_proto_filelist_proto_depIdxs = []int32{
-	2, // 0: filelist.ListFilesResponse.files:type_name -> filelist.FileInfo
-	0, // 1: filelist.FileListService.ListFiles:input_type -> filelist.ListFilesRequest
-	1, // 2: filelist.FileListService.ListFiles:output_type -> filelist.ListFilesResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	3, // 0: filelist.ListFilesResponse.files:type_name -> filelist.FileInfo
+	2, // 1: filelist.ListFilesResponse.compression:type_name -> filelist.CompressionInfo
+	3, // 2: filelist.FileChanges.upserted:type_name -> filelist.FileInfo
+	0, // 3: filelist.FileListService.ListFiles:input_type -> filelist.ListFilesRequest
+	4, // 4: filelist.FileListService.DiffFiles:input_type -> filelist.DiffFilesRequest
+	1, // 5: filelist.FileListService.ListFiles:output_type -> filelist.ListFilesResponse
+	5, // 6: filelist.FileListService.DiffFiles:output_type -> filelist.DiffFilesResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_proto_filelist_proto_init() }
@@ -294,7 +623,7 @@ func file_proto_filelist_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_filelist_proto_rawDesc), len(file_proto_filelist_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
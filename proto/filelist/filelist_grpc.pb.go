@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	FileListService_ListFiles_FullMethodName = "/filelist.FileListService/ListFiles"
+	FileListService_DiffFiles_FullMethodName = "/filelist.FileListService/DiffFiles"
 )
 
 // FileListServiceClient is the client API for FileListService service.
@@ -30,6 +31,9 @@ const (
 type FileListServiceClient interface {
 	// ListFiles returns a recursive listing of files in the specified directory.
 	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
+	// DiffFiles returns the changes to a listing since a version the client
+	// already holds, compressed against that version.
+	DiffFiles(ctx context.Context, in *DiffFilesRequest, opts ...grpc.CallOption) (*DiffFilesResponse, error)
 }
 
 type fileListServiceClient struct {
@@ -50,6 +54,16 @@ func (c *fileListServiceClient) ListFiles(ctx context.Context, in *ListFilesRequ
 	return out, nil
 }
 
+func (c *fileListServiceClient) DiffFiles(ctx context.Context, in *DiffFilesRequest, opts ...grpc.CallOption) (*DiffFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DiffFilesResponse)
+	err := c.cc.Invoke(ctx, FileListService_DiffFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FileListServiceServer is the server API for FileListService service.
 // All implementations must embed UnimplementedFileListServiceServer
 // for forward compatibility.
@@ -58,6 +72,9 @@ func (c *fileListServiceClient) ListFiles(ctx context.Context, in *ListFilesRequ
 type FileListServiceServer interface {
 	// ListFiles returns a recursive listing of files in the specified directory.
 	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
+	// DiffFiles returns the changes to a listing since a version the client
+	// already holds, compressed against that version.
+	DiffFiles(context.Context, *DiffFilesRequest) (*DiffFilesResponse, error)
 	mustEmbedUnimplementedFileListServiceServer()
 }
 
@@ -71,6 +88,9 @@ type UnimplementedFileListServiceServer struct{}
 func (UnimplementedFileListServiceServer) ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
 }
+func (UnimplementedFileListServiceServer) DiffFiles(context.Context, *DiffFilesRequest) (*DiffFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DiffFiles not implemented")
+}
 func (UnimplementedFileListServiceServer) mustEmbedUnimplementedFileListServiceServer() {}
 func (UnimplementedFileListServiceServer) testEmbeddedByValue()                         {}
 
@@ -110,6 +130,24 @@ func _FileListService_ListFiles_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FileListService_DiffFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiffFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileListServiceServer).DiffFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileListService_DiffFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileListServiceServer).DiffFiles(ctx, req.(*DiffFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // FileListService_ServiceDesc is the grpc.ServiceDesc for FileListService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -121,6 +159,10 @@ var FileListService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListFiles",
 			Handler:    _FileListService_ListFiles_Handler,
 		},
+		{
+			MethodName: "DiffFiles",
+			Handler:    _FileListService_DiffFiles_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/filelist.proto",
@@ -0,0 +1,265 @@
+// Package recordfile stores many small records in one file, each
+// compressed on its own with a shared dictionary, followed by an index
+// that allows random access by record number. It is the at-rest
+// counterpart of compressing individual gRPC messages.
+//
+// A record file is a sequence of zstd frames, one per record, followed by
+// the index in a skippable frame:
+//
+//	record 0 | record 1 | ... | index
+//
+//	index: magic (4) | payload size (4) | offsets (8 each) | dict ID (4) | count (4) | tag "zrix" (4)
+//
+// Since decoders ignore skippable frames, any zstd tool holding the
+// dictionary decompresses the file to the concatenated records.
+//
+//	w, err := recordfile.NewWriter(f, dict)
+//	for _, rec := range records {
+//	    w.Append(rec)
+//	}
+//	err = w.Close()
+//
+//	r, err := recordfile.NewReader(f, size, dict)
+//	rec, err := r.Record(42)
+package recordfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+const (
+	indexMagic = 0x184D2A5D
+	indexTag   = "zrix"
+	// indexTrailer is the fixed-size end of the index payload: dict ID,
+	// count and tag.
+	indexTrailer = 12
+)
+
+var (
+	// ErrNoIndex is returned when a file does not end with a valid index.
+	ErrNoIndex = errors.New("recordfile: missing or corrupt index")
+	// ErrClosed is returned when appending to a closed Writer.
+	ErrClosed = errors.New("recordfile: writer closed")
+)
+
+// newCompressor returns a Compressor for records made with dict, which may
+// be nil, and the dictionary's ID.
+func newCompressor(dict []byte) (*zstddict.Compressor, uint32, error) {
+	var id uint32
+	if dict != nil {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, 0, fmt.Errorf("recordfile: %w", err)
+		}
+		id = d.ID()
+	}
+	c, err := zstddict.New(zstddict.WithDictBytes(dict), zstddict.WithSmallMessages(), zstddict.WithStrictDict(true))
+	if err != nil {
+		return nil, 0, err
+	}
+	return c, id, nil
+}
+
+// Writer appends compressed records to a file. The index is written by
+// Close; a file whose Writer was never closed has no index and can't be
+// opened by NewReader or OpenAppend, though its records remain readable
+// as a zstd stream.
+type Writer struct {
+	w       io.Writer
+	c       *zstddict.Compressor
+	dictID  uint32
+	offset  int64
+	offsets []int64
+	closed  bool
+}
+
+// NewWriter returns a Writer that writes a new record file to w,
+// compressing records with dict.
+func NewWriter(w io.Writer, dict []byte) (*Writer, error) {
+	c, id, err := newCompressor(dict)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, c: c, dictID: id}, nil
+}
+
+// OpenAppend returns a Writer that adds records to the existing record file
+// f. The index is removed from the file until Close writes the new one.
+// dict must be the dictionary the file was written with.
+func OpenAppend(f *os.File, dict []byte) (*Writer, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := readIndex(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	c, id, err := newCompressor(dict)
+	if err != nil {
+		return nil, err
+	}
+	if id != idx.dictID {
+		return nil, &zstddict.DictMismatchError{Expected: id, Actual: idx.dictID}
+	}
+	if err := f.Truncate(idx.start); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(idx.start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &Writer{w: f, c: c, dictID: id, offset: idx.start, offsets: idx.offsets}, nil
+}
+
+// Append compresses and writes record, returning its record number.
+func (w *Writer) Append(record []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	frame, err := w.c.Compress(record)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.w.Write(frame); err != nil {
+		return 0, err
+	}
+	w.offsets = append(w.offsets, w.offset)
+	w.offset += int64(len(frame))
+	return len(w.offsets) - 1, nil
+}
+
+// Len returns the number of records in the file, including those present
+// before OpenAppend.
+func (w *Writer) Len() int {
+	return len(w.offsets)
+}
+
+// Close writes the index. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	payload := 8*len(w.offsets) + indexTrailer
+	buf := make([]byte, 0, 8+payload)
+	buf = binary.LittleEndian.AppendUint32(buf, indexMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(payload))
+	for _, off := range w.offsets {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(off))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, w.dictID)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(w.offsets)))
+	buf = append(buf, indexTag...)
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// index is the decoded index of a record file.
+type index struct {
+	dictID  uint32
+	offsets []int64
+	// start is the offset of the index frame, which is also the end of
+	// the last record.
+	start int64
+}
+
+// readIndex reads and validates the index at the end of a file of size
+// bytes.
+func readIndex(r io.ReaderAt, size int64) (*index, error) {
+	var trailer [indexTrailer]byte
+	if size < 8+indexTrailer {
+		return nil, ErrNoIndex
+	}
+	if _, err := r.ReadAt(trailer[:], size-indexTrailer); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != indexTag {
+		return nil, ErrNoIndex
+	}
+	idx := &index{dictID: binary.LittleEndian.Uint32(trailer[0:])}
+	count := int64(binary.LittleEndian.Uint32(trailer[4:]))
+	payload := 8*count + indexTrailer
+	idx.start = size - 8 - payload
+	if idx.start < 0 {
+		return nil, ErrNoIndex
+	}
+
+	buf := make([]byte, 8+8*count)
+	if _, err := r.ReadAt(buf, idx.start); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(buf) != indexMagic || int64(binary.LittleEndian.Uint32(buf[4:])) != payload {
+		return nil, ErrNoIndex
+	}
+	idx.offsets = make([]int64, count)
+	prev := int64(0)
+	for i := range idx.offsets {
+		off := int64(binary.LittleEndian.Uint64(buf[8+8*i:]))
+		if off < prev || off > idx.start {
+			return nil, ErrNoIndex
+		}
+		idx.offsets[i], prev = off, off
+	}
+	return idx, nil
+}
+
+// Reader reads records from a record file. It is safe for concurrent use
+// if the underlying ReaderAt is.
+type Reader struct {
+	r   io.ReaderAt
+	c   *zstddict.Compressor
+	idx *index
+}
+
+// NewReader reads the index of the size-byte record file r. dict must be
+// the dictionary the file was written with; a different one fails with a
+// *zstddict.DictMismatchError.
+func NewReader(r io.ReaderAt, size int64, dict []byte) (*Reader, error) {
+	idx, err := readIndex(r, size)
+	if err != nil {
+		return nil, err
+	}
+	c, id, err := newCompressor(dict)
+	if err != nil {
+		return nil, err
+	}
+	if id != idx.dictID {
+		return nil, &zstddict.DictMismatchError{Expected: id, Actual: idx.dictID}
+	}
+	return &Reader{r: r, c: c, idx: idx}, nil
+}
+
+// Len returns the number of records.
+func (r *Reader) Len() int {
+	return len(r.idx.offsets)
+}
+
+// DictID returns the ID of the dictionary the records were compressed
+// with, or 0 if none.
+func (r *Reader) DictID() uint32 {
+	return r.idx.dictID
+}
+
+// Record returns the decompressed record number i.
+func (r *Reader) Record(i int) ([]byte, error) {
+	if i < 0 || i >= len(r.idx.offsets) {
+		return nil, fmt.Errorf("recordfile: record %d out of range [0, %d)", i, len(r.idx.offsets))
+	}
+	end := r.idx.start
+	if i+1 < len(r.idx.offsets) {
+		end = r.idx.offsets[i+1]
+	}
+	frame := make([]byte, end-r.idx.offsets[i])
+	if _, err := r.r.ReadAt(frame, r.idx.offsets[i]); err != nil {
+		return nil, err
+	}
+	return r.c.Decompress(frame)
+}
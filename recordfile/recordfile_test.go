@@ -0,0 +1,99 @@
+package recordfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+func testRecords(start, n int) [][]byte {
+	var records [][]byte
+	for i := start; i < start+n; i++ {
+		records = append(records, fmt.Appendf(nil, `{"path":"/usr/local/share/app/file%d.txt","size":%d,"mode":"-rw-r--r--"}`, i, i*37))
+	}
+	return records
+}
+
+func TestRecordFile(t *testing.T) {
+	dict, err := zstddict.TrainDict(testRecords(0, 200), &zstddict.TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "records.zr")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := append(testRecords(1000, 50), []byte{})
+	w, err := NewWriter(f, dict)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for i, rec := range records {
+		if n, err := w.Append(rec); err != nil || n != i {
+			t.Fatalf("Append() = %d, %v; want %d", n, err, i)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Reopen for append and add more records.
+	w, err = OpenAppend(f, dict)
+	if err != nil {
+		t.Fatalf("OpenAppend() error = %v", err)
+	}
+	more := testRecords(2000, 10)
+	for _, rec := range more {
+		w.Append(rec)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := w.Append(more[0]); !errors.Is(err, ErrClosed) {
+		t.Errorf("Append() after Close error = %v, want ErrClosed", err)
+	}
+	records = append(records, more...)
+
+	fi, _ := f.Stat()
+	r, err := NewReader(f, fi.Size(), dict)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if r.Len() != len(records) || r.DictID() != 4242 {
+		t.Fatalf("Len(), DictID() = %d, %d; want %d, 4242", r.Len(), r.DictID(), len(records))
+	}
+	for _, i := range []int{len(records) - 1, 0, 50, 51, 17} {
+		got, err := r.Record(i)
+		if err != nil || !bytes.Equal(got, records[i]) {
+			t.Errorf("Record(%d) = %q, %v; want %q", i, got, err, records[i])
+		}
+	}
+	if _, err := r.Record(len(records)); err == nil {
+		t.Error("Record() out of range succeeded")
+	}
+
+	// The file is a plain zstd stream of the records.
+	data, _ := os.ReadFile(path)
+	dec, _ := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+	defer dec.Close()
+	all, err := dec.DecodeAll(data, nil)
+	if err != nil || !bytes.Equal(all, bytes.Join(records, nil)) {
+		t.Errorf("decoding the whole file failed: %v", err)
+	}
+
+	if _, err := NewReader(f, fi.Size(), nil); !errors.Is(err, zstddict.ErrDictMismatch) {
+		t.Errorf("NewReader() without dictionary error = %v, want ErrDictMismatch", err)
+	}
+	if _, err := NewReader(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1), dict); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("NewReader() of truncated file error = %v, want ErrNoIndex", err)
+	}
+}
@@ -0,0 +1,140 @@
+package samplers
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+
+	"github.com/paulstuart/zstd-dict/internal/xxhash"
+)
+
+// redundancyGram is the substring length used to measure redundancy. It
+// is in the range of zstd's minimum match lengths.
+const redundancyGram = 8
+
+// CorpusStats summarizes a training corpus. Dictionaries pay off for
+// corpora of small samples that repeat each other's content (high
+// CrossRedundancy) but not their own (low SelfRedundancy), since zstd
+// already finds repetition within a sample.
+type CorpusStats struct {
+	Samples    int
+	TotalBytes int64
+	// Duplicates is the number of samples identical to an earlier one.
+	Duplicates int
+	// DuplicateRate is Duplicates / Samples.
+	DuplicateRate float64
+
+	// Size distribution, in bytes.
+	MinSize    int
+	MaxSize    int
+	MeanSize   float64
+	MedianSize int
+	P90Size    int
+	P99Size    int
+
+	// Entropy is the order-0 Shannon entropy of the corpus bytes, in bits
+	// per byte: 8 for random data, lower for text.
+	Entropy float64
+	// SelfRedundancy is the fraction of sample bytes starting an 8-byte
+	// sequence that occurred earlier in the same sample.
+	SelfRedundancy float64
+	// CrossRedundancy is the fraction of sample bytes starting an 8-byte
+	// sequence that also occurs in a different sample: the content a
+	// dictionary could supply.
+	CrossRedundancy float64
+}
+
+// AnalyzeCorpus computes statistics for samples. Redundancy is measured
+// over unique samples, so duplicates don't inflate it. Memory use grows
+// with the number of distinct 8-byte sequences in the corpus.
+func AnalyzeCorpus(samples [][]byte) CorpusStats {
+	var st CorpusStats
+	st.Samples = len(samples)
+	if len(samples) == 0 {
+		return st
+	}
+
+	sizes := make([]int, len(samples))
+	var hist [256]int64
+	seen := make(map[uint64]bool, len(samples))
+	var unique [][]byte
+	for i, s := range samples {
+		sizes[i] = len(s)
+		st.TotalBytes += int64(len(s))
+		for _, b := range s {
+			hist[b]++
+		}
+		h := xxhash.Sum64(s)
+		if seen[h] {
+			st.Duplicates++
+			continue
+		}
+		seen[h] = true
+		unique = append(unique, s)
+	}
+	st.DuplicateRate = float64(st.Duplicates) / float64(st.Samples)
+
+	slices.Sort(sizes)
+	st.MinSize, st.MaxSize = sizes[0], sizes[len(sizes)-1]
+	st.MeanSize = float64(st.TotalBytes) / float64(st.Samples)
+	st.MedianSize = percentile(sizes, 50)
+	st.P90Size = percentile(sizes, 90)
+	st.P99Size = percentile(sizes, 99)
+
+	if st.TotalBytes > 0 {
+		for _, n := range hist {
+			if n > 0 {
+				p := float64(n) / float64(st.TotalBytes)
+				st.Entropy -= p * math.Log2(p)
+			}
+		}
+	}
+
+	st.SelfRedundancy, st.CrossRedundancy = redundancy(unique)
+	return st
+}
+
+// percentile returns the p-th percentile of sorted, by nearest rank.
+func percentile(sorted []int, p int) int {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// redundancy measures self and cross-sample redundancy over 8-byte
+// sequences.
+func redundancy(samples [][]byte) (self, cross float64) {
+	// owner records the first sample containing each sequence, or -1 once
+	// a second sample contains it too.
+	owner := make(map[uint64]int)
+	for i, s := range samples {
+		for p := 0; p+redundancyGram <= len(s); p++ {
+			g := binary.LittleEndian.Uint64(s[p:])
+			if o, ok := owner[g]; !ok {
+				owner[g] = i
+			} else if o != i {
+				owner[g] = -1
+			}
+		}
+	}
+
+	var total, selfHits, crossHits int
+	inSample := make(map[uint64]bool)
+	for _, s := range samples {
+		clear(inSample)
+		for p := 0; p+redundancyGram <= len(s); p++ {
+			g := binary.LittleEndian.Uint64(s[p:])
+			total++
+			if inSample[g] {
+				selfHits++
+			}
+			inSample[g] = true
+			if owner[g] == -1 {
+				crossHits++
+			}
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(selfHits) / float64(total), float64(crossHits) / float64(total)
+}
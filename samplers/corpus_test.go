@@ -0,0 +1,56 @@
+package samplers
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestAnalyzeCorpus(t *testing.T) {
+	// Records sharing a template repeat each other but not themselves.
+	var samples [][]byte
+	for i := range 100 {
+		samples = append(samples, fmt.Appendf(nil, `{"path":"/usr/local/share/app","id":%d,"mode":"-rw-r--r--"}`, i))
+	}
+	samples = append(samples, samples[0], samples[1])
+
+	st := AnalyzeCorpus(samples)
+	if st.Samples != 102 || st.Duplicates != 2 {
+		t.Errorf("Samples, Duplicates = %d, %d; want 102, 2", st.Samples, st.Duplicates)
+	}
+	if st.MinSize > st.MedianSize || st.MedianSize > st.P90Size || st.P90Size > st.P99Size || st.P99Size > st.MaxSize {
+		t.Errorf("size distribution out of order: %+v", st)
+	}
+	if st.CrossRedundancy < 0.8 {
+		t.Errorf("CrossRedundancy = %.2f for templated records, want >= 0.8", st.CrossRedundancy)
+	}
+	if st.SelfRedundancy > 0.1 {
+		t.Errorf("SelfRedundancy = %.2f for templated records, want <= 0.1", st.SelfRedundancy)
+	}
+	if st.Entropy <= 0 || st.Entropy >= 6 {
+		t.Errorf("Entropy = %.2f for text, want between 0 and 6", st.Entropy)
+	}
+
+	// Random samples share nothing and look incompressible.
+	rng := rand.New(rand.NewPCG(1, 2))
+	var random [][]byte
+	for range 50 {
+		b := make([]byte, 4096)
+		for i := range b {
+			b[i] = byte(rng.Uint32())
+		}
+		random = append(random, b)
+	}
+	st = AnalyzeCorpus(random)
+	if st.CrossRedundancy != 0 || st.Duplicates != 0 {
+		t.Errorf("random corpus: CrossRedundancy %.3f, Duplicates %d; want 0, 0", st.CrossRedundancy, st.Duplicates)
+	}
+	if math.Abs(st.Entropy-8) > 0.01 {
+		t.Errorf("random corpus entropy = %.3f, want about 8", st.Entropy)
+	}
+
+	if st := AnalyzeCorpus(nil); st.Samples != 0 {
+		t.Errorf("AnalyzeCorpus(nil) = %+v, want zero", st)
+	}
+}
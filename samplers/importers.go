@@ -0,0 +1,220 @@
+package samplers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// The extractors below import response bodies captured by web tooling, so
+// dictionaries can be trained from real browser sessions and server logs.
+
+// harLog is the part of a HAR 1.2 archive holding response bodies.
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			Response struct {
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ErrInvalidHAR is returned by HAR extractors for files that are not HAR
+// archives.
+var ErrInvalidHAR = errors.New("samplers: invalid HAR archive")
+
+// HAR returns the response body of every entry of each HAR archive, as
+// saved by browser developer tools and most HTTP proxies. Base64-encoded
+// bodies are decoded; entries without a body are skipped.
+func HAR(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+	return HARBodies()(fsys, path, d)
+}
+
+// HARBodies is like HAR, but only returns bodies whose MIME type starts
+// with one of mimeTypes, such as "application/json" or "text/". With no
+// mimeTypes every body is returned.
+func HARBodies(mimeTypes ...string) Extractor {
+	return func(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+		if !d.Type().IsRegular() {
+			return nil, nil
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		var har harLog
+		if err := json.Unmarshal(data, &har); err != nil {
+			return nil, ErrInvalidHAR
+		}
+
+		var samples [][]byte
+		for _, e := range har.Log.Entries {
+			c := e.Response.Content
+			if c.Text == "" || !hasMIMEPrefix(c.MimeType, mimeTypes) {
+				continue
+			}
+			body := []byte(c.Text)
+			if c.Encoding == "base64" {
+				if body, err = base64.StdEncoding.DecodeString(c.Text); err != nil {
+					continue
+				}
+			}
+			samples = append(samples, body)
+		}
+		return samples, nil
+	}
+}
+
+func hasMIMEPrefix(mime string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	mime = strings.ToLower(mime)
+	for _, p := range prefixes {
+		if strings.HasPrefix(mime, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONLogField returns a field of each line of JSON-lines log files, such
+// as the response body recorded by structured access logs. field is a
+// dot-separated path into the record, e.g. "response.body". String values
+// are returned unquoted, other values as JSON. Lines that aren't JSON
+// objects or lack the field are skipped.
+func JSONLogField(field string) Extractor {
+	keys := strings.Split(field, ".")
+	return lineExtractor(func(line []byte) []byte {
+		var v any
+		if json.Unmarshal(line, &v) != nil {
+			return nil
+		}
+		for _, k := range keys {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			if v, ok = obj[k]; !ok {
+				return nil
+			}
+		}
+		switch v := v.(type) {
+		case nil:
+			return nil
+		case string:
+			return []byte(v)
+		default:
+			b, _ := json.Marshal(v)
+			return b
+		}
+	})
+}
+
+// AccessLogBody returns a quoted field of each line of access logs in the
+// Common or Combined Log Format extended with logged bodies, as written by
+// an nginx log_format ending in "$request_body" or a response body
+// variable. field indexes the double-quoted fields of the line: in the
+// Combined format 0 is the request line, 1 the referer and 2 the user
+// agent. Negative indexes count from the end, so -1 is the last field.
+//
+// nginx escapes quotes, backslashes and non-printable bytes in logged
+// values as \" \\ and \xHH; these are decoded. Fields logged as "-", nginx's
+// placeholder for an empty value, are skipped.
+func AccessLogBody(field int) Extractor {
+	return lineExtractor(func(line []byte) []byte {
+		fields := quotedFields(line)
+		i := field
+		if i < 0 {
+			i += len(fields)
+		}
+		if i < 0 || i >= len(fields) || string(fields[i]) == "-" {
+			return nil
+		}
+		return fields[i]
+	})
+}
+
+// quotedFields returns the unescaped double-quoted fields of an access log
+// line.
+func quotedFields(line []byte) [][]byte {
+	var fields [][]byte
+	for {
+		start := bytes.IndexByte(line, '"')
+		if start < 0 {
+			return fields
+		}
+		line = line[start+1:]
+		var field []byte
+		closed := false
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c == '"' {
+				line, closed = line[i+1:], true
+				break
+			}
+			if c == '\\' && i+1 < len(line) {
+				i++
+				switch c = line[i]; c {
+				case 'x':
+					if i+2 < len(line) {
+						if b, err := strconv.ParseUint(string(line[i+1:i+3]), 16, 8); err == nil {
+							field = append(field, byte(b))
+							i += 2
+							continue
+						}
+					}
+					field = append(field, '\\', 'x')
+					continue
+				case '"', '\\':
+				default:
+					field = append(field, '\\')
+				}
+			}
+			field = append(field, c)
+		}
+		if !closed {
+			return fields
+		}
+		fields = append(fields, field)
+	}
+}
+
+// lineExtractor returns an Extractor applying fn to each non-empty line of
+// each regular file, keeping the non-empty results.
+func lineExtractor(fn func(line []byte) []byte) Extractor {
+	return func(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+		if !d.Type().IsRegular() {
+			return nil, nil
+		}
+		f, err := fsys.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var samples [][]byte
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, maxLineSize)
+		for sc.Scan() {
+			line := bytes.TrimSuffix(sc.Bytes(), []byte("\r"))
+			if len(line) == 0 {
+				continue
+			}
+			if s := fn(line); len(s) > 0 {
+				samples = append(samples, bytes.Clone(s))
+			}
+		}
+		return samples, sc.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package samplers
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+const testHAR = `{"log": {"version": "1.2", "entries": [
+  {"response": {"content": {"mimeType": "application/json; charset=utf-8", "text": "{\"id\":1}"}}},
+  {"response": {"content": {"mimeType": "text/html", "text": "<p>hi</p>"}}},
+  {"response": {"content": {"mimeType": "application/json", "text": "eyJpZCI6Mn0=", "encoding": "base64"}}},
+  {"response": {"content": {"mimeType": "image/png"}}}
+]}}`
+
+func TestImporters(t *testing.T) {
+	fsys := fstest.MapFS{
+		"session.har": {Data: []byte(testHAR)},
+		"bad.har":     {Data: []byte("not json")},
+		"access.log": {Data: []byte(
+			`10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /api/files HTTP/1.1" 200 17 "-" "curl/8.0" "{\x22path\x22:\x22/usr\x22}"` + "\n" +
+				`10.0.0.2 - - [10/Oct/2026:13:55:37 +0000] "GET /health HTTP/1.1" 200 2 "-" "curl/8.0" "-"` + "\n" +
+				"truncated line without quotes\n"),
+		},
+		"body.jsonl": {Data: []byte(
+			`{"status":200,"response":{"body":"{\"files\":[]}"}}` + "\n" +
+				`{"status":404}` + "\n" +
+				`{"status":200,"response":{"body":{"files":["a"]}}}` + "\n" +
+				"garbage\n"),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		extract Extractor
+		want    []string
+	}{
+		{"HAR", "session.har", HAR, []string{`{"id":1}`, "<p>hi</p>", `{"id":2}`}},
+		{"HARBodies", "session.har", HARBodies("application/json"), []string{`{"id":1}`, `{"id":2}`}},
+		{"AccessLogBody", "access.log", AccessLogBody(-1), []string{`{"path":"/usr"}`}},
+		{"AccessLogRequest", "access.log", AccessLogBody(0), []string{"GET /api/files HTTP/1.1", "GET /health HTTP/1.1"}},
+		{"JSONLogField", "body.jsonl", JSONLogField("response.body"), []string{`{"files":[]}`, `{"files":["a"]}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collect(fsys, ".", Options{
+				Extract: tt.extract,
+				Match:   func(path string, _ fs.DirEntry) bool { return path == tt.path },
+			})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if !slices.Equal(strs(got), tt.want) {
+				t.Errorf("Collect() = %q, want %q", strs(got), tt.want)
+			}
+		})
+	}
+
+	d, err := fs.Stat(fsys, "bad.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HAR(fsys, "bad.har", fs.FileInfoToDirEntry(d)); !errors.Is(err, ErrInvalidHAR) {
+		t.Errorf("HAR(bad.har) error = %v, want ErrInvalidHAR", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package samplers builds dictionary training corpora from files.
+//
+// Collect walks an fs.FS and turns each entry into training samples with an
+// Extractor: whole files, lines, length-delimited protobuf messages, or any
+// application-specific record format.
+//
+//	samples, err := samplers.Collect(os.DirFS("testdata"), ".", samplers.Options{
+//	    Extract:    samplers.Lines,
+//	    MaxSamples: 10000,
+//	    Shuffle:    true,
+//	})
+//	dict, err := zstddict.TrainDict(samples, nil)
+//
+// AnalyzeCorpus summarizes a corpus before training, to predict whether a
+// dictionary is worth building.
+package samplers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+)
+
+// An Extractor turns one directory entry into zero or more samples. path is
+// relative to the root of fsys. Collect calls it for every entry below the
+// root, directories included, so an extractor may sample metadata as well
+// as content. Returning an error skips the entry.
+type Extractor func(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error)
+
+// WholeFile returns the contents of each regular file as one sample.
+func WholeFile(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+	if !d.Type().IsRegular() {
+		return nil, nil
+	}
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return [][]byte{data}, nil
+}
+
+// Lines returns each non-empty line of each regular file as a sample,
+// without its line ending.
+func Lines(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+	if !d.Type().IsRegular() {
+		return nil, nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples [][]byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxLineSize)
+	for sc.Scan() {
+		if line := bytes.TrimSuffix(sc.Bytes(), []byte("\r")); len(line) > 0 {
+			samples = append(samples, bytes.Clone(line))
+		}
+	}
+	return samples, sc.Err()
+}
+
+// maxLineSize is the longest line Lines accepts.
+const maxLineSize = 1 << 20
+
+// ErrInvalidDelimited is returned by ProtoDelimited for files that are not
+// a sequence of length-delimited messages.
+var ErrInvalidDelimited = errors.New("samplers: invalid length-delimited record")
+
+// ProtoDelimited returns each message of each regular file as a sample.
+// Files must hold varint length-prefixed messages, the format written by
+// protodelim.MarshalTo and Java's writeDelimitedTo. The messages are
+// returned in wire form and are not parsed.
+func ProtoDelimited(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+	if !d.Type().IsRegular() {
+		return nil, nil
+	}
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	var samples [][]byte
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, ErrInvalidDelimited
+		}
+		data = data[n:]
+		if size > 0 {
+			samples = append(samples, data[:size:size])
+		}
+		data = data[size:]
+	}
+	return samples, nil
+}
+
+// Options configures Collect.
+type Options struct {
+	// Extract turns entries into samples. The default is WholeFile.
+	Extract Extractor
+	// Match, if set, selects the entries passed to Extract.
+	Match func(path string, d fs.DirEntry) bool
+	// MaxSamples limits the number of samples returned; 0 means no limit.
+	MaxSamples int
+	// MaxFileSize skips regular files larger than this many bytes; 0 means
+	// no limit.
+	MaxFileSize int64
+	// MinSampleSize and MaxSampleSize drop samples outside the given
+	// range. Zero disables the corresponding bound.
+	MinSampleSize int
+	MaxSampleSize int
+	// Shuffle returns the samples in random order. Combined with
+	// MaxSamples, it returns a uniform random subset of all samples
+	// instead of the first MaxSamples found.
+	Shuffle bool
+	// Seed makes shuffling reproducible. Zero uses a random seed.
+	Seed uint64
+}
+
+// Collect walks fsys from root and returns the samples extracted from its
+// entries, in walk order unless shuffled. Entries that cannot be read or
+// extracted are skipped, as are subtrees that cannot be listed.
+func Collect(fsys fs.FS, root string, opts Options) ([][]byte, error) {
+	extract := opts.Extract
+	if extract == nil {
+		extract = WholeFile
+	}
+	var rng *rand.Rand
+	if opts.Shuffle {
+		seed := opts.Seed
+		if seed == 0 {
+			seed = rand.Uint64()
+		}
+		rng = rand.New(rand.NewPCG(seed, seed))
+	}
+
+	var samples [][]byte
+	seen := 0
+	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if opts.Match != nil && !opts.Match(path, d) {
+			return nil
+		}
+		if opts.MaxFileSize > 0 && d.Type().IsRegular() {
+			if info, err := d.Info(); err != nil || info.Size() > opts.MaxFileSize {
+				return nil
+			}
+		}
+
+		records, err := extract(fsys, path, d)
+		if err != nil {
+			return nil
+		}
+		for _, r := range records {
+			if len(r) < opts.MinSampleSize || (opts.MaxSampleSize > 0 && len(r) > opts.MaxSampleSize) {
+				continue
+			}
+			seen++
+			switch {
+			case opts.MaxSamples <= 0 || len(samples) < opts.MaxSamples:
+				samples = append(samples, r)
+			case rng != nil:
+				// Reservoir sampling keeps a uniform subset of everything seen.
+				if i := rng.IntN(seen); i < opts.MaxSamples {
+					samples[i] = r
+				}
+			default:
+				return fs.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rng != nil {
+		rng.Shuffle(len(samples), func(i, j int) {
+			samples[i], samples[j] = samples[j], samples[i]
+		})
+	}
+	return samples, nil
+}
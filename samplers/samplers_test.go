@@ -0,0 +1,103 @@
+package samplers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	fsys := fstest.MapFS{
+		"a.txt":       {Data: []byte("alpha\nbeta\r\n\ngamma\n")},
+		"sub/b.txt":   {Data: []byte("delta\n")},
+		"sub/big.bin": {Data: []byte(strings.Repeat("x", 1000))},
+	}
+	var delim []byte
+	for _, msg := range []string{"one", "two", "three"} {
+		delim = binary.AppendUvarint(delim, uint64(len(msg)))
+		delim = append(delim, msg...)
+	}
+	fsys["msgs.pb"] = &fstest.MapFile{Data: delim}
+	return fsys
+}
+
+func strs(samples [][]byte) []string {
+	out := make([]string, len(samples))
+	for i, s := range samples {
+		out[i] = string(s)
+	}
+	return out
+}
+
+func TestCollect_Extractors(t *testing.T) {
+	fsys := testFS()
+	isText := func(path string, _ fs.DirEntry) bool { return strings.HasSuffix(path, ".txt") }
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"whole files", Options{Match: isText}, []string{"alpha\nbeta\r\n\ngamma\n", "delta\n"}},
+		{"lines", Options{Extract: Lines, Match: isText}, []string{"alpha", "beta", "gamma", "delta"}},
+		{"proto delimited", Options{
+			Extract: ProtoDelimited,
+			Match:   func(path string, _ fs.DirEntry) bool { return strings.HasSuffix(path, ".pb") },
+		}, []string{"one", "two", "three"}},
+		{"max samples", Options{Extract: Lines, Match: isText, MaxSamples: 2}, []string{"alpha", "beta"}},
+		{"sample size", Options{Extract: Lines, Match: isText, MinSampleSize: 5, MaxSampleSize: 5}, []string{"alpha", "gamma", "delta"}},
+		{"max file size", Options{MaxFileSize: 100, Match: func(path string, _ fs.DirEntry) bool {
+			return strings.HasPrefix(path, "sub/")
+		}}, []string{"delta\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collect(fsys, ".", tt.opts)
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if !slices.Equal(strs(got), tt.want) {
+				t.Errorf("Collect() = %q, want %q", strs(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestCollect_Shuffle(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := range 100 {
+		fsys[fmt.Sprintf("f%03d", i)] = &fstest.MapFile{Data: []byte(fmt.Sprint(i))}
+	}
+
+	opts := Options{Shuffle: true, Seed: 42, MaxSamples: 10}
+	first, err := Collect(fsys, ".", opts)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	second, _ := Collect(fsys, ".", opts)
+	if !slices.Equal(strs(first), strs(second)) {
+		t.Errorf("same seed gave %q and %q", strs(first), strs(second))
+	}
+	if len(first) != 10 {
+		t.Fatalf("Collect() = %d samples, want 10", len(first))
+	}
+
+	// A uniform subset of 100 files is very unlikely to be the first ten.
+	inOrder, _ := Collect(fsys, ".", Options{MaxSamples: 10})
+	sorted := slices.Sorted(slices.Values(strs(first)))
+	if slices.Equal(sorted, slices.Sorted(slices.Values(strs(inOrder)))) {
+		t.Errorf("shuffled subset %q equals the first ten files", sorted)
+	}
+}
+
+func TestProtoDelimited_Invalid(t *testing.T) {
+	fsys := fstest.MapFS{"bad.pb": {Data: []byte{10, 'a'}}}
+	entries, _ := fs.ReadDir(fsys, ".")
+	if _, err := ProtoDelimited(fsys, "bad.pb", entries[0]); err != ErrInvalidDelimited {
+		t.Errorf("ProtoDelimited() error = %v, want ErrInvalidDelimited", err)
+	}
+}
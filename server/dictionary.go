@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DictionaryServer implements the DictionaryService. It publishes the
+// current version of each named dictionary and pushes every promoted
+// version to the clients watching it, so a fleet rotates dictionaries as
+// soon as a server has a new one.
+//
+// A Provisioner can publish the dictionaries it trains:
+//
+//	ds := server.NewDictionaryServer()
+//	p := grpccodec.NewProvisioner(grpccodec.ProvisionOptions{
+//	    OnTrain: func(pt grpccodec.ProvisionedType, err error) {
+//	        if err == nil {
+//	            ds.Promote(string(pt.MessageType), pt.Dict)
+//	        }
+//	    },
+//	})
+//
+// Servers must keep decoding frames made with earlier versions until their
+// clients have switched; a grpccodec.TypeCompressor does.
+type DictionaryServer struct {
+	dpb.UnimplementedDictionaryServiceServer
+
+	mu       sync.Mutex
+	dicts    map[string]*dpb.Dictionary
+	watchers map[*dictWatcher]struct{}
+}
+
+// dictWatcher is the state of one WatchDictionaries call, guarded by
+// DictionaryServer.mu. Only the latest version of each dictionary is kept
+// pending, so slow clients skip versions instead of queueing them.
+type dictWatcher struct {
+	names   map[string]bool // nil watches every dictionary
+	pending map[string]*dpb.Dictionary
+	notify  chan struct{}
+}
+
+// NewDictionaryServer returns a DictionaryServer publishing no
+// dictionaries.
+func NewDictionaryServer() *DictionaryServer {
+	return &DictionaryServer{
+		dicts:    make(map[string]*dpb.Dictionary),
+		watchers: make(map[*dictWatcher]struct{}),
+	}
+}
+
+// Promote makes a copy of dict the current version of the dictionary
+// called name and sends it to the clients watching it. Promoting the
+// current version again does nothing; a dictionary with the current ID but
+// different content is a new version, since IDs are chosen by whoever
+// trains the dictionary and need not be unique.
+func (s *DictionaryServer) Promote(name string, dict []byte) error {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return fmt.Errorf("server: promoting dictionary %q: %w", name, err)
+	}
+	msg := &dpb.Dictionary{Name: name, Id: d.ID(), Data: bytes.Clone(dict)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.dicts[name]; ok && cur.Id == msg.Id && bytes.Equal(cur.Data, msg.Data) {
+		return nil
+	}
+	s.dicts[name] = msg
+	for w := range s.watchers {
+		w.offer(msg)
+	}
+	return nil
+}
+
+// offer queues d for w if w watches it. The caller holds
+// DictionaryServer.mu.
+func (w *dictWatcher) offer(d *dpb.Dictionary) {
+	if w.names != nil && !w.names[d.Name] {
+		return
+	}
+	w.pending[d.Name] = d
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// GetDictionary returns the current version of the requested dictionary.
+func (s *DictionaryServer) GetDictionary(ctx context.Context, req *dpb.GetDictionaryRequest) (*dpb.Dictionary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dicts[req.GetName()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no dictionary %q", req.GetName())
+	}
+	return d, nil
+}
+
+// WatchDictionaries sends the current version of each requested dictionary,
+// then every version promoted later, until the client cancels.
+func (s *DictionaryServer) WatchDictionaries(req *dpb.WatchDictionariesRequest, stream grpc.ServerStreamingServer[dpb.Dictionary]) error {
+	w := &dictWatcher{
+		pending: make(map[string]*dpb.Dictionary),
+		notify:  make(chan struct{}, 1),
+	}
+	if len(req.GetNames()) > 0 {
+		w.names = make(map[string]bool)
+		for _, name := range req.GetNames() {
+			w.names[name] = true
+		}
+	}
+
+	s.mu.Lock()
+	for _, d := range s.dicts {
+		w.offer(d)
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.notify:
+		}
+		s.mu.Lock()
+		pending := w.pending
+		w.pending = make(map[string]*dpb.Dictionary)
+		s.mu.Unlock()
+		for _, d := range pending {
+			if err := stream.Send(d); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	"github.com/paulstuart/zstd-dict/zstddict"
+)
+
+func TestDictionaryServer_Promote(t *testing.T) {
+	s := NewDictionaryServer()
+	get := func() *dpb.Dictionary {
+		t.Helper()
+		d, err := s.GetDictionary(context.Background(), &dpb.GetDictionaryRequest{Name: "listing"})
+		if err != nil {
+			t.Fatalf("GetDictionary() error = %v", err)
+		}
+		return d
+	}
+
+	dict := testdict.Train(t, 7)
+	if err := s.Promote("listing", dict); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+	want := bytes.Clone(dict)
+	dict[len(dict)-1] ^= 0xff
+	if got := get(); !bytes.Equal(got.GetData(), want) {
+		t.Error("Promote() kept the caller's slice; changing it changed the published dictionary")
+	}
+
+	// Promoting the same content again is not a new version.
+	cur := get()
+	if err := s.Promote("listing", want); err != nil {
+		t.Fatalf("Promote() again error = %v", err)
+	}
+	if get() != cur {
+		t.Error("Promote() of the current dictionary replaced it")
+	}
+
+	// Different content under the same ID is.
+	var samples [][]byte
+	for i := range 100 {
+		samples = append(samples, []byte(strings.Repeat("/var/log/service"+strconv.Itoa(i%5)+".log 512 -rw-------\n", 20)))
+	}
+	other, err := zstddict.TrainDict(samples, &zstddict.TrainDictOptions{ID: 7})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if err := s.Promote("listing", other); err != nil {
+		t.Fatalf("Promote() of new content error = %v", err)
+	}
+	if got := get(); got.GetId() != 7 || !bytes.Equal(got.GetData(), other) {
+		t.Errorf("GetDictionary() = ID %d, %d bytes; want the new content under ID 7", got.GetId(), len(got.GetData()))
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/paulstuart/zstd-dict/internal/listdiff"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+)
+
+// maxCachedListings is the number of recent listings kept for DiffFiles.
+// Clients whose base has been evicted get the whole listing again.
+const maxCachedListings = 16
+
+// DiffFiles lists the directory tree like ListFiles, but returns only the
+// changes since the client's base_version, compressed with the base listing
+// as a raw dictionary. Polling clients whose listing barely changes
+// receive a few bytes instead of the whole listing.
+func (s *FileListServer) DiffFiles(ctx context.Context, req *pb.DiffFilesRequest) (*pb.DiffFilesResponse, error) {
+	absRoot, files, err := walk(ctx, req.GetPath(), int(req.GetMaxDepth()))
+	if err != nil {
+		return nil, err
+	}
+	listing, err := listdiff.Marshal(absRoot, files)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.DiffFilesResponse{Version: listdiff.Version(listing)}
+
+	var base []byte
+	var baseFiles []*pb.FileInfo
+	if v := req.GetBaseVersion(); v != "" {
+		if b, ok := s.listings.get(v); ok {
+			prev, err := listdiff.Unmarshal(b)
+			if err != nil {
+				return nil, err
+			}
+			base, baseFiles, resp.BaseVersion = b, prev.GetFiles(), v
+		}
+	}
+	s.listings.add(resp.Version, listing)
+
+	resp.Changes, err = listdiff.Compress(listdiff.Diff(absRoot, baseFiles, files), base)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// listingCache holds the most recently produced listings by version.
+// The zero value is ready to use.
+type listingCache struct {
+	mu       sync.Mutex
+	listings map[string][]byte
+	order    []string // oldest first
+}
+
+func (c *listingCache) get(version string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.listings[version]
+	return b, ok
+}
+
+func (c *listingCache) add(version string, listing []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.listings[version]; ok {
+		// Unchanged listings stay cached while clients keep polling them.
+		i := slices.Index(c.order, version)
+		c.order = append(slices.Delete(c.order, i, i+1), version)
+		return
+	}
+	if c.listings == nil {
+		c.listings = make(map[string][]byte)
+	}
+	if len(c.order) == maxCachedListings {
+		delete(c.listings, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.listings[version] = listing
+	c.order = append(c.order, version)
+}
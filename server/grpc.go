@@ -0,0 +1,99 @@
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	dpb "github.com/paulstuart/zstd-dict/proto/dictionary"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/stats"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+// Options configures NewGRPCServer.
+type Options struct {
+	// Dict, if set, registers the zstd-dict compressor with this
+	// dictionary. The plain zstd compressor is always available.
+	Dict []byte
+	// DictURL is reported to clients whose requests use a dictionary the
+	// server doesn't have. See grpccodec.WithDictURL.
+	DictURL string
+	// Observer, if set, receives codec events.
+	Observer stats.Observer
+
+	// TLSConfig, if set, enables TLS.
+	TLSConfig *tls.Config
+
+	// UnaryInterceptors and StreamInterceptors are chained in order, for
+	// example for authentication, metrics, or traffic capture.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+	// StatsHandlers receive per-connection and per-RPC events, such as a
+	// *grpccodec.ConnMonitor.
+	StatsHandlers []grpcstats.Handler
+
+	// Dictionaries, if set, is registered as the DictionaryService, so
+	// clients can fetch and watch the server's dictionaries.
+	Dictionaries *DictionaryServer
+
+	// Health is the health service to register. If nil, one is created
+	// reporting SERVING for the server and the FileListService.
+	Health *health.Server
+
+	// ServerOptions are appended after those derived from the fields above.
+	ServerOptions []grpc.ServerOption
+}
+
+// NewGRPCServer returns a grpc.Server with the zstd compressors registered
+// and the FileListService and health service installed. The caller starts
+// it with Serve.
+//
+// Compressor registration is global to the process, so NewGRPCServer must
+// be called before other servers or client connections are created, and
+// fails with grpccodec.ErrAlreadyRegistered if a different zstd-dict
+// dictionary is already registered.
+func NewGRPCServer(opts Options) (*grpc.Server, error) {
+	err := grpccodec.RegisterWithConfig(grpccodec.Config{
+		Dict:     opts.Dict,
+		DictURL:  opts.DictURL,
+		Observer: opts.Observer,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sopts []grpc.ServerOption
+	if opts.TLSConfig != nil {
+		sopts = append(sopts, grpc.Creds(credentials.NewTLS(opts.TLSConfig)))
+	}
+	if len(opts.UnaryInterceptors) > 0 {
+		sopts = append(sopts, grpc.ChainUnaryInterceptor(opts.UnaryInterceptors...))
+	}
+	if len(opts.StreamInterceptors) > 0 {
+		sopts = append(sopts, grpc.ChainStreamInterceptor(opts.StreamInterceptors...))
+	}
+	for _, h := range opts.StatsHandlers {
+		sopts = append(sopts, grpc.StatsHandler(h))
+	}
+	sopts = append(sopts, opts.ServerOptions...)
+
+	s := grpc.NewServer(sopts...)
+	pb.RegisterFileListServiceServer(s, New())
+	if opts.Dictionaries != nil {
+		dpb.RegisterDictionaryServiceServer(s, opts.Dictionaries)
+	}
+
+	hs := opts.Health
+	if hs == nil {
+		hs = health.NewServer()
+		hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		hs.SetServingStatus(pb.FileListService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, hs)
+
+	return s, nil
+}
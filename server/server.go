@@ -1,19 +1,30 @@
-// Package server implements the FileListService gRPC server.
+// Package server implements the FileListService and DictionaryService gRPC
+// servers.
 package server
 
 import (
 	"context"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/paulstuart/zstd-dict/grpccodec"
 
 	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/samplers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/protobuf/proto"
 )
 
 // FileListServer implements the FileListService.
 type FileListServer struct {
 	pb.UnimplementedFileListServiceServer
+
+	// listings caches recent listings for DiffFiles.
+	listings listingCache
 }
 
 // New creates a new FileListServer.
@@ -23,7 +34,23 @@ func New() *FileListServer {
 
 // ListFiles walks the directory tree and returns file information.
 func (s *FileListServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
-	root := req.GetPath()
+	absRoot, files, err := walk(ctx, req.GetPath(), int(req.GetMaxDepth()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListFilesResponse{
+		Root:       absRoot,
+		Files:      files,
+		TotalCount: int64(len(files)),
+	}
+	resp.Compression = compressionInfo(ctx, resp, req.GetMeasureCompression())
+	return resp, nil
+}
+
+// walk lists the directory tree at root down to maxDepth, returning the
+// absolute root and its entries in walk order.
+func walk(ctx context.Context, root string, maxDepth int) (string, []*pb.FileInfo, error) {
 	if root == "" {
 		root = "."
 	}
@@ -31,11 +58,10 @@ func (s *FileListServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest
 	// Resolve to absolute path
 	absRoot, err := filepath.Abs(root)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	var files []*pb.FileInfo
-	maxDepth := int(req.GetMaxDepth())
 
 	err = filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -96,14 +122,53 @@ func (s *FileListServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
+	return absRoot, files, nil
+}
 
-	return &pb.ListFilesResponse{
-		Root:       absRoot,
-		Files:      files,
-		TotalCount: int64(len(files)),
-	}, nil
+// compressionInfo describes how gRPC will compress msg as the response to
+// the RPC in ctx. With measure set, it times compressing msg once with the
+// same compressor. If the response compressor can't be determined, only
+// UncompressedSize is set.
+func compressionInfo(ctx context.Context, msg proto.Message, measure bool) *pb.CompressionInfo {
+	info := &pb.CompressionInfo{UncompressedSize: int64(proto.Size(msg))}
+
+	// The transport stream knows the negotiated response compressor, but
+	// gRPC has no public accessor for it: SendCompress is an undocumented
+	// method on its internal server stream, so it may disappear in a
+	// later release. When it is missing, as it also is for handlers
+	// called outside a gRPC server, the info silently falls back to the
+	// uncompressed size alone, the same as for an uncompressed response.
+	st, ok := grpc.ServerTransportStreamFromContext(ctx).(interface{ SendCompress() string })
+	if !ok {
+		return info
+	}
+	info.Compressor = st.SendCompress()
+	if info.Compressor == "" || info.Compressor == encoding.Identity {
+		info.Compressor = ""
+		return info
+	}
+	info.DictId = grpccodec.RegisteredDictID(info.Compressor)
+
+	comp := encoding.GetCompressor(info.Compressor)
+	if !measure || comp == nil {
+		return info
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return info
+	}
+	start := time.Now()
+	w, err := comp.Compress(io.Discard)
+	if err != nil {
+		return info
+	}
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil && cerr == nil {
+		info.ServerCompressMicros = time.Since(start).Microseconds()
+	}
+	return info
 }
 
 // GenerateSamples generates sample file listing data for dictionary training.
@@ -112,51 +177,31 @@ func GenerateSamples(dirs []string, maxSamples int) ([][]byte, error) {
 	var samples [][]byte
 
 	for _, dir := range dirs {
-		absDir, err := filepath.Abs(dir)
+		if len(samples) >= maxSamples {
+			break
+		}
+		fsys, err := dirFS(dir)
 		if err != nil {
 			continue
 		}
-
-		err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return nil // Skip errors
-			}
-
-			if len(samples) >= maxSamples {
-				return fs.SkipAll
-			}
-
-			relPath, err := filepath.Rel(absDir, path)
-			if err != nil || relPath == "." {
-				return nil
-			}
-
-			info, err := d.Info()
-			if err != nil {
-				return nil
-			}
-
-			// Create a sample that mimics the wire format
-			fi := &pb.FileInfo{
-				Path:    relPath,
-				Name:    d.Name(),
-				Size:    info.Size(),
-				Mode:    uint32(info.Mode()),
-				ModTime: info.ModTime().Unix(),
-				IsDir:   d.IsDir(),
-			}
-
-			data, err := marshalFileInfo(fi)
-			if err != nil {
-				return nil
-			}
-
-			samples = append(samples, data)
-			return nil
+		more, err := samplers.Collect(fsys, ".", samplers.Options{
+			Extract: func(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+				fi, err := fileInfo(path, d)
+				if err != nil {
+					return nil, err
+				}
+				data, err := marshalFileInfo(fi)
+				if err != nil {
+					return nil, err
+				}
+				return [][]byte{data}, nil
+			},
+			MaxSamples: maxSamples - len(samples),
 		})
 		if err != nil {
 			continue
 		}
+		samples = append(samples, more...)
 	}
 
 	return samples, nil
@@ -181,65 +226,49 @@ func GenerateResponseSamples(dirs []string, filesPerSample, maxSamples int) ([][
 		if err != nil {
 			continue
 		}
+		fsys, err := dirFS(absDir)
+		if err != nil {
+			continue
+		}
 
 		var files []*pb.FileInfo
-		err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return nil
-			}
-
-			relPath, err := filepath.Rel(absDir, path)
-			if err != nil || relPath == "." {
-				return nil
-			}
-
-			info, err := d.Info()
-			if err != nil {
-				return nil
-			}
-
-			files = append(files, &pb.FileInfo{
-				Path:    relPath,
-				Name:    d.Name(),
-				Size:    info.Size(),
-				Mode:    uint32(info.Mode()),
-				ModTime: info.ModTime().Unix(),
-				IsDir:   d.IsDir(),
+		response := func() ([]byte, error) {
+			data, err := proto.Marshal(&pb.ListFilesResponse{
+				Root:       absDir,
+				Files:      files,
+				TotalCount: int64(len(files)),
 			})
+			files = nil // Reset for next sample
+			return data, err
+		}
 
-			// Create a sample when we have enough files
-			if len(files) >= filesPerSample {
-				resp := &pb.ListFilesResponse{
-					Root:       absDir,
-					Files:      files,
-					TotalCount: int64(len(files)),
+		more, err := samplers.Collect(fsys, ".", samplers.Options{
+			// Group files into responses, emitting a sample when one is full.
+			Extract: func(fsys fs.FS, path string, d fs.DirEntry) ([][]byte, error) {
+				fi, err := fileInfo(path, d)
+				if err != nil {
+					return nil, err
 				}
-				data, err := proto.Marshal(resp)
-				if err == nil {
-					samples = append(samples, data)
+				files = append(files, fi)
+				if len(files) < filesPerSample {
+					return nil, nil
 				}
-				files = nil // Reset for next sample
-			}
-
-			if len(samples) >= maxSamples {
-				return fs.SkipAll
-			}
-
-			return nil
+				data, err := response()
+				if err != nil {
+					return nil, err
+				}
+				return [][]byte{data}, nil
+			},
+			MaxSamples: maxSamples - len(samples),
 		})
 		if err != nil {
 			continue
 		}
+		samples = append(samples, more...)
 
 		// Handle remaining files
 		if len(files) > 0 && len(samples) < maxSamples {
-			resp := &pb.ListFilesResponse{
-				Root:       absDir,
-				Files:      files,
-				TotalCount: int64(len(files)),
-			}
-			data, err := proto.Marshal(resp)
-			if err == nil {
+			if data, err := response(); err == nil {
 				samples = append(samples, data)
 			}
 		}
@@ -248,6 +277,32 @@ func GenerateResponseSamples(dirs []string, filesPerSample, maxSamples int) ([][
 	return samples, nil
 }
 
+// dirFS returns a file system rooted at dir.
+func dirFS(dir string) (fs.FS, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return os.DirFS(absDir), nil
+}
+
+// fileInfo describes the entry at path, relative to the walked directory,
+// as it would appear in a ListFilesResponse.
+func fileInfo(path string, d fs.DirEntry) (*pb.FileInfo, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FileInfo{
+		Path:    filepath.FromSlash(path),
+		Name:    d.Name(),
+		Size:    info.Size(),
+		Mode:    uint32(info.Mode()),
+		ModTime: info.ModTime().Unix(),
+		IsDir:   d.IsDir(),
+	}, nil
+}
+
 // TrainFromDirectory creates training samples by walking a directory tree.
 func TrainFromDirectory(root string) ([][]byte, error) {
 	info, err := os.Stat(root)
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/paulstuart/zstd-dict/grpccodec"
+	"github.com/paulstuart/zstd-dict/internal/testdict"
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"github.com/paulstuart/zstd-dict/stats"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+const dictID = 3208
+
+var (
+	dictOnce sync.Once
+	dict     []byte
+
+	// Registration is global, so every test registers the same observer.
+	collector = stats.NewCollector()
+)
+
+func TestListFiles_CompressionInfo(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 1000 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%04d.txt", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Registration is global, so train once for repeated runs.
+	dictOnce.Do(func() { dict = testdict.Train(t, dictID) })
+	if err := grpccodec.RegisterWithConfig(grpccodec.Config{Dict: dict, Observer: collector}); err != nil {
+		t.Fatalf("RegisterWithConfig() error = %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterFileListServiceServer(s, New())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewFileListServiceClient(conn)
+
+	tests := []struct {
+		name       string
+		compressor string
+		measure    bool
+		wantDictID uint32
+	}{
+		{"identity", "", false, 0},
+		{"identity measured", "", true, 0},
+		{"zstd", grpccodec.NameZstd, false, 0},
+		{"zstd measured", grpccodec.NameZstd, true, 0},
+		{"zstd-dict", grpccodec.NameZstdDict, false, dictID},
+		{"zstd-dict measured", grpccodec.NameZstdDict, true, dictID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []grpc.CallOption
+			if tt.compressor != "" {
+				opts = append(opts, grpc.UseCompressor(tt.compressor))
+			}
+			req := &pb.ListFilesRequest{Path: dir, MeasureCompression: tt.measure}
+			resp, err := client.ListFiles(context.Background(), req, opts...)
+			if err != nil {
+				t.Fatalf("ListFiles() error = %v", err)
+			}
+			info := resp.GetCompression()
+			if info == nil {
+				t.Fatal("ListFiles() returned no CompressionInfo")
+			}
+			resp.Compression = nil
+			if got, want := info.GetUncompressedSize(), int64(proto.Size(resp)); got != want {
+				t.Errorf("UncompressedSize = %d, want %d", got, want)
+			}
+			if info.GetCompressor() != tt.compressor {
+				t.Errorf("Compressor = %q, want %q", info.GetCompressor(), tt.compressor)
+			}
+			if info.GetDictId() != tt.wantDictID {
+				t.Errorf("DictId = %d, want %d", info.GetDictId(), tt.wantDictID)
+			}
+			// Only a compressed, measured response is timed.
+			timed := info.GetServerCompressMicros() > 0
+			if want := tt.measure && tt.compressor != ""; timed != want {
+				t.Errorf("ServerCompressMicros = %d, want set = %v", info.GetServerCompressMicros(), want)
+			}
+		})
+	}
+}
+
+// panicWriter makes the compressor's encoder panic on flush.
+type panicWriter struct{}
+
+func (panicWriter) Write([]byte) (int, error) { panic("writer exploded") }
+
+func TestNewGRPCServer_PlainObserver(t *testing.T) {
+	// Without a dictionary only the plain compressor is registered, and
+	// the one gRPC uses must still report to the Observer.
+	if _, err := NewGRPCServer(Options{Observer: collector}); err != nil {
+		t.Fatalf("NewGRPCServer() error = %v", err)
+	}
+	panics := func() uint64 {
+		var n uint64
+		for _, s := range collector.Snapshot() {
+			if s.Compressor == grpccodec.NameZstd && s.Op == stats.OpCompress {
+				n += s.Errors
+			}
+		}
+		return n
+	}
+	before := panics()
+
+	w, err := encoding.GetCompressor(grpccodec.NameZstd).Compress(panicWriter{})
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	w.Write([]byte("data"))
+	var pe *grpccodec.PanicError
+	if err := w.Close(); !errors.As(err, &pe) {
+		t.Fatalf("Close() error = %v, want *grpccodec.PanicError", err)
+	}
+	if got := panics(); got != before+1 {
+		t.Errorf("Observer saw %d compress panics, want %d", got, before+1)
+	}
+}
+
+func TestCompressionInfo_NoTransportStream(t *testing.T) {
+	// Outside a gRPC server there is no stream to ask for the response
+	// compressor, so only the size is reported.
+	msg := &pb.ListFilesResponse{Root: "/tmp", TotalCount: 1}
+	info := compressionInfo(context.Background(), msg, true)
+	want := &pb.CompressionInfo{UncompressedSize: int64(proto.Size(msg))}
+	if !proto.Equal(info, want) {
+		t.Errorf("compressionInfo() = %v, want %v", info, want)
+	}
+}
@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Reporter periodically logs a summary of a Collector's statistics, for
+// visibility without a metrics stack. Each report covers the operations
+// since the previous one, with one log record per compressor, dictionary
+// and operation that saw activity.
+//
+//	collector := stats.NewCollector()
+//	go stats.NewReporter(collector, nil).Run(ctx, 10*time.Minute)
+type Reporter struct {
+	c      *Collector
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	last map[Key]Series
+	at   time.Time
+}
+
+// NewReporter returns a Reporter for c logging to logger, or to
+// slog.Default() if logger is nil.
+func NewReporter(c *Collector, logger *slog.Logger) *Reporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Reporter{c: c, logger: logger, last: make(map[Key]Series), at: time.Now()}
+}
+
+// Run calls Report every interval until ctx is done.
+func (r *Reporter) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.Report(ctx)
+		}
+	}
+}
+
+// Report logs the activity since the last report. The logged attributes
+// are the operation count, errors, input and output bytes, the ratio of
+// uncompressed to compressed size, and the bytes saved; both are computed
+// from the input of compressions and the output of decompressions.
+func (r *Reporter) Report(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	period := now.Sub(r.at).Round(time.Second)
+	r.at = now
+	for _, s := range r.c.Snapshot() {
+		prev := r.last[s.Key]
+		r.last[s.Key] = s
+		count := s.Count - prev.Count
+		if count == 0 {
+			continue
+		}
+		in, out := s.InBytes-prev.InBytes, s.OutBytes-prev.OutBytes
+		raw, packed := in, out
+		if s.Op == OpDecompress {
+			raw, packed = out, in
+		}
+		ratio := 0.0
+		if packed > 0 {
+			ratio = float64(raw) / float64(packed)
+		}
+		r.logger.LogAttrs(ctx, slog.LevelInfo, "zstd compression",
+			slog.String("compressor", s.Compressor),
+			slog.Uint64("dict", uint64(s.DictID)),
+			slog.String("op", s.Op.String()),
+			slog.Duration("period", period),
+			slog.Uint64("count", count),
+			slog.Uint64("errors", s.Errors-prev.Errors),
+			slog.Int64("in_bytes", in),
+			slog.Int64("out_bytes", out),
+			slog.Float64("ratio", ratio),
+			slog.Int64("saved_bytes", raw-packed),
+		)
+	}
+}
@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporter(t *testing.T) {
+	c := NewCollector()
+	var buf bytes.Buffer
+	r := NewReporter(c, slog.New(slog.NewTextHandler(&buf, nil)))
+
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpCompress, InBytes: 1000, OutBytes: 250, Duration: time.Millisecond})
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpDecompress, InBytes: 100, OutBytes: 300, Duration: time.Millisecond})
+	r.Report(context.Background())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Report() logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for _, want := range []string{"compressor=zstd-dict", "dict=7", "op=compress", "count=1", "ratio=4", "saved_bytes=750"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("compress line missing %q: %s", want, lines[0])
+		}
+	}
+	for _, want := range []string{"op=decompress", "ratio=3", "saved_bytes=200"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("decompress line missing %q: %s", want, lines[1])
+		}
+	}
+
+	// Later reports cover only new activity.
+	buf.Reset()
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpCompress, InBytes: 200, OutBytes: 100, Duration: time.Millisecond})
+	r.Report(context.Background())
+	if got := buf.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "in_bytes=200") || !strings.Contains(got, "ratio=2") {
+		t.Errorf("second Report() = %q, want one line for the new compression", got)
+	}
+}
@@ -0,0 +1,308 @@
+// Package stats collects per-operation statistics for zstd compression.
+//
+// Compressors report each operation to an Observer. Collector is the
+// built-in Observer: it keeps operation counts, byte totals and latency
+// histograms per compressor, dictionary and operation, which can be read
+// programmatically with Snapshot or exported with WriteText. Reporter logs
+// periodic summaries of a Collector through log/slog.
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op identifies the kind of operation being observed.
+type Op int
+
+const (
+	// OpCompress is a compression operation.
+	OpCompress Op = iota
+	// OpDecompress is a decompression operation.
+	OpDecompress
+)
+
+// String returns the operation name.
+func (o Op) String() string {
+	switch o {
+	case OpCompress:
+		return "compress"
+	case OpDecompress:
+		return "decompress"
+	default:
+		return "op(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
+// Event describes a single completed operation.
+type Event struct {
+	// Compressor is the name of the compressor that did the work.
+	Compressor string
+	// DictID is the ID of the dictionary in use, or 0 for none.
+	DictID uint32
+	// Op is the kind of operation.
+	Op Op
+	// InBytes and OutBytes are the input and output sizes.
+	InBytes  int
+	OutBytes int
+	// Duration is the wall time spent in the operation.
+	Duration time.Duration
+	// Err is the error the operation returned, if any.
+	Err error
+}
+
+// Observer receives an Event for every observed operation.
+// Implementations must be safe for concurrent use.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// numBuckets covers latencies from 1µs to roughly 9 minutes in powers of two.
+const numBuckets = 30
+
+// Histogram is a lock-free latency histogram with exponential buckets.
+// Bucket i counts durations up to 2^i microseconds; the final bucket also
+// absorbs anything larger. The zero value is ready to use.
+type Histogram struct {
+	counts [numBuckets]atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+// Record adds d to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	h.counts[bucketFor(d)].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func bucketFor(d time.Duration) int {
+	us := uint64(max(d.Microseconds(), 1))
+	// Smallest i such that us <= 2^i.
+	i := bits.Len64(us - 1)
+	return min(i, numBuckets-1)
+}
+
+// Snapshot returns a point-in-time copy of the histogram. Empty buckets are
+// omitted.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	var s HistogramSnapshot
+	for i := range h.counts {
+		if n := h.counts[i].Load(); n > 0 {
+			s.Buckets = append(s.Buckets, Bucket{
+				UpperBound: time.Duration(uint64(1)<<i) * time.Microsecond,
+				Count:      n,
+			})
+		}
+	}
+	s.Count = h.count.Load()
+	s.Sum = time.Duration(h.sum.Load())
+	return s
+}
+
+// Bucket is one non-empty histogram bucket.
+type Bucket struct {
+	// UpperBound is the inclusive upper bound of the bucket.
+	UpperBound time.Duration
+	// Count is the number of observations in this bucket alone.
+	Count uint64
+}
+
+// HistogramSnapshot is a point-in-time copy of a Histogram.
+type HistogramSnapshot struct {
+	Buckets []Bucket
+	Count   uint64
+	Sum     time.Duration
+}
+
+// Mean returns the average observed duration.
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile returns the upper bound of the bucket containing the q-th
+// quantile, for q in [0, 1].
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.Count))
+	var seen uint64
+	for _, b := range s.Buckets {
+		seen += b.Count
+		if seen > rank {
+			return b.UpperBound
+		}
+	}
+	return s.Buckets[len(s.Buckets)-1].UpperBound
+}
+
+// Key identifies a series of related operations.
+type Key struct {
+	Compressor string
+	DictID     uint32
+	Op         Op
+}
+
+type series struct {
+	errors   atomic.Uint64
+	inBytes  atomic.Int64
+	outBytes atomic.Int64
+	latency  Histogram
+}
+
+// Series is a snapshot of the statistics for one Key.
+type Series struct {
+	Key
+	Count    uint64
+	Errors   uint64
+	InBytes  int64
+	OutBytes int64
+	Latency  HistogramSnapshot
+}
+
+// Collector is an Observer that aggregates events per Key.
+// The zero value is ready to use.
+type Collector struct {
+	mu     sync.RWMutex
+	series map[Key]*series
+}
+
+// NewCollector creates an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Observe implements Observer.
+func (c *Collector) Observe(e Event) {
+	s := c.lookup(Key{Compressor: e.Compressor, DictID: e.DictID, Op: e.Op})
+	if e.Err != nil {
+		s.errors.Add(1)
+	}
+	s.inBytes.Add(int64(e.InBytes))
+	s.outBytes.Add(int64(e.OutBytes))
+	s.latency.Record(e.Duration)
+}
+
+func (c *Collector) lookup(k Key) *series {
+	c.mu.RLock()
+	s, ok := c.series[k]
+	c.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[k]; ok {
+		return s
+	}
+	if c.series == nil {
+		c.series = make(map[Key]*series)
+	}
+	s = &series{}
+	c.series[k] = s
+	return s
+}
+
+// Snapshot returns the statistics for every series seen so far, ordered by
+// compressor, dictionary ID and operation.
+func (c *Collector) Snapshot() []Series {
+	c.mu.RLock()
+	out := make([]Series, 0, len(c.series))
+	for k, s := range c.series {
+		lat := s.latency.Snapshot()
+		out = append(out, Series{
+			Key:      k,
+			Count:    lat.Count,
+			Errors:   s.errors.Load(),
+			InBytes:  s.inBytes.Load(),
+			OutBytes: s.outBytes.Load(),
+			Latency:  lat,
+		})
+	}
+	c.mu.RUnlock()
+
+	slices.SortFunc(out, func(a, b Series) int {
+		return cmp.Or(
+			strings.Compare(a.Compressor, b.Compressor),
+			cmp.Compare(a.DictID, b.DictID),
+			cmp.Compare(a.Op, b.Op),
+		)
+	})
+	return out
+}
+
+// WriteText writes the collected statistics to w in the Prometheus text
+// exposition format, so they can be served from an existing metrics
+// endpoint.
+func (c *Collector) WriteText(w io.Writer) error {
+	snap := c.Snapshot()
+
+	bw := &errWriter{w: w}
+	bw.printf("# TYPE zstd_operations_total counter\n")
+	for _, s := range snap {
+		bw.printf("zstd_operations_total{%s} %d\n", labels(s.Key), s.Count)
+	}
+	bw.printf("# TYPE zstd_operation_errors_total counter\n")
+	for _, s := range snap {
+		bw.printf("zstd_operation_errors_total{%s} %d\n", labels(s.Key), s.Errors)
+	}
+	bw.printf("# TYPE zstd_input_bytes_total counter\n")
+	for _, s := range snap {
+		bw.printf("zstd_input_bytes_total{%s} %d\n", labels(s.Key), s.InBytes)
+	}
+	bw.printf("# TYPE zstd_output_bytes_total counter\n")
+	for _, s := range snap {
+		bw.printf("zstd_output_bytes_total{%s} %d\n", labels(s.Key), s.OutBytes)
+	}
+	bw.printf("# TYPE zstd_operation_duration_seconds histogram\n")
+	for _, s := range snap {
+		l := labels(s.Key)
+		var cum uint64
+		for _, b := range s.Latency.Buckets {
+			cum += b.Count
+			bw.printf("zstd_operation_duration_seconds_bucket{%s,le=\"%g\"} %d\n", l, b.UpperBound.Seconds(), cum)
+		}
+		bw.printf("zstd_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, s.Latency.Count)
+		bw.printf("zstd_operation_duration_seconds_sum{%s} %g\n", l, s.Latency.Sum.Seconds())
+		bw.printf("zstd_operation_duration_seconds_count{%s} %d\n", l, s.Latency.Count)
+	}
+	return bw.err
+}
+
+func labels(k Key) string {
+	return fmt.Sprintf("compressor=%q,dict=\"%d\",op=%q", k.Compressor, k.DictID, k.Op)
+}
+
+// errWriter records the first write error and skips subsequent writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...any) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	for _, d := range []time.Duration{
+		500 * time.Nanosecond,
+		3 * time.Microsecond,
+		3 * time.Microsecond,
+		100 * time.Microsecond,
+		time.Hour,
+	} {
+		h.Record(d)
+	}
+
+	s := h.Snapshot()
+	if s.Count != 5 {
+		t.Errorf("Count = %d, want 5", s.Count)
+	}
+	if got := s.Quantile(0); got != time.Microsecond {
+		t.Errorf("Quantile(0) = %v, want 1µs", got)
+	}
+	if got := s.Quantile(0.5); got != 4*time.Microsecond {
+		t.Errorf("Quantile(0.5) = %v, want 4µs", got)
+	}
+	if got, want := s.Quantile(1), time.Duration(1<<(numBuckets-1))*time.Microsecond; got != want {
+		t.Errorf("Quantile(1) = %v, want %v", got, want)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpDecompress, InBytes: 10, OutBytes: 100, Duration: time.Millisecond})
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpCompress, InBytes: 100, OutBytes: 10, Duration: time.Millisecond})
+	c.Observe(Event{Compressor: "zstd-dict", DictID: 7, Op: OpCompress, Duration: time.Millisecond, Err: errors.New("boom")})
+
+	snap := c.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("Snapshot() = %d series, want 2", len(snap))
+	}
+	if snap[0].Op != OpCompress || snap[0].Count != 2 || snap[0].Errors != 1 || snap[0].InBytes != 100 {
+		t.Errorf("compress series = %+v", snap[0])
+	}
+	if snap[1].Op != OpDecompress || snap[1].OutBytes != 100 {
+		t.Errorf("decompress series = %+v", snap[1])
+	}
+
+	var sb strings.Builder
+	if err := c.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	want := `zstd_operation_duration_seconds_count{compressor="zstd-dict",dict="7",op="compress"} 2`
+	if !strings.Contains(sb.String(), want) {
+		t.Errorf("WriteText() missing %q in:\n%s", want, sb.String())
+	}
+}
@@ -0,0 +1,141 @@
+package zstddict
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// AdaptiveLevel configures automatic encoder level selection under load.
+//
+// The Compressor tracks how many Compress calls are in flight. While that
+// queue stays at or above HighWater the level is lowered one step at a time,
+// down to zstd.SpeedFastest; once it falls to LowWater or below, the level is
+// raised back towards the one set with WithLevel. At most one change is made
+// per Interval so the level doesn't flap.
+type AdaptiveLevel struct {
+	// HighWater is the number of concurrent compress calls at which the
+	// level is lowered. Defaults to GOMAXPROCS.
+	HighWater int
+	// LowWater is the number of concurrent compress calls at or below
+	// which the level is restored. Defaults to HighWater/2.
+	LowWater int
+	// Interval is the minimum time between level changes. Defaults to 1s.
+	Interval time.Duration
+}
+
+// WithAdaptiveLevel lowers the encoder level while the Compressor is
+// saturated and restores it when load subsides. The level set with WithLevel
+// or SetLevel is the ceiling.
+func WithAdaptiveLevel(cfg AdaptiveLevel) Option {
+	return func(c *Compressor) error {
+		if cfg.HighWater <= 0 {
+			cfg.HighWater = runtime.GOMAXPROCS(0)
+		}
+		if cfg.LowWater <= 0 || cfg.LowWater >= cfg.HighWater {
+			cfg.LowWater = cfg.HighWater / 2
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Second
+		}
+		c.adaptive = &adaptiveLevel{cfg: cfg, now: time.Now}
+		return nil
+	}
+}
+
+// LevelPolicy picks the encoder level for a payload of size bytes.
+type LevelPolicy func(size int) zstd.EncoderLevel
+
+// LevelBySize returns a LevelPolicy for mixed workloads: the best level
+// for payloads under small bytes, where it costs little, the fastest for
+// those over large, and the default between.
+func LevelBySize(small, large int) LevelPolicy {
+	return func(size int) zstd.EncoderLevel {
+		switch {
+		case size < small:
+			return zstd.SpeedBestCompression
+		case size > large:
+			return zstd.SpeedFastest
+		default:
+			return zstd.SpeedDefault
+		}
+	}
+}
+
+// WithLevelPolicy makes Compress pick the encoder level for each payload
+// with policy, instead of using one level for all of them:
+//
+//	zstddict.WithLevelPolicy(zstddict.LevelBySize(4<<10, 1<<20))
+//
+// Levels outside the valid range are clamped to it. Writers don't know the
+// size in advance and keep using the level set with WithLevel or
+// SetLevel. With WithAdaptiveLevel, the level lowered under load caps the
+// policy's choice.
+func WithLevelPolicy(policy LevelPolicy) Option {
+	return func(c *Compressor) error {
+		c.levelPolicy = policy
+		return nil
+	}
+}
+
+// policyLevel returns the level the policy picks for size bytes.
+func (c *Compressor) policyLevel(size int) zstd.EncoderLevel {
+	return min(max(c.levelPolicy(size), zstd.SpeedFastest), zstd.SpeedBestCompression)
+}
+
+// Level returns the encoder level currently used by Compress.
+func (c *Compressor) Level() zstd.EncoderLevel {
+	return c.levelOf(c.state.Load())
+}
+
+// levelOf returns the encoder level to use with st. Callers that index
+// st's pools must pass the state they loaded, since a concurrent SetLevel
+// or SetDict replaces it with one holding pools for other levels.
+func (c *Compressor) levelOf(st *dictState) zstd.EncoderLevel {
+	level := st.level
+	if c.adaptive != nil {
+		return min(zstd.EncoderLevel(c.adaptive.level.Load()), level)
+	}
+	return level
+}
+
+type adaptiveLevel struct {
+	cfg AdaptiveLevel
+	now func() time.Time
+
+	level      atomic.Int32
+	inflight   atomic.Int32
+	lastChange atomic.Int64
+}
+
+// enter records a compress call starting and returns the level it should
+// use, adjusting the level first if the load warrants it.
+func (a *adaptiveLevel) enter(ceiling zstd.EncoderLevel) zstd.EncoderLevel {
+	n := int(a.inflight.Add(1))
+	cur := zstd.EncoderLevel(a.level.Load())
+
+	var next zstd.EncoderLevel
+	switch {
+	case n >= a.cfg.HighWater && cur > zstd.SpeedFastest:
+		next = cur - 1
+	case n <= a.cfg.LowWater && cur < ceiling:
+		next = cur + 1
+	default:
+		return cur
+	}
+
+	now := a.now().UnixNano()
+	last := a.lastChange.Load()
+	if now-last < int64(a.cfg.Interval) || !a.lastChange.CompareAndSwap(last, now) {
+		return cur
+	}
+	a.level.Store(int32(next))
+	return next
+}
+
+// exit records a compress call finishing.
+func (a *adaptiveLevel) exit() {
+	a.inflight.Add(-1)
+}
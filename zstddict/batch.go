@@ -0,0 +1,48 @@
+package zstddict
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// CompressBatch compresses each sample into its own frame, spreading the
+// work over up to GOMAXPROCS goroutines that draw encoders from the pool.
+// out[i] is the frame for samples[i], as Compress would return it. On
+// failure the remaining samples are skipped and the first error is
+// returned, naming the sample it occurred on.
+func (c *Compressor) CompressBatch(samples [][]byte) ([][]byte, error) {
+	out := make([][]byte, len(samples))
+	workers := min(runtime.GOMAXPROCS(0), len(samples))
+
+	var (
+		next     atomic.Int64
+		failed   atomic.Bool
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for range workers {
+		wg.Go(func() {
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= len(samples) {
+					return
+				}
+				frame, err := c.Compress(samples[i])
+				if err != nil {
+					failed.Store(true)
+					errOnce.Do(func() { firstErr = fmt.Errorf("zstddict: sample %d: %w", i, err) })
+					return
+				}
+				out[i] = frame
+			}
+		})
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
@@ -0,0 +1,41 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressor_CompressBatch(t *testing.T) {
+	samples := generateSampleData(200)
+	dict, err := TrainDict(samples, nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	frames, err := c.CompressBatch(samples)
+	if err != nil {
+		t.Fatalf("CompressBatch() error = %v", err)
+	}
+	if len(frames) != len(samples) {
+		t.Fatalf("CompressBatch() returned %d frames, want %d", len(frames), len(samples))
+	}
+	for i, frame := range frames {
+		if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, samples[i]) {
+			t.Fatalf("frame %d decompressed to %d bytes, %v; want sample %d", i, len(got), err, i)
+		}
+	}
+
+	if frames, err := c.CompressBatch(nil); err != nil || len(frames) != 0 {
+		t.Errorf("CompressBatch(nil) = %d frames, %v", len(frames), err)
+	}
+
+	c.Close()
+	if _, err := c.CompressBatch(samples); !errors.Is(err, ErrClosed) {
+		t.Errorf("CompressBatch() after Close error = %v, want ErrClosed", err)
+	}
+}
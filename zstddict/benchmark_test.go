@@ -96,6 +96,53 @@ func BenchmarkCompression(b *testing.B) {
 	}
 }
 
+func BenchmarkSmallMessages(b *testing.B) {
+	samples := generateFileListSamples(100)
+	dict, err := TrainDict(samples, nil)
+	if err != nil {
+		b.Fatalf("TrainDict failed: %v", err)
+	}
+
+	compressorDict, _ := New(WithDictBytes(dict))
+	compressorSmall, _ := New(WithDictBytes(dict), WithSmallMessages())
+	data := samples[0][:500]
+
+	b.Run("default", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = compressorDict.Compress(data)
+		}
+	})
+
+	b.Run("small_messages", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = compressorSmall.Compress(data)
+		}
+	})
+}
+
+func BenchmarkPooledBuffers(b *testing.B) {
+	data := generateFileListSamples(1)[0]
+
+	compressorPlain, _ := New()
+	compressorPooled, _ := New(WithPooledBuffers())
+
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			out, _ := compressorPlain.Compress(data)
+			compressorPlain.Free(out)
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			out, _ := compressorPooled.Compress(data)
+			compressorPooled.Free(out)
+		}
+	})
+}
+
 func BenchmarkDecompression(b *testing.B) {
 	samples := generateFileListSamples(100)
 	dict, _ := TrainDict(samples, nil)
@@ -0,0 +1,208 @@
+package zstddict
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrBudgetExceeded is returned by fail-fast memory budgets when an
+// operation cannot be admitted without exceeding the budget.
+var ErrBudgetExceeded = errors.New("zstddict: memory budget exceeded")
+
+// BudgetPolicy controls what happens when a MemoryBudget is exhausted.
+type BudgetPolicy int
+
+const (
+	// BudgetBlock makes operations wait until enough memory is released.
+	// Waiting stops early if the operation's context is cancelled.
+	BudgetBlock BudgetPolicy = iota
+	// BudgetFailFast makes operations fail immediately with ErrBudgetExceeded.
+	BudgetFailFast
+)
+
+// MemoryBudget limits the memory used by concurrent compress and decompress
+// operations. A single budget can be shared by any number of Compressors,
+// giving processes that create many per-tenant Compressors one global cap.
+//
+// Costs are estimated per operation from the input length, the encoder
+// level and window and, for decompression, the frame header, and include
+// the encoder's or decoder's own history and tables as well as the input
+// and output. They approximate what an operation allocates rather than
+// measuring it exactly.
+type MemoryBudget struct {
+	limit  int64
+	policy BudgetPolicy
+
+	mu      sync.Mutex
+	used    int64
+	waiters []*budgetWaiter
+}
+
+type budgetWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewMemoryBudget creates a MemoryBudget of limit bytes.
+func NewMemoryBudget(limit int64, policy BudgetPolicy) *MemoryBudget {
+	return &MemoryBudget{limit: limit, policy: policy}
+}
+
+// WithMemoryBudget makes the Compressor reserve memory from b for every
+// Compress and Decompress call.
+func WithMemoryBudget(b *MemoryBudget) Option {
+	return func(c *Compressor) error {
+		if b == nil || b.limit <= 0 {
+			return errors.New("zstddict: memory budget must have a positive limit")
+		}
+		c.budget = b
+		return nil
+	}
+}
+
+// Limit returns the budget size in bytes.
+func (b *MemoryBudget) Limit() int64 {
+	return b.limit
+}
+
+// Used returns the number of bytes currently reserved.
+func (b *MemoryBudget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// acquire reserves n bytes, returning the amount actually reserved. Requests
+// larger than the whole budget are clamped so they can still run alone.
+func (b *MemoryBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	n = min(n, b.limit)
+
+	b.mu.Lock()
+	if b.used+n <= b.limit && len(b.waiters) == 0 {
+		b.used += n
+		b.mu.Unlock()
+		return n, nil
+	}
+	if b.policy == BudgetFailFast {
+		b.mu.Unlock()
+		return 0, ErrBudgetExceeded
+	}
+
+	w := &budgetWaiter{n: n, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return n, nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while we were cancelling; hand it back.
+			b.releaseLocked(n)
+		default:
+			for i, other := range b.waiters {
+				if other == w {
+					b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+					break
+				}
+			}
+			// Removing the head may let the next waiters through.
+			b.notifyLocked()
+		}
+		return 0, ctx.Err()
+	}
+}
+
+// release returns n bytes to the budget.
+func (b *MemoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.releaseLocked(n)
+	b.mu.Unlock()
+}
+
+func (b *MemoryBudget) releaseLocked(n int64) {
+	b.used -= n
+	b.notifyLocked()
+}
+
+// notifyLocked admits waiters in FIFO order while they fit.
+func (b *MemoryBudget) notifyLocked() {
+	for len(b.waiters) > 0 {
+		w := b.waiters[0]
+		if b.used+w.n > b.limit {
+			return
+		}
+		b.used += w.n
+		b.waiters = b.waiters[1:]
+		close(w.ready)
+	}
+}
+
+// Working memory of klauspost/compress/zstd, per encoder level: the match
+// tables, at 8 bytes an entry, which a dictionary doubles with a pristine
+// copy to restore between frames. Encoders also keep a history buffer of
+// the window plus up to a block, and at least 1MB; decoders keep about
+// two blocks of literal and sequence buffers, and build their history in
+// the output.
+var encoderTables = [...]int64{
+	zstd.SpeedFastest:           8 << 15,
+	zstd.SpeedDefault:           8 * (1<<17 + 1<<15),
+	zstd.SpeedBetterCompression: 8 * (1<<19 + 1<<13),
+	zstd.SpeedBestCompression:   8 * (1<<22 + 1<<18),
+}
+
+const (
+	defaultWindow  = 8 << 20
+	decoderBuffers = 2 * maxBlockSize
+)
+
+// compressCost estimates the memory needed to compress n bytes at level
+// with the given encoder window, 0 for the default: the input, a
+// worst-case output buffer, and the encoder's own memory.
+func compressCost(n int, level zstd.EncoderLevel, window int, dict bool) int64 {
+	return int64(n)*2 + encoderMemory(level, window, dict)
+}
+
+// encoderMemory estimates the memory an encoder at level keeps between
+// frames: its match tables, doubled for a dictionary, and its history
+// for the given window, 0 for the default.
+func encoderMemory(level zstd.EncoderLevel, window int, dict bool) int64 {
+	if window <= 0 {
+		window = defaultWindow
+	}
+	tables := encoderTables[level]
+	if dict {
+		tables *= 2
+	}
+	hist := max(window+min(window, maxBlockSize), 1<<20)
+	return tables + int64(hist)
+}
+
+// decompressCost estimates the memory needed to decompress a frame from its
+// header: the input, the output and the decoder's block buffers. The
+// decoder keeps its history window in the output, so the window only
+// counts when the frame does not declare its size, and the default
+// maximum window stands in when it declares neither. Frames needing more
+// than maxMemory, if positive, fail before decoding that far, so the
+// output is capped there.
+func decompressCost(data []byte, maxMemory uint64) int64 {
+	out := int64(defaultWindow)
+	var h zstd.Header
+	if err := h.Decode(data); err == nil {
+		if h.HasFCS {
+			out = int64(h.FrameContentSize)
+		} else if h.WindowSize > 0 {
+			out = int64(h.WindowSize)
+		}
+	}
+	if maxMemory > 0 {
+		out = min(out, int64(maxMemory))
+	}
+	return int64(len(data)) + out + decoderBuffers
+}
@@ -0,0 +1,147 @@
+package zstddict
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestMemoryBudget_FailFast(t *testing.T) {
+	b := NewMemoryBudget(100, BudgetFailFast)
+
+	n, err := b.acquire(context.Background(), 80)
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if _, err := b.acquire(context.Background(), 30); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("acquire() error = %v, want ErrBudgetExceeded", err)
+	}
+	b.release(n)
+
+	if got := b.Used(); got != 0 {
+		t.Errorf("Used() = %d, want 0", got)
+	}
+}
+
+func TestMemoryBudget_Block(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewMemoryBudget(100, BudgetBlock)
+
+		held, err := b.acquire(context.Background(), 100)
+		if err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+
+		acquired := make(chan int64)
+		go func() {
+			n, err := b.acquire(context.Background(), 50)
+			if err != nil {
+				t.Errorf("acquire() error = %v", err)
+			}
+			acquired <- n
+		}()
+
+		synctest.Wait()
+		select {
+		case <-acquired:
+			t.Fatal("acquire() did not block on an exhausted budget")
+		default:
+		}
+
+		b.release(held)
+		b.release(<-acquired)
+		if got := b.Used(); got != 0 {
+			t.Errorf("Used() = %d, want 0", got)
+		}
+	})
+}
+
+func TestMemoryBudget_BlockCancelled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewMemoryBudget(100, BudgetBlock)
+		held, _ := b.acquire(context.Background(), 100)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := b.acquire(ctx, 10)
+			done <- err
+		}()
+
+		synctest.Wait()
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("acquire() error = %v, want context.Canceled", err)
+		}
+
+		b.release(held)
+		if got := b.Used(); got != 0 {
+			t.Errorf("Used() = %d, want 0", got)
+		}
+	})
+}
+
+func TestMemoryBudget_Costs(t *testing.T) {
+	// Encoder tables grow with the level and double with a dictionary.
+	fastest := compressCost(1000, zstd.SpeedFastest, 0, false)
+	best := compressCost(1000, zstd.SpeedBestCompression, 0, false)
+	if best-fastest != encoderTables[zstd.SpeedBestCompression]-encoderTables[zstd.SpeedFastest] {
+		t.Errorf("compressCost() at best = %d, at fastest = %d; want them to differ by the tables", best, fastest)
+	}
+	if got := compressCost(1000, zstd.SpeedFastest, 0, true); got != fastest+encoderTables[zstd.SpeedFastest] {
+		t.Errorf("compressCost() with a dictionary = %d, want %d", got, fastest+encoderTables[zstd.SpeedFastest])
+	}
+	// A small window still costs the 1MB minimum history.
+	if got, want := compressCost(1000, zstd.SpeedFastest, 1<<10, false), 2000+encoderTables[zstd.SpeedFastest]+1<<20; got != want {
+		t.Errorf("compressCost() with a 1KB window = %d, want %d", got, want)
+	}
+
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	frame, _ := c.Compress(bytes.Repeat([]byte("x"), 5000))
+	if got, want := decompressCost(frame, 0), int64(len(frame)+5000+decoderBuffers); got != want {
+		t.Errorf("decompressCost() = %d, want %d", got, want)
+	}
+	if got, want := decompressCost(frame, 100), int64(len(frame)+100+decoderBuffers); got != want {
+		t.Errorf("decompressCost() under a 100 byte limit = %d, want %d", got, want)
+	}
+}
+
+func TestCompressor_SharedBudget(t *testing.T) {
+	budget := NewMemoryBudget(1<<20, BudgetFailFast)
+
+	c1, err := New(WithMemoryBudget(budget))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c2, err := New(WithMemoryBudget(budget))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	testData := bytes.Repeat([]byte("budgeted "), 1000)
+	compressed, err := c1.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	decompressed, err := c2.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(decompressed, testData) {
+		t.Error("round trip under budget failed")
+	}
+	if got := budget.Used(); got != 0 {
+		t.Errorf("Used() = %d after operations, want 0", got)
+	}
+
+	if _, err := New(WithMemoryBudget(nil)); err == nil {
+		t.Error("New(WithMemoryBudget(nil)) succeeded, want error")
+	}
+}
@@ -0,0 +1,118 @@
+package zstddict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/xxhash"
+)
+
+var (
+	// ErrChecksumMismatch is returned when decompressed content does not
+	// match the checksum stored alongside it.
+	ErrChecksumMismatch = errors.New("zstddict: content checksum mismatch")
+	// ErrNoChecksum is returned when a checksum is required but the data
+	// carries none.
+	ErrNoChecksum = errors.New("zstddict: content checksum missing")
+)
+
+// The checksum trailer is a zstd skippable frame, which decoders ignore, so
+// checksummed data stays readable by any zstd implementation:
+//
+//	magic (4) | payload size (4) | tag "xh64" (4) | xxhash64 (8)
+const (
+	checksumMagic   = 0x184D2A5C
+	checksumTag     = "xh64"
+	checksumPayload = len(checksumTag) + 8
+	checksumSize    = 8 + checksumPayload
+)
+
+// ChecksumFrame appends a trailer holding the xxhash64 of the uncompressed
+// content to the compressed frame and returns the extended slice.
+//
+// Unlike the 32-bit checksum zstd can embed in each frame, the trailer
+// covers the whole content with 64 bits, and is checked by VerifyFrame
+// after decompression rather than by the decoder.
+func ChecksumFrame(frame, content []byte) []byte {
+	frame = binary.LittleEndian.AppendUint32(frame, checksumMagic)
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(checksumPayload))
+	frame = append(frame, checksumTag...)
+	return binary.LittleEndian.AppendUint64(frame, xxhash.Sum64(content))
+}
+
+// VerifyFrame checks content against the trailer that ChecksumFrame added
+// to data. It returns ErrNoChecksum if data has no trailer and
+// ErrChecksumMismatch if the content does not match.
+func VerifyFrame(data, content []byte) error {
+	sum, ok := frameChecksum(data)
+	if !ok {
+		return ErrNoChecksum
+	}
+	if xxhash.Sum64(content) != sum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// frameChecksum extracts the checksum from the trailer at the end of data.
+func frameChecksum(data []byte) (uint64, bool) {
+	if len(data) < checksumSize {
+		return 0, false
+	}
+	t := data[len(data)-checksumSize:]
+	if binary.LittleEndian.Uint32(t) != checksumMagic ||
+		binary.LittleEndian.Uint32(t[4:]) != uint32(checksumPayload) ||
+		!bytes.Equal(t[8:12], []byte(checksumTag)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(t[12:]), true
+}
+
+// WithChecksums makes Compress append a ChecksumFrame trailer to every frame
+// and Decompress verify it, failing with ErrNoChecksum or
+// ErrChecksumMismatch. Use it for stored data that needs end-to-end
+// integrity beyond what the transport guarantees.
+func WithChecksums() Option {
+	return func(c *Compressor) error {
+		c.checksums = true
+		return nil
+	}
+}
+
+// WithFrameCRC sets whether frames carry the checksum zstd itself defines:
+// the low 32 bits of the xxhash64 of each frame's content, which the
+// decoder verifies as it decodes. Frames carry it by default, except with
+// WithSmallMessages, which drops it to save 4 bytes per message;
+// WithFrameCRC overrides either default.
+//
+// With WithFrameCRC(true), Decompress also rejects frames without a
+// checksum with ErrNoChecksum, so corrupt data can never decode silently,
+// and a checksum that does not match fails with ErrChecksumMismatch. Stored
+// frames carry no checksum, so the requirement is waived when
+// WithStoredFallback or a CPUGuard in GuardStore mode can produce them.
+// Unlike the trailer added by WithChecksums, the checksum is part of the
+// frame, so any zstd decoder verifies it.
+func WithFrameCRC(on bool) Option {
+	return func(c *Compressor) error {
+		c.frameCRC = &on
+		return nil
+	}
+}
+
+// requireCRC reports whether Decompress rejects frames without a zstd
+// checksum.
+func (c *Compressor) requireCRC() bool {
+	return c.frameCRC != nil && *c.frameCRC && !c.stored && !c.guardStores()
+}
+
+// checkCRC returns ErrNoChecksum if the first frame in data declares no
+// zstd checksum. Malformed headers are left for the decoder to report.
+func checkCRC(data []byte) error {
+	var h zstd.Header
+	if h.Decode(data) == nil && !h.Skippable && !h.HasCheckSum {
+		return ErrNoChecksum
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestChecksumFrame(t *testing.T) {
+	plain, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	content := bytes.Repeat([]byte("archived record "), 50)
+	frame, err := plain.Compress(content)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	if err := VerifyFrame(frame, content); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("VerifyFrame() without trailer error = %v, want ErrNoChecksum", err)
+	}
+
+	frame = ChecksumFrame(frame, content)
+	if err := VerifyFrame(frame, content); err != nil {
+		t.Errorf("VerifyFrame() error = %v", err)
+	}
+	tampered := bytes.Clone(content)
+	tampered[0] ^= 1
+	if err := VerifyFrame(frame, tampered); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyFrame() of tampered content error = %v, want ErrChecksumMismatch", err)
+	}
+
+	// The trailer is a skippable frame, so plain decoders still read it.
+	got, err := plain.Decompress(frame)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Decompress() of checksummed frame returned wrong content")
+	}
+}
+
+func TestCompressor_WithChecksums(t *testing.T) {
+	c, err := New(WithChecksums())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	content := bytes.Repeat([]byte("archived record "), 50)
+	frame, err := c.Compress(content)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	got, err := c.Decompress(frame)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("round trip with checksums failed")
+	}
+
+	// Swap in the checksum for different content.
+	forged := ChecksumFrame(frame[:len(frame)-checksumSize], []byte("something else"))
+	if _, err := c.Decompress(forged); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Decompress() of forged frame error = %v, want ErrChecksumMismatch", err)
+	}
+
+	plain, _ := New()
+	unchecked, _ := plain.Compress(content)
+	if _, err := c.Decompress(unchecked); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("Decompress() without checksum error = %v, want ErrNoChecksum", err)
+	}
+}
+
+func TestCompressor_WithFrameCRC(t *testing.T) {
+	content := bytes.Repeat([]byte("archived record "), 50)
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{"default", nil, true},
+		{"small messages", []Option{WithSmallMessages()}, false},
+		{"on with small messages", []Option{WithSmallMessages(), WithFrameCRC(true)}, true},
+		{"off", []Option{WithFrameCRC(false)}, false},
+	} {
+		c, err := New(tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: New() error = %v", tt.name, err)
+		}
+		frame, err := c.Compress(content)
+		if err != nil {
+			t.Fatalf("%s: Compress() error = %v", tt.name, err)
+		}
+		var h zstd.Header
+		if err := h.Decode(frame); err != nil || h.HasCheckSum != tt.want {
+			t.Errorf("%s: frame has checksum %v, %v; want %v", tt.name, h.HasCheckSum, err, tt.want)
+		}
+	}
+
+	c, err := New(WithSmallMessages(), WithFrameCRC(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	frame, err := c.Compress(content)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Decompress() = %d bytes, %v", len(got), err)
+	}
+
+	// The checksum is the last 4 bytes of the frame.
+	corrupt := bytes.Clone(frame)
+	corrupt[len(corrupt)-1] ^= 1
+	if _, err := c.Decompress(corrupt); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Decompress() of corrupt frame error = %v, want ErrChecksumMismatch", err)
+	}
+
+	plain, _ := New(WithFrameCRC(false))
+	unchecked, _ := plain.Compress(content)
+	if _, err := c.Decompress(unchecked); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("Decompress() of frame without checksum error = %v, want ErrNoChecksum", err)
+	}
+}
@@ -0,0 +1,95 @@
+package zstddict
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// CodecOptions configures a Codec.
+type CodecOptions struct {
+	// MaxSize bounds the serialized size of messages. Encode rejects
+	// larger messages and Decode stops decompressing once the output
+	// passes it, both failing with ErrTooLarge. If 0, messages are only
+	// bounded by the Compressor's own limits.
+	MaxSize int
+}
+
+// Codec encodes protobuf messages of type T to compressed frames and back,
+// for messages stored or sent outside gRPC:
+//
+//	codec := zstddict.NewCodec[*pb.ListFilesResponse](c, nil)
+//	data, err := codec.Encode(resp)
+//	...
+//	resp, err := codec.Decode(data)
+//
+// Messages are marshaled deterministically, so equal messages encode to
+// equal bytes. Decode checks the dictionary ID in the frame header before
+// decoding, whether or not the Compressor was created with WithStrictDict,
+// and fails with a *DictMismatchError for frames made with another
+// dictionary. A Codec is safe for concurrent use.
+type Codec[T proto.Message] struct {
+	c       *Compressor
+	maxSize int
+}
+
+// NewCodec returns a Codec compressing messages with c. opts may be nil.
+func NewCodec[T proto.Message](c *Compressor, opts *CodecOptions) *Codec[T] {
+	if opts == nil {
+		opts = &CodecOptions{}
+	}
+	return &Codec[T]{c: c, maxSize: opts.MaxSize}
+}
+
+// Encode marshals and compresses m. With WithPooledBuffers the result must
+// be released with the Compressor's Free.
+func (c *Codec[T]) Encode(m T) ([]byte, error) {
+	return c.encode(unlabeled, m)
+}
+
+// EncodeContext is like Encode, but applies the Compressor's profile
+// labels on top of those carried by ctx.
+func (c *Codec[T]) EncodeContext(ctx context.Context, m T) ([]byte, error) {
+	return c.encode(ctx, m)
+}
+
+func (c *Codec[T]) encode(ctx context.Context, m T) ([]byte, error) {
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("zstddict: marshaling %s: %w", m.ProtoReflect().Descriptor().FullName(), err)
+	}
+	if c.maxSize > 0 && len(raw) > c.maxSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrTooLarge, m.ProtoReflect().Descriptor().FullName(), len(raw), c.maxSize)
+	}
+	return c.c.compressTo(ctx, c.c.getBuffer(), raw)
+}
+
+// Decode decompresses and unmarshals a message encoded by Encode.
+func (c *Codec[T]) Decode(data []byte) (T, error) {
+	return c.decode(unlabeled, data)
+}
+
+// DecodeContext is like Decode, but applies the Compressor's profile
+// labels on top of those carried by ctx.
+func (c *Codec[T]) DecodeContext(ctx context.Context, data []byte) (T, error) {
+	return c.decode(ctx, data)
+}
+
+func (c *Codec[T]) decode(ctx context.Context, data []byte) (T, error) {
+	var zero T
+	if err := c.c.checkDict(c.c.state.Load(), data); err != nil {
+		return zero, err
+	}
+	raw, err := c.c.decompressTo(ctx, c.c.getBuffer(), data, decodeLimits{size: int64(c.maxSize)})
+	if err != nil {
+		return zero, err
+	}
+	defer c.c.Free(raw)
+
+	m := zero.ProtoReflect().Type().New().Interface().(T)
+	if err := proto.Unmarshal(raw, m); err != nil {
+		return zero, fmt.Errorf("zstddict: unmarshaling %s: %w", m.ProtoReflect().Descriptor().FullName(), err)
+	}
+	return m, nil
+}
@@ -0,0 +1,97 @@
+package zstddict
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	pb "github.com/paulstuart/zstd-dict/proto/filelist"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodec(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(500), &TrainDictOptions{ID: 3001})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec[*pb.ListFilesResponse](c, &CodecOptions{MaxSize: 4096})
+
+	resp := &pb.ListFilesResponse{Root: "/usr/local"}
+	for i := range 20 {
+		resp.Files = append(resp.Files, &pb.FileInfo{Path: fmt.Sprintf("/usr/local/bin/tool%d", i), Size: int64(i * 512)})
+	}
+	data, err := codec.Encode(resp)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !proto.Equal(got, resp) {
+		t.Errorf("Decode() = %v, want %v", got, resp)
+	}
+
+	for range 200 {
+		resp.Files = append(resp.Files, &pb.FileInfo{Path: "/usr/local/share/doc/README"})
+	}
+	if _, err := codec.Encode(resp); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Encode(large) error = %v, want ErrTooLarge", err)
+	}
+	raw, _ := proto.Marshal(resp)
+	large, err := c.Compress(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode(large); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode(large) error = %v, want ErrTooLarge", err)
+	}
+
+	plain, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCodec[*pb.ListFilesResponse](plain, nil).Decode(data); !errors.Is(err, ErrDictMismatch) {
+		t.Errorf("Decode() without the dictionary error = %v, want ErrDictMismatch", err)
+	}
+}
+
+func TestCodec_Context(t *testing.T) {
+	c, err := New(WithProfileLabels("filelist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec[*pb.ListFilesResponse](c, &CodecOptions{MaxSize: 1024})
+	ctx := context.Background()
+
+	resp := &pb.ListFilesResponse{Root: "/srv", Files: []*pb.FileInfo{{Path: "/srv/data.db", Size: 4096}}}
+	data, err := codec.EncodeContext(ctx, resp)
+	if err != nil {
+		t.Fatalf("EncodeContext() error = %v", err)
+	}
+	got, err := codec.DecodeContext(ctx, data)
+	if err != nil {
+		t.Fatalf("DecodeContext() error = %v", err)
+	}
+	if !proto.Equal(got, resp) {
+		t.Errorf("DecodeContext() = %v, want %v", got, resp)
+	}
+
+	// The size limit still applies under labels.
+	for range 100 {
+		resp.Files = append(resp.Files, &pb.FileInfo{Path: "/srv/cache/entry"})
+	}
+	raw, _ := proto.Marshal(resp)
+	large, err := c.CompressContext(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.DecodeContext(ctx, large); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeContext(large) error = %v, want ErrTooLarge", err)
+	}
+}
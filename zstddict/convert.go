@@ -0,0 +1,152 @@
+package zstddict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/xxhash"
+)
+
+// DictFormat identifies how a dictionary is encoded.
+type DictFormat int
+
+const (
+	// FormatRaw is a raw content dictionary: bytes used as history, with
+	// no header or entropy tables. Other zstd ecosystems often exchange
+	// dictionaries this way.
+	FormatRaw DictFormat = iota
+	// FormatStructured is a full zstd dictionary as produced by TrainDict
+	// or zstd --train: magic number, ID, entropy tables and content.
+	FormatStructured
+)
+
+// String returns the format name.
+func (f DictFormat) String() string {
+	switch f {
+	case FormatRaw:
+		return "raw"
+	case FormatStructured:
+		return "structured"
+	default:
+		return fmt.Sprintf("DictFormat(%d)", int(f))
+	}
+}
+
+// minStructuredDictID is the smallest ID the zstd format leaves for user
+// dictionaries; lower IDs are reserved for registration.
+const minStructuredDictID = 32768
+
+// ErrNoCorpus is returned when building a structured dictionary from raw
+// content without a corpus to derive entropy tables from.
+var ErrNoCorpus = errors.New("zstddict: converting to a structured dictionary needs a corpus")
+
+// DetectDictFormat reports whether dict is a structured zstd dictionary.
+// Anything else is treated as raw content.
+func DetectDictFormat(dict []byte) DictFormat {
+	if len(dict) >= 8 && binary.LittleEndian.Uint32(dict) == dictMagic {
+		return FormatStructured
+	}
+	return FormatRaw
+}
+
+// DictID returns the ID in the header of a structured dictionary: the ID
+// that frames compressed with it carry and that peers compare to tell
+// dictionary versions apart. Raw content dictionaries have no header, and
+// their frames no ID, so their ID is 0. An error is returned for an empty
+// dictionary, and for a structured one whose header or entropy tables do
+// not parse.
+func DictID(dict []byte) (uint32, error) {
+	if len(dict) == 0 {
+		return 0, errors.New("zstddict: empty dictionary")
+	}
+	if DetectDictFormat(dict) == FormatRaw {
+		return 0, nil
+	}
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return 0, fmt.Errorf("zstddict: invalid dictionary: %w", err)
+	}
+	return d.ID(), nil
+}
+
+// ConvertDictOptions configures ConvertDict.
+type ConvertDictOptions struct {
+	// Corpus holds samples representative of the data the dictionary will
+	// compress. Entropy tables for a structured dictionary are computed by
+	// compressing it with the dictionary content.
+	Corpus [][]byte
+	// ID is the ID for a structured dictionary built from raw content.
+	// If 0, an ID is derived from the content, so converting the same raw
+	// dictionary anywhere yields the same ID.
+	ID uint32
+	// Level is the encoder level the entropy tables are tuned for
+	// (default: best compression).
+	Level zstd.EncoderLevel
+}
+
+// ConvertDict converts dict to the format to.
+//
+// Converting a structured dictionary to raw returns its content section.
+// Converting raw content to structured builds entropy tables from
+// opts.Corpus, which is required. Converting a structured dictionary to
+// structured regenerates its tables from opts.Corpus, keeping its ID and
+// content, or returns it unchanged if there is no corpus. Raw to raw
+// returns dict unchanged.
+func ConvertDict(dict []byte, to DictFormat, opts *ConvertDictOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &ConvertDictOptions{}
+	}
+	from := DetectDictFormat(dict)
+
+	switch to {
+	case FormatRaw:
+		if from == FormatRaw {
+			return dict, nil
+		}
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Clone(d.Content()), nil
+
+	case FormatStructured:
+		content, id, offsets := dict, opts.ID, [3]int{1, 4, 8}
+		if from == FormatStructured {
+			if len(opts.Corpus) == 0 {
+				return dict, nil
+			}
+			d, err := zstd.InspectDictionary(dict)
+			if err != nil {
+				return nil, err
+			}
+			content, offsets = d.Content(), d.Offsets()
+			if id == 0 {
+				id = d.ID()
+			}
+		}
+		if len(opts.Corpus) == 0 {
+			return nil, ErrNoCorpus
+		}
+		if id == 0 {
+			id = contentDictID(content)
+		}
+		return zstd.BuildDict(zstd.BuildDictOptions{
+			ID:       id,
+			Contents: opts.Corpus,
+			History:  content,
+			Offsets:  offsets,
+			Level:    opts.Level,
+		})
+
+	default:
+		return nil, fmt.Errorf("zstddict: unknown dictionary format %v", to)
+	}
+}
+
+// contentDictID derives a dictionary ID in the user range from content.
+func contentDictID(content []byte) uint32 {
+	return minStructuredDictID + uint32(xxhash.Sum64(content)%(1<<32-minStructuredDictID))
+}
@@ -0,0 +1,92 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestConvertDict(t *testing.T) {
+	samples := generateSampleData(200)
+	dict, err := TrainDict(samples, &TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if f := DetectDictFormat(dict); f != FormatStructured {
+		t.Fatalf("DetectDictFormat(trained) = %v, want structured", f)
+	}
+
+	raw, err := ConvertDict(dict, FormatRaw, nil)
+	if err != nil {
+		t.Fatalf("ConvertDict(raw) error = %v", err)
+	}
+	d, _ := zstd.InspectDictionary(dict)
+	if !bytes.Equal(raw, d.Content()) {
+		t.Error("raw dictionary is not the structured dictionary's content")
+	}
+	if f := DetectDictFormat(raw); f != FormatRaw {
+		t.Errorf("DetectDictFormat(raw) = %v, want raw", f)
+	}
+
+	if _, err := ConvertDict(raw, FormatStructured, nil); !errors.Is(err, ErrNoCorpus) {
+		t.Errorf("ConvertDict(raw, structured) without corpus error = %v, want ErrNoCorpus", err)
+	}
+	rebuilt, err := ConvertDict(raw, FormatStructured, &ConvertDictOptions{Corpus: samples})
+	if err != nil {
+		t.Fatalf("ConvertDict(structured) error = %v", err)
+	}
+	again, _ := ConvertDict(raw, FormatStructured, &ConvertDictOptions{Corpus: samples})
+	rd, err := zstd.InspectDictionary(rebuilt)
+	if err != nil {
+		t.Fatalf("rebuilt dictionary is invalid: %v", err)
+	}
+	if id, _ := zstd.InspectDictionary(again); rd.ID() < minStructuredDictID || rd.ID() != id.ID() {
+		t.Errorf("derived ID = %d, want a stable ID >= %d", rd.ID(), minStructuredDictID)
+	}
+	if !bytes.Equal(rd.Content(), raw) {
+		t.Error("rebuilt dictionary content differs from the raw dictionary")
+	}
+
+	c, err := New(WithDictBytes(rebuilt))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, s := range samples[:10] {
+		compressed, err := c.Compress(s)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, s) {
+			t.Fatalf("round trip with rebuilt dictionary failed: %v", err)
+		}
+	}
+
+	// Regenerating a structured dictionary keeps its ID and content.
+	regen, err := ConvertDict(dict, FormatStructured, &ConvertDictOptions{Corpus: samples[:50]})
+	if err != nil {
+		t.Fatalf("ConvertDict(structured, structured) error = %v", err)
+	}
+	if gd, err := zstd.InspectDictionary(regen); err != nil || gd.ID() != 4242 || !bytes.Equal(gd.Content(), raw) {
+		t.Errorf("regenerated dictionary lost its ID or content (err = %v)", err)
+	}
+}
+
+func TestDictID(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(200), &TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if id, err := DictID(dict); err != nil || id != 4242 {
+		t.Errorf("DictID(trained) = %d, %v; want 4242", id, err)
+	}
+	if id, err := DictID([]byte("raw content")); err != nil || id != 0 {
+		t.Errorf("DictID(raw) = %d, %v; want 0", id, err)
+	}
+	for name, dict := range map[string][]byte{"empty": nil, "truncated": dict[:100]} {
+		if _, err := DictID(dict); err == nil {
+			t.Errorf("DictID(%s) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package zstddict
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// CPUGuardMode selects how a Compressor behaves while its CPUGuard is
+// tripped.
+type CPUGuardMode int
+
+const (
+	// GuardFastest compresses at zstd.SpeedFastest, keeping the dictionary.
+	GuardFastest CPUGuardMode = iota
+	// GuardStore writes stored frames, which copy the input with no
+	// compression work at all. Any zstd decoder can read them.
+	GuardStore
+)
+
+// CPUGuardOptions configures a CPUGuard.
+type CPUGuardOptions struct {
+	// Load reports the current load as a fraction, where 1 means
+	// saturated. If nil, the process CPU usage over the last Interval,
+	// relative to GOMAXPROCS, is used; on platforms where it can't be
+	// measured the guard never trips.
+	Load func() float64
+	// High is the load at or above which the guard trips. Defaults to 0.9.
+	High float64
+	// Low is the load at or below which a tripped guard resets. Defaults
+	// to High-0.2.
+	Low float64
+	// Interval is the minimum time between load samples. Defaults to 1s.
+	Interval time.Duration
+	// Mode is what tripped Compressors do. Defaults to GuardFastest.
+	Mode CPUGuardMode
+}
+
+// CPUGuard backs off compression while the host is saturated, so that
+// compression is never what tips a busy service over. Compressors created
+// with WithCPUGuard consult it on every Compress call; a single guard can
+// be shared by any number of Compressors.
+//
+// Load is sampled lazily from Compress calls, at most once per Interval.
+// The guard trips when a sample reaches High and resets when one falls to
+// Low, so load hovering around one threshold doesn't make it flap.
+type CPUGuard struct {
+	opts CPUGuardOptions
+	now  func() time.Time
+
+	tripped    atomic.Bool
+	lastSample atomic.Int64
+	load       atomic.Uint64 // math.Float64bits of the last sample
+	trips      atomic.Uint64
+	bypassed   atomic.Uint64
+
+	// lastCPU is the process CPU time at lastSample, for the default
+	// Load. Samples are taken by the caller that wins lastSample, but a
+	// slow one may still run when the next begins.
+	lastCPU atomic.Int64
+}
+
+// CPUGuardStats is a snapshot of a CPUGuard.
+type CPUGuardStats struct {
+	// Load is the most recent load sample.
+	Load float64
+	// Tripped reports whether the guard is currently tripped.
+	Tripped bool
+	// Trips counts the times the guard has tripped.
+	Trips uint64
+	// Bypassed counts the Compress calls downgraded while tripped.
+	Bypassed uint64
+}
+
+// NewCPUGuard creates a CPUGuard configured by opts.
+func NewCPUGuard(opts CPUGuardOptions) *CPUGuard {
+	if opts.High <= 0 {
+		opts.High = 0.9
+	}
+	if opts.Low <= 0 || opts.Low >= opts.High {
+		opts.Low = max(opts.High-0.2, 0)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	g := &CPUGuard{opts: opts, now: time.Now}
+	if opts.Load == nil {
+		cpu, _ := processCPUTime()
+		g.lastCPU.Store(int64(cpu))
+	}
+	g.lastSample.Store(g.now().UnixNano())
+	return g
+}
+
+// WithCPUGuard makes Compress back off as directed by g while it is
+// tripped. Frames written while tripped carry no dictionary ID in
+// GuardStore mode, so Decompress accepts those even under WithStrictDict.
+func WithCPUGuard(g *CPUGuard) Option {
+	return func(c *Compressor) error {
+		if g == nil {
+			return errors.New("zstddict: nil CPU guard")
+		}
+		c.cpuGuard = g
+		return nil
+	}
+}
+
+// guardStores reports whether c has a CPUGuard that writes stored frames,
+// which carry neither a dictionary ID nor a checksum.
+func (c *Compressor) guardStores() bool {
+	return c.cpuGuard != nil && c.cpuGuard.opts.Mode == GuardStore
+}
+
+// Stats returns the current state of the guard.
+func (g *CPUGuard) Stats() CPUGuardStats {
+	return CPUGuardStats{
+		Load:     math.Float64frombits(g.load.Load()),
+		Tripped:  g.tripped.Load(),
+		Trips:    g.trips.Load(),
+		Bypassed: g.bypassed.Load(),
+	}
+}
+
+// Tripped reports whether the guard is tripped, sampling the load first
+// if Interval has passed since the last sample.
+func (g *CPUGuard) Tripped() bool {
+	now := g.now().UnixNano()
+	last := g.lastSample.Load()
+	if now-last >= int64(g.opts.Interval) && g.lastSample.CompareAndSwap(last, now) {
+		g.sample(time.Duration(now - last))
+	}
+	return g.tripped.Load()
+}
+
+// sample takes a load reading covering the elapsed time and trips or
+// resets the guard accordingly.
+func (g *CPUGuard) sample(elapsed time.Duration) {
+	var load float64
+	if g.opts.Load != nil {
+		load = g.opts.Load()
+	} else {
+		cpu, ok := processCPUTime()
+		if !ok {
+			return
+		}
+		last := time.Duration(g.lastCPU.Swap(int64(cpu)))
+		load = float64(cpu-last) / float64(elapsed) / float64(runtime.GOMAXPROCS(0))
+	}
+	g.load.Store(math.Float64bits(load))
+
+	switch {
+	case load >= g.opts.High:
+		if g.tripped.CompareAndSwap(false, true) {
+			g.trips.Add(1)
+		}
+	case load <= g.opts.Low:
+		g.tripped.Store(false)
+	}
+}
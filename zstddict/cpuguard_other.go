@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package zstddict
+
+import "time"
+
+// processCPUTime reports that process CPU time is unavailable here.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,108 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCPUGuard_Hysteresis(t *testing.T) {
+	load := 0.5
+	g := NewCPUGuard(CPUGuardOptions{Load: func() float64 { return load }, High: 0.9, Low: 0.6, Interval: time.Second})
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+	g.lastSample.Store(now.UnixNano())
+
+	steps := []struct {
+		load    float64
+		advance time.Duration
+		want    bool
+	}{
+		{0.95, time.Millisecond, false}, // within the interval: not sampled
+		{0.95, time.Second, true},       // trips at High
+		{0.7, time.Second, true},        // between the thresholds: stays tripped
+		{0.6, time.Second, false},       // resets at Low
+		{0.8, time.Second, false},       // between the thresholds: stays reset
+	}
+	for i, s := range steps {
+		load = s.load
+		now = now.Add(s.advance)
+		if got := g.Tripped(); got != s.want {
+			t.Errorf("step %d: Tripped() = %v, want %v", i, got, s.want)
+		}
+	}
+	if st := g.Stats(); st.Trips != 1 || st.Load != 0.8 || st.Tripped {
+		t.Errorf("Stats() = %+v, want 1 trip at load 0.8", st)
+	}
+}
+
+func TestCompressor_CPUGuard(t *testing.T) {
+	samples := generateSampleData(200)
+	dict, err := TrainDict(samples, nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	for _, mode := range []CPUGuardMode{GuardFastest, GuardStore} {
+		g := NewCPUGuard(CPUGuardOptions{Load: func() float64 { return 1 }, Mode: mode})
+		g.tripped.Store(true)
+		c, err := New(WithDictBytes(dict), WithLevel(zstd.SpeedBestCompression), WithStrictDict(true), WithCPUGuard(g))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		compressed, err := c.Compress(samples[0])
+		if err != nil {
+			t.Fatalf("mode %d: Compress() error = %v", mode, err)
+		}
+		if over := len(compressed) - len(samples[0]); mode == GuardStore && (over < 9 || over > 12) {
+			t.Errorf("mode %d: frame is %d bytes over the data, want 9 to 12 bytes of stored framing", mode, over)
+		}
+		got, err := c.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("mode %d: Decompress() error = %v", mode, err)
+		}
+		if !bytes.Equal(got, samples[0]) {
+			t.Errorf("mode %d: round trip mismatch", mode)
+		}
+		if st := g.Stats(); st.Bypassed != 1 {
+			t.Errorf("mode %d: Bypassed = %d, want 1", mode, st.Bypassed)
+		}
+	}
+
+	// Only a guard that stores lets frames without the dictionary past
+	// WithStrictDict.
+	plain, _ := New(WithLevel(zstd.SpeedFastest))
+	frame, _ := plain.Compress(samples[0])
+	for _, mode := range []CPUGuardMode{GuardFastest, GuardStore} {
+		c, _ := New(WithDictBytes(dict), WithStrictDict(true), WithCPUGuard(NewCPUGuard(CPUGuardOptions{Mode: mode})))
+		_, err := c.Decompress(frame)
+		if mode == GuardFastest && !errors.Is(err, ErrDictMismatch) {
+			t.Errorf("GuardFastest: Decompress() of a frame without the dictionary error = %v, want ErrDictMismatch", err)
+		}
+		if mode == GuardStore && err != nil {
+			t.Errorf("GuardStore: Decompress() of a frame without the dictionary error = %v", err)
+		}
+	}
+
+	if _, err := New(WithCPUGuard(nil)); err == nil {
+		t.Error("New(WithCPUGuard(nil)) succeeded, want error")
+	}
+}
+
+func TestCPUGuard_ProcessLoad(t *testing.T) {
+	if _, ok := processCPUTime(); !ok {
+		t.Skip("process CPU time unavailable")
+	}
+	g := NewCPUGuard(CPUGuardOptions{Interval: time.Millisecond})
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	g.Tripped()
+	if st := g.Stats(); st.Load <= 0 {
+		t.Errorf("Load after busy loop = %v, want > 0", st.Load)
+	}
+}
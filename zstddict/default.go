@@ -0,0 +1,31 @@
+package zstddict
+
+import "sync"
+
+// defaultCompressor returns the Compressor behind the package-level
+// functions, creating it on first use.
+var defaultCompressor = sync.OnceValue(func() *Compressor {
+	// New cannot fail without options.
+	c, _ := New()
+	return c
+})
+
+// Compress compresses data with the default Compressor, which starts with
+// the default level and no dictionary until SetDefaultDict loads one. It
+// suits callers compressing payloads explicitly, without a Compressor of
+// their own to manage.
+func Compress(data []byte) ([]byte, error) {
+	return defaultCompressor().Compress(data)
+}
+
+// Decompress decompresses data with the default Compressor.
+func Decompress(data []byte) ([]byte, error) {
+	return defaultCompressor().Decompress(data)
+}
+
+// SetDefaultDict loads dict into the default Compressor, as
+// Compressor.SetDict does, so data compressed with the previous
+// dictionary still decompresses. A nil dict removes the dictionary.
+func SetDefaultDict(dict []byte) error {
+	return defaultCompressor().SetDict(dict)
+}
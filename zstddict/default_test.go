@@ -0,0 +1,38 @@
+package zstddict
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefaultCompressor(t *testing.T) {
+	samples := generateSampleData(200)
+	data := samples[0]
+
+	plain, err := Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	dict, err := TrainDict(samples, &TrainDictOptions{ID: 5150})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if err := SetDefaultDict(dict); err != nil {
+		t.Fatalf("SetDefaultDict() error = %v", err)
+	}
+	t.Cleanup(func() { SetDefaultDict(nil) })
+
+	withDict, err := Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if len(withDict) >= len(plain) {
+		t.Errorf("Compress() with dictionary = %d bytes, without = %d", len(withDict), len(plain))
+	}
+	for _, frame := range [][]byte{plain, withDict} {
+		if got, err := Decompress(frame); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package zstddict
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// dictMetaMagic starts every dictionary file written by SaveDictWithMeta
+// and identifies the envelope version.
+const dictMetaMagic = "zdmeta1\n"
+
+// maxDictMetaSize bounds the metadata LoadDictWithMeta accepts.
+const maxDictMetaSize = 1 << 20
+
+// ErrInvalidDictMeta is returned by LoadDictWithMeta for files whose
+// envelope is malformed or whose dictionary does not match its hash.
+var ErrInvalidDictMeta = errors.New("zstddict: invalid dictionary metadata")
+
+// DictMeta describes how and when a dictionary was built. It is stored
+// alongside the dictionary by SaveDictWithMeta, so a .dict file found on
+// a host can be traced back to its training run.
+type DictMeta struct {
+	// Version is the envelope version, set by SaveDictWithMeta.
+	Version int `json:"version"`
+	// Created is when the dictionary was built. If zero,
+	// SaveDictWithMeta uses the current time.
+	Created time.Time `json:"created"`
+	// Samples is the number of samples the dictionary was trained on.
+	Samples int `json:"samples,omitempty"`
+	// Options are the training options used, if known. Filter and Output
+	// are not stored.
+	Options *TrainDictOptions `json:"options,omitempty"`
+	// DictID, Size and SHA256 describe the dictionary and are set by
+	// SaveDictWithMeta. SHA256 is hex encoded, as DictHash returns it.
+	DictID uint32 `json:"dict_id"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Labels holds free-form annotations, such as the corpus or the
+	// build that produced the dictionary.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SaveDictWithMeta saves dict to path wrapped in an envelope holding
+// meta. The file has the form
+//
+//	"zdmeta1\n" | metadata length (4, little endian) | JSON metadata | dictionary
+//
+// so the dictionary itself is the tail of the file. Load it with
+// LoadDictWithMeta.
+func SaveDictWithMeta(path string, dict []byte, meta DictMeta) error {
+	data, err := EncodeDictWithMeta(dict, meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// EncodeDictWithMeta returns dict wrapped in an envelope holding meta, as
+// SaveDictWithMeta writes it.
+func EncodeDictWithMeta(dict []byte, meta DictMeta) ([]byte, error) {
+	if len(dict) == 0 {
+		return nil, errors.New("zstddict: empty dictionary")
+	}
+	id, err := DictID(dict)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(dict)
+	meta.Version = 1
+	meta.DictID, meta.Size, meta.SHA256 = id, len(dict), hex.EncodeToString(sum[:])
+	if meta.Created.IsZero() {
+		meta.Created = time.Now().UTC()
+	}
+	js, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(dictMetaMagic)+4+len(js)+len(dict))
+	out = append(out, dictMetaMagic...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(js)))
+	out = append(out, js...)
+	return append(out, dict...), nil
+}
+
+// LoadDictWithMeta loads a dictionary saved by SaveDictWithMeta, returning
+// the bare dictionary and its metadata. The dictionary is checked against
+// its recorded size and hash. A plain dictionary file, without an
+// envelope, is returned with nil metadata.
+func LoadDictWithMeta(path string) ([]byte, *DictMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeDictWithMeta(data)
+}
+
+// DecodeDictWithMeta splits data made by EncodeDictWithMeta into the
+// dictionary and its metadata, as LoadDictWithMeta does.
+func DecodeDictWithMeta(data []byte) ([]byte, *DictMeta, error) {
+	rest, ok := bytes.CutPrefix(data, []byte(dictMetaMagic))
+	if !ok {
+		return data, nil, nil
+	}
+	if len(rest) < 4 {
+		return nil, nil, fmt.Errorf("%w: truncated header", ErrInvalidDictMeta)
+	}
+	n := int64(binary.LittleEndian.Uint32(rest))
+	rest = rest[4:]
+	if n > maxDictMetaSize || n > int64(len(rest)) {
+		return nil, nil, fmt.Errorf("%w: metadata length %d", ErrInvalidDictMeta, n)
+	}
+	meta := &DictMeta{}
+	if err := json.Unmarshal(rest[:n], meta); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidDictMeta, err)
+	}
+	dict := rest[n:]
+	if len(dict) != meta.Size {
+		return nil, nil, fmt.Errorf("%w: dictionary is %d bytes, want %d", ErrInvalidDictMeta, len(dict), meta.Size)
+	}
+	if sum := sha256.Sum256(dict); hex.EncodeToString(sum[:]) != meta.SHA256 {
+		return nil, nil, fmt.Errorf("%w: SHA-256 %x, want %s", ErrInvalidDictMeta, sum, meta.SHA256)
+	}
+	return dict, meta, nil
+}
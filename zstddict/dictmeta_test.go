@@ -0,0 +1,67 @@
+package zstddict
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDictWithMeta(t *testing.T) {
+	samples := generateSampleData(200)
+	opts := &TrainDictOptions{MaxDictSize: 8 << 10, ID: 4242, Filter: RedactFilter(regexp.MustCompile("secret"))}
+	dict, err := TrainDict(samples, opts)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "filelist.dict")
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = SaveDictWithMeta(path, dict, DictMeta{
+		Created: created,
+		Samples: len(samples),
+		Options: opts,
+		Labels:  map[string]string{"corpus": "filelist"},
+	})
+	if err != nil {
+		t.Fatalf("SaveDictWithMeta() error = %v", err)
+	}
+
+	got, meta, err := LoadDictWithMeta(path)
+	if err != nil {
+		t.Fatalf("LoadDictWithMeta() error = %v", err)
+	}
+	if string(got) != string(dict) {
+		t.Fatal("LoadDictWithMeta() returned a different dictionary")
+	}
+	c, _ := New(WithDictBytes(dict))
+	if meta.Version != 1 || !meta.Created.Equal(created) || meta.Samples != len(samples) ||
+		meta.DictID != 4242 || meta.Size != len(dict) || meta.SHA256 != c.DictHash() ||
+		meta.Labels["corpus"] != "filelist" {
+		t.Errorf("LoadDictWithMeta() metadata = %+v", meta)
+	}
+	if meta.Options == nil || meta.Options.MaxDictSize != 8<<10 || meta.Options.ID != 4242 {
+		t.Errorf("LoadDictWithMeta() options = %+v", meta.Options)
+	}
+
+	// Plain dictionary files load with no metadata.
+	plain := filepath.Join(t.TempDir(), "plain.dict")
+	if err := SaveDict(dict, plain); err != nil {
+		t.Fatal(err)
+	}
+	if got, meta, err := LoadDictWithMeta(plain); err != nil || meta != nil || string(got) != string(dict) {
+		t.Errorf("LoadDictWithMeta(plain) = %d bytes, %v, %v", len(got), meta, err)
+	}
+
+	// Corruption is caught by the hash, truncation by the size.
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	if _, _, err := DecodeDictWithMeta(data); !errors.Is(err, ErrInvalidDictMeta) {
+		t.Errorf("DecodeDictWithMeta(corrupt) error = %v, want ErrInvalidDictMeta", err)
+	}
+	if _, _, err := DecodeDictWithMeta(data[:len(data)-10]); !errors.Is(err, ErrInvalidDictMeta) {
+		t.Errorf("DecodeDictWithMeta(truncated) error = %v, want ErrInvalidDictMeta", err)
+	}
+}
@@ -0,0 +1,69 @@
+package zstddict
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/xxhash"
+)
+
+// dictStringPrefix starts every encoded dictionary string and identifies
+// the format version.
+const dictStringPrefix = "zdict1:"
+
+// ErrInvalidDictString is returned by DecodeDictString for strings that
+// are not encoded dictionaries, or whose dictionary fails validation.
+var ErrInvalidDictString = errors.New("zstddict: invalid dictionary string")
+
+// EncodeDictString encodes dict as a single line of text, so small
+// dictionaries can be shipped inline in YAML or JSON configuration and
+// environment variables. The string has the form
+//
+//	zdict1:<base64 dictionary>:<hex xxhash64 of the dictionary>
+//
+// and is decoded with DecodeDictString.
+func EncodeDictString(dict []byte) string {
+	return dictStringPrefix + base64.StdEncoding.EncodeToString(dict) + ":" +
+		fmt.Sprintf("%016x", xxhash.Sum64(dict))
+}
+
+// DecodeDictString decodes a string made by EncodeDictString. Whitespace
+// is ignored, so the string may be wrapped across lines. The hash is
+// verified, and structured dictionaries must parse as such; raw content
+// dictionaries only need to be non-empty. Failures wrap
+// ErrInvalidDictString.
+func DecodeDictString(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	rest, ok := strings.CutPrefix(s, dictStringPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %q prefix", ErrInvalidDictString, dictStringPrefix)
+	}
+	body, sum, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing hash", ErrInvalidDictString)
+	}
+	want, err := strconv.ParseUint(sum, 16, 64)
+	if err != nil || len(sum) != 16 {
+		return nil, fmt.Errorf("%w: malformed hash %q", ErrInvalidDictString, sum)
+	}
+	dict, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDictString, err)
+	}
+	if got := xxhash.Sum64(dict); got != want {
+		return nil, fmt.Errorf("%w: hash %016x, want %016x", ErrInvalidDictString, got, want)
+	}
+	if len(dict) == 0 {
+		return nil, fmt.Errorf("%w: empty dictionary", ErrInvalidDictString)
+	}
+	if DetectDictFormat(dict) == FormatStructured {
+		if _, err := zstd.InspectDictionary(dict); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidDictString, err)
+		}
+	}
+	return dict, nil
+}
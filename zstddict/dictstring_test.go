@@ -0,0 +1,52 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDictString(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(300), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	s := EncodeDictString(dict)
+	if !strings.HasPrefix(s, "zdict1:") || strings.ContainsAny(s, "\n ") {
+		t.Fatalf("EncodeDictString() = %.40q..., want a single zdict1: line", s)
+	}
+
+	// Wrapped the way a YAML block scalar might be.
+	var wrapped strings.Builder
+	for i := 0; i < len(s); i += 76 {
+		wrapped.WriteString("  " + s[i:min(i+76, len(s))] + "\n")
+	}
+	got, err := DecodeDictString(wrapped.String())
+	if err != nil {
+		t.Fatalf("DecodeDictString() error = %v", err)
+	}
+	if !bytes.Equal(got, dict) {
+		t.Error("DecodeDictString() did not return the encoded dictionary")
+	}
+
+	corrupt := []byte(s)
+	corrupt[len(dictStringPrefix)+10] ^= 1
+	truncated := EncodeDictString(dict[:100])
+	for name, in := range map[string]string{
+		"no prefix":  strings.TrimPrefix(s, dictStringPrefix),
+		"no hash":    s[:strings.LastIndexByte(s, ':')],
+		"corrupt":    string(corrupt),
+		"bad header": truncated,
+		"empty":      EncodeDictString(nil),
+	} {
+		if _, err := DecodeDictString(in); !errors.Is(err, ErrInvalidDictString) {
+			t.Errorf("DecodeDictString(%s) error = %v, want ErrInvalidDictString", name, err)
+		}
+	}
+
+	raw := []byte("raw content dictionary")
+	if got, err := DecodeDictString(EncodeDictString(raw)); err != nil || !bytes.Equal(got, raw) {
+		t.Errorf("DecodeDictString(raw) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,135 @@
+package zstddict
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFetchTimeout = 30 * time.Second
+	defaultFetchMaxSize = 16 << 20
+)
+
+// FetchOption configures how WithDictURL downloads a dictionary.
+type FetchOption func(*fetchConfig)
+
+type fetchConfig struct {
+	timeout time.Duration
+	maxSize int64
+	sha256  string
+	client  *http.Client
+}
+
+// FetchTimeout bounds the whole download, including reading the body. The
+// default is 30 seconds.
+func FetchTimeout(d time.Duration) FetchOption {
+	return func(fc *fetchConfig) {
+		fc.timeout = d
+	}
+}
+
+// FetchMaxSize rejects dictionaries larger than n bytes. The default is
+// 16 MiB.
+func FetchMaxSize(n int64) FetchOption {
+	return func(fc *fetchConfig) {
+		fc.maxSize = n
+	}
+}
+
+// FetchSHA256 pins the dictionary to the SHA-256 digest sum, in hex, so a
+// compromised or misconfigured server can't substitute another one.
+func FetchSHA256(sum string) FetchOption {
+	return func(fc *fetchConfig) {
+		fc.sha256 = sum
+	}
+}
+
+// FetchClient sets the HTTP client used for the download; the default is
+// http.DefaultClient.
+func FetchClient(hc *http.Client) FetchOption {
+	return func(fc *fetchConfig) {
+		fc.client = hc
+	}
+}
+
+// WithDictURL loads a dictionary with an HTTP GET of url, such as the one
+// a server fleet publishes, so clients need no bootstrap code of their
+// own:
+//
+//	c, err := zstddict.New(zstddict.WithDictURL(
+//	    "https://dicts.example.com/filelist.dict",
+//	    zstddict.FetchTimeout(5*time.Second),
+//	    zstddict.FetchSHA256("9f86d081884c7d65..."),
+//	))
+//
+// The dictionary is fetched once, when New applies the option. Anything
+// but a 200 response is an error.
+func WithDictURL(url string, opts ...FetchOption) Option {
+	return func(c *Compressor) error {
+		fc := fetchConfig{timeout: defaultFetchTimeout, maxSize: defaultFetchMaxSize, client: http.DefaultClient}
+		for _, opt := range opts {
+			opt(&fc)
+		}
+		data, err := fc.fetch(url)
+		if err != nil {
+			return fmt.Errorf("zstddict: fetching dictionary: %w", err)
+		}
+		c.dict = data
+		return nil
+	}
+}
+
+func (fc *fetchConfig) fetch(url string) ([]byte, error) {
+	var want []byte
+	if fc.sha256 != "" {
+		var err error
+		if want, err = hex.DecodeString(strings.TrimSpace(fc.sha256)); err != nil || len(want) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 digest %q", fc.sha256)
+		}
+	}
+
+	ctx := context.Background()
+	if fc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fc.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if fc.maxSize > 0 && resp.ContentLength > fc.maxSize {
+		return nil, fmt.Errorf("GET %s: dictionary larger than %d bytes", url, fc.maxSize)
+	}
+	body := io.Reader(resp.Body)
+	if fc.maxSize > 0 {
+		body = io.LimitReader(resp.Body, fc.maxSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if fc.maxSize > 0 && int64(len(data)) > fc.maxSize {
+		return nil, fmt.Errorf("GET %s: dictionary larger than %d bytes", url, fc.maxSize)
+	}
+	if want != nil {
+		if got := sha256.Sum256(data); string(got[:]) != string(want) {
+			return nil, fmt.Errorf("GET %s: SHA-256 %x, want %x", url, got, want)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,52 @@
+package zstddict
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithDictURL(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/filelist.dict", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(dict)
+	})
+	mux.HandleFunc("/slow.dict", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	url := srv.URL + "/filelist.dict"
+	sum := sha256.Sum256(dict)
+
+	c, err := New(WithDictURL(url, FetchSHA256(hex.EncodeToString(sum[:]))))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if c.DictSize() != len(dict) {
+		t.Errorf("DictSize() = %d, want %d", c.DictSize(), len(dict))
+	}
+
+	for _, tt := range []struct {
+		name string
+		url  string
+		opts []FetchOption
+	}{
+		{"not found", srv.URL + "/missing.dict", nil},
+		{"too large", url, []FetchOption{FetchMaxSize(int64(len(dict) - 1))}},
+		{"wrong digest", url, []FetchOption{FetchSHA256(hex.EncodeToString(make([]byte, sha256.Size)))}},
+		{"bad digest", url, []FetchOption{FetchSHA256("abc")}},
+		{"timeout", srv.URL + "/slow.dict", []FetchOption{FetchTimeout(50 * time.Millisecond)}},
+	} {
+		if _, err := New(WithDictURL(tt.url, tt.opts...)); err == nil {
+			t.Errorf("%s: New() succeeded", tt.name)
+		}
+	}
+}
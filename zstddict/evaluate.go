@@ -0,0 +1,199 @@
+package zstddict
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// SplitSamples splits samples into a training set of about trainFraction
+// of them and a holdout set of the rest, for evaluating dictionaries on
+// samples they were not trained on. Samples are assigned at random, so
+// neither set is skewed by how the corpus was ordered; the same seed
+// gives the same split. Both sets keep the samples' relative order and
+// alias samples. trainFraction is clamped to [0, 1], and NaN counts as 0.
+func SplitSamples(samples [][]byte, trainFraction float64, seed uint64) (train, holdout [][]byte) {
+	if math.IsNaN(trainFraction) {
+		trainFraction = 0
+	}
+	n := int(math.Round(float64(len(samples)) * min(max(trainFraction, 0), 1)))
+	inTrain := make([]bool, len(samples))
+	for _, i := range rand.New(rand.NewPCG(seed, seed)).Perm(len(samples))[:n] {
+		inTrain[i] = true
+	}
+	train = make([][]byte, 0, n)
+	holdout = make([][]byte, 0, len(samples)-n)
+	for i, s := range samples {
+		if inTrain[i] {
+			train = append(train, s)
+		} else {
+			holdout = append(holdout, s)
+		}
+	}
+	return train, holdout
+}
+
+// defaultBuckets are the sample size bounds EvaluateDict groups by.
+var defaultBuckets = []int{1000, 5000, 10000, 50000}
+
+// EvaluateOptions configures EvaluateDict.
+type EvaluateOptions struct {
+	// Level is the encoder level to evaluate at (default:
+	// zstd.SpeedDefault).
+	Level zstd.EncoderLevel
+	// Buckets are the ascending sample sizes separating the size buckets
+	// of the report. If nil, samples are split at 1000, 5000, 10000 and
+	// 50000 bytes.
+	Buckets []int
+}
+
+// EvalReport describes how well a dictionary compresses a set of samples
+// compared to compressing them without one. Ratios are compressed size
+// over original size, so lower is better.
+type EvalReport struct {
+	// Samples is the number of samples evaluated.
+	Samples int
+	// DictSize is the size of the dictionary in bytes.
+	DictSize int
+	// Original is the total size of the samples.
+	Original int64
+	// Plain and Dict are the total compressed sizes without and with the
+	// dictionary, excluding the dictionary itself.
+	Plain, Dict int64
+	// PlainRatio and DictRatio are Plain and Dict over Original.
+	PlainRatio, DictRatio float64
+	// AvgPlainRatio and AvgDictRatio are the means of the per-sample
+	// ratios, which weigh small messages as much as large ones. Empty
+	// samples are left out.
+	AvgPlainRatio, AvgDictRatio float64
+	// Buckets breaks the totals down by sample size.
+	Buckets []SizeBucket
+	// BreakEven is the number of messages, taken in order, after which
+	// the bytes the dictionary saved exceed its size, or -1 if they never
+	// do.
+	BreakEven int
+}
+
+// Improvement returns how many percentage points of the original size
+// the dictionary saves.
+func (r *EvalReport) Improvement() float64 {
+	return (r.PlainRatio - r.DictRatio) * 100
+}
+
+// SizeBucket holds the totals of the samples from Min bytes up to, but not
+// including, Max bytes. The last bucket has a Max of math.MaxInt.
+type SizeBucket struct {
+	Min, Max int
+	Count    int
+	// Original, Plain and Dict are as in EvalReport.
+	Original, Plain, Dict int64
+}
+
+// PlainRatio returns Plain over Original, or 0 for an empty bucket.
+func (b SizeBucket) PlainRatio() float64 {
+	return ratio(b.Plain, b.Original)
+}
+
+// DictRatio returns Dict over Original, or 0 for an empty bucket.
+func (b SizeBucket) DictRatio() float64 {
+	return ratio(b.Dict, b.Original)
+}
+
+// Improvement returns how many percentage points of the original size
+// the dictionary saves on the bucket's samples.
+func (b SizeBucket) Improvement() float64 {
+	return (b.PlainRatio() - b.DictRatio()) * 100
+}
+
+func ratio(compressed, original int64) float64 {
+	if original == 0 {
+		return 0
+	}
+	return float64(compressed) / float64(original)
+}
+
+// EvaluateDict compresses samples with and without dict and reports the
+// difference, so services can decide whether a newly trained dictionary
+// is worth deploying. dict may be structured or raw. Evaluate on samples held out from training, or the
+// dictionary will look better than it is. opts may be nil.
+func EvaluateDict(dict []byte, samples [][]byte, opts *EvaluateOptions) (*EvalReport, error) {
+	if len(samples) == 0 {
+		return nil, ErrNoSamples
+	}
+	level, bounds := zstd.SpeedDefault, defaultBuckets
+	if opts != nil {
+		if opts.Level != 0 {
+			level = opts.Level
+		}
+		if opts.Buckets != nil {
+			bounds = opts.Buckets
+		}
+	}
+
+	plainC, err := New(WithLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	defer plainC.Close()
+	load := WithDictBytes(dict)
+	if DetectDictFormat(dict) == FormatRaw {
+		load = WithRawDict(0, dict)
+	}
+	dictC, err := New(load, WithLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	defer dictC.Close()
+	plain, err := plainC.CompressBatch(samples)
+	if err != nil {
+		return nil, err
+	}
+	withDict, err := dictC.CompressBatch(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &EvalReport{Samples: len(samples), DictSize: len(dict), BreakEven: -1}
+	r.Buckets = make([]SizeBucket, len(bounds)+1)
+	for i := range r.Buckets {
+		if i > 0 {
+			r.Buckets[i].Min = bounds[i-1]
+		}
+		r.Buckets[i].Max = math.MaxInt
+		if i < len(bounds) {
+			r.Buckets[i].Max = bounds[i]
+		}
+	}
+
+	nonEmpty := 0
+	for i, s := range samples {
+		n, p, d := int64(len(s)), int64(len(plain[i])), int64(len(withDict[i]))
+		r.Original += n
+		r.Plain += p
+		r.Dict += d
+		if n > 0 {
+			r.AvgPlainRatio += ratio(p, n)
+			r.AvgDictRatio += ratio(d, n)
+			nonEmpty++
+		}
+		if r.BreakEven < 0 && r.Plain-r.Dict >= int64(len(dict)) {
+			r.BreakEven = i + 1
+		}
+		for j := range r.Buckets {
+			if b := &r.Buckets[j]; len(s) < b.Max {
+				b.Count++
+				b.Original += n
+				b.Plain += p
+				b.Dict += d
+				break
+			}
+		}
+	}
+	r.PlainRatio, r.DictRatio = ratio(r.Plain, r.Original), ratio(r.Dict, r.Original)
+	if nonEmpty > 0 {
+		r.AvgPlainRatio /= float64(nonEmpty)
+		r.AvgDictRatio /= float64(nonEmpty)
+	}
+	return r, nil
+}
@@ -0,0 +1,106 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEvaluateDict(t *testing.T) {
+	samples := generateSampleData(300)
+	train, holdout := SplitSamples(samples, 2.0/3, 1)
+	dict, err := TrainDict(train, nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	r, err := EvaluateDict(dict, holdout, &EvaluateOptions{Buckets: []int{500}})
+	if err != nil {
+		t.Fatalf("EvaluateDict() error = %v", err)
+	}
+	if r.Samples != len(holdout) || r.DictSize != len(dict) {
+		t.Errorf("Samples, DictSize = %d, %d; want %d, %d", r.Samples, r.DictSize, len(holdout), len(dict))
+	}
+	if r.Dict >= r.Plain || r.Improvement() <= 0 {
+		t.Errorf("Dict %d, Plain %d: dictionary did not help", r.Dict, r.Plain)
+	}
+	if r.AvgDictRatio >= r.AvgPlainRatio {
+		t.Errorf("AvgDictRatio %.3f >= AvgPlainRatio %.3f", r.AvgDictRatio, r.AvgPlainRatio)
+	}
+
+	if len(r.Buckets) != 2 || r.Buckets[0].Max != 500 || r.Buckets[1].Min != 500 || r.Buckets[1].Max != math.MaxInt {
+		t.Fatalf("Buckets = %+v, want [0, 500) and [500, MaxInt)", r.Buckets)
+	}
+	var count int
+	var original int64
+	for _, b := range r.Buckets {
+		count += b.Count
+		original += b.Original
+	}
+	if count != r.Samples || original != r.Original {
+		t.Errorf("buckets hold %d samples, %d bytes; want %d, %d", count, original, r.Samples, r.Original)
+	}
+
+	// Break-even is where the cumulative savings first cover the dictionary.
+	plainC, _ := New()
+	dictC, _ := New(WithDictBytes(dict))
+	want, saved := -1, 0
+	for i, s := range holdout {
+		p, _ := plainC.Compress(s)
+		d, _ := dictC.Compress(s)
+		if saved += len(p) - len(d); saved >= len(dict) {
+			want = i + 1
+			break
+		}
+	}
+	if r.BreakEven != want {
+		t.Errorf("BreakEven = %d, want %d", r.BreakEven, want)
+	}
+
+	if _, err := EvaluateDict(dict, nil, nil); !errors.Is(err, ErrNoSamples) {
+		t.Errorf("EvaluateDict(nil samples) error = %v, want ErrNoSamples", err)
+	}
+}
+
+func TestSplitSamples(t *testing.T) {
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = []byte{byte(i)}
+	}
+	train, holdout := SplitSamples(samples, 0.8, 42)
+	if len(train) != 80 || len(holdout) != 20 {
+		t.Fatalf("SplitSamples() = %d/%d, want 80/20", len(train), len(holdout))
+	}
+	seen := make(map[byte]bool)
+	for _, set := range [][][]byte{train, holdout} {
+		for i, s := range set {
+			if seen[s[0]] {
+				t.Fatalf("sample %d in both sets", s[0])
+			}
+			seen[s[0]] = true
+			if i > 0 && s[0] < set[i-1][0] {
+				t.Fatal("SplitSamples() reordered samples")
+			}
+		}
+	}
+	if holdout[len(holdout)-1][0] < 50 {
+		t.Error("holdout drawn only from the start of the corpus")
+	}
+
+	again, _ := SplitSamples(samples, 0.8, 42)
+	other, _ := SplitSamples(samples, 0.8, 43)
+	if !slices.EqualFunc(train, again, bytes.Equal) {
+		t.Error("the same seed gave different splits")
+	}
+	if slices.EqualFunc(train, other, bytes.Equal) {
+		t.Error("different seeds gave the same split")
+	}
+	if train, holdout := SplitSamples(samples, 2, 0); len(train) != 100 || len(holdout) != 0 {
+		t.Errorf("SplitSamples(2) = %d/%d, want 100/0", len(train), len(holdout))
+	}
+	if train, holdout := SplitSamples(samples, math.NaN(), 0); len(train) != 0 || len(holdout) != 100 {
+		t.Errorf("SplitSamples(NaN) = %d/%d, want 0/100", len(train), len(holdout))
+	}
+}
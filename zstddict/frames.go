@@ -0,0 +1,142 @@
+package zstddict
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrInvalidFrame is returned when data cannot be split into zstd frames.
+var ErrInvalidFrame = errors.New("zstddict: invalid frame")
+
+// Block types from the zstd block header (RFC 8878, section 3.1.1.2).
+const (
+	blockTypeRLE      = 1
+	blockTypeReserved = 3
+)
+
+// SplitFrames splits data holding concatenated zstd frames into one slice
+// per frame. Skippable frames, such as WithChecksums trailers, stay
+// attached to the frame before them, or to the first frame when they lead,
+// so every returned slice can be passed to Decompress on its own.
+//
+// The returned slices alias data. SplitFrames only walks frame and block
+// headers; it does not validate the compressed content.
+func SplitFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	start, hasData := 0, false
+	for pos := 0; pos < len(data); {
+		n, skippable, err := frameSize(data[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d: %w", ErrInvalidFrame, pos, err)
+		}
+		if !skippable {
+			if hasData {
+				frames = append(frames, data[start:pos:pos])
+				start = pos
+			}
+			hasData = true
+		}
+		pos += n
+	}
+	if start < len(data) {
+		frames = append(frames, data[start:len(data):len(data)])
+	}
+	return frames, nil
+}
+
+// ConcatFrames joins frames into a single blob. Standard zstd decoders,
+// including Decompress, decode the result as the concatenation of the
+// frames' contents; SplitFrames recovers the individual frames.
+func ConcatFrames(frames ...[]byte) []byte {
+	n := 0
+	for _, f := range frames {
+		n += len(f)
+	}
+	out := make([]byte, 0, n)
+	for _, f := range frames {
+		out = append(out, f...)
+	}
+	return out
+}
+
+// DecompressFrames decompresses each frame in data separately, returning
+// one output per frame as split by SplitFrames. Dictionary, limit, and
+// checksum settings apply to every frame.
+func (c *Compressor) DecompressFrames(data []byte) ([][]byte, error) {
+	frames, err := SplitFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(frames))
+	for i, f := range frames {
+		if out[i], err = c.Decompress(f); err != nil {
+			return nil, fmt.Errorf("zstddict: frame %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+// loneFrame reports whether data holds a single frame, possibly followed by
+// skippable frames.
+func loneFrame(data []byte) bool {
+	n, skippable, err := frameSize(data)
+	if err != nil || skippable {
+		return false
+	}
+	for n < len(data) {
+		m, skippable, err := frameSize(data[n:])
+		if err != nil || !skippable {
+			return false
+		}
+		n += m
+	}
+	return true
+}
+
+// frameSize returns the size of the frame at the start of data and whether
+// it is a skippable frame.
+func frameSize(data []byte) (int, bool, error) {
+	var h zstd.Header
+	if err := h.Decode(data); err != nil {
+		return 0, false, err
+	}
+	if h.Skippable {
+		n := h.HeaderSize + int(h.SkippableSize)
+		if n > len(data) {
+			return 0, false, errors.New("truncated skippable frame")
+		}
+		return n, true, nil
+	}
+
+	pos := h.HeaderSize
+	for {
+		if pos+3 > len(data) {
+			return 0, false, errors.New("truncated block header")
+		}
+		bh := uint32(data[pos]) | uint32(data[pos+1])<<8 | uint32(data[pos+2])<<16
+		last := bh&1 != 0
+		size := int(bh >> 3)
+		switch (bh >> 1) & 3 {
+		case blockTypeRLE:
+			size = 1
+		case blockTypeReserved:
+			return 0, false, errors.New("reserved block type")
+		}
+		pos += 3 + size
+		if pos > len(data) {
+			return 0, false, errors.New("truncated block")
+		}
+		if last {
+			break
+		}
+	}
+	if h.HasCheckSum {
+		pos += 4
+		if pos > len(data) {
+			return 0, false, errors.New("truncated checksum")
+		}
+	}
+	return pos, false, nil
+}
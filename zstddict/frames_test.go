@@ -0,0 +1,65 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSplitFrames(t *testing.T) {
+	c, err := New(WithChecksums())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var records, frames [][]byte
+	for i := range 5 {
+		rec := bytes.Repeat([]byte(fmt.Sprintf("record %d ", i)), 10*(i+1))
+		frame, err := c.Compress(rec)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		records = append(records, rec)
+		frames = append(frames, frame)
+	}
+	// A streamed frame has multiple blocks and no content size.
+	var streamed bytes.Buffer
+	w, _ := c.Writer(&streamed)
+	big := bytes.Repeat([]byte("streamed block data "), 20000)
+	w.Write(big)
+	w.Close()
+	frames = append(frames, ChecksumFrame(streamed.Bytes(), big))
+	records = append(records, big)
+
+	blob := ConcatFrames(frames...)
+	split, err := SplitFrames(blob)
+	if err != nil {
+		t.Fatalf("SplitFrames() error = %v", err)
+	}
+	if len(split) != len(frames) {
+		t.Fatalf("SplitFrames() = %d frames, want %d", len(split), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(split[i], frames[i]) {
+			t.Errorf("frame %d differs after split", i)
+		}
+	}
+
+	out, err := c.DecompressFrames(blob)
+	if err != nil {
+		t.Fatalf("DecompressFrames() error = %v", err)
+	}
+	for i := range records {
+		if !bytes.Equal(out[i], records[i]) {
+			t.Errorf("DecompressFrames()[%d] mismatch", i)
+		}
+	}
+
+	if _, err := SplitFrames(blob[:len(blob)-30]); !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("SplitFrames(truncated) error = %v, want ErrInvalidFrame", err)
+	}
+	if got, err := SplitFrames(nil); err != nil || got != nil {
+		t.Errorf("SplitFrames(nil) = %v, %v; want nil, nil", got, err)
+	}
+}
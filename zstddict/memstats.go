@@ -0,0 +1,99 @@
+package zstddict
+
+import (
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/pool"
+)
+
+// MemStats describes the memory held by a Compressor.
+type MemStats struct {
+	// IdleEncoders and IdleDecoders count pooled objects ready for reuse.
+	IdleEncoders int
+	IdleDecoders int
+	// ActiveEncoders and ActiveDecoders count objects currently in use.
+	ActiveEncoders int
+	ActiveDecoders int
+	// EncoderBytes and DecoderBytes estimate the memory retained by all
+	// live encoders and decoders, idle or active, from the tables and
+	// buffers klauspost/compress allocates for each pool's level, window
+	// and dictionary.
+	EncoderBytes int64
+	DecoderBytes int64
+	// DictBytes is the size of the loaded dictionary.
+	DictBytes int64
+
+	// MaxEncoders is the WithMaxEncoders limit, or 0 if there is none.
+	MaxEncoders int
+	// EncoderHits counts encoders reused from the pool, and EncoderMisses
+	// those created because none was idle, since the pools were last
+	// rebuilt by New, SetDict or SetLevel.
+	EncoderHits   uint64
+	EncoderMisses uint64
+	// EncoderWaits counts waits at the WithMaxEncoders limit, and
+	// EncoderOverflows the extra encoders allocated beyond it, since New.
+	EncoderWaits     uint64
+	EncoderOverflows uint64
+}
+
+// EncoderHitRate returns the fraction of encoders reused from the pool,
+// or 0 before any were needed.
+func (m MemStats) EncoderHitRate() float64 {
+	if n := m.EncoderHits + m.EncoderMisses; n > 0 {
+		return float64(m.EncoderHits) / float64(n)
+	}
+	return 0
+}
+
+// TotalBytes returns the approximate total memory held by the Compressor.
+func (m MemStats) TotalBytes() int64 {
+	return m.EncoderBytes + m.DecoderBytes + m.DictBytes
+}
+
+// MemStats reports the Compressor's pooled encoders and decoders and an
+// estimate of the memory they retain. The byte figures are approximations
+// intended for capacity planning, not exact accounting. Each pool's counts
+// are read together, but the pools are read one after another.
+func (c *Compressor) MemStats() MemStats {
+	st := c.state.Load()
+	window := c.encoderWindow(len(st.dict))
+
+	var encIdle, encLive int
+	var encBytes int64
+	var counters pool.Counters
+	for i, pools := range [][]*pool.Pool[*zstd.Encoder]{st.encoderPools[:], st.plainEncoderPools[:]} {
+		dict := i == 0 && st.dict != nil
+		for level, p := range pools {
+			if p == nil {
+				continue
+			}
+			idle, live := p.Stats()
+			encIdle += idle
+			encLive += live
+			encBytes += int64(live) * encoderMemory(zstd.EncoderLevel(level), window, dict)
+			pc := p.Counters()
+			counters.Hits += pc.Hits
+			counters.Misses += pc.Misses
+			counters.Waits, counters.Overflows = pc.Waits, pc.Overflows
+		}
+	}
+	decIdle, decLive := st.decoderPool.Stats()
+
+	m := MemStats{
+		IdleEncoders:   encIdle,
+		IdleDecoders:   decIdle,
+		ActiveEncoders: encLive - encIdle,
+		ActiveDecoders: decLive - decIdle,
+		EncoderBytes:   encBytes,
+		DecoderBytes:   int64(decLive) * decoderBuffers,
+		DictBytes:      int64(len(st.dict)),
+
+		EncoderHits:      counters.Hits,
+		EncoderMisses:    counters.Misses,
+		EncoderWaits:     counters.Waits,
+		EncoderOverflows: counters.Overflows,
+	}
+	if c.encoderLimit != nil {
+		m.MaxEncoders = c.encoderLimit.Max()
+	}
+	return m
+}
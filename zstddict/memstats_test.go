@@ -0,0 +1,162 @@
+package zstddict
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressor_MemStats(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if got := c.MemStats(); got.IdleEncoders != 0 || got.EncoderBytes != 0 {
+		t.Errorf("MemStats() before use = %+v, want no encoders", got)
+	}
+
+	compressed, err := c.Compress([]byte("memory stats"))
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := c.Decompress(compressed); err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+
+	got := c.MemStats()
+	if !raceEnabled && (got.IdleEncoders != 1 || got.IdleDecoders != 1) {
+		t.Errorf("MemStats() idle = %d/%d, want 1/1", got.IdleEncoders, got.IdleDecoders)
+	}
+	if got.ActiveEncoders != 0 || got.ActiveDecoders != 0 {
+		t.Errorf("MemStats() active = %d/%d, want 0/0", got.ActiveEncoders, got.ActiveDecoders)
+	}
+	if got.DictBytes != int64(len(dict)) {
+		t.Errorf("MemStats().DictBytes = %d, want %d", got.DictBytes, len(dict))
+	}
+	if got.TotalBytes() <= got.DictBytes {
+		t.Errorf("MemStats().TotalBytes() = %d, want more than the dictionary", got.TotalBytes())
+	}
+}
+
+func TestCompressor_MaxEncoders(t *testing.T) {
+	data := bytes.Repeat([]byte("bounded pool "), 100)
+
+	c, err := New(WithMaxEncoders(1, PoolAllocate))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	w, err := c.Writer(io.Discard)
+	if err != nil {
+		t.Fatalf("Writer() error = %v", err)
+	}
+	// The Writer holds the only encoder, so Compress allocates another.
+	if _, err := c.Compress(data); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	w.Close()
+	if _, err := c.Compress(data); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	got := c.MemStats()
+	if got.MaxEncoders != 1 || got.EncoderOverflows != 1 || got.ActiveEncoders != 0 {
+		t.Errorf("MemStats() = %+v, want one overflow and no active encoders", got)
+	}
+	if !raceEnabled && (got.IdleEncoders != 1 || got.EncoderHits != 1 || got.EncoderMisses != 2 || got.EncoderHitRate() != 1.0/3) {
+		t.Errorf("MemStats() = %+v, want one idle encoder, 1 hit and 2 misses", got)
+	}
+
+	c, err = New(WithMaxEncoders(1, PoolBlock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	w, err = c.Writer(io.Discard)
+	if err != nil {
+		t.Fatalf("Writer() error = %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := c.Compress(data)
+		done <- err
+	}()
+	for c.MemStats().EncoderWaits == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Compress() after waiting error = %v", err)
+	}
+	if got := c.MemStats(); got.EncoderOverflows != 0 || !raceEnabled && got.EncoderMisses != 1 {
+		t.Errorf("MemStats() = %+v, want a single encoder", got)
+	}
+
+	if _, err := New(WithMaxEncoders(0, PoolBlock)); err == nil {
+		t.Error("New(WithMaxEncoders(0)) succeeded, want error")
+	}
+}
+
+func TestCompressor_MemStatsBytes(t *testing.T) {
+	data := bytes.Repeat([]byte("memory stats "), 100)
+	for _, level := range []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedBestCompression} {
+		c, err := New(WithLevel(level), WithWindowSize(1<<20))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		compressed, _ := c.Compress(data)
+		c.Decompress(compressed)
+
+		got := c.MemStats()
+		if want := encoderTables[level] + 1<<20 + maxBlockSize; got.EncoderBytes != want {
+			t.Errorf("level %v: EncoderBytes = %d, want %d", level, got.EncoderBytes, want)
+		}
+		if got.DecoderBytes != decoderBuffers {
+			t.Errorf("level %v: DecoderBytes = %d, want %d", level, got.DecoderBytes, decoderBuffers)
+		}
+	}
+}
+
+func TestCompressor_MemStatsConcurrent(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("memory stats "), 100)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				compressed, err := c.Compress(data)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				c.Decompress(compressed)
+			}
+		})
+	}
+	// Active counts come from one read of each pool, so they never go
+	// negative while encoders move in and out.
+	for range 1000 {
+		if got := c.MemStats(); got.ActiveEncoders < 0 || got.ActiveDecoders < 0 {
+			t.Errorf("MemStats() active = %d/%d, want neither negative", got.ActiveEncoders, got.ActiveDecoders)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package zstddict
+
+const raceEnabled = false
@@ -0,0 +1,114 @@
+package zstddict
+
+import (
+	"context"
+	"io"
+)
+
+// pipeBufferSize is the size of the copy buffer used by the pipe helpers.
+const pipeBufferSize = 32 << 10
+
+// CompressPipe compresses everything read from src into a single frame
+// written to dst. It returns the number of bytes read from src and written
+// to dst.
+//
+// Apart from the encoder's own block buffer, at most pipeBufferSize bytes
+// are held in memory. ctx is checked between reads; a read blocked inside
+// src is not interrupted. If ctx is canceled or the copy fails, the frame
+// is left unterminated and ctx's error or the copy error is returned.
+func (c *Compressor) CompressPipe(ctx context.Context, dst io.Writer, src io.Reader) (in, out int64, err error) {
+	cw := &countingWriter{w: dst}
+	w, err := c.Writer(cw)
+	if err != nil {
+		return 0, 0, err
+	}
+	in, err = copyContext(ctx, w, src)
+	if err != nil {
+		w.discard()
+		return in, cw.n, err
+	}
+	err = w.Close()
+	return in, cw.n, err
+}
+
+// DecompressPipe decompresses the zstd stream read from src and writes the
+// result to dst. It returns the number of bytes read from src and written
+// to dst. Buffering and cancellation behave as for CompressPipe, and the
+// Compressor's decoder limits and ratio limit apply.
+func (c *Compressor) DecompressPipe(ctx context.Context, dst io.Writer, src io.Reader) (in, out int64, err error) {
+	cr := &countingReader{r: src}
+	r, err := c.Reader(cr)
+	if err != nil {
+		return cr.n, 0, err
+	}
+	defer r.Close()
+	out, err = copyContext(ctx, dst, r)
+	return cr.n, out, err
+}
+
+// CompressStream compresses everything read from src into a single frame
+// written to dst, like CompressPipe without cancellation. The pooled
+// encoder reads src straight into its block buffer, so no copy buffer is
+// needed. It returns the number of bytes read from src and written to dst.
+func (c *Compressor) CompressStream(dst io.Writer, src io.Reader) (in, out int64, err error) {
+	cw := &countingWriter{w: dst}
+	w, err := c.Writer(cw)
+	if err != nil {
+		return 0, 0, err
+	}
+	in, err = w.ReadFrom(src)
+	if err != nil {
+		w.discard()
+		return in, cw.n, err
+	}
+	err = w.Close()
+	return in, cw.n, err
+}
+
+// DecompressStream decompresses the zstd stream read from src and writes
+// the result to dst, like DecompressPipe without cancellation. It returns
+// the number of bytes read from src and written to dst.
+func (c *Compressor) DecompressStream(dst io.Writer, src io.Reader) (in, out int64, err error) {
+	return c.DecompressPipe(context.Background(), dst, src)
+}
+
+// copyContext copies src to dst through a fixed buffer, stopping when ctx
+// is done.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, pipeBufferSize)
+	var n int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+			if nw != nr {
+				return n, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package zstddict
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPipe_RoundTrip(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("pipe round trip "), 10000)
+
+	var compressed bytes.Buffer
+	in, out, err := c.CompressPipe(context.Background(), &compressed, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("CompressPipe() error = %v", err)
+	}
+	if in != int64(len(data)) || out != int64(compressed.Len()) {
+		t.Errorf("CompressPipe() = %d, %d; want %d, %d", in, out, len(data), compressed.Len())
+	}
+
+	var decompressed bytes.Buffer
+	cLen := int64(compressed.Len())
+	in, out, err = c.DecompressPipe(context.Background(), &decompressed, &compressed)
+	if err != nil {
+		t.Fatalf("DecompressPipe() error = %v", err)
+	}
+	if in != cLen || out != int64(len(data)) {
+		t.Errorf("DecompressPipe() = %d, %d; want %d, %d", in, out, cLen, len(data))
+	}
+	if !bytes.Equal(decompressed.Bytes(), data) {
+		t.Error("pipe round trip mismatch")
+	}
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(200), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Join(generateSampleData(100), nil)
+
+	var compressed bytes.Buffer
+	in, out, err := c.CompressStream(&compressed, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("CompressStream() error = %v", err)
+	}
+	if in != int64(len(data)) || out != int64(compressed.Len()) {
+		t.Errorf("CompressStream() = %d, %d; want %d, %d", in, out, len(data), compressed.Len())
+	}
+
+	var decompressed bytes.Buffer
+	cLen := int64(compressed.Len())
+	in, out, err = c.DecompressStream(&decompressed, &compressed)
+	if err != nil {
+		t.Fatalf("DecompressStream() error = %v", err)
+	}
+	if in != cLen || out != int64(len(data)) {
+		t.Errorf("DecompressStream() = %d, %d; want %d, %d", in, out, cLen, len(data))
+	}
+	if !bytes.Equal(decompressed.Bytes(), data) {
+		t.Error("stream round trip mismatch")
+	}
+
+	// The encoder went back to the pool.
+	if got := c.MemStats(); got.ActiveEncoders != 0 || got.ActiveDecoders != 0 {
+		t.Errorf("MemStats() = %+v, want no active encoders or decoders", got)
+	}
+}
+
+func TestPipe_Canceled(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var compressed bytes.Buffer
+	if _, _, err := c.CompressPipe(ctx, &compressed, bytes.NewReader([]byte("data"))); !errors.Is(err, context.Canceled) {
+		t.Errorf("CompressPipe() error = %v, want context.Canceled", err)
+	}
+	if got := c.MemStats(); got.ActiveEncoders != 0 {
+		t.Errorf("MemStats().ActiveEncoders = %d after cancel, want 0", got.ActiveEncoders)
+	}
+}
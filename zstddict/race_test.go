@@ -0,0 +1,9 @@
+//go:build race
+
+package zstddict
+
+// raceEnabled reports whether the race detector is on. It slows tests and
+// inflates their memory use enough for garbage collections to evict idle
+// encoders and decoders mid-test, so exact pool counts and allocation
+// checks are skipped.
+const raceEnabled = true
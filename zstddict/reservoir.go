@@ -0,0 +1,109 @@
+package zstddict
+
+import (
+	"bytes"
+	"container/heap"
+	"iter"
+	"math/rand/v2"
+)
+
+// Reservoir keeps a uniform random subset of the samples added to it,
+// holding at most a fixed number of bytes however many are added, so a
+// dictionary can be trained from millions of captured messages without
+// keeping them all in memory. Each sample gets a random priority, and the
+// samples with the highest priorities that fit the budget are kept.
+//
+// Samples can be fed from a channel as they arrive:
+//
+//	r := zstddict.NewReservoir(64<<20, 0)
+//	for msg := range captured {
+//	    r.Add(msg)
+//	}
+//	dict, err := zstddict.TrainDict(r.Samples(), nil)
+//
+// A Reservoir is not safe for concurrent use.
+type Reservoir struct {
+	maxBytes int64
+	rng      *rand.Rand
+	kept     reservoirHeap
+	size     int64
+	seen     int
+}
+
+// NewReservoir returns a Reservoir holding up to maxBytes of samples,
+// choosing them with seed, so the same seed and samples give the same
+// subset.
+func NewReservoir(maxBytes int64, seed uint64) *Reservoir {
+	return &Reservoir{maxBytes: maxBytes, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Add offers sample to the reservoir, which keeps a copy if it is chosen,
+// so the caller may reuse its buffer. Empty samples and samples larger
+// than the whole budget are never kept.
+func (r *Reservoir) Add(sample []byte) {
+	r.seen++
+	n := int64(len(sample))
+	if n == 0 || n > r.maxBytes {
+		return
+	}
+	p := r.rng.Uint64()
+	if r.size+n > r.maxBytes && p <= r.kept[0].priority {
+		// It would be the first evicted.
+		return
+	}
+	heap.Push(&r.kept, reservoirItem{sample: bytes.Clone(sample), priority: p})
+	r.size += n
+	for r.size > r.maxBytes {
+		r.size -= int64(len(heap.Pop(&r.kept).(reservoirItem).sample))
+	}
+}
+
+// Samples returns the samples kept, in no particular order.
+func (r *Reservoir) Samples() [][]byte {
+	samples := make([][]byte, len(r.kept))
+	for i, it := range r.kept {
+		samples[i] = it.sample
+	}
+	return samples
+}
+
+// Seen returns the number of samples offered.
+func (r *Reservoir) Seen() int { return r.seen }
+
+// Size returns the total size of the samples kept.
+func (r *Reservoir) Size() int64 { return r.size }
+
+type reservoirItem struct {
+	sample   []byte
+	priority uint64
+}
+
+// reservoirHeap is a min-heap by priority, so the next sample to evict is
+// at the root.
+type reservoirHeap []reservoirItem
+
+func (h reservoirHeap) Len() int           { return len(h) }
+func (h reservoirHeap) Less(i, j int) bool { return h[i].priority < h[j].priority }
+func (h reservoirHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *reservoirHeap) Push(x any)        { *h = append(*h, x.(reservoirItem)) }
+func (h *reservoirHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+// TrainDictFromSeq trains a dictionary from a uniform random subset of the
+// samples in seq holding at most maxBytes, chosen as by a Reservoir
+// seeded with opts.Seed.
+func TrainDictFromSeq(seq iter.Seq[[]byte], maxBytes int64, opts *TrainDictOptions) ([]byte, error) {
+	var seed uint64
+	if opts != nil {
+		seed = opts.Seed
+	}
+	r := NewReservoir(maxBytes, seed)
+	for sample := range seq {
+		r.Add(sample)
+	}
+	return TrainDict(r.Samples(), opts)
+}
@@ -0,0 +1,76 @@
+package zstddict
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestReservoir(t *testing.T) {
+	const budget = 10 << 10
+	r := NewReservoir(budget, 1)
+	buf := make([]byte, 0, 64)
+	firstHalf := 0
+	for i := range 10000 {
+		// Reuse the buffer, as a capture loop would.
+		buf = fmt.Appendf(buf[:0], "message %05d: /srv/data/file.txt", i)
+		r.Add(buf)
+	}
+	r.Add(make([]byte, budget+1))
+
+	if r.Seen() != 10001 {
+		t.Errorf("Seen() = %d, want 10001", r.Seen())
+	}
+	if r.Size() > budget {
+		t.Errorf("Size() = %d, over the budget of %d", r.Size(), budget)
+	}
+	samples := r.Samples()
+	var total int64
+	seen := make(map[string]bool)
+	for _, s := range samples {
+		total += int64(len(s))
+		if seen[string(s)] {
+			t.Fatalf("sample %q kept twice", s)
+		}
+		seen[string(s)] = true
+		var i int
+		fmt.Sscanf(string(s), "message %d:", &i)
+		if i < 5000 {
+			firstHalf++
+		}
+	}
+	if total != r.Size() || total < budget-64 {
+		t.Errorf("kept %d bytes, Size() = %d, budget %d", total, r.Size(), budget)
+	}
+	// A uniform subset draws about as many from either half.
+	if n := len(samples); firstHalf < n/3 || firstHalf > 2*n/3 {
+		t.Errorf("%d of %d samples from the first half, want about half", firstHalf, n)
+	}
+
+	again := NewReservoir(budget, 1)
+	for i := range 10000 {
+		again.Add(fmt.Appendf(nil, "message %05d: /srv/data/file.txt", i))
+	}
+	key := func(ss [][]byte) []string {
+		out := make([]string, len(ss))
+		for i, s := range ss {
+			out[i] = string(s)
+		}
+		slices.Sort(out)
+		return out
+	}
+	if !slices.Equal(key(samples), key(again.Samples())) {
+		t.Error("the same seed kept different samples")
+	}
+}
+
+func TestTrainDictFromSeq(t *testing.T) {
+	samples := generateSampleData(500)
+	dict, err := TrainDictFromSeq(slices.Values(samples), 16<<10, &TrainDictOptions{Seed: 3})
+	if err != nil {
+		t.Fatalf("TrainDictFromSeq() error = %v", err)
+	}
+	if _, err := New(WithDictBytes(dict)); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+}
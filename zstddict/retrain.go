@@ -0,0 +1,117 @@
+package zstddict
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// RetrainOptions configures RetrainDict.
+type RetrainOptions struct {
+	// Train configures training on the new samples. Its MaxDictSize
+	// bounds the whole new dictionary, old content included.
+	Train TrainDictOptions
+	// Carryover is the fraction of the content kept from the old
+	// dictionary (default: 0.25). The old content that matches the new
+	// samples best is kept.
+	Carryover float64
+	// Holdout is the fraction of the new samples held out from training
+	// to compare the dictionaries on (default: 0.2), as in TrainBest.
+	Holdout float64
+}
+
+// RetrainResult holds a retrained dictionary and how it compares to the
+// one it replaces on samples held out from training.
+type RetrainResult struct {
+	Dict []byte
+	// Old and New are the evaluations of the old and new dictionaries.
+	Old, New *EvalReport
+}
+
+// Delta returns how many bytes the new dictionary saves over the old one
+// on the holdout samples; negative if it does worse.
+func (r *RetrainResult) Delta() int64 {
+	return r.Old.Dict - r.New.Dict
+}
+
+// RetrainDict trains a successor to old from newSamples. Rather than
+// starting afresh, it keeps the part of old's content that still matches
+// the new samples, so patterns the new capture happens to under-represent
+// survive rotation. The kept content goes first and the newly trained
+// content last, where offsets are cheapest, and the entropy tables are
+// rebuilt from the new samples. old may be structured or raw; the result
+// is structured. opts may be nil.
+func RetrainDict(old []byte, newSamples [][]byte, opts *RetrainOptions) (*RetrainResult, error) {
+	if opts == nil {
+		opts = &RetrainOptions{}
+	}
+	carry, holdout := opts.Carryover, opts.Holdout
+	if carry == 0 {
+		carry = 0.25
+	}
+	if holdout == 0 {
+		holdout = 0.2
+	}
+	if carry < 0 || carry >= 1 {
+		return nil, fmt.Errorf("zstddict: carryover fraction must be from 0 to 1, got %g", carry)
+	}
+	if holdout <= 0 || holdout >= 1 {
+		return nil, fmt.Errorf("zstddict: holdout fraction must be between 0 and 1, got %g", holdout)
+	}
+	if opts.Train.Filter != nil {
+		newSamples = FilterSamples(newSamples, opts.Train.Filter)
+	}
+	train, test := SplitSamples(newSamples, 1-holdout, opts.Train.Seed)
+	if len(train) == 0 || len(test) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	oldContent, err := ConvertDict(old, FormatRaw, nil)
+	if err != nil {
+		return nil, err
+	}
+	size := opts.Train.MaxDictSize
+	if size == 0 {
+		size = 32 * 1024
+	}
+	carried, err := TrimDict(oldContent, int(float64(size)*carry), train)
+	if err != nil {
+		return nil, err
+	}
+
+	trainOpts := opts.Train
+	trainOpts.Filter, trainOpts.Raw = nil, false
+	trainOpts.MaxDictSize = size - len(carried)
+	fresh, err := TrainDict(train, &trainOpts)
+	if err != nil {
+		return nil, err
+	}
+	d, err := zstd.InspectDictionary(fresh)
+	if err != nil {
+		return nil, err
+	}
+	history := append(carried[:len(carried):len(carried)], d.Content()...)
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       d.ID(),
+		Contents: train,
+		History:  history,
+		Offsets:  d.Offsets(),
+		Level:    opts.Train.Level,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Train.ContentID {
+		binary.LittleEndian.PutUint32(dict[4:], contentDictID(dict[8:]))
+	}
+
+	res := &RetrainResult{Dict: dict}
+	if res.Old, err = EvaluateDict(old, test, nil); err != nil {
+		return nil, err
+	}
+	if res.New, err = EvaluateDict(dict, test, nil); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
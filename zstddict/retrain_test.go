@@ -0,0 +1,47 @@
+package zstddict
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRetrainDict(t *testing.T) {
+	// The old corpus and the new one share part of their vocabulary.
+	oldSamples := generateSampleData(300)
+	newSamples := make([][]byte, 0, 300)
+	for i, s := range generateSampleData(300) {
+		newSamples = append(newSamples, fmt.Appendf(s, "owner=svc-%d group=storage\n", i%7))
+	}
+	old, err := TrainDict(oldSamples, &TrainDictOptions{MaxDictSize: 8 << 10})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	res, err := RetrainDict(old, newSamples, &RetrainOptions{Train: TrainDictOptions{MaxDictSize: 8 << 10, ID: 5005}})
+	if err != nil {
+		t.Fatalf("RetrainDict() error = %v", err)
+	}
+	if err := ValidateDict(res.Dict); err != nil {
+		t.Fatalf("ValidateDict() error = %v", err)
+	}
+	if id, _ := DictID(res.Dict); id != 5005 {
+		t.Errorf("DictID() = %d, want 5005", id)
+	}
+	if res.Old.Samples != res.New.Samples || res.Old.Samples == 0 {
+		t.Errorf("evaluated on %d and %d samples", res.Old.Samples, res.New.Samples)
+	}
+	if res.Delta() != res.Old.Dict-res.New.Dict {
+		t.Errorf("Delta() = %d, want %d", res.Delta(), res.Old.Dict-res.New.Dict)
+	}
+	if res.Delta() <= 0 {
+		t.Errorf("retrained dictionary did no better on the new samples: %d vs %d bytes", res.New.Dict, res.Old.Dict)
+	}
+
+	raw, _ := ConvertDict(old, FormatRaw, nil)
+	if _, err := RetrainDict(raw, newSamples, nil); err != nil {
+		t.Errorf("RetrainDict(raw) error = %v", err)
+	}
+	if _, err := RetrainDict(old, newSamples, &RetrainOptions{Carryover: 1}); err == nil {
+		t.Error("RetrainDict() accepted a carryover of 1")
+	}
+}
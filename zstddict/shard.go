@@ -0,0 +1,126 @@
+package zstddict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// shardHoldout is the fraction of samples sharded training holds out to
+// choose between candidates.
+const shardHoldout = 0.2
+
+// trainShards implements TrainDictOptions.Shards for samples that have
+// already been filtered, deduplicated and shuffled.
+func trainShards(samples [][]byte, opts *TrainDictOptions) ([]byte, error) {
+	train, test := SplitSamples(samples, 1-shardHoldout, opts.Seed)
+	if len(test) == 0 || len(train) < opts.Shards {
+		return nil, ErrNoSamples
+	}
+	shards := make([][][]byte, opts.Shards)
+	for i, s := range train {
+		shards[i%len(shards)] = append(shards[i%len(shards)], s)
+	}
+
+	shardOpts := *opts
+	shardOpts.Filter, shardOpts.Dedup, shardOpts.Shuffle, shardOpts.Shards = nil, false, false, 0
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	dicts := make([][]byte, len(shards))
+	errs := make([]error, len(shards))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			dicts[i], errs[i] = TrainDict(shard, &shardOpts)
+		})
+	}
+	wg.Wait()
+
+	var candidates [][]byte
+	for i, d := range dicts {
+		if errs[i] == nil {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errs[0]
+	}
+	if merged, err := mergeShardDicts(candidates, train, opts); err == nil {
+		candidates = append(candidates, merged)
+	}
+
+	var best []byte
+	var bestSize int64
+	evalErr := ErrNoSamples
+	for _, d := range candidates {
+		r, err := EvaluateDict(d, test, &EvaluateOptions{Level: opts.Level})
+		if err != nil {
+			evalErr = err
+			continue
+		}
+		if best == nil || r.Dict < bestSize {
+			best, bestSize = d, r.Dict
+		}
+	}
+	if best == nil {
+		return nil, evalErr
+	}
+	return best, nil
+}
+
+// mergeShardDicts builds a dictionary from the content of the shard
+// dictionaries that matches samples best.
+func mergeShardDicts(dicts [][]byte, samples [][]byte, opts *TrainDictOptions) ([]byte, error) {
+	size := opts.MaxDictSize
+	if size == 0 {
+		size = 32 * 1024
+	}
+	var content []byte
+	for _, d := range dicts {
+		c, err := ConvertDict(d, FormatRaw, nil)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, c...)
+	}
+	if opts.Raw {
+		return TrimDict(content, size, samples)
+	}
+
+	d, err := zstd.InspectDictionary(dicts[0])
+	if err != nil {
+		return nil, err
+	}
+	// Leave room for the header and entropy tables.
+	tables := len(dicts[0]) - len(d.Content())
+	content, err = TrimDict(content, max(size-tables, trimSegment), samples)
+	if err != nil {
+		return nil, err
+	}
+	id := d.ID()
+	if opts.ID != 0 {
+		id = opts.ID
+	}
+	merged, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  bytes.Clone(content),
+		Offsets:  d.Offsets(),
+		Level:    opts.Level,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.ContentID {
+		binary.LittleEndian.PutUint32(merged[4:], contentDictID(merged[8:]))
+	}
+	return merged, nil
+}
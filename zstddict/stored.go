@@ -0,0 +1,72 @@
+package zstddict
+
+import "encoding/binary"
+
+// Stored frames hold their content in raw blocks, which every zstd decoder
+// reads back without a dictionary (RFC 8878, section 3.1.1.2.2).
+const (
+	frameMagic   = 0xFD2FB528
+	maxBlockSize = 128 << 10
+)
+
+// AppendStoredFrame appends to dst a zstd frame holding data uncompressed
+// and returns the extended slice. The frame declares its content size and
+// carries no dictionary ID or checksum. It is never smaller than data: the
+// 4 byte magic number, the frame header and the first block header add 9
+// bytes up to 255 bytes of data, 10 up to 65791 and 12 beyond, and each
+// further 128KB block adds 3 more. That is the price of a frame any zstd
+// decoder reads; see StoredFrameSize.
+func AppendStoredFrame(dst, data []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, frameMagic)
+
+	// Frame header descriptor: single segment, so the content size takes
+	// the place of the window descriptor.
+	const singleSegment = 1 << 5
+	n := uint64(len(data))
+	switch {
+	case n < 256:
+		dst = append(dst, singleSegment, byte(n))
+	case n < 256+1<<16:
+		dst = append(dst, 1<<6|singleSegment)
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(n-256))
+	case n < 1<<32:
+		dst = append(dst, 2<<6|singleSegment)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(n))
+	default:
+		dst = append(dst, 3<<6|singleSegment)
+		dst = binary.LittleEndian.AppendUint64(dst, n)
+	}
+
+	for {
+		size := min(len(data), maxBlockSize)
+		// Block header: last flag, block type 0 (raw), and size.
+		hdr := uint32(size) << 3
+		if size == len(data) {
+			hdr |= 1
+		}
+		dst = append(dst, byte(hdr), byte(hdr>>8), byte(hdr>>16))
+		dst = append(dst, data[:size]...)
+		data = data[size:]
+		if len(data) == 0 {
+			return dst
+		}
+	}
+}
+
+// StoredFrameSize returns the length of the frame AppendStoredFrame
+// produces for n bytes of content.
+func StoredFrameSize(n int) int {
+	size := 4 + 1
+	switch {
+	case n < 256:
+		size++
+	case n < 256+1<<16:
+		size += 2
+	case uint64(n) < 1<<32:
+		size += 4
+	default:
+		size += 8
+	}
+	blocks := max((n+maxBlockSize-1)/maxBlockSize, 1)
+	return size + 3*blocks + n
+}
@@ -0,0 +1,95 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAppendStoredFrame(t *testing.T) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer dec.Close()
+
+	data := make([]byte, 300<<10)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// Sizes on either side of each content size field width and block
+	// boundary, with the bytes of framing the documentation promises.
+	tests := []struct {
+		n, overhead int
+	}{
+		{0, 9},
+		{1, 9},
+		{255, 9},
+		{256, 10},
+		{256 + 1<<16 - 1, 10},
+		{256 + 1<<16, 12},
+		{maxBlockSize, 12},
+		{maxBlockSize + 1, 15},
+		{len(data), 18},
+	}
+	for _, tt := range tests {
+		n := tt.n
+		frame := AppendStoredFrame([]byte("prefix"), data[:n])
+		frame = frame[len("prefix"):]
+		if len(frame)-n != tt.overhead {
+			t.Errorf("n=%d: frame adds %d bytes to the data, want %d", n, len(frame)-n, tt.overhead)
+		}
+		if len(frame) != StoredFrameSize(n) {
+			t.Errorf("n=%d: frame is %d bytes, StoredFrameSize = %d", n, len(frame), StoredFrameSize(n))
+		}
+		got, err := dec.DecodeAll(frame, nil)
+		if err != nil || !bytes.Equal(got, data[:n]) {
+			t.Errorf("n=%d: DecodeAll() = %d bytes, %v", n, len(got), err)
+		}
+	}
+}
+
+func TestCompressor_StoredFallback(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), &TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict), WithStoredFallback(), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	random := make([]byte, 4096)
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	compressed, err := c.Compress(random)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if len(compressed)-len(random) != 10 {
+		t.Errorf("random data compressed to %d bytes, want the %d bytes plus 10 bytes of stored framing", len(compressed), len(random))
+	}
+	if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, random) {
+		t.Errorf("Decompress() of stored frame = %d bytes, %v", len(got), err)
+	}
+
+	// Compressible data still gets compressed with the dictionary.
+	text := bytes.Repeat([]byte("/usr/local/bin/program "), 50)
+	compressed, _ = c.Compress(text)
+	var h zstd.Header
+	if err := h.Decode(compressed); err != nil || h.DictionaryID != 4242 || len(compressed) >= len(text) {
+		t.Errorf("text compressed to %d bytes with dictionary %d (%v), want a smaller frame with dictionary 4242", len(compressed), h.DictionaryID, err)
+	}
+
+	// Without the fallback, strict mode still rejects frames lacking the
+	// dictionary.
+	strict, _ := New(WithDictBytes(dict), WithStrictDict(true))
+	if _, err := strict.Decompress(AppendStoredFrame(nil, random)); !errors.Is(err, ErrDictMismatch) {
+		t.Errorf("strict Decompress() of stored frame error = %v, want ErrDictMismatch", err)
+	}
+}
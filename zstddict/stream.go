@@ -0,0 +1,182 @@
+package zstddict
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/pool"
+)
+
+// errClosed is returned when a Writer or Reader is used after Close.
+var errClosed = errors.New("zstddict: use of closed stream")
+
+// Writer compresses a zstd stream. It is returned by Compressor.Writer.
+// Its encoder comes from the Compressor's pool and is returned on Close.
+type Writer struct {
+	enc  *zstd.Encoder
+	pool *pool.Pool[*zstd.Encoder]
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.enc == nil {
+		return 0, errClosed
+	}
+	return w.enc.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom, so io.Copy to a Writer reads src
+// straight into the encoder's block buffer instead of through a copy
+// buffer.
+func (w *Writer) ReadFrom(src io.Reader) (int64, error) {
+	if w.enc == nil {
+		return 0, errClosed
+	}
+	return w.enc.ReadFrom(src)
+}
+
+// Flush writes any buffered data to the underlying writer as a complete
+// block, without ending the frame.
+func (w *Writer) Flush() error {
+	if w.enc == nil {
+		return errClosed
+	}
+	return w.enc.Flush()
+}
+
+// Close ends the frame, flushes it, and returns the encoder to the pool.
+// The underlying writer is not closed. Closing a closed Writer is a no-op.
+func (w *Writer) Close() error {
+	if w.enc == nil {
+		return nil
+	}
+	err := w.enc.Close()
+	// Drop the reference to the caller's writer before pooling.
+	w.enc.Reset(nil)
+	w.pool.Put(w.enc)
+	w.enc = nil
+	return err
+}
+
+// Reset discards any unfinished frame and starts a new one writing to dst,
+// keeping the encoder, so one Writer can compress stream after stream
+// without a trip through the pool in between. A closed Writer takes an
+// encoder from the pool again, and must be closed again when done.
+func (w *Writer) Reset(dst io.Writer) error {
+	if w.enc == nil {
+		enc, err := w.pool.Get()
+		if err != nil {
+			return err
+		}
+		w.enc = enc
+	}
+	w.enc.Reset(dst)
+	return nil
+}
+
+// discard returns the encoder to the pool without finishing the frame.
+func (w *Writer) discard() {
+	if w.enc == nil {
+		return
+	}
+	w.enc.Reset(nil)
+	w.pool.Put(w.enc)
+	w.enc = nil
+}
+
+// Reader decompresses a zstd stream. It is returned by Compressor.Reader.
+// Its decoder comes from the Compressor's pool and is returned on Close.
+type Reader struct {
+	dec  *zstd.Decoder
+	pool *pool.Pool[*zstd.Decoder]
+
+	// src counts compressed bytes consumed when a ratio limit is set.
+	src      *countingReader
+	maxRatio int64
+	maxSize  int64
+	out      int64
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, errClosed
+	}
+	n, err := r.dec.Read(p)
+	r.out += int64(n)
+	if r.maxRatio > 0 && r.out > max(r.src.n, 1)*r.maxRatio {
+		return n, ErrRatioExceeded
+	}
+	if r.maxSize > 0 && r.out > r.maxSize {
+		return n, &DecodedSizeError{Limit: r.maxSize}
+	}
+	return n, decodeError(err)
+}
+
+// WriteTo implements io.WriterTo, so io.Copy from a Reader writes decoded
+// blocks straight to dst instead of through a copy buffer. When the
+// Compressor limits the ratio or the decoded size, the output is counted
+// through Read as usual.
+func (r *Reader) WriteTo(dst io.Writer) (int64, error) {
+	if r.dec == nil {
+		return 0, errClosed
+	}
+	if r.maxRatio > 0 || r.maxSize > 0 {
+		// Hide WriteTo, so io.Copy reads through Read.
+		return io.Copy(dst, struct{ io.Reader }{r})
+	}
+	n, err := r.dec.WriteTo(dst)
+	r.out += n
+	return n, decodeError(err)
+}
+
+// Reset stops any stream in progress and starts reading a new one from
+// src, keeping the decoder, so one Reader can decompress stream after
+// stream without a trip through the pool in between. A closed Reader takes
+// a decoder from the pool again, and must be closed again when done.
+func (r *Reader) Reset(src io.Reader) error {
+	if r.dec == nil {
+		dec, err := r.pool.Get()
+		if err != nil {
+			return err
+		}
+		r.dec = dec
+	}
+	r.out = 0
+	if r.src != nil {
+		r.src = &countingReader{r: src}
+		src = r.src
+	}
+	if err := r.dec.Reset(src); err != nil {
+		_ = r.dec.Reset(nil)
+		return decodeError(err)
+	}
+	return nil
+}
+
+// Close returns the decoder to the pool. It always returns nil, and
+// closing a closed Reader is a no-op.
+func (r *Reader) Close() error {
+	if r.dec == nil {
+		return nil
+	}
+	// Stop any in-progress stream and drop the reference to the caller's
+	// reader before pooling.
+	_ = r.dec.Reset(nil)
+	r.pool.Put(r.dec)
+	r.dec = nil
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,9 +1,17 @@
 package zstddict
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/klauspost/compress/dict"
 	"github.com/klauspost/compress/zstd"
@@ -16,8 +24,123 @@ type TrainDictOptions struct {
 	MaxDictSize int
 	// ID is an optional dictionary ID (default: random).
 	ID uint32
+	// ContentID derives the ID from the dictionary's bytes instead, so
+	// identical dictionaries get the same ID wherever they are built and
+	// can be deduplicated or cached by ID. ID is ignored.
+	ContentID bool
 	// Level is the encoder level to optimize for (default: best compression).
 	Level zstd.EncoderLevel
+	// Filter, if set, is applied to every sample before training.
+	Filter SampleFilter `json:"-"`
+
+	// HashBytes is the shortest match, from 4 to 8 bytes, the trainer
+	// indexes (default: 6). Shorter lengths pick up the small repeated
+	// fields of binary formats such as protobuf; longer ones favour the
+	// words and phrases of text.
+	HashBytes int
+	// Raw builds a raw content dictionary, for WithRawDict, instead of a
+	// structured one. ID and Level are ignored.
+	Raw bool
+	// NoLegacyCompat lifts the restriction that keeps dictionaries usable
+	// by the reference zstd library up to v1.5.5, which mishandles some
+	// dictionaries (facebook/zstd#3724). Only set it when every peer
+	// decodes with a newer zstd or with this package.
+	NoLegacyCompat bool
+	// Output, if set, receives the trainer's progress messages.
+	Output io.Writer `json:"-"`
+
+	// Dedup drops repeated samples before training, so a few hot
+	// messages captured many times don't crowd out the rest.
+	Dedup bool
+	// Shuffle trains on the samples in an order shuffled with Seed,
+	// rather than the order given, so the dictionary doesn't depend on
+	// how the capture happened to be ordered.
+	Shuffle bool
+	// Seed seeds Shuffle; the same seed gives the same order.
+	Seed uint64
+
+	// Shards, if above 1, splits training for large corpora: a fifth of
+	// the samples, chosen with Seed, is held out, the rest are dealt
+	// round-robin into Shards parts trained concurrently, and the shard
+	// dictionaries and one merged from their content are compared on the
+	// holdout. The best is returned. Training time grows faster than linearly with
+	// the corpus, so this is much faster for 100k+ samples, usually at a
+	// small cost in ratio.
+	Shards int
+	// Workers bounds how many shards train at once (default: GOMAXPROCS).
+	Workers int
+}
+
+// SampleFilter inspects a training sample before it is used, returning the
+// sample to train on, possibly a redacted copy, or false to drop it.
+// Dictionaries hold verbatim training bytes and are shipped to every peer,
+// so a filter is the place to strip credentials and personal data. Filters
+// must not modify the sample in place.
+type SampleFilter func(sample []byte) ([]byte, bool)
+
+// RedactFilter returns a SampleFilter that overwrites every match of the
+// patterns with '*' bytes of the same length, so the surrounding structure
+// the dictionary learns from is kept.
+func RedactFilter(patterns ...*regexp.Regexp) SampleFilter {
+	return func(sample []byte) ([]byte, bool) {
+		var out []byte
+		for _, re := range patterns {
+			src := sample
+			if out != nil {
+				src = out
+			}
+			for _, m := range re.FindAllIndex(src, -1) {
+				if out == nil {
+					out = bytes.Clone(sample)
+				}
+				for i := m[0]; i < m[1]; i++ {
+					out[i] = '*'
+				}
+			}
+		}
+		if out == nil {
+			return sample, true
+		}
+		return out, true
+	}
+}
+
+// FilterSamples applies filter to samples, returning the kept samples. A
+// nil filter returns samples unchanged.
+func FilterSamples(samples [][]byte, filter SampleFilter) [][]byte {
+	if filter == nil {
+		return samples
+	}
+	kept := make([][]byte, 0, len(samples))
+	for _, s := range samples {
+		if s, ok := filter(s); ok {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// DedupSamples returns samples with repeats removed, keeping the first
+// occurrence of each.
+func DedupSamples(samples [][]byte) [][]byte {
+	seen := make(map[string]struct{}, len(samples))
+	kept := make([][]byte, 0, len(samples))
+	for _, s := range samples {
+		if _, ok := seen[string(s)]; ok {
+			continue
+		}
+		seen[string(s)] = struct{}{}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// shuffleSamples returns a copy of samples in an order given by seed.
+func shuffleSamples(samples [][]byte, seed uint64) [][]byte {
+	samples = slices.Clone(samples)
+	r := rand.New(rand.NewPCG(seed, 0))
+	r.Shuffle(len(samples), func(i, j int) { samples[i], samples[j] = samples[j], samples[i] })
+	return samples
 }
 
 // TrainDict trains a zstd dictionary from the provided samples.
@@ -28,6 +151,20 @@ func TrainDict(samples [][]byte, opts *TrainDictOptions) ([]byte, error) {
 	if len(samples) == 0 {
 		return nil, errors.New("no samples provided for training")
 	}
+	if opts != nil && opts.Filter != nil {
+		if samples = FilterSamples(samples, opts.Filter); len(samples) == 0 {
+			return nil, errors.New("no samples left for training after filtering")
+		}
+	}
+	if opts != nil && opts.Dedup {
+		samples = DedupSamples(samples)
+	}
+	if opts != nil && opts.Shuffle {
+		samples = shuffleSamples(samples, opts.Seed)
+	}
+	if opts != nil && opts.Shards > 1 {
+		return trainShards(samples, opts)
+	}
 
 	dictOpts := dict.Options{
 		HashBytes:      6,
@@ -38,20 +175,97 @@ func TrainDict(samples [][]byte, opts *TrainDictOptions) ([]byte, error) {
 		if opts.MaxDictSize > 0 {
 			dictOpts.MaxDictSize = opts.MaxDictSize
 		}
+		if opts.HashBytes != 0 {
+			if opts.HashBytes < 4 || opts.HashBytes > 8 {
+				return nil, fmt.Errorf("zstddict: hash bytes must be from 4 to 8, got %d", opts.HashBytes)
+			}
+			dictOpts.HashBytes = opts.HashBytes
+		}
 		dictOpts.ZstdDictID = opts.ID
 		dictOpts.ZstdLevel = opts.Level
+		dictOpts.ZstdDictCompat = !opts.NoLegacyCompat
+		dictOpts.Output = opts.Output
 	}
 
 	if dictOpts.MaxDictSize == 0 {
 		dictOpts.MaxDictSize = 32 * 1024 // 32KB default
 	}
 
+	if opts != nil && opts.Raw {
+		return dict.BuildRawDict(samples, dictOpts)
+	}
+	if opts != nil && opts.ContentID {
+		// Any fixed ID will do; it is replaced below.
+		dictOpts.ZstdDictID = minStructuredDictID
+		d, err := dict.BuildZstdDict(samples, dictOpts)
+		if err != nil {
+			return nil, err
+		}
+		// Everything after the ID determines the dictionary.
+		binary.LittleEndian.PutUint32(d[4:], contentDictID(d[8:]))
+		return d, nil
+	}
 	return dict.BuildZstdDict(samples, dictOpts)
 }
 
-// TrainDictFromFiles trains a dictionary from all files in the given directory.
-// It reads each file as a sample for training.
-func TrainDictFromFiles(dir string, opts *TrainDictOptions) ([]byte, error) {
+// FileOptions selects the files TrainDictFromFiles reads.
+type FileOptions struct {
+	// Patterns, if set, are filepath.Match patterns such as "*.json", at
+	// least one of which a file's base name must match.
+	Patterns []string
+	// Extensions, if set, lists the file extensions to read, such as
+	// ".json", and ExcludeExtensions those to skip. Both are compared
+	// case-insensitively.
+	Extensions        []string
+	ExcludeExtensions []string
+	// MaxFileSize skips files larger than this many bytes; 0 means no
+	// limit.
+	MaxFileSize int64
+	// MaxSamples stops the walk after this many files; 0 means no limit.
+	MaxSamples int
+	// MaxDepth limits how deep the walk descends: 1 reads only the files
+	// directly in the directory. 0 means no limit.
+	MaxDepth int
+}
+
+// match reports whether the file name passes the pattern and extension
+// filters.
+func (o *FileOptions) match(name string) (bool, error) {
+	ext := filepath.Ext(name)
+	if len(o.Extensions) > 0 && !slices.ContainsFunc(o.Extensions, func(e string) bool { return strings.EqualFold(e, ext) }) {
+		return false, nil
+	}
+	if slices.ContainsFunc(o.ExcludeExtensions, func(e string) bool { return strings.EqualFold(e, ext) }) {
+		return false, nil
+	}
+	if len(o.Patterns) == 0 {
+		return true, nil
+	}
+	for _, p := range o.Patterns {
+		if ok, err := filepath.Match(p, name); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// TrainDictFromFiles trains a dictionary from the files in the given
+// directory and its subdirectories, reading each file as a sample. files
+// selects the files to read; nil reads every one, which is only safe for
+// directories known to hold nothing but small samples.
+func TrainDictFromFiles(dir string, opts *TrainDictOptions, files *FileOptions) ([]byte, error) {
+	samples, err := readSampleFiles(dir, files)
+	if err != nil {
+		return nil, err
+	}
+	return TrainDict(samples, opts)
+}
+
+// readSampleFiles reads the files under dir that files selects.
+func readSampleFiles(dir string, files *FileOptions) ([][]byte, error) {
+	if files == nil {
+		files = &FileOptions{}
+	}
 	var samples [][]byte
 
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
@@ -59,8 +273,26 @@ func TrainDictFromFiles(dir string, opts *TrainDictOptions) ([]byte, error) {
 			return err
 		}
 		if d.IsDir() {
+			if files.MaxDepth > 0 && path != dir {
+				rel, err := filepath.Rel(dir, path)
+				if err == nil && strings.Count(rel, string(filepath.Separator))+1 >= files.MaxDepth {
+					return filepath.SkipDir
+				}
+			}
 			return nil
 		}
+		if ok, err := files.match(d.Name()); !ok || err != nil {
+			return err
+		}
+		if files.MaxFileSize > 0 {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() > files.MaxFileSize {
+				return nil
+			}
+		}
 
 		data, err := os.ReadFile(path)
 		if err != nil {
@@ -68,13 +300,15 @@ func TrainDictFromFiles(dir string, opts *TrainDictOptions) ([]byte, error) {
 		}
 
 		samples = append(samples, data)
+		if files.MaxSamples > 0 && len(samples) >= files.MaxSamples {
+			return filepath.SkipAll
+		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	return TrainDict(samples, opts)
+	return samples, nil
 }
 
 // TrainDictFromReader trains a dictionary from samples read from individual byte slices.
@@ -0,0 +1,222 @@
+package zstddict
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestTrainDict_Filter(t *testing.T) {
+	samples := generateSampleData(200)
+	for i := range samples {
+		token := fmt.Sprintf(" token=sk_live_%08d\n", i)
+		samples[i] = append(bytes.Repeat([]byte(token), 3), samples[i]...)
+	}
+	secret := regexp.MustCompile(`sk_live_[0-9]+`)
+
+	dict, err := TrainDict(samples, &TrainDictOptions{Filter: RedactFilter(secret)})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if secret.Match(dict) {
+		t.Error("dictionary contains a redacted token")
+	}
+	if !bytes.Contains(samples[0], []byte("sk_live_00000000")) {
+		t.Error("filter modified the caller's sample")
+	}
+
+	drop := func([]byte) ([]byte, bool) { return nil, false }
+	if _, err := TrainDict(samples, &TrainDictOptions{Filter: drop}); err == nil {
+		t.Error("TrainDict() with every sample dropped succeeded")
+	}
+
+	kept := FilterSamples(samples, func(s []byte) ([]byte, bool) { return s, bytes.Contains(s, []byte("_0000001")) })
+	if len(kept) != 10 {
+		t.Errorf("FilterSamples() kept %d samples, want 10", len(kept))
+	}
+}
+
+func TestTrainDict_Knobs(t *testing.T) {
+	samples := generateSampleData(200)
+	for _, hashBytes := range []int{4, 8} {
+		dict, err := TrainDict(samples, &TrainDictOptions{HashBytes: hashBytes, NoLegacyCompat: true})
+		if err != nil {
+			t.Fatalf("HashBytes %d: TrainDict() error = %v", hashBytes, err)
+		}
+		if _, err := New(WithDictBytes(dict)); err != nil {
+			t.Errorf("HashBytes %d: New() error = %v", hashBytes, err)
+		}
+	}
+	if _, err := TrainDict(samples, &TrainDictOptions{HashBytes: 3}); err == nil {
+		t.Error("TrainDict() accepted HashBytes 3")
+	}
+
+	var progress bytes.Buffer
+	raw, err := TrainDict(samples, &TrainDictOptions{Raw: true, Output: &progress})
+	if err != nil {
+		t.Fatalf("Raw: TrainDict() error = %v", err)
+	}
+	if DetectDictFormat(raw) != FormatRaw {
+		t.Error("Raw: TrainDict() returned a structured dictionary")
+	}
+	if progress.Len() == 0 {
+		t.Error("Output received no progress messages")
+	}
+	c, err := New(WithRawDict(1, raw))
+	if err != nil {
+		t.Fatalf("New(WithRawDict) error = %v", err)
+	}
+	frame, _ := c.Compress(samples[0])
+	if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, samples[0]) {
+		t.Errorf("raw dictionary round trip = %v", err)
+	}
+}
+
+func TestTrainDict_DedupShuffle(t *testing.T) {
+	samples := generateSampleData(100)
+	unique := len(DedupSamples(samples))
+	hot := samples[0]
+	for range 400 {
+		samples = append(samples, hot)
+	}
+	if got := DedupSamples(samples); len(got) != unique {
+		t.Errorf("DedupSamples() kept %d samples, want %d", len(got), unique)
+	}
+
+	order := slices.Clone(samples)
+	a, b := shuffleSamples(samples, 7), shuffleSamples(samples, 7)
+	if !slices.EqualFunc(a, b, bytes.Equal) {
+		t.Error("shuffleSamples() with the same seed gave different orders")
+	}
+	if slices.EqualFunc(a, shuffleSamples(samples, 8), bytes.Equal) {
+		t.Error("shuffleSamples() with different seeds gave the same order")
+	}
+	for i := range samples {
+		if &samples[i][0] != &order[i][0] {
+			t.Fatal("shuffleSamples() reordered the caller's samples")
+		}
+	}
+
+	if _, err := TrainDict(samples, &TrainDictOptions{Dedup: true, Shuffle: true, Seed: 7}); err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+}
+
+func TestTrainDictFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i, sample := range generateSampleData(150) {
+		sub := dir
+		if i%3 == 0 {
+			sub = filepath.Join(dir, "nested", "deeper")
+		}
+		ext := ".json"
+		if i%5 == 0 {
+			ext = ".LOG"
+		}
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("s%03d%s", i, ext)), sample, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "huge.json"), bytes.Repeat([]byte("x"), 1<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		files *FileOptions
+		want  int
+	}{
+		{"all", nil, 151},
+		{"size", &FileOptions{MaxFileSize: 64 << 10}, 150},
+		{"extensions", &FileOptions{Extensions: []string{".log"}}, 30},
+		{"exclude", &FileOptions{ExcludeExtensions: []string{".log"}, MaxFileSize: 64 << 10}, 120},
+		{"patterns", &FileOptions{Patterns: []string{"s00*", "s01*"}}, 20},
+		{"depth", &FileOptions{MaxDepth: 1}, 101},
+		{"max samples", &FileOptions{MaxSamples: 40}, 40},
+	} {
+		samples, err := readSampleFiles(dir, tt.files)
+		if err != nil {
+			t.Fatalf("%s: readSampleFiles() error = %v", tt.name, err)
+		}
+		if len(samples) != tt.want {
+			t.Errorf("%s: read %d files, want %d", tt.name, len(samples), tt.want)
+		}
+	}
+
+	if _, err := TrainDictFromFiles(dir, nil, &FileOptions{MaxFileSize: 64 << 10}); err != nil {
+		t.Fatalf("TrainDictFromFiles() error = %v", err)
+	}
+	if _, err := TrainDictFromFiles(dir, nil, &FileOptions{Patterns: []string{"["}}); err == nil {
+		t.Error("TrainDictFromFiles() accepted a malformed pattern")
+	}
+}
+
+func TestTrainDict_ContentID(t *testing.T) {
+	samples := generateSampleData(200)
+	dict, err := TrainDict(samples, &TrainDictOptions{ID: 1001, ContentID: true})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	id, err := DictID(dict)
+	if err != nil {
+		t.Fatalf("DictID() error = %v", err)
+	}
+	if id == 1001 || id < minStructuredDictID {
+		t.Errorf("DictID() = %d, want an ID derived from the content", id)
+	}
+	if want := contentDictID(dict[8:]); id != want {
+		t.Errorf("DictID() = %d, want %d", id, want)
+	}
+
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	frame, _ := c.Compress(samples[0])
+	var h zstd.Header
+	if err := h.Decode(frame); err != nil || h.DictionaryID != id {
+		t.Errorf("frame dictionary ID = %d, %v; want %d", h.DictionaryID, err, id)
+	}
+	if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, samples[0]) {
+		t.Errorf("round trip error = %v", err)
+	}
+}
+
+func TestTrainDict_Shards(t *testing.T) {
+	samples := generateSampleData(1000)
+	dict, err := TrainDict(samples, &TrainDictOptions{MaxDictSize: 8 << 10, ID: 7007, Shards: 4, Workers: 2})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if err := ValidateDict(dict); err != nil {
+		t.Fatalf("ValidateDict() error = %v", err)
+	}
+	if id, _ := DictID(dict); id != 7007 {
+		t.Errorf("DictID() = %d, want 7007", id)
+	}
+
+	train, test := SplitSamples(samples, 1-shardHoldout, 0)
+	merged, err := mergeShardDicts([][]byte{dict, dict}, train, &TrainDictOptions{MaxDictSize: 8 << 10})
+	if err != nil {
+		t.Fatalf("mergeShardDicts() error = %v", err)
+	}
+	if len(merged) > 8<<10 {
+		t.Errorf("merged dictionary is %d bytes, over the 8 KiB limit", len(merged))
+	}
+	if r, err := EvaluateDict(merged, test, nil); err != nil || r.Dict >= r.Plain {
+		t.Errorf("merged dictionary: EvaluateDict() = %+v, %v", r, err)
+	}
+
+	if _, err := TrainDict(samples[:3], &TrainDictOptions{Shards: 8}); err == nil {
+		t.Error("TrainDict() split 3 samples into 8 shards")
+	}
+}
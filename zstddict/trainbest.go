@@ -0,0 +1,151 @@
+package zstddict
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultSweepSizes are the dictionary sizes TrainBest tries by default.
+var defaultSweepSizes = []int{2 << 10, 8 << 10, 16 << 10, 32 << 10, 64 << 10}
+
+// TrainBestOptions configures TrainBest.
+type TrainBestOptions struct {
+	// Sizes are the MaxDictSize values to try. If nil, 2, 8, 16, 32 and
+	// 64 KiB are tried.
+	Sizes []int
+	// Holdout is the fraction of samples held out from training to
+	// evaluate on (default: 0.2). The split is made by SplitSamples
+	// seeded with Train.Seed, so it is reproducible.
+	Holdout float64
+	// Messages, if set, charges each candidate for shipping its
+	// dictionary once per Messages messages: candidates are scored by
+	// the bytes Messages holdout-sized messages would take plus the
+	// dictionary size. Otherwise they are scored by the compressed size
+	// of the holdout alone.
+	Messages int
+	// Train configures training; its MaxDictSize is replaced by each of
+	// Sizes in turn.
+	Train TrainDictOptions
+	// Evaluate configures evaluation on the holdout.
+	Evaluate EvaluateOptions
+}
+
+// Candidate is a dictionary TrainBest trained.
+type Candidate struct {
+	// Size is the MaxDictSize the dictionary was trained with.
+	Size int
+	// Dict is the dictionary, nil if training failed.
+	Dict []byte
+	// Report is the evaluation of Dict on the holdout.
+	Report *EvalReport
+	// Score is the number of bytes the candidate is ranked by, lower
+	// being better.
+	Score float64
+	// Err is the error training or evaluation failed with.
+	Err error
+}
+
+// TrainBestResult holds the candidates TrainBest compared.
+type TrainBestResult struct {
+	// Best is the index of the winning candidate.
+	Best int
+	// Candidates are in the order of TrainBestOptions.Sizes.
+	Candidates []Candidate
+	// TrainSamples and HoldoutSamples count the samples of each split.
+	TrainSamples, HoldoutSamples int
+}
+
+// Dict returns the winning dictionary.
+func (r *TrainBestResult) Dict() []byte {
+	return r.Candidates[r.Best].Dict
+}
+
+// WriteText writes a table comparing the candidates to w.
+func (r *TrainBestResult) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "max size\tdict bytes\tplain ratio\tdict ratio\timprovement\tbreak-even\tscore\t")
+	for i, c := range r.Candidates {
+		if c.Err != nil {
+			fmt.Fprintf(tw, "%d\t-\t-\t-\t-\t-\t-\t  %s\n", c.Size, c.Err)
+			continue
+		}
+		mark := ""
+		if i == r.Best {
+			mark = "  best"
+		}
+		rep := c.Report
+		fmt.Fprintf(tw, "%d\t%d\t%.1f%%\t%.1f%%\t%+.1f%%\t%d\t%.0f\t%s\n",
+			c.Size, rep.DictSize, rep.PlainRatio*100, rep.DictRatio*100, rep.Improvement(), rep.BreakEven, c.Score, mark)
+	}
+	return tw.Flush()
+}
+
+// String returns the text table.
+func (r *TrainBestResult) String() string {
+	var sb strings.Builder
+	r.WriteText(&sb)
+	return sb.String()
+}
+
+// TrainBest trains a dictionary at each of several sizes, evaluates each
+// on samples held out from training, and returns them all with the best
+// marked. Ties go to the smaller dictionary. opts may be nil. It fails
+// only if every candidate does.
+func TrainBest(samples [][]byte, opts *TrainBestOptions) (*TrainBestResult, error) {
+	if opts == nil {
+		opts = &TrainBestOptions{}
+	}
+	sizes, holdout := opts.Sizes, opts.Holdout
+	if sizes == nil {
+		sizes = defaultSweepSizes
+	}
+	if holdout == 0 {
+		holdout = 0.2
+	}
+	if holdout <= 0 || holdout >= 1 {
+		return nil, fmt.Errorf("zstddict: holdout fraction must be between 0 and 1, got %g", holdout)
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("zstddict: no dictionary sizes to try")
+	}
+	if opts.Train.Filter != nil {
+		samples = FilterSamples(samples, opts.Train.Filter)
+	}
+
+	train, test := SplitSamples(samples, 1-holdout, opts.Train.Seed)
+	if len(train) == 0 || len(test) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	res := &TrainBestResult{Best: -1, TrainSamples: len(train), HoldoutSamples: len(test)}
+	trainOpts := opts.Train
+	trainOpts.Filter = nil
+	for _, size := range sizes {
+		c := Candidate{Size: size}
+		trainOpts.MaxDictSize = size
+		c.Dict, c.Err = TrainDict(train, &trainOpts)
+		if c.Err == nil {
+			c.Report, c.Err = EvaluateDict(c.Dict, test, &opts.Evaluate)
+		}
+		if c.Err != nil {
+			c.Dict = nil
+		} else {
+			c.Score = float64(c.Report.Dict)
+			if opts.Messages > 0 {
+				c.Score = c.Score/float64(len(test))*float64(opts.Messages) + float64(len(c.Dict))
+			}
+			if best := res.Best; best < 0 || c.Score < res.Candidates[best].Score ||
+				c.Score == res.Candidates[best].Score && len(c.Dict) < len(res.Candidates[best].Dict) {
+				res.Best = len(res.Candidates)
+			}
+		}
+		res.Candidates = append(res.Candidates, c)
+	}
+	if res.Best < 0 {
+		return nil, fmt.Errorf("zstddict: no candidate dictionary trained: %w", res.Candidates[0].Err)
+	}
+	return res, nil
+}
@@ -0,0 +1,55 @@
+package zstddict
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrainBest(t *testing.T) {
+	samples := generateSampleData(400)
+	sizes := []int{1 << 10, 4 << 10, 16 << 10}
+	res, err := TrainBest(samples, &TrainBestOptions{Sizes: sizes, Holdout: 0.25, Train: TrainDictOptions{ID: 1234}})
+	if err != nil {
+		t.Fatalf("TrainBest() error = %v", err)
+	}
+	if res.TrainSamples != 300 || res.HoldoutSamples != 100 {
+		t.Errorf("split = %d/%d, want 300/100", res.TrainSamples, res.HoldoutSamples)
+	}
+	if len(res.Candidates) != len(sizes) {
+		t.Fatalf("got %d candidates, want %d", len(res.Candidates), len(sizes))
+	}
+	best := res.Candidates[res.Best]
+	for i, c := range res.Candidates {
+		if c.Err != nil {
+			t.Errorf("candidate %d error = %v", c.Size, c.Err)
+			continue
+		}
+		if c.Score < best.Score {
+			t.Errorf("candidate %d scored %.0f, better than best %.0f", i, c.Score, best.Score)
+		}
+	}
+	if id, err := DictID(res.Dict()); err != nil || id != 1234 {
+		t.Errorf("DictID(best) = %d, %v; want 1234", id, err)
+	}
+
+	table := res.String()
+	if !strings.Contains(table, "best") || strings.Count(table, "\n") != len(sizes)+1 {
+		t.Errorf("table:\n%s", table)
+	}
+
+	// With Messages, each candidate is charged for its dictionary.
+	res, err = TrainBest(samples, &TrainBestOptions{Sizes: sizes, Messages: 10})
+	if err != nil {
+		t.Fatalf("TrainBest() error = %v", err)
+	}
+	for _, c := range res.Candidates {
+		want := float64(c.Report.Dict)/float64(res.HoldoutSamples)*10 + float64(len(c.Dict))
+		if c.Score != want {
+			t.Errorf("candidate %d: Score = %.1f, want %.1f", c.Size, c.Score, want)
+		}
+	}
+
+	if _, err := TrainBest(samples, &TrainBestOptions{Holdout: 1}); err == nil {
+		t.Error("TrainBest() accepted a holdout fraction of 1")
+	}
+}
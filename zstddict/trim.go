@@ -0,0 +1,151 @@
+package zstddict
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Trimming works on fixed-size segments of the dictionary content, scored
+// by how often their trimGram-byte substrings occur in the samples.
+const (
+	trimSegment = 64
+	trimGram    = 8
+)
+
+// ErrNoSamples is returned by TrimDict when no samples are given.
+var ErrNoSamples = errors.New("zstddict: no samples provided")
+
+// TrimDict shrinks dict to at most targetSize bytes, keeping the parts of
+// its content that matter most for samples. Content is split into 64-byte
+// segments, and segments are chosen greedily by how many sample bytes they
+// can match that earlier choices don't already cover; the survivors keep
+// their original order, so the most valuable content stays nearest the
+// end of the history where offsets are cheapest.
+//
+// A structured dictionary gets new entropy tables computed from samples
+// and a new ID derived from its content, since its content no longer
+// matches the original's. A raw dictionary stays raw. A dictionary already
+// within targetSize is returned unchanged.
+func TrimDict(dict []byte, targetSize int, samples [][]byte) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, ErrNoSamples
+	}
+	if len(dict) <= targetSize {
+		return dict, nil
+	}
+
+	structured := DetectDictFormat(dict) == FormatStructured
+	content := dict
+	if structured {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, err
+		}
+		content = d.Content()
+	}
+
+	order := rankSegments(content, samples, targetSize)
+	budget := targetSize
+	for range 4 {
+		trimmed := assembleSegments(content, order, budget)
+		if !structured {
+			return trimmed, nil
+		}
+		if len(trimmed) < trimGram {
+			break
+		}
+		out, err := ConvertDict(trimmed, FormatStructured, &ConvertDictOptions{Corpus: samples})
+		if err != nil {
+			return nil, err
+		}
+		if len(out) <= targetSize {
+			return out, nil
+		}
+		// Shrink the content by however much the header and tables
+		// overshot.
+		budget -= len(out) - targetSize
+	}
+	return nil, fmt.Errorf("zstddict: target size %d is too small for a structured dictionary", targetSize)
+}
+
+// rankSegments returns the indexes of content's segments in the order
+// they should be kept, stopping once limit bytes are ranked.
+func rankSegments(content []byte, samples [][]byte, limit int) []int {
+	nseg := (len(content) + trimSegment - 1) / trimSegment
+	segGrams := make([][]uint64, nseg)
+	inContent := make(map[uint64]int)
+	for i := range nseg {
+		start := i * trimSegment
+		end := min(start+trimSegment+trimGram-1, len(content))
+		for p := start; p+trimGram <= end; p++ {
+			g := binary.LittleEndian.Uint64(content[p:])
+			segGrams[i] = append(segGrams[i], g)
+			inContent[g] = 0
+		}
+		slices.Sort(segGrams[i])
+		segGrams[i] = slices.Compact(segGrams[i])
+	}
+
+	// Count sample occurrences of the grams the content can supply.
+	for _, s := range samples {
+		for p := 0; p+trimGram <= len(s); p++ {
+			g := binary.LittleEndian.Uint64(s[p:])
+			if n, ok := inContent[g]; ok {
+				inContent[g] = n + 1
+			}
+		}
+	}
+
+	covered := make(map[uint64]bool)
+	order := make([]int, 0, nseg)
+	taken := make([]bool, nseg)
+	for size := 0; size < limit && len(order) < nseg; size += trimSegment {
+		best, bestGain := -1, -1
+		for i, grams := range segGrams {
+			if taken[i] {
+				continue
+			}
+			gain := 0
+			for _, g := range grams {
+				if !covered[g] {
+					gain += inContent[g]
+				}
+			}
+			if gain > bestGain {
+				best, bestGain = i, gain
+			}
+		}
+		taken[best] = true
+		order = append(order, best)
+		for _, g := range segGrams[best] {
+			covered[g] = true
+		}
+	}
+	return order
+}
+
+// assembleSegments concatenates, in content order, the highest ranked
+// segments that fit in budget bytes.
+func assembleSegments(content []byte, order []int, budget int) []byte {
+	var keep []int
+	size := 0
+	for _, i := range order {
+		n := min(trimSegment, len(content)-i*trimSegment)
+		if size+n > budget {
+			continue
+		}
+		keep = append(keep, i)
+		size += n
+	}
+	slices.Sort(keep)
+
+	out := make([]byte, 0, size)
+	for _, i := range keep {
+		out = append(out, content[i*trimSegment:min((i+1)*trimSegment, len(content))]...)
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestTrimDict(t *testing.T) {
+	// A 16KB dictionary whose content is mostly noise, with the useful
+	// part, taken from the samples, in the middle.
+	samples := generateSampleData(150)
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(rng.Uint32())
+		}
+		return b
+	}
+	content := noise(6 * 1024)
+	for _, s := range samples {
+		if len(content) >= 10*1024 {
+			break
+		}
+		content = append(content, s...)
+	}
+	content = append(content, noise(6*1024)...)
+	dict, err := ConvertDict(content, FormatStructured, &ConvertDictOptions{Corpus: samples, ID: 4242})
+	if err != nil {
+		t.Fatalf("ConvertDict() error = %v", err)
+	}
+
+	trimmed, err := TrimDict(dict, 4096, samples)
+	if err != nil {
+		t.Fatalf("TrimDict() error = %v", err)
+	}
+	if len(trimmed) > 4096 {
+		t.Errorf("len(trimmed) = %d, want <= 4096", len(trimmed))
+	}
+	d, err := zstd.InspectDictionary(trimmed)
+	if err != nil {
+		t.Fatalf("trimmed dictionary is invalid: %v", err)
+	}
+	if d.ID() == 4242 {
+		t.Error("trimmed dictionary kept the original ID")
+	}
+
+	c, err := New(WithDictBytes(trimmed))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	plain, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	var withDict, without int
+	for _, s := range samples[:100] {
+		compressed, err := c.Compress(s)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, s) {
+			t.Fatalf("round trip with trimmed dictionary failed: %v", err)
+		}
+		withDict += len(compressed)
+		p, _ := plain.Compress(s)
+		without += len(p)
+	}
+	if withDict >= without {
+		t.Errorf("trimmed dictionary output %d bytes, no dictionary %d; want an improvement", withDict, without)
+	}
+
+	raw, _ := ConvertDict(dict, FormatRaw, nil)
+	trimmedRaw, err := TrimDict(raw, 2048, samples)
+	if err != nil || len(trimmedRaw) > 2048 || DetectDictFormat(trimmedRaw) != FormatRaw {
+		t.Errorf("TrimDict(raw) = %d bytes, %v; want raw content <= 2048 bytes", len(trimmedRaw), err)
+	}
+
+	if same, err := TrimDict(dict, len(dict), samples); err != nil || !bytes.Equal(same, dict) {
+		t.Errorf("TrimDict() within target changed the dictionary (err = %v)", err)
+	}
+	if _, err := TrimDict(dict, 4096, nil); !errors.Is(err, ErrNoSamples) {
+		t.Errorf("TrimDict() without samples error = %v, want ErrNoSamples", err)
+	}
+}
@@ -0,0 +1,168 @@
+package zstddict
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/xxhash"
+)
+
+// ErrIntegrity is matched by errors from DecompressValidate reporting
+// output that does not agree with what its frames declare. The concrete
+// error is an *IntegrityError.
+var ErrIntegrity = errors.New("zstddict: integrity check failed")
+
+// IntegrityCheck identifies the check an IntegrityError failed.
+type IntegrityCheck int
+
+const (
+	// CheckFraming fails when the input is not a complete sequence of
+	// frames, such as when it was truncated.
+	CheckFraming IntegrityCheck = iota
+	// CheckContentSize fails when a frame's output length differs from
+	// the content size in its header.
+	CheckContentSize
+	// CheckFrameChecksum fails when a frame's output does not match the
+	// 32-bit checksum zstd stores at the end of the frame.
+	CheckFrameChecksum
+	// CheckContentChecksum fails when a frame's output does not match a
+	// ChecksumFrame trailer.
+	CheckContentChecksum
+)
+
+// String returns the check name.
+func (k IntegrityCheck) String() string {
+	switch k {
+	case CheckFraming:
+		return "framing"
+	case CheckContentSize:
+		return "content size"
+	case CheckFrameChecksum:
+		return "frame checksum"
+	case CheckContentChecksum:
+		return "content checksum"
+	default:
+		return fmt.Sprintf("check(%d)", int(k))
+	}
+}
+
+// IntegrityError reports a frame whose output failed a DecompressValidate
+// check. It matches ErrIntegrity.
+type IntegrityError struct {
+	// Frame is the index of the failing frame, as split by SplitFrames.
+	Frame int
+	// Check is the check that failed.
+	Check IntegrityCheck
+	// Declared and Actual are the expected and observed content size or
+	// checksum. Both are 0 for framing failures.
+	Declared uint64
+	Actual   uint64
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *IntegrityError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("zstddict: frame %d: %s check failed: %v", e.Frame, e.Check, e.Err)
+	case e.Check == CheckContentSize:
+		return fmt.Sprintf("zstddict: frame %d: declares %d bytes of content, decoded %d", e.Frame, e.Declared, e.Actual)
+	default:
+		return fmt.Sprintf("zstddict: frame %d: %s mismatch: declared %#x, computed %#x", e.Frame, e.Check, e.Declared, e.Actual)
+	}
+}
+
+// Is reports whether target is ErrIntegrity.
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+// Unwrap returns the underlying error.
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// DecompressValidate is like Decompress, but cross-checks every frame's
+// output against the content size declared in its header, the checksum
+// zstd stores at its end and any ChecksumFrame trailer, failing with an
+// *IntegrityError on the first disagreement. Input that ends mid-frame or
+// holds no frames at all fails too. Checks a frame does not carry are
+// skipped, so producers should enable them (WithSmallMessages always
+// records the content size) where silent truncation is worse than failure.
+func (c *Compressor) DecompressValidate(data []byte) ([]byte, error) {
+	frames, err := SplitFrames(data)
+	if err != nil {
+		return nil, &IntegrityError{Check: CheckFraming, Err: err}
+	}
+	if len(frames) == 0 {
+		return nil, &IntegrityError{Check: CheckFraming, Err: errors.New("no frames")}
+	}
+
+	out := c.getBuffer()
+	for i, f := range frames {
+		start := len(out)
+		if out, err = c.decompressTo(unlabeled, out, f, decodeLimits{}); err != nil {
+			return nil, integrityError(i, err)
+		}
+		if err := validateFrame(f, out[start:]); err != nil {
+			err.Frame = i
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// validateFrame checks content against the declarations of frame, a slice
+// returned by SplitFrames.
+func validateFrame(frame, content []byte) *IntegrityError {
+	// Skip any leading skippable frames; SplitFrames has already checked
+	// the framing.
+	pos := 0
+	for pos < len(frame) {
+		n, skippable, _ := frameSize(frame[pos:])
+		if !skippable {
+			break
+		}
+		pos += n
+	}
+	if pos == len(frame) {
+		return &IntegrityError{Check: CheckFraming, Err: errors.New("only skippable frames")}
+	}
+	n, _, _ := frameSize(frame[pos:])
+	var h zstd.Header
+	if err := h.Decode(frame[pos:]); err != nil {
+		return &IntegrityError{Check: CheckFraming, Err: err}
+	}
+
+	if h.HasFCS && h.FrameContentSize != uint64(len(content)) {
+		return &IntegrityError{Check: CheckContentSize, Declared: h.FrameContentSize, Actual: uint64(len(content))}
+	}
+	if h.HasCheckSum {
+		declared := binary.LittleEndian.Uint32(frame[pos+n-4:])
+		if actual := uint32(xxhash.Sum64(content)); actual != declared {
+			return &IntegrityError{Check: CheckFrameChecksum, Declared: uint64(declared), Actual: uint64(actual)}
+		}
+	}
+	if declared, ok := frameChecksum(frame); ok {
+		if actual := xxhash.Sum64(content); actual != declared {
+			return &IntegrityError{Check: CheckContentChecksum, Declared: declared, Actual: actual}
+		}
+	}
+	return nil
+}
+
+// integrityError converts decoder errors that signal an integrity failure
+// into an *IntegrityError for frame i and passes others through.
+func integrityError(i int, err error) error {
+	switch {
+	case errors.Is(err, zstd.ErrFrameSizeMismatch):
+		return &IntegrityError{Frame: i, Check: CheckContentSize, Err: err}
+	case errors.Is(err, zstd.ErrCRCMismatch):
+		return &IntegrityError{Frame: i, Check: CheckFrameChecksum, Err: err}
+	case errors.Is(err, ErrChecksumMismatch):
+		return &IntegrityError{Frame: i, Check: CheckContentChecksum, Err: err}
+	}
+	return fmt.Errorf("zstddict: frame %d: %w", i, err)
+}
@@ -0,0 +1,66 @@
+package zstddict
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressor_DecompressValidate(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	a, b := []byte("first frame content, first frame content"), []byte("second frame")
+	fa, err := c.Compress(a)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	fb, err := c.Compress(b)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	got, err := c.DecompressValidate(ConcatFrames(ChecksumFrame(fa, a), fb))
+	if err != nil {
+		t.Fatalf("DecompressValidate() error = %v", err)
+	}
+	if want := append(bytes.Clone(a), b...); !bytes.Equal(got, want) {
+		t.Errorf("DecompressValidate() = %q, want %q", got, want)
+	}
+
+	badFCS := AppendStoredFrame(nil, []byte("short"))
+	badFCS[5] = 9 // declare 9 bytes of content instead of 5
+	badCRC := bytes.Clone(fb)
+	badCRC[len(badCRC)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want IntegrityCheck
+	}{
+		{"empty", nil, CheckFraming},
+		{"truncated", ConcatFrames(fa, fb[:len(fb)-2]), CheckFraming},
+		{"content size", badFCS, CheckContentSize},
+		{"frame checksum", ConcatFrames(fa, badCRC), CheckFrameChecksum},
+		{"content checksum", ChecksumFrame(bytes.Clone(fa), b), CheckContentChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.DecompressValidate(tt.data)
+			if !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("DecompressValidate() error = %v, want ErrIntegrity", err)
+			}
+			var ie *IntegrityError
+			if !errors.As(err, &ie) || ie.Check != tt.want {
+				t.Errorf("DecompressValidate() error = %v, want %s check", err, tt.want)
+			}
+		})
+	}
+
+	// Plain Decompress accepts the content checksum mismatch it doesn't
+	// look for.
+	if _, err := c.Decompress(ChecksumFrame(bytes.Clone(fa), b)); err != nil {
+		t.Errorf("Decompress() error = %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package zstddict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrInvalidDict is matched by errors from ValidateDict. The concrete
+// error is a *DictError.
+var ErrInvalidDict = errors.New("zstddict: invalid dictionary")
+
+// DictProblem identifies the part of a dictionary a DictError found fault
+// with.
+type DictProblem int
+
+const (
+	// DictEmpty fails an empty dictionary.
+	DictEmpty DictProblem = iota
+	// DictMagic fails data that does not start with the dictionary magic
+	// number, such as a raw content dictionary or a file of another kind.
+	DictMagic
+	// DictHeader fails a header whose dictionary ID is 0, which frames
+	// cannot refer to.
+	DictHeader
+	// DictTables fails entropy tables or repeat offsets that do not
+	// parse, as when the dictionary was truncated.
+	DictTables
+	// DictUnusable fails a dictionary that parses but that a frame
+	// compressed with it does not decompress correctly with.
+	DictUnusable
+)
+
+// String returns the problem name.
+func (p DictProblem) String() string {
+	switch p {
+	case DictEmpty:
+		return "empty"
+	case DictMagic:
+		return "magic number"
+	case DictHeader:
+		return "header"
+	case DictTables:
+		return "entropy tables"
+	case DictUnusable:
+		return "unusable"
+	default:
+		return fmt.Sprintf("problem(%d)", int(p))
+	}
+}
+
+// DictError reports a dictionary that failed ValidateDict. It matches
+// ErrInvalidDict.
+type DictError struct {
+	Problem DictProblem
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *DictError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("zstddict: invalid dictionary: %s", e.Problem)
+	}
+	return fmt.Sprintf("zstddict: invalid dictionary: %s: %v", e.Problem, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DictError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInvalidDict.
+func (e *DictError) Is(target error) bool {
+	return target == ErrInvalidDict
+}
+
+// ValidateDict checks that dict is a well-formed structured dictionary
+// before it is deployed: that it has the magic number and a usable ID,
+// that its entropy tables and repeat offsets parse, and that a probe
+// compressed with it round trips. Raw content dictionaries have no
+// structure to check and fail with DictMagic. Truncation that only
+// shortens the content goes unnoticed, as the format records no length;
+// the hash kept by SaveDictWithMeta catches it.
+func ValidateDict(dict []byte) error {
+	if len(dict) == 0 {
+		return &DictError{Problem: DictEmpty}
+	}
+	if DetectDictFormat(dict) != FormatStructured {
+		return &DictError{Problem: DictMagic}
+	}
+	if binary.LittleEndian.Uint32(dict[4:]) == 0 {
+		return &DictError{Problem: DictHeader, Err: errors.New("dictionary ID is 0")}
+	}
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return &DictError{Problem: DictTables, Err: err}
+	}
+	if err := probeDict(dict, d.Content()); err != nil {
+		return &DictError{Problem: DictUnusable, Err: err}
+	}
+	return nil
+}
+
+// probeDict compresses a probe resembling content with dict and checks
+// that it decompresses to the same bytes.
+func probeDict(dict, content []byte) error {
+	probe := bytes.Repeat(content[max(0, len(content)-256):], 4)
+	probe = append(probe, "zstddict probe"...)
+
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	frame := enc.EncodeAll(probe, nil)
+	enc.Close()
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	got, err := dec.DecodeAll(frame, nil)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, probe) {
+		return errors.New("probe did not round trip")
+	}
+	return nil
+}
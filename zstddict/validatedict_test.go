@@ -0,0 +1,38 @@
+package zstddict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestValidateDict(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(200), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if err := ValidateDict(dict); err != nil {
+		t.Fatalf("ValidateDict() error = %v", err)
+	}
+
+	noID := bytes.Clone(dict)
+	binary.LittleEndian.PutUint32(noID[4:], 0)
+	for _, tt := range []struct {
+		name string
+		dict []byte
+		want DictProblem
+	}{
+		{"empty", nil, DictEmpty},
+		{"raw", []byte("just some content"), DictMagic},
+		{"short", dict[:6], DictMagic},
+		{"zero ID", noID, DictHeader},
+		{"truncated", dict[:40], DictTables},
+	} {
+		err := ValidateDict(tt.dict)
+		var de *DictError
+		if !errors.Is(err, ErrInvalidDict) || !errors.As(err, &de) || de.Problem != tt.want {
+			t.Errorf("%s: ValidateDict() error = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
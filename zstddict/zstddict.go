@@ -1,24 +1,219 @@
 // Package zstddict provides zstd compression with optional dictionary support.
 // It wraps github.com/klauspost/compress/zstd to provide a simple API for
 // compressing and decompressing data with pre-trained dictionaries.
+//
+// Simple callers can use the package-level Compress and Decompress, backed
+// by a shared default Compressor whose dictionary SetDefaultDict sets.
 package zstddict
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/internal/pool"
+	"github.com/paulstuart/zstd-dict/stats"
 )
 
 // Compressor provides zstd compression with optional dictionary support.
-// It maintains encoder and decoder pools for efficient reuse.
+// It maintains sharded encoder and decoder pools for efficient reuse.
+//
+// Configuration is fixed by New, except for the dictionary and the encoder
+// level, which SetDict and SetLevel change. The dictionary and the pools
+// built for it are published together as one immutable state before New
+// returns, and replaced as a whole by SetDict and SetLevel, so a
+// Compressor is safe for concurrent use from the start, and pooled
+// encoders and decoders can never observe a dictionary or level other than
+// the one they were built with.
 type Compressor struct {
+	name string
+
+	// dict is the dictionary set by options. It is only read by New; the
+	// live dictionary is held in state. rawDict marks it as raw content
+	// loaded with rawDictID.
+	dict      []byte
+	rawDict   bool
+	rawDictID uint32
+
+	// decodeDicts are other generations of the dictionary, accepted when
+	// decoding.
+	decodeDicts []dictRef
+
+	smallMessages bool
+	windowSize    int
+	longDistance  bool
+	strictDict    bool
+	checksums     bool
+	frameCRC      *bool
+	level         zstd.EncoderLevel
+	adaptive      *adaptiveLevel
+	levelPolicy   LevelPolicy
+	dictThreshold int
+	autoDict      bool
+	stored        bool
+
+	encoderConcurrency int
+	encoderLimit       *pool.Limit
+	encoderExtra       []zstd.EOption
+	decoderExtra       []zstd.DOption
+	decoderConcurrency int
+	decoderMaxMemory   uint64
+	decoderMaxWindow   uint64
+	maxDecodedSize     int64
+	maxRatio           int
+
+	budget   *MemoryBudget
+	cpuGuard *CPUGuard
+
+	observer stats.Observer
+
+	pooledBuffers bool
+	bufferPool    sync.Pool
+
+	// profileName enables pprof labels when non-empty.
+	profileName string
+
+	// mu serializes replacements of state.
+	mu     sync.Mutex
+	state  atomic.Pointer[dictState]
+	closed atomic.Bool
+}
+
+// dictState holds everything derived from a dictionary. It is immutable
+// once built: the pool constructors capture the state's own copy of the
+// dictionary rather than reading Compressor fields.
+type dictState struct {
 	dict []byte
+	id   uint32
+	raw  bool
+	// hash is the SHA-256 of dict, hex encoded, or empty without one.
+	hash string
+
+	// prev is the dictionary SetDict replaced, kept for decoding only so
+	// frames compressed just before a swap still decode.
+	prev dictRef
+
+	// level is the configured encoder level, the highest with a pool.
+	level zstd.EncoderLevel
+
+	compressLabels   pprof.LabelSet
+	decompressLabels pprof.LabelSet
+
+	// encoderPools holds one pool per encoder level, indexed by level.
+	// Only the configured level has a pool unless adaptive levels are on.
+	encoderPools [zstd.SpeedBestCompression + 1]*pool.Pool[*zstd.Encoder]
+	decoderPool  *pool.Pool[*zstd.Decoder]
+
+	// plainEncoderPools mirrors encoderPools without the dictionary, for
+	// payloads above the WithDictThreshold size and WithAutoDict. It is
+	// only populated when there is both a dictionary and one of those.
+	plainEncoderPools [zstd.SpeedBestCompression + 1]*pool.Pool[*zstd.Encoder]
+}
+
+// ErrClosed is returned by the methods of a Compressor after Close.
+var ErrClosed = errors.New("zstddict: compressor closed")
+
+// ErrMemoryLimit is returned when decoding a frame would exceed the memory
+// limits configured with WithDecoderMaxMemory or WithDecoderMaxWindow, or
+// the per-call limit given to DecompressLimit.
+var ErrMemoryLimit = errors.New("zstddict: decoder memory limit exceeded")
+
+// MemoryLimitError reports a DecompressLimit call that needed more memory
+// than its limit allowed. It matches ErrMemoryLimit.
+type MemoryLimitError struct {
+	// Limit is the per-call limit in bytes.
+	Limit int64
+	// Window is the window size declared by the frame, 0 for
+	// single-segment frames, which decode straight into the output.
+	Window int64
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("zstddict: decode needs more than %d bytes (window %d)", e.Limit, e.Window)
+}
+
+// Is reports whether target is ErrMemoryLimit.
+func (e *MemoryLimitError) Is(target error) bool {
+	return target == ErrMemoryLimit
+}
+
+// ErrDictMismatch is matched by errors reporting a frame that was compressed
+// with a different dictionary than the one loaded. The concrete error is a
+// *DictMismatchError carrying both IDs.
+var ErrDictMismatch = errors.New("zstddict: dictionary mismatch")
 
-	encoderPool sync.Pool
-	decoderPool sync.Pool
+// ErrNoDict is matched by errors reporting a frame that needs a dictionary
+// the Compressor has not loaded: one it was never given, or one missing
+// from its decoders, such as a frame from a newer dictionary generation.
+var ErrNoDict = errors.New("zstddict: dictionary not loaded")
+
+// ErrCorruptFrame is matched by errors reporting data that is not valid
+// zstd: a bad magic number, malformed headers or blocks, or a truncated
+// frame. Checksum failures match ErrChecksumMismatch instead.
+var ErrCorruptFrame = errors.New("zstddict: corrupt frame")
+
+// DictMismatchError reports a frame whose dictionary ID differs from the
+// loaded dictionary's. An ID of 0 means no dictionary. When no dictionary
+// is loaded, it also matches ErrNoDict.
+type DictMismatchError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *DictMismatchError) Error() string {
+	return fmt.Sprintf("zstddict: dictionary mismatch: frame uses dictionary %d, loaded dictionary is %d", e.Actual, e.Expected)
+}
+
+// Is reports whether target is ErrDictMismatch, or ErrNoDict for a frame
+// that needs a dictionary when none is loaded.
+func (e *DictMismatchError) Is(target error) bool {
+	return target == ErrDictMismatch || target == ErrNoDict && e.Expected == 0 && e.Actual != 0
+}
+
+// ErrRatioExceeded is returned when decompressed output would exceed the
+// expansion ratio set with WithMaxRatio.
+var ErrRatioExceeded = errors.New("zstddict: decompression ratio limit exceeded")
+
+// ErrTooLarge is returned when data exceeds a size limit, such as the
+// limit set with WithMaxDecodedSize or the message size limit of a Codec.
+var ErrTooLarge = errors.New("zstddict: data too large")
+
+// DecodedSizeError reports decompressed output that would exceed a size
+// limit, such as the one set with WithMaxDecodedSize.
+type DecodedSizeError struct {
+	// Limit is the most output allowed, in bytes.
+	Limit int64
+	// Declared is the content size declared by the frame header, if the
+	// frame was rejected before decoding, and 0 otherwise.
+	Declared int64
+}
+
+func (e *DecodedSizeError) Error() string {
+	if e.Declared > 0 {
+		return fmt.Sprintf("zstddict: frame declares %d bytes, limit is %d", e.Declared, e.Limit)
+	}
+	return fmt.Sprintf("zstddict: decoded output exceeds limit of %d bytes", e.Limit)
+}
+
+// Is reports whether target is ErrTooLarge.
+func (e *DecodedSizeError) Is(target error) bool {
+	return target == ErrTooLarge
 }
 
 // Option configures a Compressor.
@@ -32,6 +227,41 @@ func WithDictBytes(dict []byte) Option {
 	}
 }
 
+// WithRawDict loads a raw content dictionary: arbitrary bytes, such as
+// typical messages concatenated, used as history that matches can refer
+// to, without the entropy tables of a trained dictionary. Some corpora
+// compress better with such prefix-style dictionaries, and other zstd
+// ecosystems often exchange them. Raw dictionaries have no header, so
+// frames carry id as their dictionary ID, and peers must load the same
+// content under the same id. An id of 0 omits the ID from frames.
+func WithRawDict(id uint32, content []byte) Option {
+	return func(c *Compressor) error {
+		if len(content) == 0 {
+			return errors.New("zstddict: empty raw dictionary")
+		}
+		c.dict, c.rawDict, c.rawDictID = content, true, id
+		return nil
+	}
+}
+
+// WithDecodeDicts makes decoders accept frames compressed with any of
+// dicts as well as the loaded dictionary, picking the one named by each
+// frame's dictionary ID. List the generations that may still be in flight
+// during a rolling dictionary upgrade, such as frames queued before or
+// produced by peers already on the next version. The dictionaries must be
+// structured; they are copied.
+func WithDecodeDicts(dicts ...[]byte) Option {
+	return func(c *Compressor) error {
+		for _, dict := range dicts {
+			if _, err := zstd.InspectDictionary(dict); err != nil {
+				return fmt.Errorf("zstddict: decode dictionary: %w", err)
+			}
+			c.decodeDicts = append(c.decodeDicts, structuredDict(bytes.Clone(dict)))
+		}
+		return nil
+	}
+}
+
 // WithDictFile loads a dictionary from the specified file path.
 func WithDictFile(path string) Option {
 	return func(c *Compressor) error {
@@ -44,9 +274,364 @@ func WithDictFile(path string) Option {
 	}
 }
 
+// WithDictFS loads a dictionary from path in fsys, such as an embed.FS,
+// so services can embed their dictionary in the binary:
+//
+//	//go:embed filelist.dict
+//	var dicts embed.FS
+//
+//	c, err := zstddict.New(zstddict.WithDictFS(dicts, "filelist.dict"))
+func WithDictFS(fsys fs.FS, path string) Option {
+	return func(c *Compressor) error {
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		c.dict = data
+		return nil
+	}
+}
+
+// WithDictBase64 loads a dictionary from its standard base64 encoding, as
+// shipped in configuration or environment variables. Surrounding
+// whitespace is ignored.
+func WithDictBase64(s string) Option {
+	return func(c *Compressor) error {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("zstddict: base64 dictionary: %w", err)
+		}
+		c.dict = data
+		return nil
+	}
+}
+
+// WithLevel sets the encoder level. The default is zstd.SpeedDefault.
+func WithLevel(level zstd.EncoderLevel) Option {
+	return func(c *Compressor) error {
+		if level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+			return fmt.Errorf("zstddict: invalid encoder level %d", level)
+		}
+		c.level = level
+		return nil
+	}
+}
+
+// WithStrictDict makes Decompress check the dictionary ID in each frame
+// header against the loaded dictionary before decoding, failing with a
+// *DictMismatchError when they differ. Without it, a frame compressed with
+// another dictionary fails with whatever error the decoder happens to hit.
+func WithStrictDict(strict bool) Option {
+	return func(c *Compressor) error {
+		c.strictDict = strict
+		return nil
+	}
+}
+
+// WithSmallMessages tunes encoders for the sub-1KB payloads that dictionaries
+// are most useful for. Frames are written as a single segment with no
+// trailing checksum, and the window is shrunk to the smallest power of two
+// that still covers the dictionary, so back-references into it are kept.
+//
+// The frame content size is always present in single-segment frames; it is
+// what allows the window descriptor byte to be omitted.
+func WithSmallMessages() Option {
+	return func(c *Compressor) error {
+		c.smallMessages = true
+		return nil
+	}
+}
+
+// WithWindowSize sets the encoder window, the distance back-references may
+// reach, which must be a power of two from zstd.MinWindowSize to
+// zstd.MaxWindowSize. Each pooled encoder keeps a history buffer of about
+// twice the window, so small-message users can shrink memory with a small
+// window and large-payload users can trade memory for ratio with a large
+// one. A window smaller than the dictionary keeps only its tail reachable.
+// It overrides the window chosen by WithSmallMessages or
+// WithLongDistanceMatching. Decoders must allow the window; see
+// WithDecoderMaxWindow.
+func WithWindowSize(n int) Option {
+	return func(c *Compressor) error {
+		if n < zstd.MinWindowSize || n > zstd.MaxWindowSize || n&(n-1) != 0 {
+			return fmt.Errorf("zstddict: window size must be a power of two from %d to %d, got %d", zstd.MinWindowSize, zstd.MaxWindowSize, n)
+		}
+		c.windowSize = n
+		return nil
+	}
+}
+
+// longDistanceWindow is the window used by WithLongDistanceMatching, the
+// one zstd --long selects by default.
+const longDistanceWindow = 128 << 20
+
+// WithLongDistanceMatching widens the encoder window to 128 MiB, as
+// zstd --long does, so repetitions far apart in large payloads are found.
+// klauspost/compress has no separate long-distance match finder, so this
+// is only the window half of zstd's feature: matches are found by the
+// level's regular match finder, which searches the wider window best at
+// zstd.SpeedBetterCompression and above. Pooled encoders grow accordingly,
+// to about 256 MiB each once used for streaming, so pair it with few
+// concurrent encoders.
+func WithLongDistanceMatching() Option {
+	return func(c *Compressor) error {
+		c.longDistance = true
+		return nil
+	}
+}
+
+// WithDictThreshold makes Compress skip the dictionary for payloads larger
+// than n bytes. Dictionaries mostly help small inputs; on large ones they
+// stop paying for themselves and can slightly hurt. Such frames carry no
+// dictionary ID, which decoders already handle, so Decompress accepts both
+// kinds, including under WithStrictDict. Streaming writers, which can't
+// know the size up front, always use the dictionary.
+func WithDictThreshold(n int) Option {
+	return func(c *Compressor) error {
+		if n < 1 {
+			return fmt.Errorf("zstddict: dictionary threshold must be positive, got %d", n)
+		}
+		c.dictThreshold = n
+		return nil
+	}
+}
+
+// WithAutoDict makes Compress encode each payload both with and without
+// the dictionary and keep the smaller frame, for workloads where some
+// payloads compress worse with the dictionary. It costs a second encode
+// per call. No marker needs adding to tell the two kinds apart: frames
+// compressed without the dictionary carry no dictionary ID, which decoders
+// already handle, so the output stays standard zstd and Decompress accepts
+// both, including under WithStrictDict. Payloads above a WithDictThreshold
+// are only encoded without the dictionary, and streaming writers always
+// use it.
+func WithAutoDict() Option {
+	return func(c *Compressor) error {
+		c.autoDict = true
+		return nil
+	}
+}
+
+// WithStoredFallback makes Compress emit a stored frame, holding the data
+// uncompressed, whenever that is smaller than the compressed frame, as with
+// already-compressed images or random blobs. Stored frames are ordinary
+// zstd frames, see AppendStoredFrame, so any decoder reads them; since
+// they carry no dictionary ID, Decompress accepts them under
+// WithStrictDict. The framing still costs 9 to 12 bytes over the data, so
+// incompressible input grows by that much rather than not at all.
+func WithStoredFallback() Option {
+	return func(c *Compressor) error {
+		c.stored = true
+		return nil
+	}
+}
+
+// WithEncoderConcurrency sets the number of goroutines each pooled encoder
+// may use for streaming compression. Each one holds its own block encoder,
+// so on many-core machines the default, GOMAXPROCS, costs memory per
+// pooled encoder without helping small messages. A value of 1 compresses
+// synchronously, as WithSmallMessages does; an explicit setting overrides
+// that.
+func WithEncoderConcurrency(n int) Option {
+	return func(c *Compressor) error {
+		if n < 1 {
+			return fmt.Errorf("zstddict: encoder concurrency must be at least 1, got %d", n)
+		}
+		c.encoderConcurrency = n
+		return nil
+	}
+}
+
+// PoolPolicy controls what happens when a Compressor has as many encoders
+// checked out as WithMaxEncoders allows.
+type PoolPolicy int
+
+const (
+	// PoolBlock makes Compress and Writer wait for an encoder to be put
+	// back.
+	PoolBlock PoolPolicy = iota
+	// PoolAllocate makes them create an extra encoder, which is closed
+	// rather than pooled when put back.
+	PoolAllocate
+)
+
+// WithMaxEncoders bounds the encoders checked out at once, across all
+// levels, to n. Each encoder holds megabytes of buffers, so under bursty
+// load an unbounded pool grows to one per concurrent call and the idle
+// ones are only trimmed back slowly. MemStats reports the hit rate, the
+// waits and the extra encoders allocated, to size n. Under PoolBlock, a
+// Writer holds its encoder until closed, so open Writers can starve
+// Compress.
+func WithMaxEncoders(n int, policy PoolPolicy) Option {
+	return func(c *Compressor) error {
+		if n < 1 {
+			return fmt.Errorf("zstddict: max encoders must be at least 1, got %d", n)
+		}
+		c.encoderLimit = pool.NewLimit(n, policy == PoolBlock)
+		return nil
+	}
+}
+
+// WithDecoderConcurrency sets the number of goroutines each pooled decoder
+// may use. A value of 1 disables background decoding goroutines entirely.
+func WithDecoderConcurrency(n int) Option {
+	return func(c *Compressor) error {
+		if n < 1 {
+			return fmt.Errorf("zstddict: decoder concurrency must be at least 1, got %d", n)
+		}
+		c.decoderConcurrency = n
+		return nil
+	}
+}
+
+// WithDecoderMaxMemory caps the memory a single decode may allocate for its
+// output and working buffers. Frames that need more fail with ErrMemoryLimit.
+func WithDecoderMaxMemory(n uint64) Option {
+	return func(c *Compressor) error {
+		if n == 0 {
+			return errors.New("zstddict: decoder max memory must be positive")
+		}
+		c.decoderMaxMemory = n
+		return nil
+	}
+}
+
+// WithDecoderMaxWindow caps the window size a frame may request. Frames
+// declaring a larger window fail with ErrMemoryLimit before any memory is
+// allocated for them.
+func WithDecoderMaxWindow(n uint64) Option {
+	return func(c *Compressor) error {
+		if n < zstd.MinWindowSize {
+			return fmt.Errorf("zstddict: decoder max window must be at least %d, got %d", zstd.MinWindowSize, n)
+		}
+		c.decoderMaxWindow = n
+		return nil
+	}
+}
+
+// WithEncoderOptions passes opts to every encoder the Compressor builds,
+// for settings it has no option of its own for. They are applied after the
+// Compressor's own, so they win where both set something, and after
+// earlier WithEncoderOptions. Load dictionaries with WithDictBytes or
+// WithRawDict rather than zstd options, so the pools without a dictionary
+// stay without one. Invalid options fail New.
+func WithEncoderOptions(opts ...zstd.EOption) Option {
+	return func(c *Compressor) error {
+		enc, err := zstd.NewWriter(nil, opts...)
+		if err != nil {
+			return fmt.Errorf("zstddict: encoder options: %w", err)
+		}
+		enc.Close()
+		c.encoderExtra = append(c.encoderExtra, opts...)
+		return nil
+	}
+}
+
+// WithDecoderOptions passes opts to every decoder the Compressor builds,
+// like WithEncoderOptions does for encoders.
+func WithDecoderOptions(opts ...zstd.DOption) Option {
+	return func(c *Compressor) error {
+		dec, err := zstd.NewReader(nil, opts...)
+		if err != nil {
+			return fmt.Errorf("zstddict: decoder options: %w", err)
+		}
+		dec.Close()
+		c.decoderExtra = append(c.decoderExtra, opts...)
+		return nil
+	}
+}
+
+// WithMaxDecodedSize bounds the output of a single decompression to n
+// bytes, so a tiny frame from a malicious peer can't expand to gigabytes.
+// Frames declaring a larger content size are rejected before decoding;
+// others are decoded incrementally and abandoned once they pass the limit.
+// Either way the error is a *DecodedSizeError, which matches ErrTooLarge.
+// The limit applies to Decompress and its variants and to Readers.
+func WithMaxDecodedSize(n int64) Option {
+	return func(c *Compressor) error {
+		if n <= 0 {
+			return fmt.Errorf("zstddict: max decoded size must be positive, got %d", n)
+		}
+		c.maxDecodedSize = n
+		return nil
+	}
+}
+
+// WithName sets the name the Compressor reports to its Observer.
+func WithName(name string) Option {
+	return func(c *Compressor) error {
+		c.name = name
+		return nil
+	}
+}
+
+// WithObserver reports every Compress and Decompress call to o, including
+// its sizes, latency and error.
+func WithObserver(o stats.Observer) Option {
+	return func(c *Compressor) error {
+		c.observer = o
+		return nil
+	}
+}
+
+// WithPooledBuffers makes Compress and Decompress return slices drawn from
+// an internal buffer pool instead of allocating a new result per call.
+//
+// Ownership of a returned slice passes to the caller, who must hand it back
+// with Free once it is no longer referenced. Slices that are never freed are
+// simply garbage collected; slices used after Free may be overwritten by a
+// later call. The CompressTo and DecompressTo variants are unaffected, since
+// the caller already owns dst.
+func WithPooledBuffers() Option {
+	return func(c *Compressor) error {
+		c.pooledBuffers = true
+		return nil
+	}
+}
+
+// maxPooledBuffer is the largest buffer capacity retained by Free.
+const maxPooledBuffer = 1 << 20
+
+// WithMaxRatio refuses to decompress data that expands to more than ratio
+// times its compressed size, failing with ErrRatioExceeded. Unlike the
+// absolute limits, it needs no up-front knowledge of reasonable payload
+// sizes. The limit is enforced incrementally, both by Decompress and by
+// readers returned from Reader, so oversized output is never fully
+// materialized.
+func WithMaxRatio(ratio int) Option {
+	return func(c *Compressor) error {
+		if ratio < 1 {
+			return fmt.Errorf("zstddict: max ratio must be at least 1, got %d", ratio)
+		}
+		c.maxRatio = ratio
+		return nil
+	}
+}
+
+// WithProfileLabels tags compression and decompression work with pprof
+// labels so CPU profiles attribute the cost to this Compressor. Each
+// operation is labeled with:
+//
+//	zstddict.compressor  the given name
+//	zstddict.dict        the dictionary ID, or "none"
+//	zstddict.op          "compress" or "decompress"
+//
+// Only the Context variants, such as CompressContext, DecompressContext
+// and Codec's EncodeContext and DecodeContext, apply the labels:
+// runtime/pprof cannot read the calling goroutine's current labels, so the
+// other methods leave them untouched rather than replace them with the
+// Compressor's. grpccodec's PayloadCompressor interceptors pass the call's
+// context, so its payload work is labeled too.
+func WithProfileLabels(name string) Option {
+	return func(c *Compressor) error {
+		c.profileName = name
+		return nil
+	}
+}
+
 // New creates a new Compressor with the given options.
 func New(opts ...Option) (*Compressor, error) {
-	c := &Compressor{}
+	c := &Compressor{level: zstd.SpeedDefault}
 
 	for _, opt := range opts {
 		if err := opt(c); err != nil {
@@ -54,107 +639,801 @@ func New(opts ...Option) (*Compressor, error) {
 		}
 	}
 
-	c.encoderPool = sync.Pool{
-		New: func() any {
-			var enc *zstd.Encoder
-			var err error
-			if c.dict != nil {
-				enc, err = zstd.NewWriter(nil, zstd.WithEncoderDict(c.dict))
-			} else {
-				enc, err = zstd.NewWriter(nil)
-			}
-			if err != nil {
-				return nil
-			}
-			return enc
-		},
-	}
-
-	c.decoderPool = sync.Pool{
-		New: func() any {
-			var dec *zstd.Decoder
-			var err error
-			if c.dict != nil {
-				dec, err = zstd.NewReader(nil, zstd.WithDecoderDicts(c.dict))
-			} else {
-				dec, err = zstd.NewReader(nil)
-			}
-			if err != nil {
-				return nil
-			}
-			return dec
-		},
+	if c.adaptive != nil {
+		c.adaptive.level.Store(int32(c.level))
 	}
 
+	// Copy the dictionary so later changes to the caller's slice can't
+	// reach the encoders.
+	cur := structuredDict(bytes.Clone(c.dict))
+	if c.rawDict {
+		cur.id, cur.raw = c.rawDictID, true
+	}
+	c.state.Store(c.newDictState(cur, dictRef{}, c.level))
+	c.dict = nil
+
 	return c, nil
 }
 
+// dictRef is a dictionary with the ID and format it is loaded with. A nil
+// data means no dictionary.
+type dictRef struct {
+	data []byte
+	id   uint32
+	raw  bool
+}
+
+// structuredDict returns a reference to dict loaded as a structured
+// dictionary.
+func structuredDict(dict []byte) dictRef {
+	return dictRef{data: dict, id: dictID(dict)}
+}
+
+// ref returns a reference to the state's dictionary.
+func (st *dictState) ref() dictRef {
+	return dictRef{data: st.dict, id: st.id, raw: st.raw}
+}
+
+// newDictState builds the pools and labels for cur, with encoders up to
+// level. Decoders also accept frames made with prev, if it has data.
+func (c *Compressor) newDictState(cur, prev dictRef, level zstd.EncoderLevel) *dictState {
+	dict := cur.data
+	st := &dictState{dict: dict, id: cur.id, raw: cur.raw, level: level}
+	if dict != nil {
+		sum := sha256.Sum256(dict)
+		st.hash = hex.EncodeToString(sum[:])
+	}
+	if prev.data != nil && prev.id != st.id {
+		st.prev = prev
+	}
+
+	if c.profileName != "" {
+		id := "none"
+		if dict != nil {
+			id = strconv.FormatUint(uint64(st.id), 10)
+		}
+		st.compressLabels = pprof.Labels(
+			"zstddict.compressor", c.profileName,
+			"zstddict.dict", id,
+			"zstddict.op", "compress",
+		)
+		st.decompressLabels = pprof.Labels(
+			"zstddict.compressor", c.profileName,
+			"zstddict.dict", id,
+			"zstddict.op", "decompress",
+		)
+	}
+
+	lowest, highest := level, level
+	if c.adaptive != nil || c.cpuGuard != nil {
+		lowest = zstd.SpeedFastest
+	}
+	if c.levelPolicy != nil {
+		lowest, highest = zstd.SpeedFastest, zstd.SpeedBestCompression
+	}
+	for level := lowest; level <= highest; level++ {
+		encOpts := c.encoderOptions(cur, level)
+		st.encoderPools[level] = pool.New(func() (*zstd.Encoder, error) {
+			return zstd.NewWriter(nil, encOpts...)
+		}, func(enc *zstd.Encoder) { enc.Close() })
+		if c.encoderLimit != nil {
+			st.encoderPools[level].SetLimit(c.encoderLimit)
+		}
+
+		if dict != nil && (c.dictThreshold > 0 || c.autoDict) {
+			plainOpts := c.encoderOptions(dictRef{}, level)
+			st.plainEncoderPools[level] = pool.New(func() (*zstd.Encoder, error) {
+				return zstd.NewWriter(nil, plainOpts...)
+			}, func(enc *zstd.Encoder) { enc.Close() })
+			if c.encoderLimit != nil {
+				st.plainEncoderPools[level].SetLimit(c.encoderLimit)
+			}
+		}
+	}
+
+	decOpts := c.decoderOptions(cur)
+	if st.prev.data != nil {
+		decOpts = append(decOpts, decoderDict(st.prev))
+	}
+	for _, d := range c.decodeDicts {
+		if d.id != st.id && (st.prev.data == nil || d.id != st.prev.id) {
+			decOpts = append(decOpts, decoderDict(d))
+		}
+	}
+	st.decoderPool = pool.New(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, decOpts...)
+	}, (*zstd.Decoder).Close)
+
+	return st
+}
+
+// encoderOptions returns the zstd encoder options derived from the
+// Compressor configuration, for dict at the given level.
+func (c *Compressor) encoderOptions(dict dictRef, level zstd.EncoderLevel) []zstd.EOption {
+	opts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+	if c.smallMessages {
+		opts = append(opts,
+			zstd.WithSingleSegment(true),
+			zstd.WithEncoderCRC(false),
+			zstd.WithEncoderConcurrency(1),
+		)
+	}
+	if c.frameCRC != nil {
+		opts = append(opts, zstd.WithEncoderCRC(*c.frameCRC))
+	}
+	if w := c.encoderWindow(len(dict.data)); w > 0 {
+		opts = append(opts, zstd.WithWindowSize(w))
+	}
+	if c.encoderConcurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(c.encoderConcurrency))
+	}
+	opts = append(opts, c.encoderExtra...)
+	switch {
+	case dict.raw:
+		opts = append(opts, zstd.WithEncoderDictRaw(dict.id, dict.data))
+	case dict.data != nil:
+		opts = append(opts, zstd.WithEncoderDict(dict.data))
+	}
+	return opts
+}
+
+// decoderOptions returns the zstd decoder options derived from the
+// Compressor configuration, for dict.
+func (c *Compressor) decoderOptions(dict dictRef) []zstd.DOption {
+	var opts []zstd.DOption
+	if c.decoderConcurrency > 0 {
+		opts = append(opts, zstd.WithDecoderConcurrency(c.decoderConcurrency))
+	}
+	if c.decoderMaxMemory > 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(c.decoderMaxMemory))
+	}
+	if c.decoderMaxWindow > 0 {
+		opts = append(opts, zstd.WithDecoderMaxWindow(c.decoderMaxWindow))
+	}
+	opts = append(opts, c.decoderExtra...)
+	if dict.data != nil {
+		opts = append(opts, decoderDict(dict))
+	}
+	return opts
+}
+
+// decoderDict returns the decoder option registering dict.
+func decoderDict(dict dictRef) zstd.DOption {
+	if dict.raw {
+		return zstd.WithDecoderDictRaw(dict.id, dict.data)
+	}
+	return zstd.WithDecoderDicts(dict.data)
+}
+
+// dictID returns the ID stored in a zstd dictionary header, or 0 for raw
+// content dictionaries.
+func dictID(dict []byte) uint32 {
+	if len(dict) < 8 || binary.LittleEndian.Uint32(dict) != dictMagic {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(dict[4:])
+}
+
+// dictMagic is the magic number that starts a zstd dictionary.
+const dictMagic = 0xEC30A437
+
+// encoderWindow returns the encoder window size for a dictionary of
+// dictSize bytes, or 0 for the zstd default. An explicit WithWindowSize
+// wins over WithLongDistanceMatching, which wins over WithSmallMessages.
+func (c *Compressor) encoderWindow(dictSize int) int {
+	switch {
+	case c.windowSize > 0:
+		return c.windowSize
+	case c.longDistance:
+		return longDistanceWindow
+	case c.smallMessages:
+		return smallMessageWindow(dictSize)
+	}
+	return 0
+}
+
+// smallMessageWindow returns the smallest valid window size that covers a
+// dictionary of dictSize bytes.
+func smallMessageWindow(dictSize int) int {
+	size := zstd.MinWindowSize
+	for size < dictSize {
+		size <<= 1
+	}
+	return size
+}
+
 // Compress compresses the input data using zstd with the configured dictionary.
+// With WithPooledBuffers the result must be released with Free.
 func (c *Compressor) Compress(data []byte) ([]byte, error) {
-	enc := c.encoderPool.Get().(*zstd.Encoder)
-	if enc == nil {
-		return nil, errors.New("failed to get encoder from pool")
-	}
-	defer c.encoderPool.Put(enc)
+	return c.compressTo(unlabeled, c.getBuffer(), data)
+}
 
-	return enc.EncodeAll(data, nil), nil
+// CompressContext is like Compress, but applies profile labels on top of
+// those carried by ctx.
+func (c *Compressor) CompressContext(ctx context.Context, data []byte) ([]byte, error) {
+	return c.compressTo(ctx, c.getBuffer(), data)
 }
 
 // CompressTo compresses the input data and appends to dst.
 func (c *Compressor) CompressTo(dst, data []byte) ([]byte, error) {
-	enc := c.encoderPool.Get().(*zstd.Encoder)
-	if enc == nil {
-		return nil, errors.New("failed to get encoder from pool")
+	return c.compressTo(unlabeled, dst, data)
+}
+
+func (c *Compressor) compressTo(ctx context.Context, dst, data []byte) (out []byte, err error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
 	}
-	defer c.encoderPool.Put(enc)
+	st := c.state.Load()
+	pools, id := &st.encoderPools, st.id
+	if st.plainEncoderPools[st.level] != nil && c.dictThreshold > 0 && len(data) > c.dictThreshold {
+		pools, id = &st.plainEncoderPools, 0
+	}
+	if c.observer != nil {
+		start := time.Now()
+		defer func() { c.observe(stats.OpCompress, id, start, len(data), len(dst), &out, &err) }()
+	}
+
+	level := st.level
+	if c.levelPolicy != nil {
+		level = c.policyLevel(len(data))
+	}
+	if c.budget != nil {
+		// Adaptive and guarded levels only go lower, so level bounds
+		// the encoder's tables.
+		cost := compressCost(len(data), level, c.encoderWindow(len(st.dict)), pools == &st.encoderPools && st.dict != nil)
+		n, err := c.budget.acquire(ctx, cost)
+		if err != nil {
+			return nil, err
+		}
+		defer c.budget.release(n)
+	}
+	if c.adaptive != nil {
+		// The adaptive level may briefly exceed a ceiling just lowered
+		// by SetLevel.
+		level = min(c.adaptive.enter(st.level), st.level, level)
+		defer c.adaptive.exit()
+	}
+	if c.cpuGuard != nil && c.cpuGuard.Tripped() {
+		c.cpuGuard.bypassed.Add(1)
+		if c.cpuGuard.opts.Mode == GuardStore {
+			out = AppendStoredFrame(dst, data)
+			if c.checksums {
+				out = ChecksumFrame(out, data)
+			}
+			return out, nil
+		}
+		level = zstd.SpeedFastest
+	}
+
+	encoders := pools[level]
+	enc, err := encoders.Get()
+	if err != nil {
+		return nil, err
+	}
+	out = c.encode(ctx, st, enc, data, dst)
+	// Put the encoder back before taking another, so no call ever holds
+	// two against WithMaxEncoders.
+	encoders.Put(enc)
+	if c.autoDict && pools == &st.encoderPools && st.plainEncoderPools[level] != nil {
+		if out, id, err = c.smallerPlain(ctx, st, level, data, dst, out); err != nil {
+			return nil, err
+		}
+	}
+	if c.stored && len(out)-len(dst) >= StoredFrameSize(len(data)) {
+		out = AppendStoredFrame(out[:len(dst)], data)
+	}
+	if c.checksums {
+		out = ChecksumFrame(out, data)
+	}
+	return out, nil
+}
 
-	return enc.EncodeAll(data, dst), nil
+// unlabeled is the context the methods without a context argument pass
+// down; work under it runs without the Compressor's profile labels, so
+// the caller's own labels stay in place.
+var unlabeled = context.WithValue(context.Background(), unlabeledKey{}, true)
+
+type unlabeledKey struct{}
+
+// labeled reports whether work under ctx is tagged with profile labels.
+func (c *Compressor) labeled(ctx context.Context) bool {
+	return c.profileName != "" && ctx != unlabeled
+}
+
+// encode appends the frame for data to dst, under the state's profile
+// labels if they are enabled.
+func (c *Compressor) encode(ctx context.Context, st *dictState, enc *zstd.Encoder, data, dst []byte) (out []byte) {
+	if !c.labeled(ctx) {
+		return enc.EncodeAll(data, dst)
+	}
+	pprof.Do(ctx, st.compressLabels, func(context.Context) {
+		out = enc.EncodeAll(data, dst)
+	})
+	return out
+}
+
+// smallerPlain encodes data without the dictionary after out, the frame
+// made with it at dst's end, and keeps the smaller of the two frames. It
+// returns the output and the dictionary ID of the frame kept.
+func (c *Compressor) smallerPlain(ctx context.Context, st *dictState, level zstd.EncoderLevel, data, dst, out []byte) ([]byte, uint32, error) {
+	encoders := st.plainEncoderPools[level]
+	enc, err := encoders.Get()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer encoders.Put(enc)
+
+	both := c.encode(ctx, st, enc, data, out)
+	plain := both[len(out):]
+	if len(plain) >= len(out)-len(dst) {
+		return both[:len(out)], st.id, nil
+	}
+	n := copy(both[len(dst):], plain)
+	return both[:len(dst)+n], 0, nil
 }
 
 // Decompress decompresses the input data using zstd with the configured dictionary.
+// With WithPooledBuffers the result must be released with Free.
 func (c *Compressor) Decompress(data []byte) ([]byte, error) {
-	dec := c.decoderPool.Get().(*zstd.Decoder)
-	if dec == nil {
-		return nil, errors.New("failed to get decoder from pool")
+	return c.decompressTo(unlabeled, c.getBuffer(), data, decodeLimits{})
+}
+
+// DecompressAny is like Decompress, but first checks the frame's
+// dictionary ID against every dictionary generation the Compressor knows:
+// the loaded dictionary, the one SetDict last replaced, those given to
+// WithDecodeDicts, and none. Frames from an unknown generation fail with a
+// *DictMismatchError naming it, whatever WithStrictDict says, rather than
+// with the decoder's opaque error, so callers draining mixed queues during
+// a rolling dictionary upgrade can tell which frames they cannot read yet.
+func (c *Compressor) DecompressAny(data []byte) ([]byte, error) {
+	if err := c.matchDict(c.state.Load(), data, true); err != nil {
+		return nil, err
 	}
-	defer c.decoderPool.Put(dec)
+	return c.decompressTo(unlabeled, c.getBuffer(), data, decodeLimits{anyDict: true})
+}
+
+// DecompressLimit is like Decompress, but fails with a *MemoryLimitError
+// once the window declared by the first frame plus the decoded output
+// would exceed maxMemory bytes. Frames declaring too large a size are
+// rejected before decoding; others are decoded incrementally and abandoned
+// as soon as they pass the limit. It suits endpoints that accept frames
+// from untrusted clients, and applies on top of any MemoryBudget and
+// Compressor-wide decoder limits.
+func (c *Compressor) DecompressLimit(data []byte, maxMemory int64) ([]byte, error) {
+	if maxMemory <= 0 {
+		return nil, fmt.Errorf("zstddict: decode memory limit must be positive, got %d", maxMemory)
+	}
+	return c.decompressTo(unlabeled, c.getBuffer(), data, decodeLimits{memory: maxMemory})
+}
+
+// DecompressInto decompresses data, appending to dst, and fails with a
+// *DecodedSizeError if the output would exceed maxSize bytes. Frames that
+// declare their content size, as those from Compress do, are checked
+// against maxSize before decoding and then decoded in one pass into dst,
+// which is grown once to the declared size if it lacks room, rather than
+// through the repeated growth of Decompress. Passing a dst with enough
+// capacity, such as a reused buffer, avoids allocating at all. Frames that
+// do not declare a size are decoded incrementally and abandoned once they
+// pass maxSize.
+func (c *Compressor) DecompressInto(dst, data []byte, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("zstddict: decoded size limit must be positive, got %d", maxSize)
+	}
+	return c.decompressTo(unlabeled, dst, data, decodeLimits{size: maxSize})
+}
 
-	return dec.DecodeAll(data, nil)
+// DecompressContext is like Decompress, but applies profile labels on top of
+// those carried by ctx.
+func (c *Compressor) DecompressContext(ctx context.Context, data []byte) ([]byte, error) {
+	return c.decompressTo(ctx, c.getBuffer(), data, decodeLimits{})
+}
+
+// Free returns a slice obtained from Compress or Decompress to the buffer
+// pool. The caller must not use b afterwards. Free is a no-op unless the
+// Compressor was created with WithPooledBuffers.
+func (c *Compressor) Free(b []byte) {
+	if !c.pooledBuffers || b == nil || cap(b) > maxPooledBuffer {
+		return
+	}
+	b = b[:0]
+	c.bufferPool.Put(&b)
+}
+
+// getBuffer returns an empty pooled buffer, or nil when buffer pooling is
+// disabled.
+func (c *Compressor) getBuffer() []byte {
+	if !c.pooledBuffers {
+		return nil
+	}
+	if bp, ok := c.bufferPool.Get().(*[]byte); ok {
+		return *bp
+	}
+	return nil
 }
 
 // DecompressTo decompresses the input data and appends to dst.
 func (c *Compressor) DecompressTo(dst, data []byte) ([]byte, error) {
-	dec := c.decoderPool.Get().(*zstd.Decoder)
-	if dec == nil {
-		return nil, errors.New("failed to get decoder from pool")
+	return c.decompressTo(unlabeled, dst, data, decodeLimits{})
+}
+
+// decodeLimits are per-call limits on a decode. Zero fields are unlimited.
+type decodeLimits struct {
+	memory int64 // window plus output
+	size   int64 // output
+
+	// anyDict lifts WithStrictDict for callers that checked the
+	// dictionary themselves.
+	anyDict bool
+}
+
+// decompressTo decodes data into dst within lim.
+func (c *Compressor) decompressTo(ctx context.Context, dst, data []byte, lim decodeLimits) (out []byte, err error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	st := c.state.Load()
+	if c.maxDecodedSize > 0 && (lim.size == 0 || c.maxDecodedSize < lim.size) {
+		lim.size = c.maxDecodedSize
+	}
+	if c.observer != nil {
+		defer c.observe(stats.OpDecompress, st.id, time.Now(), len(data), len(dst), &out, &err)
+	}
+
+	if c.budget != nil {
+		n, err := c.budget.acquire(ctx, decompressCost(data, c.decoderMaxMemory))
+		if err != nil {
+			return nil, err
+		}
+		defer c.budget.release(n)
+	}
+
+	if c.strictDict && !lim.anyDict {
+		if err := c.checkDict(st, data); err != nil {
+			return nil, err
+		}
+	}
+	if c.requireCRC() {
+		if err := checkCRC(data); err != nil {
+			return nil, err
+		}
+	}
+
+	dec, err := st.decoderPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer st.decoderPool.Put(dec)
+
+	if !c.labeled(ctx) {
+		out, err = c.decodeAll(dec, data, dst, lim)
+	} else {
+		pprof.Do(ctx, st.decompressLabels, func(context.Context) {
+			out, err = c.decodeAll(dec, data, dst, lim)
+		})
+	}
+	if err == nil && c.checksums {
+		if err := VerifyFrame(data, out[len(dst):]); err != nil {
+			return nil, err
+		}
+	}
+	return out, err
+}
+
+// decodeAll decodes data into dst, enforcing the expansion ratio limit and
+// the limits in lim if they are set.
+func (c *Compressor) decodeAll(dec *zstd.Decoder, data, dst []byte, lim decodeLimits) ([]byte, error) {
+	if c.maxRatio == 0 && lim.memory == 0 && lim.size == 0 {
+		out, err := dec.DecodeAll(data, dst)
+		return out, decodeError(err)
+	}
+
+	var h zstd.Header
+	if h.Decode(data) != nil {
+		h = zstd.Header{}
+	}
+
+	// limit is the most output allowed, and limitErr builds the error
+	// reported when the tighter of the limits is passed. Errors are only
+	// built on failure, keeping successful decodes free of allocations.
+	const (
+		ratioLimit = iota
+		memoryLimit
+		sizeLimit
+	)
+	limit, tighter := int64(math.MaxInt64), ratioLimit
+	if c.maxRatio > 0 {
+		limit = int64(len(data)) * int64(c.maxRatio)
+	}
+	if lim.memory > 0 {
+		if int64(h.WindowSize) >= lim.memory {
+			return nil, &MemoryLimitError{Limit: lim.memory, Window: int64(h.WindowSize)}
+		}
+		if n := lim.memory - int64(h.WindowSize); n < limit {
+			limit, tighter = n, memoryLimit
+		}
+	}
+	if lim.size > 0 && lim.size < limit {
+		limit, tighter = lim.size, sizeLimit
+	}
+	limitErr := func(declared int64) error {
+		switch tighter {
+		case memoryLimit:
+			return &MemoryLimitError{Limit: lim.memory, Window: int64(h.WindowSize)}
+		case sizeLimit:
+			return &DecodedSizeError{Limit: lim.size, Declared: declared}
+		}
+		return ErrRatioExceeded
+	}
+
+	// Reject up front when the header already declares too much output.
+	if h.HasFCS && h.FrameContentSize > uint64(limit) {
+		return nil, limitErr(int64(h.FrameContentSize))
+	}
+
+	// A lone frame declaring a size within the limit can be decoded in one
+	// pass: the decoder sizes the output from the header and fails if the
+	// frame holds more than it declared.
+	if h.HasFCS && loneFrame(data) {
+		out, err := dec.DecodeAll(data, dst)
+		return out, decodeError(err)
+	}
+
+	// Frames need not declare their size, so decode as a stream and stop
+	// as soon as the output passes the limit. However the stream ends,
+	// stop it and drop the reference to data before the decoder is
+	// pooled again.
+	defer dec.Reset(bytes.NewReader(nil))
+	if err := dec.Reset(bytes.NewReader(data)); err != nil {
+		return nil, decodeError(err)
+	}
+	buf := bytes.NewBuffer(dst)
+	n, err := buf.ReadFrom(io.LimitReader(dec, limit+1))
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if n > limit {
+		return nil, limitErr(0)
+	}
+	return buf.Bytes(), nil
+}
+
+// observe reports a completed operation to the observer. dstLen is the
+// length of any prefix in the output that the operation did not produce.
+func (c *Compressor) observe(op stats.Op, dictID uint32, start time.Time, in, dstLen int, out *[]byte, err *error) {
+	c.observer.Observe(stats.Event{
+		Compressor: c.name,
+		DictID:     dictID,
+		Op:         op,
+		InBytes:    in,
+		OutBytes:   max(len(*out)-dstLen, 0),
+		Duration:   time.Since(start),
+		Err:        *err,
+	})
+}
+
+// checkDict verifies that the first frame in data was compressed with the
+// dictionary of st, or with none if the configuration can produce such
+// frames.
+func (c *Compressor) checkDict(st *dictState, data []byte) error {
+	return c.matchDict(st, data, c.dictThreshold > 0 || c.autoDict || c.stored || c.guardStores())
+}
+
+// matchDict verifies that the first frame in data was compressed with a
+// dictionary the decoders of st know, or with none if allowNone is set.
+// Errors name the dictionary of st as the one expected.
+func (c *Compressor) matchDict(st *dictState, data []byte, allowNone bool) error {
+	err := checkDict(st.id, data, allowNone)
+	if err == nil {
+		return nil
 	}
-	defer c.decoderPool.Put(dec)
+	if st.prev.data != nil && checkDict(st.prev.id, data, allowNone) == nil {
+		return nil
+	}
+	for _, d := range c.decodeDicts {
+		if checkDict(d.id, data, allowNone) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkDict verifies that the first frame in data was compressed with the
+// dictionary identified by want, or with none if allowNone is set.
+func checkDict(want uint32, data []byte, allowNone bool) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var h zstd.Header
+	if err := h.Decode(data); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptFrame, err)
+	}
+	if !h.Skippable && h.DictionaryID != want && !(allowNone && h.DictionaryID == 0) {
+		return &DictMismatchError{Expected: want, Actual: h.DictionaryID}
+	}
+	return nil
+}
+
+// corruptErrors are the decoder errors reporting invalid input.
+var corruptErrors = []error{
+	zstd.ErrMagicMismatch,
+	zstd.ErrReservedBlockType,
+	zstd.ErrCompressedSizeTooBig,
+	zstd.ErrBlockTooSmall,
+	zstd.ErrUnexpectedBlockSize,
+	zstd.ErrWindowSizeTooSmall,
+	zstd.ErrFrameSizeExceeded,
+	zstd.ErrFrameSizeMismatch,
+	io.ErrUnexpectedEOF,
+}
 
-	return dec.DecodeAll(data, dst)
+// decodeError wraps decoder limit violations in ErrMemoryLimit, frame
+// checksum failures in ErrChecksumMismatch, unknown dictionaries in
+// ErrNoDict and invalid input in ErrCorruptFrame, keeping the decoder's
+// error in the chain.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return fmt.Errorf("%w: %w", ErrMemoryLimit, err)
+	}
+	if errors.Is(err, zstd.ErrCRCMismatch) {
+		return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+	if errors.Is(err, zstd.ErrUnknownDictionary) {
+		return fmt.Errorf("%w: %w", ErrNoDict, err)
+	}
+	for _, target := range corruptErrors {
+		if errors.Is(err, target) {
+			return fmt.Errorf("%w: %w", ErrCorruptFrame, err)
+		}
+	}
+	return err
 }
 
-// Writer returns a streaming zstd writer that writes compressed data to w.
-func (c *Compressor) Writer(w io.Writer) (*zstd.Encoder, error) {
-	if c.dict != nil {
-		return zstd.NewWriter(w, zstd.WithEncoderDict(c.dict))
+// Writer returns a streaming writer that writes compressed data to w,
+// using an encoder from the pool at the current level. The caller must
+// Close it to end the frame and release the encoder; Reset reuses it for
+// another stream.
+func (c *Compressor) Writer(w io.Writer) (*Writer, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
 	}
-	return zstd.NewWriter(w)
+	st := c.state.Load()
+	p := st.encoderPools[c.levelOf(st)]
+	enc, err := p.Get()
+	if err != nil {
+		return nil, err
+	}
+	enc.Reset(w)
+	return &Writer{enc: enc, pool: p}, nil
 }
 
-// Reader returns a streaming zstd reader that decompresses data from r.
-func (c *Compressor) Reader(r io.Reader) (*zstd.Decoder, error) {
-	if c.dict != nil {
-		return zstd.NewReader(r, zstd.WithDecoderDicts(c.dict))
+// Reader returns a streaming reader that decompresses data from r, using a
+// decoder from the pool. The caller must Close it to release the decoder;
+// Reset reuses it for another stream.
+func (c *Compressor) Reader(r io.Reader) (*Reader, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	p := c.state.Load().decoderPool
+	zr := &Reader{pool: p, maxRatio: int64(c.maxRatio), maxSize: c.maxDecodedSize}
+	if zr.maxRatio > 0 {
+		zr.src = &countingReader{r: r}
+		r = zr.src
+	}
+	dec, err := p.Get()
+	if err != nil {
+		return nil, err
 	}
-	return zstd.NewReader(r)
+	if err := dec.Reset(r); err != nil {
+		_ = dec.Reset(nil)
+		p.Put(dec)
+		return nil, decodeError(err)
+	}
+	zr.dec = dec
+	return zr, nil
+}
+
+// SetLevel changes the encoder level used by Compress and new Writers, for
+// example to switch a running service between fast and best compression.
+// The encoder pools are rebuilt for the new level and swapped in as a
+// whole: calls in progress finish at the old level, and their encoders
+// are dropped rather than pooled. With WithAdaptiveLevel, level becomes
+// the new ceiling.
+func (c *Compressor) SetLevel(level zstd.EncoderLevel) error {
+	if level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+		return fmt.Errorf("zstddict: invalid encoder level %d", level)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed.Load() {
+		return ErrClosed
+	}
+
+	st := c.state.Load()
+	if level == st.level {
+		return nil
+	}
+	c.state.Store(c.newDictState(st.ref(), st.prev, level))
+	if c.adaptive != nil {
+		c.adaptive.level.Store(int32(level))
+	}
+	return nil
+}
+
+// SetDict replaces the dictionary, for example to rotate a long-lived
+// service to a freshly trained one without recreating the Compressor and
+// breaking the references callers hold. The pools are rebuilt for dict and
+// swapped in as a whole: calls in progress finish with the old dictionary,
+// and their encoders and decoders are dropped rather than pooled. Decoders
+// keep accepting frames made with the replaced dictionary, so messages
+// compressed just before the swap still decode, until the next SetDict.
+// dict must be a structured dictionary, even if the one it replaces was
+// loaded with WithRawDict. A nil dict removes the dictionary. dict is
+// copied.
+func (c *Compressor) SetDict(dict []byte) error {
+	if dict != nil {
+		if _, err := zstd.InspectDictionary(dict); err != nil {
+			return fmt.Errorf("zstddict: SetDict: %w", err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed.Load() {
+		return ErrClosed
+	}
+
+	st := c.state.Load()
+	if bytes.Equal(dict, st.dict) && (dict == nil) == (st.dict == nil) && !st.raw {
+		return nil
+	}
+	c.state.Store(c.newDictState(structuredDict(bytes.Clone(dict)), st.ref(), st.level))
+	return nil
 }
 
 // HasDict returns true if the compressor has a dictionary loaded.
 func (c *Compressor) HasDict() bool {
-	return c.dict != nil
+	return c.state.Load().dict != nil
 }
 
 // DictSize returns the size of the loaded dictionary in bytes.
 func (c *Compressor) DictSize() int {
-	return len(c.dict)
+	return len(c.state.Load().dict)
+}
+
+// Dict returns a copy of the loaded dictionary, or nil if there is none.
+func (c *Compressor) Dict() []byte {
+	return bytes.Clone(c.state.Load().dict)
+}
+
+// DictHash returns the SHA-256 of the loaded dictionary in hex, or "" if
+// there is none. Unlike the dictionary ID, which trainers may reuse, it
+// tells whether two processes loaded byte-identical dictionaries, so it is
+// worth logging or exchanging at startup and after SetDict.
+func (c *Compressor) DictHash() string {
+	return c.state.Load().hash
+}
+
+// Close releases the pooled encoders and decoders, whose buffers and
+// goroutines would otherwise live as long as the Compressor, and makes the
+// Compressor unusable: later calls return ErrClosed. Writers and Readers
+// still open keep working, and their encoder or decoder is released when
+// they are closed. Closing a closed Compressor is a no-op.
+func (c *Compressor) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed.Swap(true) {
+		return nil
+	}
+	st := c.state.Load()
+	for _, pools := range [][]*pool.Pool[*zstd.Encoder]{st.encoderPools[:], st.plainEncoderPools[:]} {
+		for _, p := range pools {
+			if p != nil {
+				p.Close()
+			}
+		}
+	}
+	st.decoderPool.Close()
+	return nil
 }
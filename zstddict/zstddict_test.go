@@ -2,10 +2,26 @@ package zstddict
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"runtime/pprof"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paulstuart/zstd-dict/stats"
 )
 
 func TestCompressor_RoundTrip(t *testing.T) {
@@ -100,67 +116,1331 @@ func TestCompressor_WithDict(t *testing.T) {
 			t.Errorf("DictSize() = %d, want %d", c.DictSize(), len(dict))
 		}
 	})
+
+	t.Run("Dict", func(t *testing.T) {
+		c, _ := New(WithDictBytes(dict))
+		got := c.Dict()
+		if !bytes.Equal(got, dict) {
+			t.Fatal("Dict() differs from the loaded dictionary")
+		}
+		got[0] ^= 0xff
+		if !bytes.Equal(c.Dict(), dict) {
+			t.Error("modifying the result of Dict() changed the dictionary")
+		}
+		sum := sha256.Sum256(dict)
+		if got, want := c.DictHash(), hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("DictHash() = %s, want %s", got, want)
+		}
+
+		plain, _ := New()
+		if plain.Dict() != nil || plain.DictHash() != "" {
+			t.Errorf("without a dictionary, Dict() = %v, DictHash() = %q", plain.Dict(), plain.DictHash())
+		}
+	})
+
+	t.Run("WithDictFS", func(t *testing.T) {
+		fsys := fstest.MapFS{"dicts/filelist.dict": {Data: dict}}
+		c, err := New(WithDictFS(fsys, "dicts/filelist.dict"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if c.DictSize() != len(dict) {
+			t.Errorf("DictSize() = %d, want %d", c.DictSize(), len(dict))
+		}
+		if _, err := New(WithDictFS(fsys, "missing.dict")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("New() with a missing file error = %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	t.Run("WithDictBase64", func(t *testing.T) {
+		c, err := New(WithDictBase64(base64.StdEncoding.EncodeToString(dict) + "\n"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if c.DictSize() != len(dict) {
+			t.Errorf("DictSize() = %d, want %d", c.DictSize(), len(dict))
+		}
+		if _, err := New(WithDictBase64("not base64!")); err == nil {
+			t.Error("New() accepted invalid base64")
+		}
+	})
 }
 
 func TestCompressor_StreamingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"synchronous", []Option{WithEncoderConcurrency(1), WithDecoderConcurrency(1)}},
+		{"concurrent", []Option{WithEncoderConcurrency(4), WithDecoderConcurrency(4)}},
+	}
+	testData := bytes.Repeat([]byte("streaming test data "), 1000)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			// Compress with writer
+			var compressed bytes.Buffer
+			w, err := c.Writer(&compressed)
+			if err != nil {
+				t.Fatalf("Writer() error = %v", err)
+			}
+			if _, err := w.Write(testData); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			// Decompress with reader
+			r, err := c.Reader(&compressed)
+			if err != nil {
+				t.Fatalf("Reader() error = %v", err)
+			}
+			defer r.Close()
+
+			var decompressed bytes.Buffer
+			if _, err := decompressed.ReadFrom(r); err != nil {
+				t.Fatalf("ReadFrom() error = %v", err)
+			}
+
+			if !bytes.Equal(decompressed.Bytes(), testData) {
+				t.Error("streaming round trip failed")
+			}
+		})
+	}
+}
+
+func TestCompressor_CompressTo(t *testing.T) {
 	c, err := New()
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
 
-	testData := bytes.Repeat([]byte("streaming test data "), 1000)
+	testData := []byte("test data for CompressTo")
+	dst := make([]byte, 0, 100)
 
-	// Compress with writer
-	var compressed bytes.Buffer
-	w, err := c.Writer(&compressed)
+	compressed, err := c.CompressTo(dst, testData)
 	if err != nil {
-		t.Fatalf("Writer() error = %v", err)
+		t.Fatalf("CompressTo() error = %v", err)
 	}
-	if _, err := w.Write(testData); err != nil {
-		t.Fatalf("Write() error = %v", err)
+
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
 	}
-	if err := w.Close(); err != nil {
-		t.Fatalf("Close() error = %v", err)
+
+	if !bytes.Equal(decompressed, testData) {
+		t.Error("CompressTo round trip failed")
 	}
+}
 
-	// Decompress with reader
-	r, err := c.Reader(&compressed)
+func TestCompressor_SmallMessages(t *testing.T) {
+	samples := generateSampleData(100)
+	dict, err := TrainDict(samples, nil)
 	if err != nil {
-		t.Fatalf("Reader() error = %v", err)
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	cDefault, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	cSmall, err := New(WithDictBytes(dict), WithSmallMessages())
+	if err != nil {
+		t.Fatalf("New(WithSmallMessages) error = %v", err)
+	}
+
+	testData := samples[7][:600]
+
+	compressed, err := cSmall.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
 	}
-	defer r.Close()
 
-	var decompressed bytes.Buffer
-	if _, err := decompressed.ReadFrom(r); err != nil {
-		t.Fatalf("ReadFrom() error = %v", err)
+	// Frames must remain readable by a default decoder.
+	decompressed, err := cDefault.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(decompressed, testData) {
+		t.Error("small message round trip failed")
 	}
 
-	if !bytes.Equal(decompressed.Bytes(), testData) {
-		t.Error("streaming round trip failed")
+	baseline, err := cDefault.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if len(compressed) > len(baseline) {
+		t.Errorf("small message frame = %d bytes, want <= %d", len(compressed), len(baseline))
 	}
 }
 
-func TestCompressor_CompressTo(t *testing.T) {
+func TestCompressor_WindowSize(t *testing.T) {
+	// Two copies of a random block, so the second compresses only if the
+	// window reaches back to the first.
+	block := make([]byte, 256<<10)
+	rand.NewChaCha8([32]byte{1}).Read(block)
+	data := append(bytes.Clone(block), block...)
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantWindow uint64 // 0 skips the header check
+		wantRepeat bool
+	}{
+		{"default", nil, 0, true},
+		{"small", []Option{WithWindowSize(64 << 10)}, 64 << 10, false},
+		{"small messages", []Option{WithSmallMessages(), WithWindowSize(1 << 20)}, 1 << 20, true},
+		{"long distance", []Option{WithLongDistanceMatching()}, longDistanceWindow, true},
+		{"explicit wins", []Option{WithLongDistanceMatching(), WithWindowSize(64 << 10)}, 64 << 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			compressed, err := c.Compress(data)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("Decompress() round trip failed: %v", err)
+			}
+			if repeated := len(compressed) < len(data)*3/4; repeated != tt.wantRepeat {
+				t.Errorf("Compress() = %d bytes from %d; repeat found = %v, want %v", len(compressed), len(data), repeated, tt.wantRepeat)
+			}
+
+			if tt.wantWindow == 0 {
+				return
+			}
+			var buf bytes.Buffer
+			w, err := c.Writer(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Flushing writes the header before the stream length is known,
+			// so the encoder can't shrink the window to fit.
+			w.Write(data[:100])
+			w.Flush()
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			var h zstd.Header
+			if err := h.Decode(buf.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			if !h.SingleSegment && h.WindowSize != tt.wantWindow {
+				t.Errorf("streamed frame window = %d, want %d", h.WindowSize, tt.wantWindow)
+			}
+		})
+	}
+
+	for _, n := range []int{512, 3 << 20, zstd.MaxWindowSize * 2} {
+		if _, err := New(WithWindowSize(n)); err == nil {
+			t.Errorf("New(WithWindowSize(%d)) succeeded, want error", n)
+		}
+	}
+}
+
+func TestCompressor_DecoderLimits(t *testing.T) {
 	c, err := New()
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
+	large := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 10000)
+	compressed, err := c.Compress(large)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
 
-	testData := []byte("test data for CompressTo")
-	dst := make([]byte, 0, 100)
-
-	compressed, err := c.CompressTo(dst, testData)
+	limited, err := New(WithDecoderConcurrency(1), WithDecoderMaxMemory(64*1024))
 	if err != nil {
-		t.Fatalf("CompressTo() error = %v", err)
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := limited.Decompress(compressed); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("Decompress() error = %v, want ErrMemoryLimit", err)
 	}
 
-	decompressed, err := c.Decompress(compressed)
+	small := []byte("hello world")
+	compressed, err = c.Compress(small)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	got, err := limited.Decompress(compressed)
 	if err != nil {
 		t.Fatalf("Decompress() error = %v", err)
 	}
+	if !bytes.Equal(got, small) {
+		t.Error("round trip under limits failed")
+	}
+
+	for _, opt := range []Option{WithEncoderConcurrency(0), WithDecoderConcurrency(0), WithDecoderMaxMemory(0), WithDecoderMaxWindow(1)} {
+		if _, err := New(opt); err == nil {
+			t.Error("New() with invalid limit succeeded, want error")
+		}
+	}
+}
+
+func TestCompressor_ExtraOptions(t *testing.T) {
+	c, err := New(
+		WithEncoderOptions(zstd.WithEncoderCRC(false), zstd.WithZeroFrames(true)),
+		WithDecoderOptions(zstd.IgnoreChecksum(true)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("escape hatch "), 100)
+	frame, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	var h zstd.Header
+	if err := h.Decode(frame); err != nil || h.HasCheckSum {
+		t.Errorf("frame has checksum %v, %v; want none", h.HasCheckSum, err)
+	}
+	if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+	}
+	if empty, err := c.Compress(nil); err != nil || len(empty) == 0 {
+		t.Errorf("Compress(nil) = %d bytes, %v; want a zero frame", len(empty), err)
+	}
+
+	if _, err := New(WithEncoderOptions(zstd.WithEncoderConcurrency(0))); err == nil {
+		t.Error("New() with an invalid encoder option succeeded")
+	}
+	if _, err := New(WithDecoderOptions(zstd.WithDecoderMaxMemory(0))); err == nil {
+		t.Error("New() with an invalid decoder option succeeded")
+	}
+}
+
+func TestCompressor_ProfileLabels(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), &TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if got := dictID(dict); got != 4242 {
+		t.Errorf("dictID() = %d, want 4242", got)
+	}
+
+	c, err := New(WithDictBytes(dict), WithProfileLabels("filelist"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
 
+	testData := []byte(strings.Repeat("/usr/local/bin/program ", 50))
+	compressed, err := c.CompressContext(context.Background(), testData)
+	if err != nil {
+		t.Fatalf("CompressContext() error = %v", err)
+	}
+	decompressed, err := c.DecompressContext(context.Background(), compressed)
+	if err != nil {
+		t.Fatalf("DecompressContext() error = %v", err)
+	}
 	if !bytes.Equal(decompressed, testData) {
-		t.Error("CompressTo round trip failed")
+		t.Error("round trip with profile labels failed")
+	}
+
+	// The calling goroutine's own labels survive the calls without a
+	// context.
+	pprof.Do(context.Background(), pprof.Labels("caller", "listfiles"), func(context.Context) {
+		frame, err := c.Compress(testData)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		if _, err := c.Decompress(frame); err != nil {
+			t.Fatalf("Decompress() error = %v", err)
+		}
+		var profile bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		if !strings.Contains(profile.String(), `"caller":"listfiles"`) {
+			t.Error("Compress() and Decompress() dropped the caller's profile labels")
+		}
+	})
+}
+
+func TestCompressor_PooledBuffers(t *testing.T) {
+	c, err := New(WithPooledBuffers())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	testData := bytes.Repeat([]byte("pooled buffer data "), 100)
+	for range 3 {
+		compressed, err := c.Compress(testData)
+		if err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		decompressed, err := c.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("Decompress() error = %v", err)
+		}
+		c.Free(compressed)
+
+		if !bytes.Equal(decompressed, testData) {
+			t.Error("round trip with pooled buffers failed")
+		}
+		c.Free(decompressed)
+	}
+}
+
+func TestCompressor_Observer(t *testing.T) {
+	collector := stats.NewCollector()
+	c, err := New(WithName("test"), WithObserver(collector))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	testData := bytes.Repeat([]byte("observed "), 100)
+	compressed, err := c.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := c.Decompress(compressed); err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if _, err := c.Decompress([]byte("not zstd")); err == nil {
+		t.Fatal("Decompress() of garbage succeeded, want error")
+	}
+
+	snap := collector.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("Snapshot() = %d series, want 2", len(snap))
+	}
+	comp, decomp := snap[0], snap[1]
+	if comp.Compressor != "test" || comp.Count != 1 || comp.InBytes != int64(len(testData)) || comp.OutBytes != int64(len(compressed)) {
+		t.Errorf("compress series = %+v", comp)
+	}
+	if decomp.Count != 2 || decomp.Errors != 1 || decomp.OutBytes != int64(len(testData)) {
+		t.Errorf("decompress series = %+v", decomp)
+	}
+}
+
+func TestCompressor_AdaptiveLevel(t *testing.T) {
+	c, err := New(
+		WithLevel(zstd.SpeedBetterCompression),
+		WithAdaptiveLevel(AdaptiveLevel{HighWater: 2, LowWater: 1, Interval: time.Second}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Unix(1000, 0)
+	c.adaptive.now = func() time.Time { return now }
+
+	// Simulate a saturated compressor: two calls in flight.
+	c.adaptive.inflight.Add(1)
+	if got := c.adaptive.enter(c.level); got != zstd.SpeedDefault {
+		t.Errorf("level under load = %v, want %v", got, zstd.SpeedDefault)
+	}
+	c.adaptive.exit()
+
+	// A second drop within the interval is suppressed.
+	now = now.Add(time.Millisecond)
+	if got := c.adaptive.enter(c.level); got != zstd.SpeedDefault {
+		t.Errorf("level within interval = %v, want %v", got, zstd.SpeedDefault)
+	}
+	c.adaptive.exit()
+	c.adaptive.inflight.Add(-1)
+
+	// Once load subsides the level climbs back to the ceiling.
+	now = now.Add(2 * time.Second)
+	if _, err := c.Compress([]byte("restore")); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if got := c.Level(); got != zstd.SpeedBetterCompression {
+		t.Errorf("Level() after load = %v, want %v", got, zstd.SpeedBetterCompression)
+	}
+
+	if _, err := New(WithLevel(zstd.EncoderLevel(9))); err == nil {
+		t.Error("New(WithLevel(9)) succeeded, want error")
+	}
+}
+
+func TestCompressor_LevelPolicy(t *testing.T) {
+	c, err := New(WithLevelPolicy(LevelBySize(4<<10, 1<<20)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, tt := range []struct {
+		size int
+		want zstd.EncoderLevel
+	}{
+		{100, zstd.SpeedBestCompression},
+		{64 << 10, zstd.SpeedDefault},
+		{2 << 20, zstd.SpeedFastest},
+	} {
+		data := bytes.Repeat([]byte("x"), tt.size)
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("Compress(%d bytes) error = %v", tt.size, err)
+		}
+		if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+		}
+		// The encoder used went back to the pool for its level.
+		if idle, _ := c.state.Load().encoderPools[tt.want].Stats(); idle != 1 {
+			t.Errorf("Compress(%d bytes) did not use level %v", tt.size, tt.want)
+		}
+	}
+
+	// Out of range levels are clamped.
+	c, err = New(WithLevelPolicy(func(int) zstd.EncoderLevel { return 99 }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := c.Compress([]byte("clamped")); err != nil {
+		t.Errorf("Compress() with out of range policy error = %v", err)
+	}
+}
+
+func TestCompressor_SetLevel(t *testing.T) {
+	c, err := New(WithLevel(zstd.SpeedFastest))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("/usr/local/share/doc/package-1.2.3/README.md 4096 -rw-r--r--\n"), 200)
+	fast, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	if err := c.SetLevel(zstd.SpeedBestCompression); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	if got := c.Level(); got != zstd.SpeedBestCompression {
+		t.Errorf("Level() = %v, want %v", got, zstd.SpeedBestCompression)
+	}
+	best, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if len(best) > len(fast) {
+		t.Errorf("best level produced %d bytes, fastest %d", len(best), len(fast))
+	}
+	for _, frame := range [][]byte{fast, best} {
+		if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+		}
+	}
+
+	if err := c.SetLevel(zstd.EncoderLevel(99)); err == nil {
+		t.Error("SetLevel(99) succeeded")
+	}
+
+	// Lowering the ceiling of an adaptive Compressor takes effect at once.
+	a, err := New(WithLevel(zstd.SpeedBestCompression), WithAdaptiveLevel(AdaptiveLevel{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := a.SetLevel(zstd.SpeedFastest); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	if got := a.Level(); got != zstd.SpeedFastest {
+		t.Errorf("adaptive Level() = %v, want %v", got, zstd.SpeedFastest)
+	}
+	if _, err := a.Compress(data); err != nil {
+		t.Errorf("Compress() after SetLevel error = %v", err)
+	}
+}
+
+func TestCompressor_SetLevelConcurrentWriter(t *testing.T) {
+	// Each state only has pools for its own level, so Writer must pick
+	// the level from the state it took the pools from.
+	c, err := New(WithLevel(zstd.SpeedFastest))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		levels := []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedBestCompression}
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := c.SetLevel(levels[i%2]); err != nil {
+				t.Errorf("SetLevel() error = %v", err)
+				return
+			}
+		}
+	})
+	for range 2000 {
+		w, err := c.Writer(io.Discard)
+		if err != nil {
+			t.Fatalf("Writer() error = %v", err)
+		}
+		w.Write([]byte("data"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestCompressor_SetDict(t *testing.T) {
+	samples := generateSampleData(100)
+	dictA, err := TrainDict(samples, &TrainDictOptions{ID: 1001})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	dictB, err := TrainDict(samples, &TrainDictOptions{ID: 2002})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dictA), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := samples[0]
+	oldFrame, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	if err := c.SetDict(dictB); err != nil {
+		t.Fatalf("SetDict() error = %v", err)
+	}
+	newFrame, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	var h zstd.Header
+	if err := h.Decode(newFrame); err != nil || h.DictionaryID != 2002 {
+		t.Errorf("frame after SetDict has dictionary %d, %v; want 2002", h.DictionaryID, err)
+	}
+	// Frames made with the replaced dictionary still decode.
+	for _, frame := range [][]byte{oldFrame, newFrame} {
+		if got, err := c.Decompress(frame); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+		}
+	}
+
+	// Only the one replaced dictionary is kept.
+	if err := c.SetDict(nil); err != nil {
+		t.Fatalf("SetDict(nil) error = %v", err)
+	}
+	if c.HasDict() {
+		t.Error("HasDict() after SetDict(nil) = true")
+	}
+	if _, err := c.Decompress(newFrame); err != nil {
+		t.Errorf("Decompress(dictionary 2002) error = %v", err)
+	}
+	if _, err := c.Decompress(oldFrame); !errors.Is(err, ErrDictMismatch) {
+		t.Errorf("Decompress(dictionary 1001) error = %v, want ErrDictMismatch", err)
+	}
+
+	if err := c.SetDict([]byte("not a dictionary")); err == nil {
+		t.Error("SetDict() accepted an invalid dictionary")
+	}
+}
+
+func TestCompressor_RawDict(t *testing.T) {
+	samples := generateSampleData(100)
+	content := bytes.Join(samples[:20], nil)
+	c, err := New(WithRawDict(7001, content), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	plain, _ := New()
+
+	data := samples[50]
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	var h zstd.Header
+	if err := h.Decode(compressed); err != nil || h.DictionaryID != 7001 {
+		t.Errorf("frame dictionary ID = %d, %v; want 7001", h.DictionaryID, err)
+	}
+	without, _ := plain.Compress(data)
+	if len(compressed) >= len(without) {
+		t.Errorf("raw dictionary compressed to %d bytes, no dictionary to %d", len(compressed), len(without))
+	}
+	if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Decompress() = %d bytes, %v; want original", len(got), err)
+	}
+
+	// The same content under another ID is a different dictionary.
+	other, _ := New(WithRawDict(7002, content), WithStrictDict(true))
+	if _, err := other.Decompress(compressed); !errors.Is(err, ErrDictMismatch) {
+		t.Errorf("Decompress() with other ID error = %v, want ErrDictMismatch", err)
+	}
+
+	// Frames made with a raw dictionary still decode after SetDict.
+	dict, err := TrainDict(samples, nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	if err := c.SetDict(dict); err != nil {
+		t.Fatalf("SetDict() error = %v", err)
+	}
+	if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Decompress() after SetDict = %d bytes, %v; want original", len(got), err)
+	}
+
+	if _, err := New(WithRawDict(1, nil)); err == nil {
+		t.Error("New(WithRawDict(1, nil)) succeeded, want error")
+	}
+}
+
+func TestCompressor_DecompressAny(t *testing.T) {
+	samples := generateSampleData(100)
+	var gens [3][]byte
+	var frames [3][]byte
+	for i := range gens {
+		dict, err := TrainDict(samples, &TrainDictOptions{ID: uint32(9001 + i)})
+		if err != nil {
+			t.Fatalf("TrainDict() error = %v", err)
+		}
+		gen, _ := New(WithDictBytes(dict))
+		if frames[i], err = gen.Compress(samples[i]); err != nil {
+			t.Fatalf("Compress() error = %v", err)
+		}
+		gens[i] = dict
+	}
+	plain, _ := New()
+	noDict, _ := plain.Compress(samples[3])
+
+	// The service runs generation 1 and still reads generation 0; frames
+	// from generation 2 are not known yet.
+	c, err := New(WithDictBytes(gens[1]), WithDecodeDicts(gens[0]), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i, frame := range [][]byte{frames[0], frames[1], noDict} {
+		want := samples[i]
+		if i == 2 {
+			want = samples[3]
+		}
+		if got, err := c.DecompressAny(frame); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("DecompressAny(frame %d) = %d bytes, %v; want original", i, len(got), err)
+		}
+	}
+	if got, err := c.Decompress(frames[0]); err != nil || !bytes.Equal(got, samples[0]) {
+		t.Errorf("Decompress(generation 0) = %d bytes, %v; want original", len(got), err)
+	}
+	var mismatch *DictMismatchError
+	if _, err := c.DecompressAny(frames[2]); !errors.As(err, &mismatch) || mismatch.Actual != 9003 {
+		t.Errorf("DecompressAny(generation 2) error = %v, want *DictMismatchError for 9003", err)
+	}
+
+	if _, err := New(WithDecodeDicts([]byte("not a dictionary"))); err == nil {
+		t.Error("New() with an invalid decode dictionary succeeded")
+	}
+}
+
+func TestCompressor_StrictDict(t *testing.T) {
+	samples := generateSampleData(100)
+	dictA, err := TrainDict(samples, &TrainDictOptions{ID: 1001})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	dictB, err := TrainDict(samples, &TrainDictOptions{ID: 2002})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+
+	cA, _ := New(WithDictBytes(dictA))
+	cB, _ := New(WithDictBytes(dictB), WithStrictDict(true))
+
+	testData := []byte(strings.Repeat("/usr/local/bin/program ", 50))
+	compressed, err := cA.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	_, err = cB.Decompress(compressed)
+	if !errors.Is(err, ErrDictMismatch) {
+		t.Fatalf("Decompress() error = %v, want ErrDictMismatch", err)
+	}
+	var mismatch *DictMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Expected != 2002 || mismatch.Actual != 1001 {
+		t.Errorf("Decompress() error = %#v, want expected 2002, actual 1001", err)
+	}
+
+	compressed, err = cB.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := cB.Decompress(compressed); err != nil {
+		t.Errorf("Decompress() with matching dict error = %v", err)
+	}
+}
+
+func TestCompressor_ErrorKinds(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), &TrainDictOptions{ID: 1001})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	withDict, _ := New(WithDictBytes(dict))
+	plain, _ := New()
+	strict, _ := New(WithStrictDict(true))
+
+	testData := []byte(strings.Repeat("/usr/local/bin/program ", 50))
+	frame, err := withDict.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	for name, c := range map[string]*Compressor{"plain": plain, "strict": strict} {
+		if _, err := c.Decompress(frame); !errors.Is(err, ErrNoDict) {
+			t.Errorf("%s: Decompress() of a dictionary frame error = %v, want ErrNoDict", name, err)
+		}
+	}
+
+	corrupt := bytes.Clone(frame)
+	corrupt[0] ^= 0xff
+	truncated := frame[:len(frame)/2]
+	for name, data := range map[string][]byte{"bad magic": corrupt, "truncated": truncated} {
+		if _, err := withDict.Decompress(data); !errors.Is(err, ErrCorruptFrame) {
+			t.Errorf("%s: Decompress() error = %v, want ErrCorruptFrame", name, err)
+		}
+	}
+	if _, err := strict.Decompress(corrupt); !errors.Is(err, ErrCorruptFrame) {
+		t.Errorf("strict: Decompress() error = %v, want ErrCorruptFrame", err)
+	}
+}
+
+func TestCompressor_DictThreshold(t *testing.T) {
+	samples := generateSampleData(100)
+	dict, err := TrainDict(samples, &TrainDictOptions{ID: 4242})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict), WithDictThreshold(8192), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	small := samples[0]
+	large := bytes.Repeat(samples[1], 4)
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		wantID uint32
+	}{
+		{"small", small, 4242},
+		{"large", large, 0},
+	} {
+		compressed, err := c.Compress(tt.data)
+		if err != nil {
+			t.Fatalf("%s: Compress() error = %v", tt.name, err)
+		}
+		var h zstd.Header
+		if err := h.Decode(compressed); err != nil || h.DictionaryID != tt.wantID {
+			t.Errorf("%s: frame dictionary ID = %d (%v), want %d", tt.name, h.DictionaryID, err, tt.wantID)
+		}
+		got, err := c.Decompress(compressed)
+		if err != nil || !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: round trip failed: %v", tt.name, err)
+		}
+	}
+
+	if _, err := New(WithDictThreshold(0)); err == nil {
+		t.Error("New() with zero threshold succeeded, want error")
+	}
+}
+
+func TestCompressor_AutoDict(t *testing.T) {
+	samples := generateSampleData(100)
+	dict, err := TrainDict(samples, &TrainDictOptions{ID: 4343})
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict), WithAutoDict(), WithStrictDict(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	plain, _ := New()
+	withDict, _ := New(WithDictBytes(dict))
+
+	// Random bytes gain nothing from the dictionary but pay for its ID.
+	noise := make([]byte, 200)
+	rand.NewChaCha8([32]byte{7}).Read(noise)
+	prefix := []byte("prefix")
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		wantID uint32
+	}{
+		{"similar", samples[0], 4343},
+		{"noise", noise, 0},
+	} {
+		got, err := c.CompressTo(bytes.Clone(prefix), tt.data)
+		if err != nil {
+			t.Fatalf("%s: CompressTo() error = %v", tt.name, err)
+		}
+		if !bytes.HasPrefix(got, prefix) {
+			t.Fatalf("%s: CompressTo() lost the prefix", tt.name)
+		}
+		frame := got[len(prefix):]
+		var h zstd.Header
+		if err := h.Decode(frame); err != nil || h.DictionaryID != tt.wantID {
+			t.Errorf("%s: frame dictionary ID = %d, %v; want %d", tt.name, h.DictionaryID, err, tt.wantID)
+		}
+		a, _ := plain.Compress(tt.data)
+		b, _ := withDict.Compress(tt.data)
+		if want := min(len(a), len(b)); len(frame) != want {
+			t.Errorf("%s: frame is %d bytes, want the smaller of %d and %d", tt.name, len(frame), len(a), len(b))
+		}
+		if out, err := c.Decompress(frame); err != nil || !bytes.Equal(out, tt.data) {
+			t.Errorf("%s: Decompress() = %d bytes, %v; want original", tt.name, len(out), err)
+		}
+	}
+}
+
+func TestCompressor_MaxRatio(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	bomb := bytes.Repeat([]byte{0}, 1<<20)
+	compressed, err := c.Compress(bomb)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	limited, err := New(WithMaxRatio(100))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := limited.Decompress(compressed); !errors.Is(err, ErrRatioExceeded) {
+		t.Errorf("Decompress() error = %v, want ErrRatioExceeded", err)
+	}
+
+	// Streamed frames carry no content size, so the limit must be enforced
+	// while decoding.
+	var streamed bytes.Buffer
+	w, _ := c.Writer(&streamed)
+	w.Write(bomb)
+	w.Close()
+	if _, err := limited.Decompress(streamed.Bytes()); !errors.Is(err, ErrRatioExceeded) {
+		t.Errorf("Decompress() of streamed frame error = %v, want ErrRatioExceeded", err)
+	}
+
+	r, err := limited.Reader(bytes.NewReader(streamed.Bytes()))
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, ErrRatioExceeded) {
+		t.Errorf("Reader copy error = %v, want ErrRatioExceeded", err)
+	}
+
+	// Ordinary data stays within the limit.
+	testData := bytes.Repeat([]byte("the quick brown fox "), 100)
+	compressed, _ = c.Compress(testData)
+	got, err := limited.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(got, testData) {
+		t.Error("round trip under ratio limit failed")
+	}
+}
+
+func TestCompressor_MaxDecodedSize(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	bomb := bytes.Repeat([]byte{0}, 1<<20)
+	compressed, err := c.Compress(bomb)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	var streamed bytes.Buffer
+	w, _ := c.Writer(&streamed)
+	w.Write(bomb)
+	w.Close()
+
+	limited, err := New(WithMaxDecodedSize(64 << 10))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	var sizeErr *DecodedSizeError
+	_, err = limited.Decompress(compressed)
+	if !errors.As(err, &sizeErr) || sizeErr.Declared != 1<<20 || !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decompress() error = %v, want *DecodedSizeError declaring %d bytes", err, 1<<20)
+	}
+	if _, err := limited.Decompress(streamed.Bytes()); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decompress() of streamed frame error = %v, want ErrTooLarge", err)
+	}
+	r, err := limited.Reader(bytes.NewReader(streamed.Bytes()))
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Reader copy error = %v, want ErrTooLarge", err)
+	}
+
+	small := []byte("within the limit")
+	compressed, _ = c.Compress(small)
+	if got, err := limited.Decompress(compressed); err != nil || !bytes.Equal(got, small) {
+		t.Errorf("Decompress() = %q, %v; want %q", got, err, small)
+	}
+	if _, err := New(WithMaxDecodedSize(0)); err == nil {
+		t.Error("New(WithMaxDecodedSize(0)) succeeded, want error")
+	}
+}
+
+func TestCompressor_DecompressLimit(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("the quick brown fox "), 50000)
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	got, err := c.DecompressLimit(compressed, 2<<20)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("DecompressLimit() under limit = %d bytes, %v", len(got), err)
+	}
+
+	var limitErr *MemoryLimitError
+	if _, err := c.DecompressLimit(compressed, 64*1024); !errors.As(err, &limitErr) || !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("DecompressLimit() error = %v, want *MemoryLimitError", err)
+	} else if limitErr.Limit != 64*1024 {
+		t.Errorf("MemoryLimitError.Limit = %d, want %d", limitErr.Limit, 64*1024)
+	}
+
+	// Streamed frames declare a window and no content size, so the output
+	// is counted while decoding.
+	var streamed bytes.Buffer
+	w, _ := c.Writer(&streamed)
+	w.Write(data)
+	w.Close()
+	var h zstd.Header
+	if err := h.Decode(streamed.Bytes()); err != nil || h.HasFCS {
+		t.Fatalf("streamed frame header = %+v, %v; want no content size", h, err)
+	}
+	limit := int64(h.WindowSize) + int64(len(data)) - 1
+	if _, err := c.DecompressLimit(streamed.Bytes(), limit); !errors.As(err, &limitErr) || limitErr.Window != int64(h.WindowSize) {
+		t.Errorf("DecompressLimit() of streamed frame error = %v, want *MemoryLimitError with window %d", err, h.WindowSize)
+	}
+	if got, err := c.DecompressLimit(streamed.Bytes(), limit+1); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecompressLimit() of streamed frame at limit = %d bytes, %v", len(got), err)
+	}
+
+	// A stream that fails partway leaves the pooled decoder reusable.
+	corrupt := bytes.Clone(streamed.Bytes())
+	corrupt = corrupt[:len(corrupt)/2]
+	for range 3 {
+		if _, err := c.DecompressLimit(corrupt, limit+1); err == nil {
+			t.Fatal("DecompressLimit() of truncated stream succeeded")
+		}
+		if got, err := c.DecompressLimit(streamed.Bytes(), limit+1); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("DecompressLimit() after failed stream = %d bytes, %v", len(got), err)
+		}
+	}
+
+	// The limit applies per call; the Compressor itself stays unlimited.
+	if _, err := c.Decompress(compressed); err != nil {
+		t.Errorf("Decompress() error = %v", err)
+	}
+	if _, err := c.DecompressLimit(compressed, 0); err == nil {
+		t.Error("DecompressLimit() with zero limit succeeded, want error")
+	}
+}
+
+func TestCompressor_DecompressInto(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("the quick brown fox "), 5000)
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	// A buffer with room is filled in place.
+	buf := make([]byte, 0, len(data))
+	got, err := c.DecompressInto(buf, compressed, int64(len(data)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("DecompressInto() = %d bytes, %v", len(got), err)
+	}
+	if &got[0] != &buf[:1][0] {
+		t.Error("DecompressInto() did not decode into the supplied buffer")
+	}
+	if n := testing.AllocsPerRun(10, func() { c.DecompressInto(buf, compressed, int64(len(data))) }); n > 0 && !raceEnabled {
+		t.Errorf("DecompressInto() into a large enough buffer made %v allocations", n)
+	}
+
+	// Without room, the output is sized from the header.
+	got, err = c.DecompressInto([]byte("prefix:"), compressed, int64(len(data)))
+	if err != nil || !bytes.Equal(got[7:], data) || string(got[:7]) != "prefix:" {
+		t.Fatalf("DecompressInto() with prefix = %d bytes, %v", len(got), err)
+	}
+
+	var sizeErr *DecodedSizeError
+	if _, err := c.DecompressInto(nil, compressed, int64(len(data))-1); !errors.As(err, &sizeErr) || sizeErr.Declared != int64(len(data)) {
+		t.Errorf("DecompressInto() over limit error = %v, want *DecodedSizeError declaring %d", err, len(data))
+	}
+
+	// Frames without a declared size are checked while decoding.
+	var streamed bytes.Buffer
+	w, _ := c.Writer(&streamed)
+	w.Write(data)
+	w.Close()
+	if got, err := c.DecompressInto(nil, streamed.Bytes(), int64(len(data))); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecompressInto() of streamed frame = %d bytes, %v", len(got), err)
+	}
+	if _, err := c.DecompressInto(nil, streamed.Bytes(), int64(len(data))-1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecompressInto() of streamed frame over limit error = %v, want ErrTooLarge", err)
+	}
+
+	// Concatenated frames are not trusted to the first frame's size.
+	twice := ConcatFrames(compressed, compressed)
+	if _, err := c.DecompressInto(nil, twice, int64(len(data))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecompressInto() of two frames error = %v, want ErrTooLarge", err)
+	}
+
+	if _, err := c.DecompressInto(nil, compressed, 0); err == nil {
+		t.Error("DecompressInto() with zero limit succeeded, want error")
+	}
+}
+
+func TestCompressor_DictCopiedAtNew(t *testing.T) {
+	dict, err := TrainDict(generateSampleData(100), nil)
+	if err != nil {
+		t.Fatalf("TrainDict() error = %v", err)
+	}
+	c, err := New(WithDictBytes(dict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want, _ := New(WithDictBytes(bytes.Clone(dict)))
+
+	// Scribbling over the caller's slice must not reach the Compressor.
+	clear(dict)
+
+	testData := []byte(strings.Repeat("/usr/local/bin/program ", 50))
+	compressed, err := c.Compress(testData)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	decompressed, err := want.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	if !bytes.Equal(decompressed, testData) {
+		t.Error("round trip after caller mutation failed")
+	}
+}
+
+func TestCompressor_StreamingPooled(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	data := bytes.Repeat([]byte("pooled stream "), 1000)
+	for i := range 3 {
+		var compressed bytes.Buffer
+		w, err := c.Writer(&compressed)
+		if err != nil {
+			t.Fatalf("Writer() error = %v", err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if _, err := w.Write(data); err == nil {
+			t.Error("Write() after Close succeeded")
+		}
+
+		r, err := c.Reader(&compressed)
+		if err != nil {
+			t.Fatalf("Reader() error = %v", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		r.Close()
+		r.Close()
+		if !bytes.Equal(got, data) {
+			t.Fatalf("stream %d: round trip mismatch", i)
+		}
+	}
+
+	// Every stream reused the same pooled encoder and decoder.
+	got := c.MemStats()
+	if raceEnabled {
+		return
+	}
+	if got.IdleEncoders != 1 || got.IdleDecoders != 1 || got.ActiveEncoders != 0 || got.ActiveDecoders != 0 {
+		t.Errorf("MemStats() = %+v, want one idle encoder and decoder", got)
+	}
+}
+
+func TestCompressor_StreamingCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("/srv/listing/file.txt 4096\n"), 5000)
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"unlimited", nil},
+		{"size limit", []Option{WithMaxDecodedSize(int64(len(data)))}},
+	} {
+		c, err := New(tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: New() error = %v", tt.name, err)
+		}
+		var compressed bytes.Buffer
+		w, _ := c.Writer(&compressed)
+		var _ io.ReaderFrom = w
+		if n, err := io.Copy(w, bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+			t.Fatalf("%s: io.Copy() to Writer = %d, %v", tt.name, n, err)
+		}
+		w.Close()
+
+		r, _ := c.Reader(&compressed)
+		var _ io.WriterTo = r
+		var out bytes.Buffer
+		if n, err := io.Copy(&out, r); err != nil || n != int64(len(data)) {
+			t.Fatalf("%s: io.Copy() from Reader = %d, %v", tt.name, n, err)
+		}
+		r.Close()
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%s: round trip mismatch", tt.name)
+		}
+	}
+
+	// Limits still apply when copying.
+	c, _ := New(WithMaxDecodedSize(100))
+	var compressed bytes.Buffer
+	w, _ := c.Writer(&compressed)
+	w.Write(data)
+	w.Close()
+	r, _ := c.Reader(&compressed)
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("io.Copy() over the size limit error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestCompressor_StreamingReset(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	var w *Writer
+	var r *Reader
+	for i := range 3 {
+		data := bytes.Repeat([]byte("stream "+strconv.Itoa(i)+" "), 1000)
+		var compressed bytes.Buffer
+		if w == nil {
+			w, err = c.Writer(&compressed)
+		} else {
+			err = w.Reset(&compressed)
+		}
+		if err != nil {
+			t.Fatalf("stream %d: Writer error = %v", i, err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("stream %d: Close() error = %v", i, err)
+		}
+
+		if r == nil {
+			r, err = c.Reader(&compressed)
+		} else {
+			err = r.Reset(&compressed)
+		}
+		if err != nil {
+			t.Fatalf("stream %d: Reader error = %v", i, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("stream %d: ReadAll() = %d bytes, %v; want original", i, len(got), err)
+		}
+	}
+	r.Close()
+
+	// Reset abandons an unfinished frame.
+	var compressed bytes.Buffer
+	w.Reset(io.Discard)
+	w.Write([]byte("abandoned"))
+	w.Reset(&compressed)
+	w.Write([]byte("kept"))
+	w.Close()
+	if got, err := c.Decompress(compressed.Bytes()); err != nil || string(got) != "kept" {
+		t.Errorf("Decompress() after Reset = %q, %v; want %q", got, err, "kept")
+	}
+
+	// One encoder and one decoder served every stream.
+	got := c.MemStats()
+	if raceEnabled {
+		return
+	}
+	if got.IdleEncoders != 1 || got.IdleDecoders != 1 || got.ActiveEncoders != 0 || got.ActiveDecoders != 0 {
+		t.Errorf("MemStats() = %+v, want one idle encoder and decoder", got)
+	}
+}
+
+func TestCompressor_Close(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data := bytes.Repeat([]byte("closing time "), 100)
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if _, err := c.Decompress(compressed); err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	var buf bytes.Buffer
+	w, err := c.Writer(&buf)
+	if err != nil {
+		t.Fatalf("Writer() error = %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+	if got := c.MemStats(); !raceEnabled && (got.IdleEncoders != 0 || got.IdleDecoders != 0 || got.ActiveEncoders != 1) {
+		t.Errorf("MemStats() after Close = %+v, want only the open Writer's encoder", got)
+	}
+
+	// The open Writer finishes its frame and releases its encoder.
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Errorf("Writer.Close() error = %v", err)
+	}
+	if got := c.MemStats(); !raceEnabled && (got.IdleEncoders != 0 || got.ActiveEncoders != 0) {
+		t.Errorf("MemStats() after Writer.Close = %+v, want no encoders", got)
+	}
+
+	if _, err := c.Compress(data); !errors.Is(err, ErrClosed) {
+		t.Errorf("Compress() error = %v, want ErrClosed", err)
+	}
+	if _, err := c.Decompress(compressed); !errors.Is(err, ErrClosed) {
+		t.Errorf("Decompress() error = %v, want ErrClosed", err)
+	}
+	if _, err := c.Reader(&buf); !errors.Is(err, ErrClosed) {
+		t.Errorf("Reader() error = %v, want ErrClosed", err)
+	}
+	if err := c.SetLevel(zstd.SpeedFastest); !errors.Is(err, ErrClosed) {
+		t.Errorf("SetLevel() error = %v, want ErrClosed", err)
 	}
 }
 